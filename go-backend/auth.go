@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	apiKeyHeaderName   = "X-API-Key"
+	accessTokenParam   = "access_token"
+	authRealm          = "go-backend"
+	jwtClockLeeway     = 30 * time.Second
+	authMethodAPIKey   = "api_key"
+	authMethodJWT      = "jwt"
+	maxJWKSFileBytes   = 1 << 20
+	protectedAPIPrefix = "/api/"
+)
+
+var (
+	// ErrMissingCredentials is returned when a protected request carries no credentials.
+	ErrMissingCredentials = errors.New("authentication required")
+	// ErrInvalidCredentials is returned when credentials are present but rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrExpiredCredentials is returned for a correctly signed token that
+	// has expired. It is an ErrInvalidCredentials too.
+	ErrExpiredCredentials = fmt.Errorf("%w: token has expired", ErrInvalidCredentials)
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Method  string
+	// Delegating principals (such as the Node gateway) may name the acting
+	// user with X-Actor.
+	Delegating bool
+	// Workspace, when set, is the only workspace the credentials are valid for.
+	Workspace string
+}
+
+// AuthConfig selects the credentials the service accepts. Authentication is
+// disabled when no API keys and no JWT keys are configured.
+type AuthConfig struct {
+	APIKeys       []APIKey
+	HMACSecret    []byte
+	RSAPublicKeys map[string]*rsa.PublicKey
+	Issuer        string
+	Audience      string
+}
+
+// APIKey is a static key; Name becomes the actor for requests using it.
+type APIKey struct {
+	Name       string
+	Key        string
+	Delegating bool
+}
+
+// Enabled reports whether any credential source is configured.
+func (c AuthConfig) Enabled() bool {
+	return len(c.APIKeys) > 0 || len(c.HMACSecret) > 0 || len(c.RSAPublicKeys) > 0
+}
+
+// authConfigFromEnv reads AUTH_API_KEYS ("name:key,..."), AUTH_DELEGATING_KEYS
+// (key names trusted to send X-Actor), AUTH_JWT_HS256_SECRET,
+// AUTH_JWT_JWKS_FILE, AUTH_JWT_ISSUER and AUTH_JWT_AUDIENCE.
+func authConfigFromEnv(getenv func(string) string) (AuthConfig, error) {
+	var cfg AuthConfig
+
+	keys, err := parseAPIKeys(getenv("AUTH_API_KEYS"), getenv("AUTH_DELEGATING_KEYS"))
+	if err != nil {
+		return AuthConfig{}, err
+	}
+	cfg.APIKeys = keys
+
+	if secret := getenv("AUTH_JWT_HS256_SECRET"); secret != "" {
+		cfg.HMACSecret = []byte(secret)
+	}
+	if path := strings.TrimSpace(getenv("AUTH_JWT_JWKS_FILE")); path != "" {
+		publicKeys, err := loadJWKSFile(path)
+		if err != nil {
+			return AuthConfig{}, err
+		}
+		cfg.RSAPublicKeys = publicKeys
+	}
+	cfg.Issuer = strings.TrimSpace(getenv("AUTH_JWT_ISSUER"))
+	cfg.Audience = strings.TrimSpace(getenv("AUTH_JWT_AUDIENCE"))
+
+	return cfg, nil
+}
+
+func parseAPIKeys(value, delegating string) ([]APIKey, error) {
+	delegatingNames := make(map[string]bool)
+	for _, name := range strings.Split(delegating, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			delegatingNames[name] = true
+		}
+	}
+
+	var keys []APIKey
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, ":")
+		name, key = strings.TrimSpace(name), strings.TrimSpace(key)
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("invalid AUTH_API_KEYS entry %q (want name:key)", entry)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate API key name %q", name)
+		}
+		seen[name] = true
+		keys = append(keys, APIKey{Name: name, Key: key, Delegating: delegatingNames[name]})
+	}
+
+	for name := range delegatingNames {
+		if !seen[name] {
+			return nil, fmt.Errorf("AUTH_DELEGATING_KEYS names unknown API key %q", name)
+		}
+	}
+	return keys, nil
+}
+
+type jsonWebKeySet struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		Alg string `json:"alg"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// loadJWKSFile reads the RSA signing keys of a JWKS document, indexed by kid.
+func loadJWKSFile(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS file: %w", err)
+	}
+	if len(data) > maxJWKSFileBytes {
+		return nil, fmt.Errorf("JWKS file %s is larger than %d bytes", path, maxJWKSFileBytes)
+	}
+	return parseJWKS(data)
+}
+
+func parseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set jsonWebKeySet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || (jwk.Use != "" && jwk.Use != "sig") || (jwk.Alg != "" && jwk.Alg != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("decode modulus of key %q: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("decode exponent of key %q: %w", jwk.Kid, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("key %q has an unsupported exponent", jwk.Kid)
+		}
+		if _, dup := keys[jwk.Kid]; dup {
+			return nil, fmt.Errorf("duplicate JWKS key id %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no RSA signing keys")
+	}
+	return keys, nil
+}
+
+// authenticator validates API keys and JWT bearer tokens.
+type authenticator struct {
+	apiKeys    []APIKey
+	keyHashes  [][sha256.Size]byte
+	hmacSecret []byte
+	rsaKeys    map[string]*rsa.PublicKey
+	parser     *jwt.Parser
+}
+
+func newAuthenticator(cfg AuthConfig) *authenticator {
+	a := &authenticator{
+		apiKeys:    cfg.APIKeys,
+		hmacSecret: cfg.HMACSecret,
+		rsaKeys:    cfg.RSAPublicKeys,
+	}
+	for _, key := range cfg.APIKeys {
+		a.keyHashes = append(a.keyHashes, sha256.Sum256([]byte(key.Key)))
+	}
+
+	var methods []string
+	if len(cfg.HMACSecret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if len(cfg.RSAPublicKeys) > 0 {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithLeeway(jwtClockLeeway),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	a.parser = jwt.NewParser(options...)
+
+	return a
+}
+
+// authenticate resolves the principal for r from X-API-Key, an
+// "Authorization: Bearer" API key or JWT, or (for browser streams that cannot
+// set headers) the access_token query parameter.
+func (a *authenticator) authenticate(r *http.Request) (Principal, error) {
+	credential := strings.TrimSpace(r.Header.Get(apiKeyHeaderName))
+	if credential == "" {
+		if scheme, value, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+			credential = strings.TrimSpace(value)
+		}
+	}
+	if credential == "" && isStreamPath(r.URL.Path) {
+		credential = strings.TrimSpace(r.URL.Query().Get(accessTokenParam))
+	}
+	if credential == "" {
+		return Principal{}, ErrMissingCredentials
+	}
+
+	if strings.Count(credential, ".") == 2 && (len(a.hmacSecret) > 0 || len(a.rsaKeys) > 0) {
+		return a.authenticateJWT(credential)
+	}
+	return a.authenticateAPIKey(credential)
+}
+
+func (a *authenticator) authenticateAPIKey(credential string) (Principal, error) {
+	hash := sha256.Sum256([]byte(credential))
+
+	// Compare against every key so timing does not reveal which one matched.
+	match := -1
+	for i := range a.keyHashes {
+		if subtle.ConstantTimeCompare(hash[:], a.keyHashes[i][:]) == 1 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+
+	key := a.apiKeys[match]
+	return Principal{Subject: key.Name, Method: authMethodAPIKey, Delegating: key.Delegating}, nil
+}
+
+func (a *authenticator) authenticateJWT(credential string) (Principal, error) {
+	token, err := a.parser.Parse(credential, a.signingKey)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return Principal{}, fmt.Errorf("%w: %v", ErrExpiredCredentials, err)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+
+	subject, err := token.Claims.GetSubject()
+	if err != nil || strings.TrimSpace(subject) == "" {
+		return Principal{}, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	principal := Principal{Subject: normalizeActor(subject), Method: authMethodJWT}
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if workspaceID, present := claims[workspaceClaim]; present {
+			id, isString := workspaceID.(string)
+			if !isString || !isValidWorkspaceID(id) {
+				return Principal{}, fmt.Errorf("%w: invalid %s claim", ErrInvalidCredentials, workspaceClaim)
+			}
+			principal.Workspace = id
+		}
+	}
+	return principal, nil
+}
+
+func (a *authenticator) signingKey(token *jwt.Token) (any, error) {
+	switch token.Method.Alg() {
+	case jwt.SigningMethodHS256.Alg():
+		return a.hmacSecret, nil
+	case jwt.SigningMethodRS256.Alg():
+		kid, _ := token.Header["kid"].(string)
+		if key, ok := a.rsaKeys[kid]; ok {
+			return key, nil
+		}
+		if kid == "" && len(a.rsaKeys) == 1 {
+			for _, key := range a.rsaKeys {
+				return key, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+func isStreamPath(path string) bool {
+	return path == "/api/events" || path == "/api/ws"
+}
+
+type principalContextKey struct{}
+
+func withPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+func principalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(Principal)
+	return principal, ok
+}
+
+// authMiddleware requires valid credentials on /api/* when authentication is
+// configured. Probes and /metrics stay open for orchestrators and scrapers.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := s.settings.Load().auth
+		if auth == nil || !strings.HasPrefix(r.URL.Path, protectedAPIPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !s.authAttemptAllowed(w, r) {
+			return
+		}
+		principal, err := auth.authenticate(r)
+		if err != nil {
+			// Expired tokens were issued to the caller, so only other
+			// rejected credentials count as guesses.
+			guess := errors.Is(err, ErrInvalidCredentials) && !errors.Is(err, ErrExpiredCredentials)
+			if guess && !s.recordAuthFailure(w, r) {
+				return
+			}
+			s.writeUnauthorized(w, r, err)
+			return
+		}
+
+		ctx := withPrincipal(r.Context(), principal)
+		r = r.WithContext(ctx)
+		setRequestActor(ctx, extractActor(r))
+		trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(principal.Subject))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeUnauthorized answers 401 with an RFC 6750 WWW-Authenticate challenge.
+func (s *Server) writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	challenge := fmt.Sprintf(`Bearer realm=%q`, authRealm)
+	message := ErrMissingCredentials.Error()
+	if errors.Is(err, ErrInvalidCredentials) {
+		challenge += `, error="invalid_token", error_description="the access token is invalid or expired"`
+		message = "invalid or expired credentials"
+		s.logger.InfoContext(r.Context(), "authentication failed", "error", err)
+	}
+
+	w.Header().Set("WWW-Authenticate", challenge)
+	s.writeError(w, http.StatusUnauthorized, message)
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testJWTSecret = "test-secret-with-enough-entropy"
+
+func newAuthTestServer(t *testing.T, cfg AuthConfig) *Server {
+	t.Helper()
+
+	s := newTestServer(t)
+	s.EnableAuth(cfg)
+	return s
+}
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testJWTSecret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func validClaims(subject string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": subject,
+		"iss": "https://issuer.example",
+		"aud": "go-backend",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestAuthDisabledByDefault(t *testing.T) {
+	s := newTestServer(t)
+	s.EnableAuth(AuthConfig{})
+
+	res := performRequest(s.Handler(), http.MethodGet, "/api/users", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d without auth configured, got %d", http.StatusOK, res.Code)
+	}
+}
+
+func TestAuthRejectsMissingCredentials(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{APIKeys: []APIKey{{Name: "ci", Key: "secret-key"}}})
+
+	res := performRequest(s.Handler(), http.MethodGet, "/api/users", "")
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, res.Code)
+	}
+	if got := res.Header().Get("WWW-Authenticate"); got != `Bearer realm="go-backend"` {
+		t.Fatalf("unexpected WWW-Authenticate header: %q", got)
+	}
+
+	body := decodeProblem(t, res)
+	if body.Detail != "authentication required" || body.Instance == "" {
+		t.Fatalf("unexpected error body: %v", body)
+	}
+}
+
+func TestAuthLeavesProbesAndPreflightOpen(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{APIKeys: []APIKey{{Name: "ci", Key: "secret-key"}}})
+
+	for _, path := range []string{"/health", "/livez", "/readyz", "/metrics"} {
+		if res := performRequest(s.Handler(), http.MethodGet, path, ""); res.Code != http.StatusOK {
+			t.Fatalf("expected %s to stay open, got %d", path, res.Code)
+		}
+	}
+	if res := performRequest(s.Handler(), http.MethodOptions, "/api/users", ""); res.Code != http.StatusNoContent {
+		t.Fatalf("expected preflight to bypass auth, got %d", res.Code)
+	}
+}
+
+func TestAuthAPIKeySetsActor(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{APIKeys: []APIKey{
+		{Name: "ci", Key: "ci-key"},
+		{Name: "gateway", Key: "gateway-key", Delegating: true},
+	}})
+
+	testCases := []struct {
+		name      string
+		headers   map[string]string
+		wantActor string
+	}{
+		{name: "X-API-Key header", headers: map[string]string{"X-API-Key": "ci-key"}, wantActor: "ci"},
+		{name: "bearer API key ignores spoofed actor", headers: map[string]string{"Authorization": "Bearer ci-key", "X-Actor": "mallory"}, wantActor: "ci"},
+		{name: "delegating key honors X-Actor", headers: map[string]string{"X-API-Key": "gateway-key", "X-Actor": "alice"}, wantActor: "alice"},
+		{name: "delegating key without X-Actor", headers: map[string]string{"X-API-Key": "gateway-key"}, wantActor: "gateway"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequestWithHeaders(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"title":"`+tc.name+`"}`, tc.headers)
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+			}
+
+			var task Task
+			decodeJSONResponse(t, res.Body.Bytes(), &task)
+			if task.LastChange == nil || task.LastChange.ChangedBy != tc.wantActor {
+				t.Fatalf("expected change by %q, got %+v", tc.wantActor, task.LastChange)
+			}
+		})
+	}
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", map[string]string{"X-API-Key": "wrong"})
+	if res.Code != http.StatusUnauthorized || !strings.Contains(res.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Fatalf("expected invalid_token challenge, got %d %q", res.Code, res.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestAuthHS256JWT(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{
+		HMACSecret: []byte(testJWTSecret),
+		Issuer:     "https://issuer.example",
+		Audience:   "go-backend",
+	})
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/tasks", `{"title":"From JWT","status":"pending","userId":1}`, map[string]string{
+		"Authorization": "Bearer " + signHS256(t, validClaims("alice")),
+		"X-Actor":       "mallory",
+	})
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var task Task
+	decodeJSONResponse(t, res.Body.Bytes(), &task)
+	if task.LastChange == nil || task.LastChange.ChangedBy != "alice" {
+		t.Fatalf("expected actor from token subject, got %+v", task.LastChange)
+	}
+
+	claimsWith := func(key string, value any) jwt.MapClaims {
+		claims := validClaims("alice")
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	otherKey, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims("alice")).SignedString([]byte("another-secret"))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims("alice")).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to build unsigned token: %v", err)
+	}
+
+	rejected := map[string]string{
+		"expired":        signHS256(t, claimsWith("exp", time.Now().Add(-time.Hour).Unix())),
+		"missing exp":    signHS256(t, claimsWith("exp", nil)),
+		"wrong issuer":   signHS256(t, claimsWith("iss", "https://evil.example")),
+		"wrong audience": signHS256(t, claimsWith("aud", "other-service")),
+		"missing sub":    signHS256(t, claimsWith("sub", nil)),
+		"wrong secret":   otherKey,
+		"alg none":       unsigned,
+	}
+	for name, token := range rejected {
+		t.Run(name, func(t *testing.T) {
+			res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", map[string]string{"Authorization": "Bearer " + token})
+			if res.Code != http.StatusUnauthorized {
+				t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, res.Code)
+			}
+			if !strings.Contains(res.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+				t.Fatalf("expected invalid_token challenge, got %q", res.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthRS256JWTWithJWKSFile(t *testing.T) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	jwks := map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "key-1",
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(privateKey.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(privateKey.E)).Bytes()),
+	}}}
+	data, _ := json.Marshal(jwks)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("failed to write JWKS: %v", err)
+	}
+
+	cfg, err := authConfigFromEnv(func(key string) string {
+		return map[string]string{"AUTH_JWT_JWKS_FILE": path, "AUTH_JWT_AUDIENCE": "go-backend"}[key]
+	})
+	if err != nil {
+		t.Fatalf("expected JWKS config to load, got %v", err)
+	}
+	s := newAuthTestServer(t, cfg)
+
+	sign := func(kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, validClaims("bob"))
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(privateKey)
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", map[string]string{"Authorization": "Bearer " + sign("key-1")})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+
+	res = performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", map[string]string{"Authorization": "Bearer " + sign("unknown")})
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected unknown kid to be rejected, got %d", res.Code)
+	}
+
+	// An HS256 token must not be accepted when only RS256 keys are configured.
+	res = performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", map[string]string{"Authorization": "Bearer " + signHS256(t, validClaims("bob"))})
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected HS256 token to be rejected, got %d", res.Code)
+	}
+}
+
+func TestAuthAccessTokenQueryOnlyForStreams(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{APIKeys: []APIKey{{Name: "ci", Key: "ci-key"}}})
+
+	if res := performRequest(s.Handler(), http.MethodGet, "/api/users?access_token=ci-key", ""); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected query token to be ignored on REST routes, got %d", res.Code)
+	}
+
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	res, err := http.Get(ts.URL + "/api/ws?access_token=ci-key")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+	// Authenticated, but not a WebSocket handshake.
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected query token to authenticate stream route, got %d", res.StatusCode)
+	}
+}
+
+func TestAuthConfigFromEnvValidation(t *testing.T) {
+	testCases := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{name: "malformed key", env: map[string]string{"AUTH_API_KEYS": "no-separator"}, want: "want name:key"},
+		{name: "duplicate name", env: map[string]string{"AUTH_API_KEYS": "a:1,a:2"}, want: "duplicate"},
+		{name: "unknown delegating key", env: map[string]string{"AUTH_API_KEYS": "a:1", "AUTH_DELEGATING_KEYS": "b"}, want: "unknown API key"},
+		{name: "missing JWKS file", env: map[string]string{"AUTH_JWT_JWKS_FILE": "/does/not/exist.json"}, want: "read JWKS file"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := authConfigFromEnv(func(key string) string { return tc.env[key] })
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	cfg, err := authConfigFromEnv(func(key string) string {
+		return map[string]string{"AUTH_API_KEYS": "gateway:k1, ci:k2", "AUTH_DELEGATING_KEYS": "gateway"}[key]
+	})
+	if err != nil || len(cfg.APIKeys) != 2 || !cfg.APIKeys[0].Delegating || cfg.APIKeys[1].Delegating {
+		t.Fatalf("unexpected parsed config %+v err=%v", cfg, err)
+	}
+}
+
+func TestParseJWKSRejectsEmptySet(t *testing.T) {
+	if _, err := parseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"x"}]}`)); err == nil {
+		t.Fatal("expected JWKS without RSA keys to be rejected")
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Permissions checked by handlers before calling the Store.
+const (
+	permUsersRead            = "users:read"
+	permUsersCreate          = "users:create"
+	permTasksRead            = "tasks:read"
+	permTasksCreate          = "tasks:create"
+	permTasksUpdate          = "tasks:update"
+	permTasksUpdateOwnStatus = "tasks:update-own-status"
+	permTasksAssign          = "tasks:assign"
+	permStatsRead            = "stats:read"
+
+	// permAll in a role grants every permission.
+	permAll = "*"
+
+	maxPolicyFileBytes = 1 << 20
+)
+
+var allPermissions = []string{
+	permUsersRead,
+	permUsersCreate,
+	permTasksRead,
+	permTasksCreate,
+	permTasksUpdate,
+	permTasksUpdateOwnStatus,
+	permTasksAssign,
+	permStatsRead,
+}
+
+// Policy maps roles to permissions. A caller's role comes from Subjects when
+// the actor is listed there (service accounts), otherwise from the Role of the
+// user whose email or name matches the actor, otherwise DefaultRole.
+type Policy struct {
+	Roles       map[string][]string `json:"roles"`
+	Subjects    map[string]string   `json:"subjects,omitempty"`
+	DefaultRole string              `json:"defaultRole,omitempty"`
+}
+
+// DefaultPolicy lets managers do everything and other roles read, create
+// their own tasks and move their own tasks through the workflow.
+func DefaultPolicy() Policy {
+	contributor := []string{permUsersRead, permTasksRead, permTasksCreate, permTasksUpdateOwnStatus, permStatsRead}
+	return Policy{
+		Roles: map[string][]string{
+			"manager":   {permAll},
+			"developer": contributor,
+			"designer":  contributor,
+		},
+	}
+}
+
+// loadPolicyFile reads a JSON policy file, or returns DefaultPolicy when path is empty.
+func loadPolicyFile(path string) (Policy, error) {
+	if strings.TrimSpace(path) == "" {
+		return DefaultPolicy(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Policy{}, fmt.Errorf("read policy file: %w", err)
+	}
+	if len(data) > maxPolicyFileBytes {
+		return Policy{}, fmt.Errorf("policy file %s is larger than %d bytes", path, maxPolicyFileBytes)
+	}
+	return parsePolicy(data)
+}
+
+func parsePolicy(data []byte) (Policy, error) {
+	var policy Policy
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		return Policy{}, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := policy.validate(); err != nil {
+		return Policy{}, err
+	}
+	return policy, nil
+}
+
+func (p Policy) validate() error {
+	if len(p.Roles) == 0 {
+		return errors.New("policy defines no roles")
+	}
+
+	known := make(map[string]bool, len(allPermissions)+1)
+	known[permAll] = true
+	for _, permission := range allPermissions {
+		known[permission] = true
+	}
+
+	for _, role := range sortedKeys(p.Roles) {
+		for _, permission := range p.Roles[role] {
+			if !known[permission] {
+				return fmt.Errorf("role %q: unknown permission %q", role, permission)
+			}
+		}
+	}
+	for _, subject := range sortedKeys(p.Subjects) {
+		if _, ok := p.Roles[p.Subjects[subject]]; !ok {
+			return fmt.Errorf("subject %q: unknown role %q", subject, p.Subjects[subject])
+		}
+	}
+	if p.DefaultRole != "" {
+		if _, ok := p.Roles[p.DefaultRole]; !ok {
+			return fmt.Errorf("defaultRole: unknown role %q", p.DefaultRole)
+		}
+	}
+	return nil
+}
+
+// permissionsFor expands role into its permission set.
+func (p Policy) permissionsFor(role string) map[string]bool {
+	granted := make(map[string]bool)
+	for _, permission := range p.Roles[role] {
+		if permission == permAll {
+			for _, each := range allPermissions {
+				granted[each] = true
+			}
+			continue
+		}
+		granted[permission] = true
+	}
+	return granted
+}
+
+// EnableAuthorization enforces policy on /api/*. Without it every caller has
+// every permission.
+func (s *Server) EnableAuthorization(policy Policy) {
+	s.updateSettings(func(settings *serverSettings) { settings.policy = &policy })
+}
+
+// caller is the acting identity of a request with its resolved permissions.
+type caller struct {
+	actor       string
+	role        string
+	userID      int
+	permissions map[string]bool
+}
+
+func (c caller) can(permission string) bool {
+	return c.permissions[permission]
+}
+
+// resolveCaller looks up the role of actor. Users are matched by email
+// (case-insensitive), which must belong to exactly one user; names are not
+// unique, so they never grant a user's role.
+func (s *Server) resolveCaller(ctx context.Context, actor string) (caller, error) {
+	c := caller{actor: actor}
+	policy := s.settings.Load().policy
+	if policy == nil {
+		c.permissions = make(map[string]bool, len(allPermissions))
+		for _, permission := range allPermissions {
+			c.permissions[permission] = true
+		}
+		return c, nil
+	}
+
+	if role, ok := policy.Subjects[actor]; ok {
+		c.role = role
+	} else {
+		user, found, err := s.dataStore.GetUserByEmail(ctx, actor)
+		if err != nil {
+			return caller{}, fmt.Errorf("resolve caller %q: %w", actor, err)
+		}
+		c.role = policy.DefaultRole
+		if found {
+			c.role = user.Role
+			c.userID = user.ID
+		}
+	}
+
+	c.permissions = policy.permissionsFor(c.role)
+	return c, nil
+}
+
+// authorize resolves the request's caller and checks each permission. On
+// failure it writes the error response and reports false.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, permissions ...string) (caller, bool) {
+	c, err := s.resolveCaller(r.Context(), extractActor(r))
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "error resolving caller permissions", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return caller{}, false
+	}
+	for _, permission := range permissions {
+		if !c.can(permission) {
+			s.writeForbidden(w, r, c, permission)
+			return caller{}, false
+		}
+	}
+	return c, true
+}
+
+func (s *Server) writeForbidden(w http.ResponseWriter, r *http.Request, c caller, permission string) {
+	s.logger.InfoContext(r.Context(), "permission denied", "role", c.role, "permission", permission)
+	s.writeError(w, http.StatusForbidden, "missing permission: "+permission)
+}
+
+// missingTaskUpdatePermission returns the permission c lacks to apply update
+// to task, or "" when the update is allowed. Reassignment needs tasks:assign;
+// other changes need tasks:update, except that an assignee may change the
+// status of their own task with tasks:update-own-status. Fields set to their
+// current value need nothing, so a full replacement may repeat them.
+func (c caller) missingTaskUpdatePermission(task Task, update TaskUpdate) string {
+	if update.UserID != nil && *update.UserID != task.UserID && !c.can(permTasksAssign) {
+		return permTasksAssign
+	}
+	if update.Title != nil && *update.Title != task.Title && !c.can(permTasksUpdate) {
+		return permTasksUpdate
+	}
+	if update.Status != nil && *update.Status != task.Status && !c.can(permTasksUpdate) {
+		if c.userID == 0 || c.userID != task.UserID {
+			return permTasksUpdate
+		}
+		if !c.can(permTasksUpdateOwnStatus) {
+			return permTasksUpdateOwnStatus
+		}
+	}
+	return ""
+}
+
+// checkTaskUpdate loads the task and returns the permission c lacks to apply
+// update, or "". It returns ErrTaskNotFound when the task does not exist.
+func (s *Server) checkTaskUpdate(ctx context.Context, c caller, taskID int, update TaskUpdate) (string, error) {
+	if s.settings.Load().policy == nil {
+		return "", nil
+	}
+
+	task, found, err := s.dataStore.GetTaskByID(ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", fmt.Errorf("%w: %d", ErrTaskNotFound, taskID)
+	}
+	return c.missingTaskUpdatePermission(task, update), nil
+}
+
+// PermissionsResponse describes what the current caller may do.
+type PermissionsResponse struct {
+	Actor       string   `json:"actor"`
+	Role        string   `json:"role,omitempty"`
+	UserID      int      `json:"userId,omitempty"`
+	Permissions []string `json:"permissions"`
+	Enforced    bool     `json:"enforced"`
+}
+
+func (s *Server) handleMyPermissions(w http.ResponseWriter, r *http.Request) {
+	c, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	permissions := make([]string, 0, len(c.permissions))
+	for permission := range c.permissions {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+
+	s.writeJSON(w, http.StatusOK, PermissionsResponse{
+		Actor:       c.actor,
+		Role:        c.role,
+		UserID:      c.userID,
+		Permissions: permissions,
+		Enforced:    s.settings.Load().policy != nil,
+	})
+}
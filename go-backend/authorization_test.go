@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func newPolicyTestServer(t *testing.T, policy Policy) *Server {
+	t.Helper()
+
+	s := newTestServer(t)
+	s.EnableAuthorization(policy)
+	return s
+}
+
+func asActor(actor string) map[string]string {
+	return map[string]string{actorHeaderName: actor}
+}
+
+func assertForbidden(t *testing.T, res *httptest.ResponseRecorder, permission string) {
+	t.Helper()
+
+	if res.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusForbidden, res.Code, res.Body.String())
+	}
+	if body := decodeProblem(t, res); body.Detail != "missing permission: "+permission {
+		t.Fatalf("expected missing permission %q, got %v", permission, body)
+	}
+}
+
+func TestAuthorizationDefaultPolicy(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+	h := s.Handler()
+
+	const (
+		developer = "john@example.com"
+		designer  = "jane@example.com"
+		manager   = "bob@example.com"
+	)
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		actor      string
+		wantStatus int
+		wantDenied string
+	}{
+		{name: "developer reads tasks", method: http.MethodGet, path: "/api/tasks", actor: developer, wantStatus: http.StatusOK},
+		{name: "developer cannot create users", method: http.MethodPost, path: "/api/users", body: `{"name":"A","email":"a@example.com","role":"developer"}`, actor: developer, wantDenied: permUsersCreate},
+		{name: "manager creates users", method: http.MethodPost, path: "/api/users", body: `{"name":"A","email":"a@example.com","role":"developer"}`, actor: manager, wantStatus: http.StatusCreated},
+		{name: "developer creates own task", method: http.MethodPost, path: "/api/tasks", body: `{"title":"Mine","status":"pending","userId":1}`, actor: developer, wantStatus: http.StatusCreated},
+		{name: "developer cannot create task for others", method: http.MethodPost, path: "/api/tasks", body: `{"title":"Yours","status":"pending","userId":2}`, actor: developer, wantDenied: permTasksAssign},
+		{name: "assignee changes own status", method: http.MethodPatch, path: "/api/tasks/1", body: `{"status":"in-progress"}`, actor: developer, wantStatus: http.StatusOK},
+		{name: "assignee cannot rename own task", method: http.MethodPatch, path: "/api/tasks/1", body: `{"title":"Renamed"}`, actor: developer, wantDenied: permTasksUpdate},
+		{name: "designer cannot change others' status", method: http.MethodPatch, path: "/api/tasks/1", body: `{"status":"completed"}`, actor: designer, wantDenied: permTasksUpdate},
+		{name: "developer cannot reassign", method: http.MethodPatch, path: "/api/tasks/1", body: `{"userId":2}`, actor: developer, wantDenied: permTasksAssign},
+		{name: "unchanged assignee is not a reassignment", method: http.MethodPatch, path: "/api/tasks/1", body: `{"userId":1,"status":"completed"}`, actor: developer, wantStatus: http.StatusOK},
+		{name: "manager reassigns", method: http.MethodPatch, path: "/api/tasks/1", body: `{"userId":2}`, actor: manager, wantStatus: http.StatusOK},
+		{name: "unknown actor has no permissions", method: http.MethodGet, path: "/api/stats", actor: "stranger", wantDenied: permStatsRead},
+		{name: "missing task is 404 before permissions", method: http.MethodPatch, path: "/api/tasks/999", body: `{"status":"completed"}`, actor: developer, wantStatus: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequestWithHeaders(h, tc.method, tc.path, tc.body, asActor(tc.actor))
+			if tc.wantDenied != "" {
+				assertForbidden(t, res, tc.wantDenied)
+				return
+			}
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d body=%s", tc.wantStatus, res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthorizationMatchesUsersByEmailOnly(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+	ctx := context.Background()
+	if _, err := s.dataStore.CreateUser(ctx, "Alex", "alex.m@example.com", "manager"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.dataStore.CreateUser(ctx, "Alex", "alex.d@example.com", "developer"); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"name":"A","email":"a@example.com","role":"developer"}`
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/users", body, asActor("Alex"))
+	assertForbidden(t, res, permUsersCreate)
+
+	res = performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/users", body, asActor("ALEX.D@example.com"))
+	assertForbidden(t, res, permUsersCreate)
+
+	res = performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/users", body, asActor("alex.m@example.com"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected the manager's email to grant %s, got %d body=%s", permUsersCreate, res.Code, res.Body.String())
+	}
+
+	// An email shared by several users is ambiguous and grants no role.
+	if _, err := s.dataStore.CreateUser(ctx, "Mallory", "Alex.M@example.com", "developer"); err != nil {
+		t.Fatal(err)
+	}
+	res = performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/stats", "", asActor("alex.m@example.com"))
+	assertForbidden(t, res, permStatsRead)
+}
+
+func TestAuthorizationDisabledAllowsEverything(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"userId":2}`, asActor("stranger"))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d without a policy, got %d", http.StatusOK, res.Code)
+	}
+}
+
+func TestAuthorizationSubjectsAndAuthenticatedActor(t *testing.T) {
+	s := newTestServer(t)
+	s.EnableAuth(AuthConfig{APIKeys: []APIKey{{Name: "reporting", Key: "reporting-key"}}})
+	policy := DefaultPolicy()
+	policy.Roles["reader"] = []string{permStatsRead, permTasksRead}
+	policy.Subjects = map[string]string{"reporting": "reader"}
+	s.EnableAuthorization(policy)
+
+	// X-Actor is ignored for non-delegating keys, so spoofing a manager fails.
+	headers := map[string]string{"X-API-Key": "reporting-key", actorHeaderName: "bob@example.com"}
+	if res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/stats", "", headers); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", headers)
+	assertForbidden(t, res, permUsersRead)
+}
+
+func TestMyPermissions(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/me/permissions", "", asActor("john@example.com"))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	var body PermissionsResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &body)
+
+	want := []string{permStatsRead, permTasksCreate, permTasksRead, permTasksUpdateOwnStatus, permUsersRead}
+	if body.Role != "developer" || body.UserID != 1 || !body.Enforced || !reflect.DeepEqual(body.Permissions, want) {
+		t.Fatalf("unexpected permissions response: %+v", body)
+	}
+
+	res = performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/me/permissions", "", asActor("stranger"))
+	var stranger PermissionsResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &stranger)
+	if res.Code != http.StatusOK || len(stranger.Permissions) != 0 || stranger.Role != "" {
+		t.Fatalf("expected empty permissions for unknown actor, got %d %+v", res.Code, stranger)
+	}
+}
+
+func TestWebSocketUpdateEnforcesPolicy(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	conn := dialWebSocket(t, ts.URL, "?actor=jane@example.com")
+	sendWS(t, conn, map[string]any{"type": "update", "id": "1", "taskId": 1, "changes": map[string]any{"status": "completed"}})
+
+	msg := readWSType(t, conn, wsTypeError)
+	if msg.Error != "missing permission: "+permTasksUpdate {
+		t.Fatalf("unexpected error message: %+v", msg)
+	}
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/ws?actor=stranger"
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || res == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected handshake without tasks:read to be forbidden, got %v", err)
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	policy, err := loadPolicyFile("")
+	if err != nil || !reflect.DeepEqual(policy, DefaultPolicy()) {
+		t.Fatalf("expected default policy for empty path, got %+v err=%v", policy, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"roles":{"admin":["*"],"guest":["tasks:read"]},"subjects":{"gateway":"admin"},"defaultRole":"guest"}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write policy: %v", err)
+	}
+	policy, err = loadPolicyFile(path)
+	if err != nil {
+		t.Fatalf("expected policy to load, got %v", err)
+	}
+	if got := policy.permissionsFor("admin"); len(got) != len(allPermissions) {
+		t.Fatalf("expected * to grant every permission, got %v", got)
+	}
+
+	invalid := map[string]string{
+		"no roles":             `{"roles":{}}`,
+		"unknown permission":   `{"roles":{"a":["tasks:delete"]}}`,
+		"unknown subject role": `{"roles":{"a":["*"]},"subjects":{"x":"b"}}`,
+		"unknown default role": `{"roles":{"a":["*"]},"defaultRole":"b"}`,
+		"unknown field":        `{"roles":{"a":["*"]},"extra":true}`,
+	}
+	for name, data := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parsePolicy([]byte(data)); err == nil {
+				t.Fatal("expected policy to be rejected")
+			}
+		})
+	}
+
+	if _, err := loadPolicyFile(filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "read policy file") {
+		t.Fatalf("expected read error, got %v", err)
+	}
+}
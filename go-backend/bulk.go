@@ -0,0 +1,439 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// ErrBatchAborted is the result of writes in an atomic batch that were rolled
+// back or never attempted because another write failed.
+var ErrBatchAborted = errors.New("not applied: another operation in the batch failed")
+
+// maxBulkItems is the default Limits.MaxBulkItems, which caps the writes one
+// bulk request may expand to.
+const maxBulkItems = 500
+
+// TaskBatch is a list of task writes applied together. History entries
+// written by the batch carry its ID.
+type TaskBatch struct {
+	ID string
+	// Atomic batches apply every write or none.
+	Atomic bool
+	Actor  string
+	Writes []TaskWrite
+}
+
+// TaskWrite is one write in a TaskBatch: a create when Create is set,
+// otherwise Update applied to TaskID.
+type TaskWrite struct {
+	Create *TaskCreate
+	TaskID int
+	Update TaskUpdate
+}
+
+// TaskCreate holds the fields of a new task.
+type TaskCreate struct {
+	Title  string
+	Status string
+	UserID int
+}
+
+// TaskWriteResult is the outcome of one TaskWrite.
+type TaskWriteResult struct {
+	Task Task
+	Err  error
+}
+
+// taskBatchWriter is implemented by stores that can apply a TaskBatch in one
+// unit of work.
+type taskBatchWriter interface {
+	ApplyTaskBatch(ctx context.Context, batch TaskBatch) ([]TaskWriteResult, error)
+}
+
+// checkStatus rejects a status outside taskStatuses before the write runs.
+func (w TaskWrite) checkStatus() error {
+	status := w.Update.Status
+	if w.Create != nil {
+		status = &w.Create.Status
+	}
+	if status != nil && !isValidTaskStatus(*status) {
+		return fmt.Errorf("%w: %q", ErrInvalidTaskStatus, *status)
+	}
+	return nil
+}
+
+// abortedBatchResults reports err for the write at failed and ErrBatchAborted
+// for every other write of an atomic batch of n writes.
+func abortedBatchResults(n, failed int, err error) []TaskWriteResult {
+	results := make([]TaskWriteResult, n)
+	for i := range results {
+		results[i].Err = ErrBatchAborted
+	}
+	results[failed].Err = err
+	return results
+}
+
+type bulkTaskRequest struct {
+	Atomic     bool                `json:"atomic"`
+	Operations []bulkTaskOperation `json:"operations"`
+}
+
+// bulkTaskOperation creates Task, or applies Changes to the tasks listed in
+// IDs or matched by Filter.
+type bulkTaskOperation struct {
+	Op      string             `json:"op"`
+	Task    *createTaskRequest `json:"task"`
+	IDs     []int              `json:"ids"`
+	Filter  *bulkTaskFilter    `json:"filter"`
+	Changes *updateTaskRequest `json:"changes"`
+}
+
+type bulkTaskFilter struct {
+	Status string `json:"status"`
+	UserID *int   `json:"userId"`
+}
+
+// BulkTaskResult is the outcome of one write. Index is the position of the
+// operation that produced it, so an update may yield several results.
+type BulkTaskResult struct {
+	Index  int          `json:"index"`
+	Op     string       `json:"op"`
+	TaskID int          `json:"taskId,omitempty"`
+	Status int          `json:"status"`
+	Task   *Task        `json:"task,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// BulkTaskResponse is the body of POST /api/tasks/bulk.
+type BulkTaskResponse struct {
+	BatchID   string           `json:"batchId"`
+	Atomic    bool             `json:"atomic"`
+	Committed bool             `json:"committed"`
+	Results   []BulkTaskResult `json:"results"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+}
+
+// validate checks the envelope of every operation. Task fields are validated
+// per result so one bad item does not reject the whole request.
+func (req *bulkTaskRequest) validate() error {
+	var v validator
+	if len(req.Operations) == 0 {
+		v.add("operations", codeRequired, "operations is required")
+	}
+	for i, op := range req.Operations {
+		field := "operations[" + strconv.Itoa(i) + "]"
+		switch op.Op {
+		case "create":
+			if op.Task == nil {
+				v.add(field+".task", codeRequired, "task is required for create")
+			}
+			if op.IDs != nil || op.Filter != nil || op.Changes != nil {
+				v.add(field, codeInvalidValue, "create takes only task")
+			}
+		case "update":
+			if op.Changes == nil {
+				v.add(field+".changes", codeRequired, "changes is required for update")
+			}
+			switch {
+			case op.Task != nil:
+				v.add(field+".task", codeInvalidValue, "update takes ids or filter, not task")
+			case (op.IDs == nil) == (op.Filter == nil):
+				v.add(field, codeInvalidValue, "update needs exactly one of ids or filter")
+			case op.Filter != nil && op.Filter.Status == "" && op.Filter.UserID == nil:
+				v.add(field+".filter", codeRequired, "filter needs status or userId")
+			}
+		case "":
+			v.add(field+".op", codeRequired, "op is required")
+		default:
+			v.add(field+".op", codeInvalidValue, "op must be create or update")
+		}
+	}
+	return v.err()
+}
+
+// handleBulkTasks applies a list of task creates and updates. Each write gets
+// its own result; the response is 200 when all succeed and 207 otherwise.
+// Atomic requests commit every write or none.
+func (s *Server) handleBulkTasks(w http.ResponseWriter, r *http.Request) {
+	if err := requireJSONContentType(r); err != nil {
+		s.writeError(w, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+	limits := s.settings.Load().limits
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBodyBytes)
+
+	var req bulkTaskRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+	if err := req.validate(); err != nil {
+		s.writeValidationError(w, err)
+		return
+	}
+
+	c, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+
+	results, writes, err := s.expandBulkOperations(r.Context(), req.Operations)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "error expanding bulk task operations", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if len(results) > limits.MaxBulkItems {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("bulk request expands to %d writes; the limit is %d", len(results), limits.MaxBulkItems))
+		return
+	}
+	if err := s.authorizeBulkWrites(r.Context(), c, results, writes); err != nil {
+		s.logger.ErrorContext(r.Context(), "error authorizing bulk task operations", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	response := BulkTaskResponse{BatchID: newRequestID(), Atomic: req.Atomic, Results: results}
+
+	// pending maps each write sent to the store back to its result.
+	var (
+		pending []int
+		batch   = TaskBatch{ID: response.BatchID, Atomic: req.Atomic, Actor: c.actor}
+	)
+	for i := range results {
+		if results[i].Status == 0 {
+			pending = append(pending, i)
+			batch.Writes = append(batch.Writes, writes[i])
+		}
+	}
+
+	switch {
+	case req.Atomic && len(pending) < len(results):
+		for _, i := range pending {
+			results[i].Status = http.StatusFailedDependency
+			results[i].Error = ErrBatchAborted.Error()
+		}
+	case len(pending) > 0:
+		writeResults, err := s.applyTaskBatch(r.Context(), batch)
+		if errors.Is(err, errAtomicBatchUnsupported) {
+			s.writeError(w, http.StatusNotImplemented, err.Error())
+			return
+		}
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "error applying task batch", "batch_id", batch.ID, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		for j, i := range pending {
+			s.fillBulkResult(r.Context(), &results[i], writeResults[j])
+		}
+		response.Committed = !req.Atomic || allSucceeded(writeResults)
+	}
+
+	for _, result := range results {
+		if result.Status < http.StatusMultipleChoices {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	s.writeJSON(w, status, response)
+}
+
+// expandBulkOperations turns operations into one result and one write per
+// task. Results that already failed validation have a non-zero Status.
+func (s *Server) expandBulkOperations(ctx context.Context, operations []bulkTaskOperation) ([]BulkTaskResult, []TaskWrite, error) {
+	var (
+		results []BulkTaskResult
+		writes  []TaskWrite
+	)
+	for index, op := range operations {
+		if op.Op == "create" {
+			result := BulkTaskResult{Index: index, Op: op.Op}
+			var write TaskWrite
+			if err := op.Task.validate(); err != nil {
+				setBulkValidationError(&result, err)
+			} else {
+				write.Create = &TaskCreate{Title: op.Task.Title, Status: op.Task.Status, UserID: *op.Task.UserID}
+			}
+			results = append(results, result)
+			writes = append(writes, write)
+			continue
+		}
+
+		taskIDs := op.IDs
+		if op.Filter != nil {
+			userID := ""
+			if op.Filter.UserID != nil {
+				userID = strconv.Itoa(*op.Filter.UserID)
+			}
+			tasks, err := s.dataStore.GetTasks(ctx, op.Filter.Status, userID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("expand filter of operation %d: %w", index, err)
+			}
+			taskIDs = make([]int, 0, len(tasks))
+			for _, task := range tasks {
+				taskIDs = append(taskIDs, task.ID)
+			}
+		}
+
+		update, validationErr := op.Changes.validate()
+		for _, taskID := range taskIDs {
+			result := BulkTaskResult{Index: index, Op: op.Op, TaskID: taskID}
+			if validationErr != nil {
+				setBulkValidationError(&result, validationErr)
+			}
+			results = append(results, result)
+			writes = append(writes, TaskWrite{TaskID: taskID, Update: update})
+		}
+	}
+	return results, writes, nil
+}
+
+// authorizeBulkWrites marks results c may not write as 403, or 404 for
+// updates of tasks that do not exist. Each allowed update expects the
+// assignee it was authorized against, so a task reassigned before the batch
+// applies fails with 409 instead of being written on stale permissions.
+func (s *Server) authorizeBulkWrites(ctx context.Context, c caller, results []BulkTaskResult, writes []TaskWrite) error {
+	if s.settings.Load().policy == nil {
+		return nil
+	}
+
+	var taskIDs []int
+	for i := range results {
+		if results[i].Status == 0 && writes[i].Create == nil {
+			taskIDs = append(taskIDs, writes[i].TaskID)
+		}
+	}
+	owners, err := s.taskOwners(ctx, taskIDs)
+	if err != nil {
+		return err
+	}
+
+	for i := range results {
+		if results[i].Status != 0 {
+			continue
+		}
+
+		var missing string
+		if create := writes[i].Create; create != nil {
+			switch {
+			case !c.can(permTasksCreate):
+				missing = permTasksCreate
+			case create.UserID != c.userID && !c.can(permTasksAssign):
+				missing = permTasksAssign
+			}
+		} else {
+			owner, found := owners[writes[i].TaskID]
+			if !found {
+				results[i].Status = http.StatusNotFound
+				results[i].Error = "task not found"
+				continue
+			}
+			// Only the assignee is loaded, so a title or status counts as a
+			// change even when it repeats the current value.
+			missing = c.missingTaskUpdatePermission(Task{ID: writes[i].TaskID, UserID: owner}, writes[i].Update)
+			if writes[i].Update.Expect.UserID == nil {
+				writes[i].Update.Expect.UserID = &owner
+			}
+		}
+		if missing != "" {
+			s.logger.InfoContext(ctx, "permission denied", "role", c.role, "permission", missing)
+			results[i].Status = http.StatusForbidden
+			results[i].Error = "missing permission: " + missing
+		}
+	}
+	return nil
+}
+
+// taskOwners returns the assignee of each task in taskIDs that exists, in
+// one query when the store has a history feed.
+func (s *Server) taskOwners(ctx context.Context, taskIDs []int) (map[int]int, error) {
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	if s.history != nil {
+		return s.history.GetTaskOwners(ctx, taskIDs)
+	}
+
+	owners := make(map[int]int, len(taskIDs))
+	for _, taskID := range taskIDs {
+		task, found, err := s.dataStore.GetTaskByID(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			owners[taskID] = task.UserID
+		}
+	}
+	return owners, nil
+}
+
+var errAtomicBatchUnsupported = errors.New("atomic bulk operations are not supported by this store")
+
+// applyTaskBatch applies batch through the store's taskBatchWriter, or one
+// write at a time for stores without one.
+func (s *Server) applyTaskBatch(ctx context.Context, batch TaskBatch) ([]TaskWriteResult, error) {
+	if s.batches != nil {
+		return s.batches.ApplyTaskBatch(ctx, batch)
+	}
+	if batch.Atomic {
+		return nil, errAtomicBatchUnsupported
+	}
+
+	results := make([]TaskWriteResult, len(batch.Writes))
+	for i, write := range batch.Writes {
+		if write.Create != nil {
+			results[i].Task, results[i].Err = s.dataStore.CreateTask(ctx, write.Create.Title, write.Create.Status, write.Create.UserID, batch.Actor)
+		} else {
+			results[i].Task, results[i].Err = s.dataStore.UpdateTask(ctx, write.TaskID, write.Update, batch.Actor)
+		}
+	}
+	return results, nil
+}
+
+// fillBulkResult records the outcome of a store write in result.
+func (s *Server) fillBulkResult(ctx context.Context, result *BulkTaskResult, written TaskWriteResult) {
+	switch {
+	case written.Err == nil:
+		task := written.Task
+		result.Task = &task
+		result.TaskID = task.ID
+		result.Status = http.StatusOK
+		if result.Op == "create" {
+			result.Status = http.StatusCreated
+		}
+	case errors.Is(written.Err, ErrBatchAborted):
+		result.Status = http.StatusFailedDependency
+		result.Error = written.Err.Error()
+	default:
+		result.Status, result.Error = s.taskUpdateError(ctx, result.TaskID, written.Err)
+	}
+}
+
+func setBulkValidationError(result *BulkTaskResult, err error) {
+	result.Status = http.StatusBadRequest
+	result.Error = err.Error()
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		result.Errors = validationErr.Errors
+	}
+}
+
+func allSucceeded(results []TaskWriteResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestBulkTasksBestEffort(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+
+	body := `{"operations":[
+		{"op":"create","task":{"title":"New","status":"pending","userId":2}},
+		{"op":"create","task":{"title":"Orphan","status":"pending","userId":99}},
+		{"op":"update","ids":[1,999],"changes":{"status":"completed"}},
+		{"op":"update","filter":{"userId":2},"changes":{"title":" "}}
+	]}`
+	res := performRequestWithHeaders(h, http.MethodPost, "/api/tasks/bulk", body, asActor("alice"))
+	if res.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusMultiStatus, res.Code, res.Body.String())
+	}
+	var response BulkTaskResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+
+	want := []struct {
+		index, taskID, status int
+	}{
+		{index: 0, taskID: 4, status: http.StatusCreated},
+		{index: 1, status: http.StatusBadRequest},
+		{index: 2, taskID: 1, status: http.StatusOK},
+		{index: 2, taskID: 999, status: http.StatusNotFound},
+		{index: 3, taskID: 2, status: http.StatusBadRequest},
+	}
+	if len(response.Results) != len(want) {
+		t.Fatalf("expected %d results, got %+v", len(want), response.Results)
+	}
+	for i, w := range want {
+		got := response.Results[i]
+		if got.Index != w.index || got.TaskID != w.taskID || got.Status != w.status {
+			t.Fatalf("result %d: expected %+v, got %+v", i, w, got)
+		}
+	}
+	if codes := fieldErrorCodes(ProblemDetails{Errors: response.Results[4].Errors}); codes["title"] != codeBlank {
+		t.Fatalf("expected a blank title error, got %+v", response.Results[4])
+	}
+	if !response.Committed || response.Succeeded != 2 || response.Failed != 3 || response.BatchID == "" {
+		t.Fatalf("unexpected summary: %+v", response)
+	}
+
+	history, err := s.dataStore.GetTaskHistory(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetTaskHistory: %v", err)
+	}
+	if history[0].BatchID != response.BatchID || history[0].ChangedBy != "alice" {
+		t.Fatalf("expected the latest change to carry batch %q, got %+v", response.BatchID, history[0])
+	}
+}
+
+func TestBulkTasksAtomic(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+
+	body := `{"atomic":true,"operations":[
+		{"op":"create","task":{"title":"New","status":"pending","userId":1}},
+		{"op":"update","ids":[1],"changes":{"status":"completed"}},
+		{"op":"update","ids":[2],"changes":{"userId":99}}
+	]}`
+	res := performRequest(h, http.MethodPost, "/api/tasks/bulk", body)
+	if res.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusMultiStatus, res.Code, res.Body.String())
+	}
+	var response BulkTaskResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+	if response.Committed || response.Succeeded != 0 {
+		t.Fatalf("expected nothing to be committed, got %+v", response)
+	}
+	for i, status := range []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusBadRequest} {
+		if response.Results[i].Status != status {
+			t.Fatalf("result %d: expected status %d, got %+v", i, status, response.Results[i])
+		}
+	}
+
+	tasks, err := s.dataStore.GetTasks(context.Background(), "", "")
+	if err != nil {
+		t.Fatalf("GetTasks: %v", err)
+	}
+	if len(tasks) != 3 || tasks[0].Status != "pending" {
+		t.Fatalf("expected the batch to be rolled back, got %+v", tasks)
+	}
+
+	body = `{"atomic":true,"operations":[
+		{"op":"create","task":{"title":"New","status":"pending","userId":1}},
+		{"op":"update","ids":[1,2],"changes":{"status":"completed"}}
+	]}`
+	res = performRequest(h, http.MethodPost, "/api/tasks/bulk", body)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+	if !response.Committed || response.Succeeded != 3 || response.Results[0].Task.ID != 4 {
+		t.Fatalf("expected every write to commit, got %+v", response)
+	}
+}
+
+func TestBulkTasksRejectsInvalidEnvelope(t *testing.T) {
+	s := newTestServer(t)
+
+	testCases := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{name: "no operations", body: `{"operations":[]}`, want: map[string]string{"operations": codeRequired}},
+		{name: "unknown op", body: `{"operations":[{"op":"delete","ids":[1]}]}`, want: map[string]string{"operations[0].op": codeInvalidValue}},
+		{name: "update without target", body: `{"operations":[{"op":"update","changes":{"status":"completed"}}]}`, want: map[string]string{"operations[0]": codeInvalidValue}},
+		{name: "empty filter", body: `{"operations":[{"op":"update","filter":{},"changes":{"status":"completed"}}]}`, want: map[string]string{"operations[0].filter": codeRequired}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequest(s.Handler(), http.MethodPost, "/api/tasks/bulk", tc.body)
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, res.Code, res.Body.String())
+			}
+			codes := fieldErrorCodes(decodeProblem(t, res))
+			for field, code := range tc.want {
+				if codes[field] != code {
+					t.Fatalf("expected %q to fail with %q, got %v", field, code, codes)
+				}
+			}
+		})
+	}
+}
+
+func TestBulkTasksChecksPermissionsPerItem(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+
+	body := `{"operations":[
+		{"op":"create","task":{"title":"Mine","status":"pending","userId":1}},
+		{"op":"create","task":{"title":"Theirs","status":"pending","userId":2}},
+		{"op":"update","ids":[1,2],"changes":{"status":"completed"}}
+	]}`
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/tasks/bulk", body, asActor("john@example.com"))
+	if res.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusMultiStatus, res.Code, res.Body.String())
+	}
+	var response BulkTaskResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+	for i, status := range []int{http.StatusCreated, http.StatusForbidden, http.StatusOK, http.StatusForbidden} {
+		if response.Results[i].Status != status {
+			t.Fatalf("result %d: expected status %d, got %+v", i, status, response.Results[i])
+		}
+	}
+	if response.Results[1].Error != "missing permission: "+permTasksAssign {
+		t.Fatalf("expected the assign permission to be missing, got %+v", response.Results[1])
+	}
+}
+
+// reassigningFeed reassigns a task right after its owners are read, as a
+// concurrent PATCH could between authorizing a batch and applying it.
+type reassigningFeed struct {
+	historyFeed
+	calls    [][]int
+	reassign func()
+}
+
+func (f *reassigningFeed) GetTaskOwners(ctx context.Context, taskIDs []int) (map[int]int, error) {
+	f.calls = append(f.calls, taskIDs)
+	owners, err := f.historyFeed.GetTaskOwners(ctx, taskIDs)
+	f.reassign()
+	return owners, err
+}
+
+func TestBulkTasksRecheckOwnershipWhenApplying(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+	ctx := context.Background()
+	jane := 2
+	feed := &reassigningFeed{historyFeed: s.history, reassign: func() {
+		if _, err := s.dataStore.UpdateTask(ctx, 1, TaskUpdate{UserID: &jane}, "bob@example.com"); err != nil {
+			t.Fatalf("UpdateTask: %v", err)
+		}
+	}}
+	s.history = feed
+
+	body := `{"operations":[{"op":"update","ids":[1,2],"changes":{"status":"completed"}}]}`
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/tasks/bulk", body, asActor("john@example.com"))
+	if res.Code != http.StatusMultiStatus {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusMultiStatus, res.Code, res.Body.String())
+	}
+	if !reflect.DeepEqual(feed.calls, [][]int{{1, 2}}) {
+		t.Fatalf("expected the owners to be loaded in one call, got %v", feed.calls)
+	}
+
+	var response BulkTaskResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+	if response.Results[0].Status != http.StatusConflict || response.Results[1].Status != http.StatusForbidden {
+		t.Fatalf("expected a conflict for the reassigned task, got %+v", response.Results)
+	}
+	task, _, err := s.dataStore.GetTaskByID(ctx, 1)
+	if err != nil || task.Status != "pending" || task.UserID != jane {
+		t.Fatalf("expected task 1 to keep its status after the reassignment, got %+v, %v", task, err)
+	}
+}
+
+func TestDataStoreApplyTaskBatchRestoresStateOnFailure(t *testing.T) {
+	ds := newDemoDataStore(t)
+	ctx := context.Background()
+	completed := "completed"
+
+	results, err := ds.ApplyTaskBatch(ctx, TaskBatch{ID: "b1", Atomic: true, Writes: []TaskWrite{
+		{Create: &TaskCreate{Title: "New", Status: "pending", UserID: 1}},
+		{TaskID: 1, Update: TaskUpdate{Status: &completed}},
+		{TaskID: 42, Update: TaskUpdate{Status: &completed}},
+	}})
+	if err != nil {
+		t.Fatalf("ApplyTaskBatch: %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrBatchAborted) || !errors.Is(results[1].Err, ErrBatchAborted) || !errors.Is(results[2].Err, ErrTaskNotFound) {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	history, err := ds.GetTaskHistory(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetTaskHistory: %v", err)
+	}
+	for _, entry := range history {
+		if entry.BatchID != "" {
+			t.Fatalf("expected rolled back history to be gone, got %+v", entry)
+		}
+	}
+
+	// IDs freed by the rollback are reused.
+	task, err := ds.CreateTask(ctx, "Next", "pending", 1, "admin")
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if task.ID != 4 {
+		t.Fatalf("expected task ID 4, got %d", task.ID)
+	}
+}
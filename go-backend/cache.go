@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheTTL is the default CacheConfig.TTL.
+const defaultCacheTTL = 5 * time.Second
+
+// Cache results and invalidation reasons for metrics.
+const (
+	cacheHit  = "hit"
+	cacheMiss = "miss"
+
+	invalidatedByWrite = "write"
+	invalidatedByEvent = "event"
+)
+
+// cachingStore serves reads from memory, per workspace and arguments, until
+// a write through it or a change event from any replica clears every entry.
+// Entries also expire after ttl, which bounds staleness if change events are
+// lost, e.g. while the listener reconnects.
+type cachingStore struct {
+	next          Store
+	ttl           time.Duration
+	now           func() time.Time
+	requests      *counterVec
+	invalidations *counterVec
+
+	mu sync.Mutex
+	// generation changes on every invalidation, so a read that started
+	// before one does not cache what it loaded.
+	generation uint64
+	entries    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value   any
+	expires time.Time
+}
+
+// lookupResult is a cached GetUserByID or GetTaskByID result; misses are
+// cached too.
+type lookupResult[T any] struct {
+	value T
+	found bool
+}
+
+func newCachingStore(next Store, ttl time.Duration, metrics *serverMetrics) *cachingStore {
+	return &cachingStore{
+		next: next,
+		ttl:  ttl,
+		now:  time.Now,
+		requests: metrics.registry.NewCounterVec(
+			"store_cache_requests_total",
+			"Cached Store reads, by Store method and result (hit or miss).",
+			metricsStoreOperation, "result",
+		),
+		invalidations: metrics.registry.NewCounterVec(
+			"store_cache_invalidations_total",
+			"Times the Store cache was cleared, by reason (write or event).",
+			"reason",
+		),
+		entries: make(map[string]cacheEntry),
+	}
+}
+
+// EnableCache serves Store reads through a cachingStore with ttl. Bulk
+// writes and imports, which bypass the Store, clear it too.
+func (s *Server) EnableCache(ttl time.Duration) {
+	cache := newCachingStore(s.dataStore, ttl, s.metrics)
+	s.dataStore = cache
+	if s.batches != nil {
+		s.batches = invalidatingBatchWriter{next: s.batches, cache: cache}
+	}
+	if s.importer != nil {
+		s.importer = invalidatingImporter{next: s.importer, cache: cache}
+	}
+	cache.watch(s.streamsCtx, s.events)
+}
+
+// watch clears the cache on every change event until ctx ends. It subscribes
+// before returning, so no later write is missed. If the bus drops the
+// subscription for falling behind, events may have been missed, so it clears
+// the cache and subscribes again.
+func (c *cachingStore) watch(ctx context.Context, events *EventBus) {
+	ch, unsubscribe := events.Subscribe(EventFilter{})
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				unsubscribe()
+				return
+			case _, open := <-ch:
+				c.invalidate(invalidatedByEvent)
+				if !open {
+					ch, unsubscribe = events.Subscribe(EventFilter{})
+				}
+			}
+		}
+	}()
+}
+
+func (c *cachingStore) invalidate(reason string) {
+	c.mu.Lock()
+	c.generation++
+	c.entries = make(map[string]cacheEntry)
+	c.mu.Unlock()
+	c.invalidations.Inc(reason)
+}
+
+// cachedRead returns the entry for operation and args in the caller's
+// workspace, or loads and caches it. Errors are not cached. clone deep-copies
+// values, like the data store's copy helpers, so callers cannot change cached
+// values.
+func cachedRead[T any](ctx context.Context, c *cachingStore, operation string, clone func(T) T, load func(context.Context) (T, error), args ...string) (T, error) {
+	key := operation + "\x00" + workspaceFromContext(ctx) + "\x00" + strings.Join(args, "\x00")
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		c.requests.Inc(operation, cacheHit)
+		return clone(entry.value.(T)), nil
+	}
+	c.requests.Inc(operation, cacheMiss)
+
+	value, err := load(ctx)
+	if err != nil {
+		return value, err
+	}
+	c.mu.Lock()
+	if c.generation == generation {
+		c.entries[key] = cacheEntry{value: clone(value), expires: c.now().Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return value, nil
+}
+
+func same[T any](value T) T { return value }
+
+func copyTaskLookup(result lookupResult[Task]) lookupResult[Task] {
+	result.value = copyTask(result.value)
+	return result
+}
+
+func (c *cachingStore) GetUsers(ctx context.Context) ([]User, error) {
+	return cachedRead(ctx, c, "GetUsers", copyUsers, c.next.GetUsers)
+}
+
+func (c *cachingStore) GetUserByID(ctx context.Context, id int) (User, bool, error) {
+	result, err := cachedRead(ctx, c, "GetUserByID", same[lookupResult[User]], func(ctx context.Context) (lookupResult[User], error) {
+		user, found, err := c.next.GetUserByID(ctx, id)
+		return lookupResult[User]{value: user, found: found}, err
+	}, strconv.Itoa(id))
+	return result.value, result.found, err
+}
+
+func (c *cachingStore) GetUserByEmail(ctx context.Context, email string) (User, bool, error) {
+	result, err := cachedRead(ctx, c, "GetUserByEmail", same[lookupResult[User]], func(ctx context.Context) (lookupResult[User], error) {
+		user, found, err := c.next.GetUserByEmail(ctx, email)
+		return lookupResult[User]{value: user, found: found}, err
+	}, strings.ToLower(email))
+	return result.value, result.found, err
+}
+
+func (c *cachingStore) GetTasks(ctx context.Context, status, userID string) ([]Task, error) {
+	return cachedRead(ctx, c, "GetTasks", copyTasks, func(ctx context.Context) ([]Task, error) {
+		return c.next.GetTasks(ctx, status, userID)
+	}, status, userID)
+}
+
+func (c *cachingStore) GetTaskByID(ctx context.Context, id int) (Task, bool, error) {
+	result, err := cachedRead(ctx, c, "GetTaskByID", copyTaskLookup, func(ctx context.Context) (lookupResult[Task], error) {
+		task, found, err := c.next.GetTaskByID(ctx, id)
+		return lookupResult[Task]{value: task, found: found}, err
+	}, strconv.Itoa(id))
+	return result.value, result.found, err
+}
+
+func (c *cachingStore) GetTaskHistory(ctx context.Context, taskID int) ([]TaskHistoryItem, error) {
+	return cachedRead(ctx, c, "GetTaskHistory", copyTaskHistory, func(ctx context.Context) ([]TaskHistoryItem, error) {
+		return c.next.GetTaskHistory(ctx, taskID)
+	}, strconv.Itoa(taskID))
+}
+
+func (c *cachingStore) GetStats(ctx context.Context) (StatsResponse, error) {
+	return cachedRead(ctx, c, "GetStats", same[StatsResponse], c.next.GetStats)
+}
+
+// Writes clear the cache even when they fail, since a failure may come after
+// the change was made.
+
+func (c *cachingStore) CreateUser(ctx context.Context, name, email, role string) (User, error) {
+	defer c.invalidate(invalidatedByWrite)
+	return c.next.CreateUser(ctx, name, email, role)
+}
+
+func (c *cachingStore) CreateTask(ctx context.Context, title, status string, userID int, actor string) (Task, error) {
+	defer c.invalidate(invalidatedByWrite)
+	return c.next.CreateTask(ctx, title, status, userID, actor)
+}
+
+func (c *cachingStore) UpdateTask(ctx context.Context, id int, update TaskUpdate, actor string) (Task, error) {
+	defer c.invalidate(invalidatedByWrite)
+	return c.next.UpdateTask(ctx, id, update, actor)
+}
+
+type invalidatingBatchWriter struct {
+	next  taskBatchWriter
+	cache *cachingStore
+}
+
+func (w invalidatingBatchWriter) ApplyTaskBatch(ctx context.Context, batch TaskBatch) ([]TaskWriteResult, error) {
+	defer w.cache.invalidate(invalidatedByWrite)
+	return w.next.ApplyTaskBatch(ctx, batch)
+}
+
+type invalidatingImporter struct {
+	next  importer
+	cache *cachingStore
+}
+
+func (imp invalidatingImporter) Import(ctx context.Context, batch ImportBatch) (ImportResult, error) {
+	defer imp.cache.invalidate(invalidatedByWrite)
+	return imp.next.Import(ctx, batch)
+}
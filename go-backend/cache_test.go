@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore counts the GetStats and GetTasks calls that reach it.
+type countingStore struct {
+	*DataStore
+	stats atomic.Int64
+	tasks atomic.Int64
+}
+
+func (s *countingStore) GetStats(ctx context.Context) (StatsResponse, error) {
+	s.stats.Add(1)
+	return s.DataStore.GetStats(ctx)
+}
+
+func (s *countingStore) GetTasks(ctx context.Context, status, userID string) ([]Task, error) {
+	s.tasks.Add(1)
+	return s.DataStore.GetTasks(ctx, status, userID)
+}
+
+func newTestCache(t *testing.T) (*cachingStore, *countingStore) {
+	t.Helper()
+	next := &countingStore{DataStore: NewDataStore(
+		[]User{{ID: 1, Name: "John Doe", Email: "john@example.com", Role: "developer"}},
+		[]Task{{ID: 1, Title: "Implement authentication", Status: "pending", UserID: 1}},
+	)}
+	return newCachingStore(next, time.Minute, newServerMetrics()), next
+}
+
+func TestCachingStoreServesRepeatedReads(t *testing.T) {
+	cache, next := newTestCache(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		stats, err := cache.GetStats(ctx)
+		if err != nil {
+			t.Fatalf("GetStats: %v", err)
+		}
+		if stats.Users.Total != 1 || stats.Tasks.Total != 1 {
+			t.Fatalf("unexpected stats: %+v", stats)
+		}
+	}
+	if got := next.stats.Load(); got != 1 {
+		t.Fatalf("expected one GetStats call to reach the store, got %d", got)
+	}
+	if hits, misses := cache.requests.Value("GetStats", cacheHit), cache.requests.Value("GetStats", cacheMiss); hits != 2 || misses != 1 {
+		t.Fatalf("expected 2 hits and 1 miss, got %v and %v", hits, misses)
+	}
+
+	other := withWorkspace(ctx, "team-b")
+	if _, err := cache.GetStats(other); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if _, err := cache.GetTasks(ctx, "pending", ""); err != nil {
+		t.Fatalf("GetTasks: %v", err)
+	}
+	if _, err := cache.GetTasks(ctx, "completed", ""); err != nil {
+		t.Fatalf("GetTasks: %v", err)
+	}
+	if next.stats.Load() != 2 || next.tasks.Load() != 2 {
+		t.Fatalf("expected separate entries per workspace and filter, got %d stats and %d tasks calls", next.stats.Load(), next.tasks.Load())
+	}
+}
+
+func TestCachingStoreInvalidatesOnWrite(t *testing.T) {
+	cache, next := newTestCache(t)
+	ctx := context.Background()
+
+	if _, err := cache.GetStats(ctx); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if _, err := cache.CreateTask(ctx, "Write docs", "pending", 1, "alice"); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	stats, err := cache.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.Tasks.Total != 2 || next.stats.Load() != 2 {
+		t.Fatalf("expected the write to clear the cache, got %+v after %d calls", stats, next.stats.Load())
+	}
+	if got := cache.invalidations.Value(invalidatedByWrite); got != 1 {
+		t.Fatalf("expected one invalidation by write, got %v", got)
+	}
+}
+
+func TestCachingStoreInvalidatesOnChangeEvent(t *testing.T) {
+	cache, next := newTestCache(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache.watch(ctx, next.Events())
+
+	if _, err := cache.GetStats(ctx); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	// A write that bypasses the cache, as another replica's would.
+	if _, err := next.CreateTask(ctx, "Write docs", "pending", 1, "alice"); err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cache.invalidations.Value(invalidatedByEvent) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the change event to clear the cache")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	stats, err := cache.GetStats(ctx)
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.Tasks.Total != 2 {
+		t.Fatalf("expected fresh stats after the event, got %+v", stats)
+	}
+}
+
+func TestCachingStoreExpiresEntries(t *testing.T) {
+	cache, next := newTestCache(t)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if _, err := cache.GetStats(ctx); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	now = now.Add(cache.ttl - time.Second)
+	if _, err := cache.GetStats(ctx); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	now = now.Add(time.Second)
+	if _, err := cache.GetStats(ctx); err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if got := next.stats.Load(); got != 2 {
+		t.Fatalf("expected the entry to expire after the TTL, got %d calls", got)
+	}
+}
+
+func TestCachingStoreReturnsCopies(t *testing.T) {
+	cache, _ := newTestCache(t)
+	ctx := context.Background()
+
+	tasks, err := cache.GetTasks(ctx, "", "")
+	if err != nil {
+		t.Fatalf("GetTasks: %v", err)
+	}
+	tasks[0].Title = "changed by the caller"
+	tasks, err = cache.GetTasks(ctx, "", "")
+	if err != nil {
+		t.Fatalf("GetTasks: %v", err)
+	}
+	if tasks[0].Title != "Implement authentication" {
+		t.Fatalf("expected the cached slice to be unchanged, got %q", tasks[0].Title)
+	}
+}
+
+func TestCachingStoreReturnsDeepCopies(t *testing.T) {
+	cache, next := newTestCache(t)
+	ctx := context.Background()
+	completed := "completed"
+	if _, err := next.UpdateTask(ctx, 1, TaskUpdate{Status: &completed}, "john@example.com"); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+
+	// Every read is made twice: the first is cached, the second is a hit
+	// that must not share pointers with the first.
+	for i := 0; i < 2; i++ {
+		task, _, err := cache.GetTaskByID(ctx, 1)
+		if err != nil || task.LastChange == nil || task.LastChange.FromValue == nil || *task.LastChange.FromValue != "pending" {
+			t.Fatalf("read %d: expected the last change from pending, got %+v, %v", i, task.LastChange, err)
+		}
+		*task.LastChange.FromValue = "changed by the caller"
+
+		tasks, err := cache.GetTasks(ctx, "", "")
+		if err != nil || *tasks[0].LastChange.FromValue != "pending" {
+			t.Fatalf("read %d: expected the cached task list to be unchanged, got %v", i, err)
+		}
+		*tasks[0].LastChange.FromValue = "changed by the caller"
+
+		history, err := cache.GetTaskHistory(ctx, 1)
+		if err != nil || len(history) == 0 || *history[len(history)-1].FromValue != "pending" {
+			t.Fatalf("read %d: expected the cached history to be unchanged, got %+v, %v", i, history, err)
+		}
+		*history[len(history)-1].FromValue = "changed by the caller"
+	}
+}
+
+func TestServerCacheInvalidatesOnBulkWrite(t *testing.T) {
+	s := newTestServer(t)
+	s.EnableCache(time.Minute)
+	h := s.Handler()
+
+	res := performRequest(h, http.MethodGet, "/api/stats", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var before StatsResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &before)
+
+	body := `{"operations":[{"op":"create","task":{"title":"Bulk task","status":"pending","userId":1}}]}`
+	if res := performRequest(h, http.MethodPost, "/api/tasks/bulk", body); res.Code != http.StatusOK {
+		t.Fatalf("bulk write failed: %d %s", res.Code, res.Body.String())
+	}
+
+	res = performRequest(h, http.MethodGet, "/api/stats", "")
+	var after StatsResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &after)
+	if after.Tasks.Total != before.Tasks.Total+1 {
+		t.Fatalf("expected the bulk write to be visible, got %+v", after)
+	}
+}
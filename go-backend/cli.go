@@ -0,0 +1,661 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// Exit codes shared by every command.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+	// exitPending means the database is reachable but has pending migrations.
+	exitPending = 3
+)
+
+// command is a subcommand of the backend binary. Its settings come from
+// loadConfig, so a flag overrides the environment, which overrides -config.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string, stdout, stderr io.Writer) int
+}
+
+func commands() []command {
+	return []command{
+		{name: "serve", summary: "run the HTTP server (the default)", run: runServe},
+		{name: "migrate", summary: "apply, revert or list schema migrations", run: runMigrate},
+		{name: "seed", summary: "load a fixture set or file of users, tasks and history", run: runSeed},
+		{name: "export", summary: "write tasks, users or history as CSV or NDJSON", run: runExport},
+		{name: "import", summary: "create users and tasks from a JSON or CSV file", run: runImport},
+		{name: "check-db", summary: "check the database is reachable and migrated", run: runCheckDB},
+		{name: "config", summary: "print the effective configuration, secrets redacted", run: runConfig},
+	}
+}
+
+// run dispatches args to a command and returns the process exit code. With
+// no command, or only flags, it serves.
+func run(args []string, stdout, stderr io.Writer) int {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			printUsage(stdout)
+			return exitOK
+		}
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return runServe(ctx, args, stdout, stderr)
+	}
+	for _, cmd := range commands() {
+		if cmd.name == args[0] {
+			return cmd.run(ctx, args[1:], stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: go-backend <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands() {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	_ = tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "go-backend <command> -h" for a command's flags.`)
+}
+
+func newFlagSet(name, usage string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: go-backend %s %s\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args, allowing flags after positional arguments as in
+// "migrate up -dsn ...", and returns the positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// flagExitCode maps a parseFlags error to an exit code; -h is not a failure.
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	return exitUsage
+}
+
+// usageError reports a bad invocation of fs.
+func usageError(fs *flag.FlagSet, format string, args ...any) int {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return exitUsage
+}
+
+func commandFailed(stderr io.Writer, name string, err error) int {
+	fmt.Fprintf(stderr, "%s: %v\n", name, err)
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		for _, fieldErr := range validationErr.Errors {
+			fmt.Fprintf(stderr, "  %s: %s (%s)\n", fieldErr.Field, fieldErr.Message, fieldErr.Code)
+		}
+	}
+	return exitFailure
+}
+
+func workspaceFlag(fs *flag.FlagSet) *string {
+	return fs.String("workspace", defaultWorkspaceID, "workspace to read from or write to")
+}
+
+// openCommandStore connects for a database command. An empty DSN is a usage
+// error; an unreachable database a failure.
+func openCommandStore(fs *flag.FlagSet, cfg DatabaseConfig, stderr io.Writer) (*PostgresStore, int) {
+	if strings.TrimSpace(cfg.DSN) == "" {
+		return nil, usageError(fs, "-dsn or POSTGRES_DSN is required")
+	}
+	store, err := openPostgres(cfg)
+	if err != nil {
+		return nil, commandFailed(stderr, fs.Name(), err)
+	}
+	return store, exitOK
+}
+
+// runServe starts the HTTP server: it migrates the schema, seeds fixtures
+// when asked to and serves until SIGINT or SIGTERM.
+func runServe(_ context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("serve", "[flags]", stderr)
+	loadCfg := bindConfig(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) > 0 {
+		return usageError(fs, "serve takes no arguments")
+	}
+
+	// Every setting is checked before anything starts, and all problems are
+	// reported at once.
+	cfg, err := loadCfg()
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+
+	// The level is a LevelVar so a reload can change it.
+	level := new(slog.LevelVar)
+	level.Set(cfg.Log.Level)
+	logger, err := newLogger(stdout, cfg.Log.Format, level)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid logging configuration: %v\n", err)
+		return exitFailure
+	}
+	slog.SetDefault(logger)
+	logger.Debug("effective configuration", "config", cfg)
+
+	shutdownTracing, err := setupTracing(context.Background(), cfg.Tracing.Exporter, cfg.Tracing.File)
+	if err != nil {
+		logger.Error("failed to initialize tracing", "error", err)
+		return exitFailure
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("error flushing traces", "error", err)
+		}
+	}()
+
+	if strings.TrimSpace(cfg.Database.DSN) == "" {
+		logger.Error("POSTGRES_DSN is required (no in-memory fallback is configured)")
+		return exitUsage
+	}
+
+	// Seeding is opt-in so a production database is never written to unasked.
+	var fixtures *Fixtures
+	if cfg.Seed.Fixtures != "" {
+		loaded, err := loadFixtures(cfg.Seed.Fixtures)
+		if err != nil {
+			logger.Error("invalid SEED_FIXTURES", "error", err)
+			return exitFailure
+		}
+		fixtures = &loaded
+	}
+
+	postgresStore, err := NewPostgresStore(cfg.Database)
+	if err != nil {
+		logger.Error("failed to initialize postgres store", "error", err)
+		return exitFailure
+	}
+	defer func() {
+		if closeErr := postgresStore.Close(); closeErr != nil {
+			logger.Error("error closing postgres store", "error", closeErr)
+		}
+	}()
+
+	if fixtures != nil {
+		if err := postgresStore.Seed(context.Background(), *fixtures, cfg.Seed.Mode); err != nil {
+			logger.Error("failed to seed fixtures", "fixtures", cfg.Seed.Fixtures, "error", err)
+			return exitFailure
+		}
+		logger.Info("seeded fixtures", "fixtures", cfg.Seed.Fixtures, "mode", cfg.Seed.Mode,
+			"users", len(fixtures.Users), "tasks", len(fixtures.Tasks), "history", len(fixtures.History))
+	}
+
+	server := NewServer(postgresStore)
+	if err := server.Configure(cfg); err != nil {
+		logger.Error("invalid server configuration", "error", err)
+		return exitFailure
+	}
+	if cfg.Cache.TTL > 0 {
+		server.EnableCache(cfg.Cache.TTL)
+	}
+	if cfg.RateLimit.Backend == rateLimitBackendPostgres {
+		server.UseRateLimiter(newPostgresRateLimiter(postgresStore))
+	}
+	server.EnableReload(cfg, loadCfg, level)
+	if !cfg.Auth.Enabled() {
+		logger.Warn("authentication is disabled; /api/* trusts every caller and the X-Actor header")
+	}
+	if err := server.Start(cfg.HTTP); err != nil {
+		logger.Error("server failed", "error", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runMigrate applies pending migrations, reverts the latest ones or lists
+// them. status exits with exitPending when any are pending.
+func runMigrate(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("migrate", "[flags] up|down|status", stderr)
+	loadCfg := bindConfig(fs, "database")
+	steps := fs.Int("steps", 1, "number of migrations down reverts")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		return usageError(fs, "migrate needs exactly one of up, down or status")
+	}
+	action := positional[0]
+	switch action {
+	case "up", "status":
+	case "down":
+		if *steps < 1 {
+			return usageError(fs, "-steps must be at least 1")
+		}
+	default:
+		return usageError(fs, "unknown migrate action %q", action)
+	}
+
+	cfg, err := loadCfg()
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+	store, code := openCommandStore(fs, cfg.Database, stderr)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	switch action {
+	case "up":
+		applied, err := store.MigrateUp(ctx)
+		if err != nil {
+			return commandFailed(stderr, "migrate up", err)
+		}
+		if len(applied) == 0 {
+			fmt.Fprintln(stdout, "no pending migrations")
+		}
+		for _, m := range applied {
+			fmt.Fprintf(stdout, "applied %d %s\n", m.version, m.name)
+		}
+	case "down":
+		reverted, err := store.MigrateDown(ctx, *steps)
+		if err != nil {
+			return commandFailed(stderr, "migrate down", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Fprintln(stdout, "no applied migrations")
+		}
+		for _, m := range reverted {
+			fmt.Fprintf(stdout, "reverted %d %s\n", m.version, m.name)
+		}
+	case "status":
+		statuses, err := store.MigrationStatus(ctx)
+		if err != nil {
+			return commandFailed(stderr, "migrate status", err)
+		}
+		printMigrationStatus(stdout, statuses)
+		if pendingMigrations(statuses) > 0 {
+			return exitPending
+		}
+	}
+	return exitOK
+}
+
+func printMigrationStatus(w io.Writer, statuses []MigrationStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", status.Version, status.Name, applied)
+	}
+	_ = tw.Flush()
+}
+
+// runSeed loads a built-in fixture set or a YAML or JSON fixtures file.
+func runSeed(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("seed", "[flags] "+strings.Join(fixtureSetNames(), "|")+"|FILE", stderr)
+	loadCfg := bindConfig(fs, "database")
+	modeValue := fs.String("mode", "", "if-empty fills empty tables; upsert inserts or overwrites every row by ID (default seed.mode)")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	cfg, err := loadCfg()
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+	source := cfg.Seed.Fixtures
+	switch len(positional) {
+	case 0:
+		if source == "" {
+			return usageError(fs, "seed needs a fixture set or file (or SEED_FIXTURES)")
+		}
+	case 1:
+		source = positional[0]
+	default:
+		return usageError(fs, "seed takes one fixture set or file")
+	}
+	mode := cfg.Seed.Mode
+	if *modeValue != "" {
+		if mode, err = parseSeedMode(*modeValue); err != nil {
+			return usageError(fs, "%v", err)
+		}
+	}
+
+	fixtures, err := loadFixtures(source)
+	if err != nil {
+		return commandFailed(stderr, "seed", err)
+	}
+
+	store, code := openCommandStore(fs, cfg.Database, stderr)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	if code := requireMigrated(ctx, store, stderr); code != exitOK {
+		return code
+	}
+	if err := store.Seed(ctx, fixtures, mode); err != nil {
+		return commandFailed(stderr, "seed", err)
+	}
+	fmt.Fprintf(stdout, "seeded %s (%s): %d users, %d tasks, %d history entries\n",
+		source, mode, len(fixtures.Users), len(fixtures.Tasks), len(fixtures.History))
+	return exitOK
+}
+
+// requireMigrated stops commands that need the current schema.
+func requireMigrated(ctx context.Context, store *PostgresStore, stderr io.Writer) int {
+	statuses, err := store.MigrationStatus(ctx)
+	if err != nil {
+		return commandFailed(stderr, "check migrations", err)
+	}
+	if pending := pendingMigrations(statuses); pending > 0 {
+		fmt.Fprintf(stderr, "%d migrations are pending; run \"go-backend migrate up\" first\n", pending)
+		return exitPending
+	}
+	return exitOK
+}
+
+// exportColumns are the header rows of each export kind.
+var exportColumns = map[string][]string{
+	"tasks":   taskExportColumns,
+	"users":   userExportColumns,
+	"history": historyExportColumns,
+}
+
+// runExport writes one export kind to stdout or a file, in the same format
+// as the /api/export endpoints.
+func runExport(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("export", "[flags] tasks|users|history", stderr)
+	loadCfg := bindConfig(fs, "database")
+	workspace := workspaceFlag(fs)
+	formatName := fs.String("format", "csv", "csv or ndjson")
+	output := fs.String("o", "", "file to write instead of stdout")
+	status := fs.String("status", "", "only export tasks with this status")
+	userID := fs.Int("user-id", 0, "only export tasks assigned to this user")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		return usageError(fs, "export needs exactly one of tasks, users or history")
+	}
+	kind := positional[0]
+	if _, ok := exportColumns[kind]; !ok {
+		return usageError(fs, "unknown export kind %q", kind)
+	}
+	format, err := exportFormatByName(*formatName)
+	if err != nil {
+		return usageError(fs, "%v", err)
+	}
+	if *status != "" && !isValidTaskStatus(*status) {
+		return usageError(fs, "invalid -status %q (want %s)", *status, strings.Join(taskStatuses, ", "))
+	}
+	if *userID < 0 {
+		return usageError(fs, "-user-id must be positive")
+	}
+	if *workspace != allWorkspaces && !isValidWorkspaceID(*workspace) {
+		return usageError(fs, "invalid -workspace %q", *workspace)
+	}
+	userFilter := ""
+	if *userID > 0 {
+		userFilter = strconv.Itoa(*userID)
+	}
+
+	cfg, err := loadCfg()
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+	store, code := openCommandStore(fs, cfg.Database, stderr)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	out := stdout
+	var file *os.File
+	if *output != "" {
+		if file, err = os.Create(*output); err != nil {
+			return commandFailed(stderr, "export", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	rows := newRowWriter(format, out)
+	count, err := writeExport(withWorkspace(ctx, *workspace), store, kind, *status, userFilter, rows)
+	if err != nil {
+		return commandFailed(stderr, "export", err)
+	}
+	if file != nil {
+		if err := file.Close(); err != nil {
+			return commandFailed(stderr, "export", err)
+		}
+	}
+	fmt.Fprintf(stderr, "exported %d %s\n", count, kind)
+	return exitOK
+}
+
+// writeExport writes the header and every row of kind, returning the row count.
+func writeExport(ctx context.Context, source exportSource, kind, status, userID string, rows rowWriter) (int, error) {
+	if err := rows.writeHeader(exportColumns[kind]); err != nil {
+		return 0, err
+	}
+	count := 0
+	write := func(record []string, value any) error {
+		count++
+		return rows.writeRow(record, value)
+	}
+
+	var err error
+	switch kind {
+	case "tasks":
+		err = source.ExportTasks(ctx, status, userID, func(task Task) error {
+			return write(taskExportRecord(task), task)
+		})
+	case "users":
+		err = source.ExportUsers(ctx, func(user User) error {
+			return write(userExportRecord(user), user)
+		})
+	case "history":
+		err = source.ExportHistory(ctx, func(entry TaskHistoryItem) error {
+			return write(historyExportRecord(entry), entry)
+		})
+	}
+	if err != nil {
+		return count, err
+	}
+	return count, rows.flush()
+}
+
+// runImport validates a JSON or CSV file like POST /api/import and imports
+// it all or nothing. A .csv file needs -kind.
+func runImport(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("import", "[flags] FILE", stderr)
+	loadCfg := bindConfig(fs, "database")
+	workspace := workspaceFlag(fs)
+	kind := fs.String("kind", "", "users or tasks, for CSV files")
+	dryRun := fs.Bool("dry-run", false, "validate the file without importing it")
+	actor := fs.String("actor", defaultActorName, "author recorded in task history")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) != 1 {
+		return usageError(fs, "import needs exactly one file")
+	}
+	if !isValidWorkspaceID(*workspace) {
+		return usageError(fs, "invalid -workspace %q", *workspace)
+	}
+
+	req, err := readImportFile(positional[0], *kind)
+	if err != nil {
+		return commandFailed(stderr, "import", err)
+	}
+	if len(req.Users)+len(req.Tasks) == 0 {
+		return commandFailed(stderr, "import", errors.New("nothing to import"))
+	}
+
+	cfg, err := loadCfg()
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+	store, code := openCommandStore(fs, cfg.Database, stderr)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	ctx = withWorkspace(ctx, *workspace)
+	existing, err := store.GetUsers(ctx)
+	if err != nil {
+		return commandFailed(stderr, "import", err)
+	}
+	batch, err := req.validate(existing)
+	if err != nil {
+		return commandFailed(stderr, "import", err)
+	}
+	if *dryRun {
+		fmt.Fprintf(stdout, "%d users and %d tasks are valid\n", len(batch.Users), len(batch.Tasks))
+		return exitOK
+	}
+
+	batch.ID = newRequestID()
+	batch.Actor = *actor
+	result, err := store.Import(ctx, batch)
+	if err != nil {
+		return commandFailed(stderr, "import", err)
+	}
+	fmt.Fprintf(stdout, "imported %d users and %d tasks (batch %s)\n", len(result.Users), len(result.Tasks), batch.ID)
+	return exitOK
+}
+
+// readImportFile decodes path, or stdin for "-", as CSV when it ends in .csv
+// and as JSON otherwise.
+func readImportFile(path, kind string) (importRequest, error) {
+	var req importRequest
+	in := io.Reader(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return req, err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		err = decodeImportCSV(in, kind, &req)
+	} else {
+		err = decodeJSON(in, &req)
+	}
+	if err != nil {
+		return importRequest{}, err
+	}
+	return req, nil
+}
+
+// runCheckDB pings the database once and reports pending migrations, for
+// readiness scripts: exitOK, exitFailure when unreachable or exitPending.
+func runCheckDB(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("check-db", "[flags]", stderr)
+	loadCfg := bindConfig(fs, "database")
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) > 0 {
+		return usageError(fs, "check-db takes no arguments")
+	}
+
+	cfg, err := loadCfg()
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+	// One attempt: readiness scripts do their own retrying.
+	cfg.Database.PingRetries = 1
+	store, code := openCommandStore(fs, cfg.Database, stderr)
+	if store == nil {
+		return code
+	}
+	defer store.Close()
+
+	if code := requireMigrated(ctx, store, stderr); code != exitOK {
+		return code
+	}
+	fmt.Fprintln(stdout, "database ok")
+	return exitOK
+}
+
+// runConfig prints every setting with its effective value and source, then
+// any problems with it, without connecting to anything.
+func runConfig(_ context.Context, args []string, stdout, stderr io.Writer) int {
+	fs := newFlagSet("config", "[flags]", stderr)
+	loadCfg := bindConfig(fs)
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	if len(positional) > 0 {
+		return usageError(fs, "config takes no arguments")
+	}
+
+	cfg, err := loadCfg()
+	if printErr := cfg.Print(stdout); printErr != nil {
+		return commandFailed(stderr, "config", printErr)
+	}
+	if err != nil {
+		return configFailed(stderr, err)
+	}
+	return exitOK
+}
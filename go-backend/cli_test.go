@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func runCommand(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunExitCodes(t *testing.T) {
+	t.Setenv("POSTGRES_DSN", "")
+
+	testCases := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "help", args: []string{"help"}, want: exitOK},
+		{name: "command help", args: []string{"migrate", "-h"}, want: exitOK},
+		{name: "unknown command", args: []string{"frobnicate"}, want: exitUsage},
+		{name: "unknown flag", args: []string{"seed", "-bogus"}, want: exitUsage},
+		{name: "migrate without action", args: []string{"migrate"}, want: exitUsage},
+		{name: "unknown migrate action", args: []string{"migrate", "sideways"}, want: exitUsage},
+		{name: "migrate down without steps", args: []string{"migrate", "down", "-steps", "0"}, want: exitUsage},
+		{name: "missing dsn", args: []string{"check-db"}, want: exitUsage},
+		{name: "unknown export kind", args: []string{"export", "projects"}, want: exitUsage},
+		{name: "unknown export format", args: []string{"export", "tasks", "-format", "xlsx"}, want: exitUsage},
+		{name: "import without file", args: []string{"import"}, want: exitUsage},
+		{name: "missing import file", args: []string{"import", filepath.Join(t.TempDir(), "missing.json")}, want: exitFailure},
+		{name: "serve with arguments", args: []string{"serve", "now"}, want: exitUsage},
+		{name: "invalid configuration", args: []string{"serve", "-port", "0"}, want: exitUsage},
+		{name: "missing config file", args: []string{"config", "-config", filepath.Join(t.TempDir(), "missing.yaml")}, want: exitUsage},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if code, _, stderr := runCommand(t, tc.args...); code != tc.want {
+				t.Fatalf("expected exit code %d, got %d stderr=%s", tc.want, code, stderr)
+			}
+		})
+	}
+}
+
+func TestRunHelpListsCommands(t *testing.T) {
+	_, stdout, _ := runCommand(t, "help")
+	for _, cmd := range commands() {
+		if !strings.Contains(stdout, cmd.name) {
+			t.Fatalf("expected usage to list %q, got %s", cmd.name, stdout)
+		}
+	}
+}
+
+func TestParseFlagsAllowsFlagsAfterArguments(t *testing.T) {
+	fs := newFlagSet("migrate", "", &bytes.Buffer{})
+	dsn := fs.String("dsn", "from-env", "")
+	steps := fs.Int("steps", 1, "")
+
+	positional, err := parseFlags(fs, []string{"down", "-steps", "2", "-dsn", "from-flag"})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if !reflect.DeepEqual(positional, []string{"down"}) || *steps != 2 || *dsn != "from-flag" {
+		t.Fatalf("unexpected parse: %v steps=%d dsn=%q", positional, *steps, *dsn)
+	}
+}
+
+func TestSeedRejectsInvalidFixturesBeforeConnecting(t *testing.T) {
+	t.Setenv("POSTGRES_DSN", "")
+	path := filepath.Join(t.TempDir(), "fixtures.json")
+	if err := os.WriteFile(path, []byte(`{"users":[],"tasks":[{"id":1,"title":"T","status":"pending","userId":7}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCommand(t, "seed", path)
+	if code != exitFailure || !strings.Contains(stderr, "tasks[0].userId") {
+		t.Fatalf("expected a fixture error for tasks[0].userId, got %d stderr=%s", code, stderr)
+	}
+}
+
+func TestWriteExport(t *testing.T) {
+	ds := newDemoDataStore(t)
+	format, _ := exportFormatByName("csv")
+	var out bytes.Buffer
+
+	count, err := writeExport(context.Background(), ds, "tasks", "completed", "", newRowWriter(format, &out))
+	if err != nil {
+		t.Fatalf("writeExport: %v", err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if count != 1 || len(records) != 2 || !reflect.DeepEqual(records[0], taskExportColumns) || records[1][3] != "completed" {
+		t.Fatalf("expected the header and the completed task, got %d %v", count, records)
+	}
+}
+
+func TestReadImportFile(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "users.csv")
+	if err := os.WriteFile(csvPath, []byte("name,email,role\nDana,dana@example.com,developer\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := readImportFile(csvPath, "users")
+	if err != nil {
+		t.Fatalf("readImportFile: %v", err)
+	}
+	if len(req.Users) != 1 || req.Users[0].Email != "dana@example.com" {
+		t.Fatalf("unexpected import request: %+v", req)
+	}
+	if _, err := readImportFile(csvPath, ""); err == nil {
+		t.Fatal("expected a CSV file without -kind to be rejected")
+	}
+}
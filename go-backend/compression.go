@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressionMinBytes is the default HTTPConfig.CompressionMinBytes.
+const defaultCompressionMinBytes = 1024
+
+// Content codings the server can produce, in order of preference.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+var (
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+	// HTTP's "deflate" coding is the zlib format (RFC 9110, section 8.4.1.2),
+	// not a raw deflate stream.
+	zlibWriters = sync.Pool{New: func() any { return zlib.NewWriter(io.Discard) }}
+)
+
+// compressor is a pooled gzip or zlib writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressionMiddleware compresses responses of at least the configured size
+// with the best coding the client accepts. Streaming routes are left alone,
+// since compressors hold back bytes the client is waiting for.
+func (s *Server) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		minBytes := s.settings.Load().compressionMinBytes
+		if minBytes <= 0 || s.routeStreams(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding, minBytes: minBytes}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header by
+// quality, preferring gzip on ties, or returns "" if the client accepts
+// neither.
+func negotiateEncoding(header string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		qualities[coding] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, coding := range []string{encodingGzip, encodingDeflate} {
+		q, ok := qualities[coding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = coding, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the start of a response until it has minBytes,
+// then compresses it unless it is already encoded or of a type that does not
+// compress. Smaller responses are sent as they are.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+
+	status  int
+	buf     bytes.Buffer
+	decided bool
+	encoder compressor
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	// Informational responses are sent at once and do not end the headers.
+	if status >= 100 && status < 200 {
+		cw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	cw.status = status
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.decided {
+		cw.buf.Write(p)
+		if cw.buf.Len() < cw.minBytes {
+			return len(p), nil
+		}
+		if err := cw.start(cw.compressible()); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+// Flush sends what is held back, uncompressed if the size is not yet known
+// to be worth it, and flushes the connection.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if err := cw.start(false); err != nil {
+			return
+		}
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Flush()
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// compressible reports whether the held-back response should be compressed.
+func (cw *compressWriter) compressible() bool {
+	header := cw.Header()
+	if header.Get("Content-Encoding") != "" || !bodyAllowed(cw.status) {
+		return false
+	}
+	// Without a Content-Type, net/http sniffs the first bytes, which it
+	// cannot do once they are compressed.
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && compressibleType(mediaType)
+}
+
+// start sends the headers and the held-back bytes, compressed or not.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+	header := cw.Header()
+	// Encoded bytes differ from the identity ones, so a strong validator
+	// would be wrong; conditional GETs still match weakly. ETags are weakened
+	// whether or not this response ends up compressed, so a 304 carries the
+	// same validator as the 200 it revalidates.
+	if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		header.Set("ETag", "W/"+etag)
+	}
+	if compress {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length")
+		cw.encoder = acquireCompressor(cw.encoding, cw.ResponseWriter)
+	}
+	if cw.status != 0 {
+		cw.ResponseWriter.WriteHeader(cw.status)
+	}
+	if cw.buf.Len() == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(cw.buf.Bytes())
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf.Bytes())
+	}
+	cw.buf.Reset()
+	return err
+}
+
+// close ends the response: it sends a response that stayed under minBytes as
+// it is, or finishes the compressed stream.
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		_ = cw.start(false)
+	}
+	if cw.encoder != nil {
+		_ = cw.encoder.Close()
+		releaseCompressor(cw.encoding, cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+func acquireCompressor(encoding string, w io.Writer) compressor {
+	var c compressor
+	if encoding == encodingGzip {
+		c = gzipWriters.Get().(*gzip.Writer)
+	} else {
+		c = zlibWriters.Get().(*zlib.Writer)
+	}
+	c.Reset(w)
+	return c
+}
+
+func releaseCompressor(encoding string, c compressor) {
+	c.Reset(io.Discard)
+	if encoding == encodingGzip {
+		gzipWriters.Put(c)
+	} else {
+		zlibWriters.Put(c)
+	}
+}
+
+// bodyAllowed reports whether responses with status may carry a body.
+func bodyAllowed(status int) bool {
+	return status != http.StatusNoContent && status != http.StatusNotModified && status >= 200
+}
+
+// compressibleType reports whether a media type is worth compressing: text
+// and structured text such as JSON, but not images, audio, video or archives,
+// which are compressed already.
+func compressibleType(mediaType string) bool {
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/problem+json", "application/x-ndjson",
+		"application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newCompressionTestServer compresses responses of at least minBytes.
+func newCompressionTestServer(t *testing.T, minBytes int) *Server {
+	t.Helper()
+	s := newTestServer(t)
+	s.updateSettings(func(settings *serverSettings) { settings.compressionMinBytes = minBytes })
+	return s
+}
+
+// variesByEncoding reports whether res lists Accept-Encoding in Vary.
+func variesByEncoding(res *httptest.ResponseRecorder) bool {
+	return strings.Contains(strings.Join(res.Header().Values("Vary"), ","), "Accept-Encoding")
+}
+
+func TestCompressionEncodesLargeResponses(t *testing.T) {
+	h := newCompressionTestServer(t, 64).Handler()
+
+	testCases := []struct {
+		acceptEncoding string
+		want           string
+		decode         func(io.Reader) (io.Reader, error)
+	}{
+		{"gzip, deflate", encodingGzip, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{"deflate, gzip;q=0.5", encodingDeflate, func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) }},
+		{"br, *", encodingGzip, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			res := performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", map[string]string{"Accept-Encoding": tc.acceptEncoding})
+			if res.Code != http.StatusOK || res.Header().Get("Content-Encoding") != tc.want {
+				t.Fatalf("expected a %s-encoded 200, got %d %q", tc.want, res.Code, res.Header().Get("Content-Encoding"))
+			}
+			if !variesByEncoding(res) {
+				t.Fatalf("expected Vary: Accept-Encoding, got %q", res.Header().Values("Vary"))
+			}
+			reader, err := tc.decode(res.Body)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			body, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("read: %v", err)
+			}
+			var response TasksResponse
+			decodeJSONResponse(t, body, &response)
+			if response.Count != 3 {
+				t.Fatalf("expected 3 tasks, got %+v", response)
+			}
+		})
+	}
+}
+
+func TestCompressionSkipsSmallAndUnacceptedResponses(t *testing.T) {
+	h := newCompressionTestServer(t, 4096).Handler()
+	res := performRequestWithHeaders(h, http.MethodGet, "/api/users/1", "", map[string]string{"Accept-Encoding": "gzip"})
+	if res.Header().Get("Content-Encoding") != "" || !strings.Contains(res.Body.String(), "John Doe") {
+		t.Fatalf("expected a small response to be sent as is, got %q %s", res.Header().Get("Content-Encoding"), res.Body.String())
+	}
+	if !variesByEncoding(res) {
+		t.Fatalf("expected Vary on an uncompressed response too, got %q", res.Header().Values("Vary"))
+	}
+
+	h = newCompressionTestServer(t, 64).Handler()
+	for _, acceptEncoding := range []string{"", "identity", "gzip;q=0, deflate;q=0", "br"} {
+		res := performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", map[string]string{"Accept-Encoding": acceptEncoding})
+		if res.Header().Get("Content-Encoding") != "" {
+			t.Fatalf("Accept-Encoding %q: expected no compression, got %q", acceptEncoding, res.Header().Get("Content-Encoding"))
+		}
+	}
+
+	h = newCompressionTestServer(t, 0).Handler()
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", map[string]string{"Accept-Encoding": "gzip"})
+	if res.Header().Get("Content-Encoding") != "" || variesByEncoding(res) {
+		t.Fatal("expected compression to be disabled at 0")
+	}
+}
+
+func TestCompressionSkipsCompressedTypesAndStreams(t *testing.T) {
+	s := newCompressionTestServer(t, 16)
+	png := s.compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write([]byte(strings.Repeat("x", 64)))
+	}))
+	res := performRequestWithHeaders(png, http.MethodGet, "/logo.png", "", map[string]string{"Accept-Encoding": "gzip"})
+	if res.Header().Get("Content-Encoding") != "" || res.Body.Len() != 64 {
+		t.Fatalf("expected an image to be sent as is, got %q", res.Header().Get("Content-Encoding"))
+	}
+
+	stream := s.compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(*httptest.ResponseRecorder); !ok {
+			t.Errorf("expected a streaming route to get the writer unwrapped, got %T", w)
+		}
+	}))
+	res = performRequestWithHeaders(stream, http.MethodGet, "/api/events", "", map[string]string{"Accept-Encoding": "gzip"})
+	if variesByEncoding(res) {
+		t.Fatal("expected no Vary on a stream")
+	}
+}
+
+func TestCompressionWeakensETags(t *testing.T) {
+	h := newCompressionTestServer(t, 64).Handler()
+	gzipped := map[string]string{"Accept-Encoding": "gzip"}
+
+	res := performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", gzipped)
+	etag := res.Header().Get("ETag")
+	if !strings.HasPrefix(etag, `W/"`) {
+		t.Fatalf("expected a weak ETag on a compressed response, got %q", etag)
+	}
+
+	gzipped["If-None-Match"] = etag
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", gzipped)
+	if res.Code != http.StatusNotModified || res.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected an unencoded 304, got %d %q", res.Code, res.Header().Get("Content-Encoding"))
+	}
+	if got := res.Header().Get("ETag"); got != etag {
+		t.Fatalf("expected the 304 to carry the 200's ETag %q, got %q", etag, got)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	testCases := map[string]string{
+		"":                          "",
+		"gzip":                      encodingGzip,
+		"deflate":                   encodingDeflate,
+		"GZIP;q=0.8, deflate;q=0.9": encodingDeflate,
+		"gzip;q=0, *":               encodingDeflate,
+		"*;q=0":                     "",
+		"gzip;q=bad, deflate":       encodingDeflate,
+		"zstd, br":                  "",
+	}
+	for header, want := range testCases {
+		if got := negotiateEncoding(header); got != want {
+			t.Fatalf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
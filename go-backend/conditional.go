@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// writeCollection writes payload like writeJSON, with a strong ETag computed
+// from the encoded body and, if lastModified is not zero, a Last-Modified
+// header. A conditional GET or HEAD the response would satisfy gets 304 Not
+// Modified without a body instead.
+//
+// Last-Modified has one-second precision, so a change later in the same
+// second as lastModified would not make it newer. Until that second is over
+// the header is neither sent nor honored, and the ETag alone validates.
+func (s *Server) writeCollection(w http.ResponseWriter, r *http.Request, payload any, lastModified time.Time) {
+	if !lastModified.Truncate(time.Second).Before(s.now().Truncate(time.Second)) {
+		lastModified = time.Time{}
+	}
+
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(payload); err != nil {
+		s.logger.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	if !lastModified.IsZero() {
+		header.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	// Responses depend on credentials and the workspace: browsers must
+	// revalidate them, and shared caches must not keep them.
+	header.Set("Cache-Control", "private, no-cache")
+
+	if notModified(r, etag, lastModified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(body.Bytes())
+}
+
+// notModified reports whether the request's preconditions match the current
+// representation. If-None-Match takes precedence over If-Modified-Since, as
+// RFC 9110 requires.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		return etagListMatches(match, etag)
+	}
+	since := r.Header.Get("If-Modified-Since")
+	if since == "" || lastModified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(since)
+	if err != nil {
+		return false
+	}
+	// Last-Modified has one-second precision.
+	return !lastModified.Truncate(time.Second).After(t)
+}
+
+// etagListMatches reports whether an If-None-Match list names etag, using the
+// weak comparison conditional GETs call for.
+func etagListMatches(list, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// latestTaskChange returns when the most recent of tasks last changed, or the
+// zero time if none has history.
+func latestTaskChange(tasks []Task) time.Time {
+	var latest time.Time
+	for _, task := range tasks {
+		if task.LastChange != nil && task.LastChange.ChangedAt.After(latest) {
+			latest = task.LastChange.ChangedAt
+		}
+	}
+	return latest
+}
+
+// latestHistoryChange returns when the most recent of history was made.
+func latestHistoryChange(history []TaskHistoryItem) time.Time {
+	var latest time.Time
+	for _, item := range history {
+		if item.ChangedAt.After(latest) {
+			latest = item.ChangedAt
+		}
+	}
+	return latest
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCollectionsAnswerIfNoneMatch(t *testing.T) {
+	h := newTestServer(t).Handler()
+
+	for _, path := range []string{"/api/users", "/api/tasks", "/api/tasks?status=pending", "/api/tasks/1/history"} {
+		res := performRequest(h, http.MethodGet, path, "")
+		etag := res.Header().Get("ETag")
+		if res.Code != http.StatusOK || etag == "" {
+			t.Fatalf("%s: expected 200 with an ETag, got %d %q", path, res.Code, etag)
+		}
+
+		for _, method := range []string{http.MethodGet, http.MethodHead} {
+			for _, match := range []string{etag, `"other", W/` + etag, "*"} {
+				res := performRequestWithHeaders(h, method, path, "", map[string]string{"If-None-Match": match})
+				if res.Code != http.StatusNotModified || res.Body.Len() != 0 {
+					t.Fatalf("%s %s If-None-Match %s: expected an empty 304, got %d %s", method, path, match, res.Code, res.Body.String())
+				}
+				if res.Header().Get("ETag") != etag {
+					t.Fatalf("%s: expected the 304 to repeat the ETag, got %q", path, res.Header().Get("ETag"))
+				}
+			}
+		}
+	}
+}
+
+func TestCollectionETagChangesWithContent(t *testing.T) {
+	h := newTestServer(t).Handler()
+	etag := performRequest(h, http.MethodGet, "/api/tasks", "").Header().Get("ETag")
+
+	res := performRequest(h, http.MethodPut, "/api/tasks/1", `{"title":"Renamed","status":"pending","userId":1}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", res.Code, res.Body.String())
+	}
+
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", map[string]string{"If-None-Match": etag})
+	if res.Code != http.StatusOK || res.Header().Get("ETag") == etag {
+		t.Fatalf("expected a new representation after the update, got %d with ETag %q", res.Code, res.Header().Get("ETag"))
+	}
+}
+
+func TestTasksAnswerIfModifiedSince(t *testing.T) {
+	s := newTestServer(t)
+	s.now = func() time.Time { return time.Now().Add(time.Second) }
+	h := s.Handler()
+	res := performRequest(h, http.MethodPut, "/api/tasks/1", `{"title":"Renamed","status":"pending","userId":1}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", res.Code, res.Body.String())
+	}
+
+	res = performRequest(h, http.MethodGet, "/api/tasks", "")
+	lastModified, err := http.ParseTime(res.Header().Get("Last-Modified"))
+	if err != nil {
+		t.Fatalf("expected a Last-Modified header, got %q", res.Header().Get("Last-Modified"))
+	}
+	if got := performRequest(h, http.MethodGet, "/api/tasks?status=pending", "").Header().Get("Last-Modified"); got != "" {
+		t.Fatalf("expected no Last-Modified on a filtered list, got %q", got)
+	}
+
+	testCases := []struct {
+		name    string
+		headers map[string]string
+		want    int
+	}{
+		{"unchanged since", map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"changed since", map[string]string{"If-Modified-Since": lastModified.Add(-time.Second).Format(http.TimeFormat)}, http.StatusOK},
+		{"invalid date", map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"If-None-Match wins", map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat), "If-None-Match": `"stale"`}, http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if res := performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", tc.headers); res.Code != tc.want {
+				t.Fatalf("expected status %d, got %d", tc.want, res.Code)
+			}
+		})
+	}
+}
+
+func TestTasksOmitLastModifiedWithinTheChangedSecond(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+	res := performRequest(h, http.MethodPut, "/api/tasks/1", `{"title":"Renamed","status":"pending","userId":1}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("update failed: %d %s", res.Code, res.Body.String())
+	}
+	task, _, err := s.dataStore.GetTaskByID(context.Background(), 1)
+	if err != nil || task.LastChange == nil {
+		t.Fatalf("expected task 1 to have changed, got %+v, %v", task, err)
+	}
+	changedAt := task.LastChange.ChangedAt
+
+	// Another change could still land in this second, so a date covering it
+	// must not produce 304.
+	s.now = func() time.Time { return changedAt.Truncate(time.Second).Add(999 * time.Millisecond) }
+	headers := map[string]string{"If-Modified-Since": changedAt.Add(time.Hour).Format(http.TimeFormat)}
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", headers)
+	if res.Code != http.StatusOK || res.Header().Get("Last-Modified") != "" || res.Header().Get("ETag") == "" {
+		t.Fatalf("expected 200 with only an ETag, got %d %v", res.Code, res.Header())
+	}
+
+	s.now = func() time.Time { return changedAt.Truncate(time.Second).Add(time.Second) }
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", headers)
+	if res.Code != http.StatusNotModified || res.Header().Get("Last-Modified") != changedAt.UTC().Format(http.TimeFormat) {
+		t.Fatalf("expected 304 with Last-Modified once the second is over, got %d %v", res.Code, res.Header())
+	}
+}
@@ -0,0 +1,622 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config sources, lowest precedence first.
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	sourceFlag    = "flag"
+)
+
+const redactedValue = "xxxxx"
+
+// Config is the process configuration. loadConfig layers built-in defaults, a
+// YAML (or JSON) config file, environment variables and command-line flags,
+// each overriding the ones before it.
+type Config struct {
+	HTTP      HTTPConfig
+	Database  DatabaseConfig
+	Limits    Limits
+	Cache     CacheConfig
+	RateLimit RateLimitConfig
+	Log       LogConfig
+	Tracing   TracingConfig
+	Seed      SeedConfig
+
+	ErrorFormat ErrorFormat
+	Auth        AuthConfig
+	// PolicyFile turns on authorization even without authentication.
+	PolicyFile string
+	Policy     Policy
+	CORS       CORSConfig
+
+	// raw holds the auth and CORS settings by environment variable name; they
+	// are parsed together by authConfigFromEnv and corsConfigFromEnv.
+	raw map[string]string
+	// sources records the layer each setting's value came from, by key.
+	sources map[string]string
+}
+
+// HTTPConfig configures the listener and long-lived connections.
+type HTTPConfig struct {
+	Port              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	DrainDelay        time.Duration
+	ReadinessTimeout  time.Duration
+	EventHeartbeat    time.Duration
+	WSPingInterval    time.Duration
+	// CompressionMinBytes is the smallest response body compressed; 0
+	// disables compression.
+	CompressionMinBytes int
+}
+
+func defaultHTTPConfig() HTTPConfig {
+	return HTTPConfig{
+		Port:                defaultPort,
+		ReadHeaderTimeout:   5 * time.Second,
+		ReadTimeout:         10 * time.Second,
+		WriteTimeout:        15 * time.Second,
+		IdleTimeout:         60 * time.Second,
+		ShutdownTimeout:     10 * time.Second,
+		ReadinessTimeout:    readinessCheckTimeout,
+		EventHeartbeat:      defaultEventHeartbeat,
+		WSPingInterval:      wsPingInterval,
+		CompressionMinBytes: defaultCompressionMinBytes,
+	}
+}
+
+// DatabaseConfig configures the PostgreSQL connection pool and how long
+// operations may take.
+type DatabaseConfig struct {
+	DSN                  string
+	MaxOpenConns         int
+	MaxIdleConns         int
+	ConnMaxLifetime      time.Duration
+	ConnMaxIdleTime      time.Duration
+	PingRetries          int
+	OperationTimeout     time.Duration
+	ExportTimeout        time.Duration
+	BatchTimeout         time.Duration
+	ImportTimeout        time.Duration
+	MigrationTimeout     time.Duration
+	ListenerMinReconnect time.Duration
+	ListenerMaxReconnect time.Duration
+}
+
+func defaultDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		MaxOpenConns:         20,
+		MaxIdleConns:         5,
+		ConnMaxLifetime:      30 * time.Minute,
+		ConnMaxIdleTime:      5 * time.Minute,
+		PingRetries:          dbPingRetries,
+		OperationTimeout:     dbOperationTimeout,
+		ExportTimeout:        dbExportTimeout,
+		BatchTimeout:         dbBatchTimeout,
+		ImportTimeout:        dbImportTimeout,
+		MigrationTimeout:     dbMigrationTimeout,
+		ListenerMinReconnect: listenerMinReconnect,
+		ListenerMaxReconnect: listenerMaxReconnect,
+	}
+}
+
+// Limits cap the size of what a single request may carry.
+type Limits struct {
+	MaxBodyBytes       int64
+	MaxImportBodyBytes int64
+	MaxImportRows      int
+	MaxBulkItems       int
+}
+
+func defaultLimits() Limits {
+	return Limits{
+		MaxBodyBytes:       maxRequestBodyBytes,
+		MaxImportBodyBytes: maxImportBodyBytes,
+		MaxImportRows:      maxImportRows,
+		MaxBulkItems:       maxBulkItems,
+	}
+}
+
+// CacheConfig configures the Store read cache; a zero TTL disables it.
+type CacheConfig struct {
+	TTL time.Duration
+}
+
+// LogConfig selects the log format (text or json) and minimum level.
+type LogConfig struct {
+	Format string
+	Level  slog.Level
+}
+
+// TracingConfig selects the trace exporter; File is required for "file".
+type TracingConfig struct {
+	Exporter string
+	File     string
+}
+
+// SeedConfig names the fixtures serve seeds on startup; empty seeds nothing.
+type SeedConfig struct {
+	Fixtures string
+	Mode     SeedMode
+}
+
+// ConfigError lists every problem found while loading configuration.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// setting is one configuration value: its key in the config file, the
+// environment variable and flag that override it, and where it is stored.
+type setting struct {
+	key   string
+	env   string
+	flag  string
+	usage string
+	value configValue
+	// redact hides secrets when the effective config is printed.
+	redact func(string) string
+	// restart marks settings read once at startup, which Reload cannot apply.
+	restart bool
+}
+
+// display is the printable value of s, secrets redacted.
+func (s setting) display() string {
+	value := s.value.String()
+	if s.redact != nil && value != "" {
+		return s.redact(value)
+	}
+	return value
+}
+
+// section is the config file section of s, which also groups its flags.
+func (s setting) section() string {
+	section, _, _ := strings.Cut(s.key, ".")
+	return section
+}
+
+// settings binds every setting to its field in c. Auth and CORS settings are
+// kept raw in c.raw.
+func (c *Config) settings() []setting {
+	if c.raw == nil {
+		c.raw = make(map[string]string)
+	}
+	raw := func(env string) configValue { return rawValue{m: c.raw, key: env} }
+
+	return []setting{
+		{key: "http.port", restart: true, env: "PORT", flag: "port", usage: "HTTP port", value: portValue(&c.HTTP.Port)},
+		{key: "http.readHeaderTimeout", restart: true, env: "HTTP_READ_HEADER_TIMEOUT", flag: "read-header-timeout", usage: "time to read request headers", value: durationValue(&c.HTTP.ReadHeaderTimeout, true)},
+		{key: "http.readTimeout", restart: true, env: "HTTP_READ_TIMEOUT", flag: "read-timeout", usage: "time to read a whole request", value: durationValue(&c.HTTP.ReadTimeout, true)},
+		{key: "http.writeTimeout", restart: true, env: "HTTP_WRITE_TIMEOUT", flag: "write-timeout", usage: "time to write a response; event streams are exempt", value: durationValue(&c.HTTP.WriteTimeout, true)},
+		{key: "http.idleTimeout", restart: true, env: "HTTP_IDLE_TIMEOUT", flag: "idle-timeout", usage: "how long idle keep-alive connections stay open", value: durationValue(&c.HTTP.IdleTimeout, true)},
+		{key: "http.shutdownTimeout", env: "HTTP_SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "time in-flight requests get to finish on shutdown", value: durationValue(&c.HTTP.ShutdownTimeout, true)},
+		{key: "http.drainDelay", env: "SHUTDOWN_DRAIN_DELAY", flag: "drain-delay", usage: "wait before draining connections on shutdown", value: durationValue(&c.HTTP.DrainDelay, false)},
+		{key: "http.readinessTimeout", env: "READINESS_CHECK_TIMEOUT", flag: "readiness-timeout", usage: "time each readiness check may take", value: durationValue(&c.HTTP.ReadinessTimeout, true)},
+		{key: "http.eventHeartbeat", env: "EVENT_HEARTBEAT", flag: "event-heartbeat", usage: "interval between SSE heartbeat comments", value: durationValue(&c.HTTP.EventHeartbeat, true)},
+		{key: "http.wsPingInterval", env: "WS_PING_INTERVAL", flag: "ws-ping-interval", usage: "interval between WebSocket pings", value: durationValue(&c.HTTP.WSPingInterval, true)},
+		{key: "http.compressionMinBytes", env: "HTTP_COMPRESSION_MIN_BYTES", flag: "compression-min-bytes", usage: "smallest response body sent gzip or deflate encoded; 0 disables compression", value: intValue(&c.HTTP.CompressionMinBytes, 0)},
+
+		{key: "database.dsn", restart: true, env: "POSTGRES_DSN", flag: "dsn", usage: "PostgreSQL connection string", value: stringValue(&c.Database.DSN), redact: redactDSN},
+		{key: "database.maxOpenConns", restart: true, env: "DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "connection pool size", value: intValue(&c.Database.MaxOpenConns, 1)},
+		{key: "database.maxIdleConns", restart: true, env: "DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "idle connections kept in the pool", value: intValue(&c.Database.MaxIdleConns, 0)},
+		{key: "database.connMaxLifetime", restart: true, env: "DB_CONN_MAX_LIFETIME", flag: "db-conn-max-lifetime", usage: "age after which connections are replaced", value: durationValue(&c.Database.ConnMaxLifetime, true)},
+		{key: "database.connMaxIdleTime", restart: true, env: "DB_CONN_MAX_IDLE_TIME", flag: "db-conn-max-idle-time", usage: "idle time after which connections are closed", value: durationValue(&c.Database.ConnMaxIdleTime, true)},
+		{key: "database.pingRetries", restart: true, env: "DB_PING_RETRIES", flag: "db-ping-retries", usage: "connection attempts, a second apart, before giving up", value: intValue(&c.Database.PingRetries, 1)},
+		{key: "database.operationTimeout", restart: true, env: "DB_OPERATION_TIMEOUT", flag: "db-operation-timeout", usage: "time a single query or write may take", value: durationValue(&c.Database.OperationTimeout, true)},
+		{key: "database.exportTimeout", restart: true, env: "DB_EXPORT_TIMEOUT", flag: "db-export-timeout", usage: "time a streamed export may take", value: durationValue(&c.Database.ExportTimeout, true)},
+		{key: "database.batchTimeout", restart: true, env: "DB_BATCH_TIMEOUT", flag: "db-batch-timeout", usage: "time a bulk task request may take", value: durationValue(&c.Database.BatchTimeout, true)},
+		{key: "database.importTimeout", restart: true, env: "DB_IMPORT_TIMEOUT", flag: "db-import-timeout", usage: "time an import or seed may take", value: durationValue(&c.Database.ImportTimeout, true)},
+		{key: "database.migrationTimeout", restart: true, env: "DB_MIGRATION_TIMEOUT", flag: "db-migration-timeout", usage: "time a migration run may take", value: durationValue(&c.Database.MigrationTimeout, true)},
+		{key: "database.listenerMinReconnect", restart: true, env: "DB_LISTENER_MIN_RECONNECT", flag: "db-listener-min-reconnect", usage: "first change listener reconnect delay", value: durationValue(&c.Database.ListenerMinReconnect, true)},
+		{key: "database.listenerMaxReconnect", restart: true, env: "DB_LISTENER_MAX_RECONNECT", flag: "db-listener-max-reconnect", usage: "longest change listener reconnect delay", value: durationValue(&c.Database.ListenerMaxReconnect, true)},
+
+		{key: "limits.maxBodyBytes", env: "MAX_REQUEST_BODY_BYTES", flag: "max-body-bytes", usage: "largest request body", value: intValue(&c.Limits.MaxBodyBytes, 1)},
+		{key: "limits.maxImportBodyBytes", env: "MAX_IMPORT_BODY_BYTES", flag: "max-import-body-bytes", usage: "largest /api/import body", value: intValue(&c.Limits.MaxImportBodyBytes, 1)},
+		{key: "limits.maxImportRows", env: "MAX_IMPORT_ROWS", flag: "max-import-rows", usage: "most rows one import may carry", value: intValue(&c.Limits.MaxImportRows, 1)},
+		{key: "limits.maxBulkItems", env: "MAX_BULK_ITEMS", flag: "max-bulk-items", usage: "most writes one bulk request may expand to", value: intValue(&c.Limits.MaxBulkItems, 1)},
+
+		{key: "rateLimit.enabled", env: "RATE_LIMIT_ENABLED", flag: "rate-limit", usage: "limit /api/* requests per client and failed authentications per IP (off by default)", value: parsedValue(&c.RateLimit.Enabled, parseBool)},
+		{key: "rateLimit.key", env: "RATE_LIMIT_KEY", flag: "rate-limit-key", usage: "principal, actor or ip", value: choiceValue(&c.RateLimit.Key, rateLimitKeyPrincipal, rateLimitKeyActor, rateLimitKeyIP)},
+		{key: "rateLimit.backend", restart: true, env: "RATE_LIMIT_BACKEND", flag: "rate-limit-backend", usage: "memory (per replica) or postgres (shared)", value: choiceValue(&c.RateLimit.Backend, rateLimitBackendMemory, rateLimitBackendPostgres)},
+		{key: "rateLimit.read", env: "RATE_LIMIT_READ", flag: "rate-limit-read", usage: "GET and HEAD requests per client, as limit/period", value: parsedValue(&c.RateLimit.Read, parseRate)},
+		{key: "rateLimit.write", env: "RATE_LIMIT_WRITE", flag: "rate-limit-write", usage: "other requests per client, as limit/period", value: parsedValue(&c.RateLimit.Write, parseRate)},
+		{key: "rateLimit.routes", env: "RATE_LIMIT_ROUTES", flag: "rate-limit-routes", usage: "route=limit/period overrides, comma-separated", value: parsedValue(&c.RateLimit.Routes, parseRouteRates)},
+		{key: "rateLimit.authFailures", env: "RATE_LIMIT_AUTH_FAILURES", flag: "rate-limit-auth-failures", usage: "failed authentications per IP address, as limit/period", value: parsedValue(&c.RateLimit.AuthFailures, parseRate)},
+		{key: "rateLimit.trustedProxies", env: "RATE_LIMIT_TRUSTED_PROXIES", flag: "rate-limit-trusted-proxies", usage: "proxy IPs and CIDR ranges whose X-Forwarded-For names the client, comma-separated", value: parsedValue(&c.RateLimit.TrustedProxies, parseTrustedProxies)},
+
+		{key: "cache.ttl", restart: true, env: "CACHE_TTL", flag: "cache-ttl", usage: "how long Store reads are cached at most; 0 disables the cache", value: durationValue(&c.Cache.TTL, false)},
+
+		{key: "log.format", restart: true, env: "LOG_FORMAT", flag: "log-format", usage: "text or json", value: choiceValue(&c.Log.Format, "text", "json")},
+		{key: "log.level", env: "LOG_LEVEL", flag: "log-level", usage: "debug, info, warn or error", value: parsedValue(&c.Log.Level, parseLogLevel)},
+		{key: "tracing.exporter", restart: true, env: "OTEL_TRACES_EXPORTER", flag: "traces-exporter", usage: "none, otlp, stdout or file", value: choiceValue(&c.Tracing.Exporter, tracesExporterNone, tracesExporterOTLP, tracesExporterStdout, tracesExporterFile)},
+		{key: "tracing.file", restart: true, env: "OTEL_TRACES_FILE", flag: "traces-file", usage: "file the file exporter appends spans to", value: stringValue(&c.Tracing.File)},
+
+		{key: "errors.format", env: "ERROR_FORMAT", flag: "error-format", usage: "problem or legacy", value: parsedValue(&c.ErrorFormat, parseErrorFormat)},
+		{key: "seed.fixtures", restart: true, env: "SEED_FIXTURES", flag: "seed", usage: "fixture set or file to seed on startup; empty seeds nothing", value: stringValue(&c.Seed.Fixtures)},
+		{key: "seed.mode", restart: true, env: "SEED_MODE", flag: "seed-mode", usage: "if-empty or upsert", value: parsedValue(&c.Seed.Mode, parseSeedMode)},
+
+		{key: "auth.apiKeys", env: "AUTH_API_KEYS", usage: "name:key pairs", value: raw("AUTH_API_KEYS"), redact: redactAPIKeys},
+		{key: "auth.delegatingKeys", env: "AUTH_DELEGATING_KEYS", usage: "API key names allowed to act for others", value: raw("AUTH_DELEGATING_KEYS")},
+		{key: "auth.jwtHS256Secret", env: "AUTH_JWT_HS256_SECRET", usage: "HMAC secret for HS256 tokens", value: raw("AUTH_JWT_HS256_SECRET"), redact: redactAll},
+		{key: "auth.jwksFile", env: "AUTH_JWT_JWKS_FILE", usage: "JWKS file with RS256 public keys", value: raw("AUTH_JWT_JWKS_FILE")},
+		{key: "auth.jwtIssuer", env: "AUTH_JWT_ISSUER", usage: "required token issuer", value: raw("AUTH_JWT_ISSUER")},
+		{key: "auth.jwtAudience", env: "AUTH_JWT_AUDIENCE", usage: "required token audience", value: raw("AUTH_JWT_AUDIENCE")},
+		{key: "auth.policyFile", env: "AUTH_POLICY_FILE", flag: "policy-file", usage: "authorization policy file", value: stringValue(&c.PolicyFile)},
+		{key: "cors.allowedOrigins", env: "CORS_ALLOWED_ORIGINS", usage: "allowed origins, comma-separated", value: raw("CORS_ALLOWED_ORIGINS")},
+		{key: "cors.allowCredentials", env: "CORS_ALLOW_CREDENTIALS", usage: "allow credentialed requests", value: raw("CORS_ALLOW_CREDENTIALS")},
+		{key: "cors.maxAge", env: "CORS_MAX_AGE", usage: "how long browsers may cache preflights", value: raw("CORS_MAX_AGE")},
+	}
+}
+
+// defaultConfig is the configuration with no file, environment or flags.
+func defaultConfig() Config {
+	return Config{
+		HTTP:        defaultHTTPConfig(),
+		Database:    defaultDatabaseConfig(),
+		Limits:      defaultLimits(),
+		Cache:       CacheConfig{TTL: defaultCacheTTL},
+		RateLimit:   defaultRateLimitConfig(),
+		Log:         LogConfig{Format: "text", Level: slog.LevelInfo},
+		Tracing:     TracingConfig{Exporter: tracesExporterNone},
+		Seed:        SeedConfig{Mode: SeedIfEmpty},
+		ErrorFormat: ErrorFormatProblem,
+		Policy:      DefaultPolicy(),
+		CORS:        DefaultCORSConfig(),
+	}
+}
+
+// loadConfig reads the file at path, if any, then the environment through
+// lookupEnv, then flags (by flag name), and validates the result. Every
+// problem is reported in one *ConfigError; the returned Config is still
+// usable for printing.
+func loadConfig(path string, lookupEnv func(string) (string, bool), flags map[string]string) (Config, error) {
+	cfg := defaultConfig()
+	cfg.sources = make(map[string]string)
+	settings := cfg.settings()
+
+	var problems []string
+	set := func(s setting, source, from, value string) {
+		if err := s.value.Set(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s (%s): %v", s.key, from, err))
+			return
+		}
+		cfg.sources[s.key] = source
+	}
+
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		known := make(map[string]bool, len(settings))
+		for _, s := range settings {
+			known[s.key] = true
+			if value, ok := values[s.key]; ok {
+				set(s, sourceFile, path, value)
+			}
+		}
+		for _, key := range sortedKeys(values) {
+			if !known[key] {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %q", path, key))
+			}
+		}
+	}
+	if lookupEnv != nil {
+		for _, s := range settings {
+			if value, ok := lookupEnv(s.env); ok && strings.TrimSpace(value) != "" {
+				set(s, sourceEnv, "env "+s.env, value)
+			}
+		}
+	}
+	for _, s := range settings {
+		if value, ok := flags[s.flag]; ok && s.flag != "" {
+			set(s, sourceFlag, "flag -"+s.flag, value)
+		}
+	}
+
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return cfg, &ConfigError{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// validate checks settings that depend on each other and parses the auth,
+// policy and CORS settings, which may read files.
+func (c *Config) validate() []string {
+	var problems []string
+	if c.Database.MaxIdleConns > c.Database.MaxOpenConns {
+		problems = append(problems, fmt.Sprintf("database.maxIdleConns (%d) is more than database.maxOpenConns (%d)", c.Database.MaxIdleConns, c.Database.MaxOpenConns))
+	}
+	if c.Database.ListenerMinReconnect > c.Database.ListenerMaxReconnect {
+		problems = append(problems, "database.listenerMinReconnect is longer than database.listenerMaxReconnect")
+	}
+	if c.Limits.MaxImportBodyBytes < c.Limits.MaxBodyBytes {
+		problems = append(problems, "limits.maxImportBodyBytes is smaller than limits.maxBodyBytes")
+	}
+	if c.HTTP.WSPingInterval >= wsPongWait {
+		problems = append(problems, fmt.Sprintf("http.wsPingInterval must be shorter than the %s pong wait", wsPongWait))
+	}
+	if c.Tracing.Exporter == tracesExporterFile && strings.TrimSpace(c.Tracing.File) == "" {
+		problems = append(problems, "tracing.file is required for the file exporter")
+	}
+
+	getenv := func(key string) string { return c.raw[key] }
+	var err error
+	if c.Auth, err = authConfigFromEnv(getenv); err != nil {
+		problems = append(problems, "auth: "+err.Error())
+	}
+	if c.Policy, err = loadPolicyFile(c.PolicyFile); err != nil {
+		problems = append(problems, "auth.policyFile: "+err.Error())
+	}
+	if c.CORS, err = corsConfigFromEnv(getenv); err != nil {
+		problems = append(problems, "cors: "+err.Error())
+	}
+	return problems
+}
+
+// configFileFormats are the config file extensions readConfigFile accepts.
+// JSON files are decoded as YAML, of which JSON is a subset.
+var configFileFormats = []string{".yaml", ".yml", ".json", ".toml"}
+
+// readConfigFile flattens a YAML, JSON or TOML file into dotted keys such as
+// "http.port". Lists become comma-separated values.
+func readConfigFile(path string) (map[string]string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if !containsString(configFileFormats, ext) {
+		return nil, fmt.Errorf("unsupported config file format %q: use %s", ext, strings.Join(configFileFormats, ", "))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+	decode := yaml.Unmarshal
+	if ext == ".toml" {
+		decode = toml.Unmarshal
+	}
+	var document map[string]any
+	if err := decode(data, &document); err != nil {
+		return nil, fmt.Errorf("decode config file %s: %w", path, err)
+	}
+
+	values := make(map[string]string)
+	var flatten func(prefix string, node any)
+	flatten = func(prefix string, node any) {
+		switch node := node.(type) {
+		case map[string]any:
+			for key, child := range node {
+				flatten(prefix+key+".", child)
+			}
+		case []any:
+			items := make([]string, len(node))
+			for i, item := range node {
+				items[i] = fmt.Sprint(item)
+			}
+			values[strings.TrimSuffix(prefix, ".")] = strings.Join(items, ",")
+		case nil:
+			values[strings.TrimSuffix(prefix, ".")] = ""
+		default:
+			values[strings.TrimSuffix(prefix, ".")] = fmt.Sprint(node)
+		}
+	}
+	flatten("", document)
+	return values, nil
+}
+
+// Source returns the layer the setting with key came from.
+func (c Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return sourceDefault
+}
+
+// Print writes every setting with its effective value and source, secrets
+// redacted.
+func (c Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, s := range c.settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, s.display(), c.Source(s.key))
+	}
+	return tw.Flush()
+}
+
+// LogValue lets the effective config be logged as one redacted group.
+func (c Config) LogValue() slog.Value {
+	var attrs []slog.Attr
+	for _, s := range c.settings() {
+		attrs = append(attrs, slog.String(s.key, s.display()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// bindConfig registers -config and the flags of settings in sections
+// ("http", "database", ...), or of every setting when none are named, on fs.
+// The returned function loads the config once fs is parsed, with flags the
+// caller set taking precedence.
+func bindConfig(fs *flag.FlagSet, sections ...string) func() (Config, error) {
+	path := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML (.yaml, .yml), JSON (.json) or TOML (.toml) config file (env CONFIG_FILE)")
+	flagValues := make(map[string]*string)
+	for _, s := range (&Config{}).settings() {
+		if s.flag == "" || (len(sections) > 0 && !containsString(sections, s.section())) {
+			continue
+		}
+		flagValues[s.flag] = fs.String(s.flag, "", fmt.Sprintf("%s (env %s, config %s)", s.usage, s.env, s.key))
+	}
+
+	return func() (Config, error) {
+		flags := make(map[string]string)
+		fs.Visit(func(f *flag.Flag) {
+			if value, ok := flagValues[f.Name]; ok {
+				flags[f.Name] = *value
+			}
+		})
+		return loadConfig(strings.TrimSpace(*path), os.LookupEnv, flags)
+	}
+}
+
+// configFailed reports every configuration problem; bad configuration is a
+// usage error.
+func configFailed(stderr io.Writer, err error) int {
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		fmt.Fprintf(stderr, "invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	fmt.Fprintln(stderr, "invalid configuration:")
+	for _, problem := range configErr.Problems {
+		fmt.Fprintf(stderr, "  %s\n", problem)
+	}
+	return exitUsage
+}
+
+// configValue is where a setting is stored; Set parses a value from any layer.
+type configValue interface {
+	Set(value string) error
+	String() string
+}
+
+type funcValue struct {
+	set    func(string) error
+	format func() string
+}
+
+func (v funcValue) Set(value string) error { return v.set(strings.TrimSpace(value)) }
+func (v funcValue) String() string         { return v.format() }
+
+func parsedValue[T any](p *T, parse func(string) (T, error)) configValue {
+	return funcValue{
+		set: func(value string) error {
+			parsed, err := parse(value)
+			if err != nil {
+				return err
+			}
+			*p = parsed
+			return nil
+		},
+		format: func() string { return fmt.Sprint(*p) },
+	}
+}
+
+func stringValue(p *string) configValue {
+	return parsedValue(p, func(value string) (string, error) { return value, nil })
+}
+
+func choiceValue(p *string, choices ...string) configValue {
+	return parsedValue(p, func(value string) (string, error) {
+		value = strings.ToLower(value)
+		if !containsString(choices, value) {
+			return "", fmt.Errorf("%q is not one of %s", value, strings.Join(choices, ", "))
+		}
+		return value, nil
+	})
+}
+
+func portValue(p *string) configValue {
+	return parsedValue(p, func(value string) (string, error) {
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			return "", fmt.Errorf("invalid port %q", value)
+		}
+		return value, nil
+	})
+}
+
+// durationValue parses a Go duration; only drain-style delays may be zero.
+func durationValue(p *time.Duration, positive bool) configValue {
+	return parsedValue(p, func(value string) (time.Duration, error) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", value)
+		}
+		if d < 0 || (positive && d == 0) {
+			return 0, fmt.Errorf("duration %s must be positive", value)
+		}
+		return d, nil
+	})
+}
+
+func intValue[T int | int64](p *T, min T) configValue {
+	return parsedValue(p, func(value string) (T, error) {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer %q", value)
+		}
+		if T(n) < min {
+			return 0, fmt.Errorf("%d is less than %d", n, min)
+		}
+		return T(n), nil
+	})
+}
+
+func parseBool(value string) (bool, error) {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid boolean %q", value)
+	}
+	return b, nil
+}
+
+// rawValue stores a setting in m under key, unparsed.
+type rawValue struct {
+	m   map[string]string
+	key string
+}
+
+func (v rawValue) Set(value string) error { v.m[v.key] = strings.TrimSpace(value); return nil }
+func (v rawValue) String() string         { return v.m[v.key] }
+
+func redactAll(string) string { return redactedValue }
+
+var dsnPasswordPattern = regexp.MustCompile(`(password=)('[^']*'|\S+)`)
+
+// redactDSN hides the password of a URL or key=value connection string.
+func redactDSN(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redactedValue)
+		}
+		if query := u.Query(); query.Has("password") {
+			query.Set("password", redactedValue)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+	return dsnPasswordPattern.ReplaceAllString(dsn, "${1}"+redactedValue)
+}
+
+// redactAPIKeys keeps the key names of AUTH_API_KEYS and hides the keys.
+func redactAPIKeys(value string) string {
+	entries := strings.Split(value, ",")
+	for i, entry := range entries {
+		name, _, _ := strings.Cut(entry, ":")
+		entries[i] = strings.TrimSpace(name) + ":" + redactedValue
+	}
+	return strings.Join(entries, ",")
+}
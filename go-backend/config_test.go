@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig("", nil, nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.HTTP != defaultHTTPConfig() || cfg.Database != defaultDatabaseConfig() || cfg.Limits != defaultLimits() {
+		t.Fatalf("expected the built-in defaults, got %+v", cfg)
+	}
+	if cfg.Seed.Mode != SeedIfEmpty || cfg.ErrorFormat != ErrorFormatProblem || cfg.Auth.Enabled() {
+		t.Fatalf("unexpected defaults: %+v", cfg)
+	}
+	if cfg.Source("http.port") != sourceDefault {
+		t.Fatalf("expected http.port from defaults, got %s", cfg.Source("http.port"))
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+http:
+  port: 9000
+  writeTimeout: 20s
+  readTimeout: 20s
+database:
+  maxOpenConns: 40
+cors:
+  allowedOrigins: [https://a.example, https://b.example]
+`)
+	env := map[string]string{
+		"HTTP_WRITE_TIMEOUT": "25s",
+		"HTTP_READ_TIMEOUT":  "25s",
+		"LOG_LEVEL":          "  ",
+	}
+	flags := map[string]string{"read-timeout": "30s"}
+
+	cfg, err := loadConfig(path, envLookup(env), flags)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.HTTP.Port != "9000" || cfg.HTTP.WriteTimeout != 25*time.Second || cfg.HTTP.ReadTimeout != 30*time.Second || cfg.Database.MaxOpenConns != 40 {
+		t.Fatalf("expected flags over env over file, got %+v %+v", cfg.HTTP, cfg.Database)
+	}
+	if !reflect.DeepEqual(cfg.CORS.AllowedOrigins, []string{"https://a.example", "https://b.example"}) {
+		t.Fatalf("expected origins from the file list, got %v", cfg.CORS.AllowedOrigins)
+	}
+	for key, want := range map[string]string{
+		"http.port":         sourceFile,
+		"http.writeTimeout": sourceEnv,
+		"http.readTimeout":  sourceFlag,
+		"log.level":         sourceDefault,
+	} {
+		if got := cfg.Source(key); got != want {
+			t.Fatalf("expected %s from %s, got %s", key, want, got)
+		}
+	}
+}
+
+func TestLoadConfigTOMLFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	body := `
+[http]
+port = 9000
+writeTimeout = "20s"
+readTimeout = "20s"
+
+[database]
+maxOpenConns = 40
+
+[cors]
+allowedOrigins = ["https://a.example", "https://b.example"]
+`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	env := map[string]string{"HTTP_WRITE_TIMEOUT": "25s"}
+	flags := map[string]string{"read-timeout": "30s"}
+
+	cfg, err := loadConfig(path, envLookup(env), flags)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.HTTP.Port != "9000" || cfg.HTTP.WriteTimeout != 25*time.Second || cfg.HTTP.ReadTimeout != 30*time.Second || cfg.Database.MaxOpenConns != 40 {
+		t.Fatalf("expected flags over env over the TOML file, got %+v %+v", cfg.HTTP, cfg.Database)
+	}
+	if !reflect.DeepEqual(cfg.CORS.AllowedOrigins, []string{"https://a.example", "https://b.example"}) {
+		t.Fatalf("expected origins from the TOML array, got %v", cfg.CORS.AllowedOrigins)
+	}
+	for key, want := range map[string]string{
+		"http.port":         sourceFile,
+		"http.writeTimeout": sourceEnv,
+		"http.readTimeout":  sourceFlag,
+	} {
+		if got := cfg.Source(key); got != want {
+			t.Fatalf("expected %s from %s, got %s", key, want, got)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("[http\nport = 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(path, envLookup(nil), nil); err == nil || !strings.Contains(err.Error(), "decode config file") {
+		t.Fatalf("expected a TOML syntax error, got %v", err)
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	path := writeConfigFile(t, `
+http:
+  port: 80000
+  timeouts: 5s
+database:
+  maxOpenConns: 2
+  maxIdleConns: 3
+`)
+	env := map[string]string{
+		"DB_OPERATION_TIMEOUT": "soon",
+		"AUTH_API_KEYS":        "missing-colon",
+		"OTEL_TRACES_EXPORTER": "file",
+	}
+	flags := map[string]string{"max-bulk-items": "0"}
+
+	_, err := loadConfig(path, envLookup(env), flags)
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("expected a *ConfigError, got %v", err)
+	}
+	for _, want := range []string{
+		"http.port (" + path + "): invalid port",
+		`unknown key "http.timeouts"`,
+		"database.operationTimeout (env DB_OPERATION_TIMEOUT): invalid duration",
+		"limits.maxBulkItems (flag -max-bulk-items)",
+		"database.maxIdleConns (3) is more than database.maxOpenConns (2)",
+		"tracing.file is required",
+		"auth: invalid AUTH_API_KEYS entry",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q among the problems, got %v", want, configErr.Problems)
+		}
+	}
+}
+
+func TestLoadConfigRejectsUnsupportedFileFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(path, []byte("[http]\nport = 8080\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadConfig(path, envLookup(nil), nil)
+	if err == nil || !strings.Contains(err.Error(), `unsupported config file format ".ini": use .yaml, .yml, .json, .toml`) {
+		t.Fatalf("expected the supported formats to be named, got %v", err)
+	}
+
+	path = filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"http": {"port": 9090}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path, envLookup(nil), nil)
+	if err != nil || cfg.HTTP.Port != "9090" {
+		t.Fatalf("expected a JSON config file to load, got %+v, %v", cfg.HTTP, err)
+	}
+}
+
+func TestConfigPrintRedactsSecrets(t *testing.T) {
+	env := map[string]string{
+		"POSTGRES_DSN":          "postgres://app:s3cret@db:5432/app?sslmode=disable",
+		"AUTH_API_KEYS":         "gateway:k3y-one,ci:k3y-two",
+		"AUTH_JWT_HS256_SECRET": "hmac-s3cret",
+	}
+	cfg, err := loadConfig("", envLookup(env), nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print: %v", err)
+	}
+	printed := out.String()
+	for _, secret := range []string{"s3cret", "k3y-one", "k3y-two"} {
+		if strings.Contains(printed, secret) {
+			t.Fatalf("expected %q to be redacted, got\n%s", secret, printed)
+		}
+	}
+	for _, want := range []string{"postgres://app:xxxxx@db:5432/app", "gateway:xxxxx,ci:xxxxx", "http.port"} {
+		if !strings.Contains(printed, want) {
+			t.Fatalf("expected %q in\n%s", want, printed)
+		}
+	}
+}
+
+func TestRedactDSN(t *testing.T) {
+	testCases := map[string]string{
+		"postgres://app:pw@db/app":                "postgres://app:xxxxx@db/app",
+		"postgres://app@db/app?password=pw":       "postgres://app@db/app?password=xxxxx",
+		"host=db user=app password=pw dbname=app": "host=db user=app password=xxxxx dbname=app",
+		"host=db password='p w' dbname=app":       "host=db password=xxxxx dbname=app",
+		"postgres://app@db/app?sslmode=disable":   "postgres://app@db/app?sslmode=disable",
+	}
+	for dsn, want := range testCases {
+		if got := redactDSN(dsn); got != want {
+			t.Fatalf("redactDSN(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+}
+
+func TestServerConfigureAppliesLimits(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Limits.MaxBodyBytes = 64
+	s := newTestServer(t)
+	if err := s.Configure(cfg); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+
+	body := `{"name":"` + strings.Repeat("a", 100) + `","email":"long@example.com","role":"developer"}`
+	res := performRequest(s.Handler(), http.MethodPost, "/api/users", body)
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status %d over the configured limit, got %d body=%s", http.StatusRequestEntityTooLarge, res.Code, res.Body.String())
+	}
+}
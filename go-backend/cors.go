@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultCORSMaxAge = 10 * time.Minute
+	corsAnyOrigin     = "*"
+)
+
+// corsAllowedHeaders are the request headers browsers may send cross-origin.
+var corsAllowedHeaders = []string{"Content-Type", "X-Actor", "Authorization", "X-API-Key", workspaceHeaderName, requestIDHeaderName, "If-None-Match", "If-Modified-Since"}
+
+// corsExposedHeaders are the response headers cross-origin scripts may read,
+// beyond the CORS-safelisted ones.
+var corsExposedHeaders = []string{"ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy", "Retry-After", requestIDHeaderName}
+
+// CORSConfig controls which browser origins may call the API.
+//
+// AllowedOrigins entries are "*", an exact origin such as
+// "https://app.example.com", or a wildcard subdomain such as
+// "https://*.example.com", which matches any subdomain but not the apex.
+type CORSConfig struct {
+	AllowedOrigins   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// DefaultCORSConfig allows any origin without credentials.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{AllowedOrigins: []string{corsAnyOrigin}, MaxAge: defaultCORSMaxAge}
+}
+
+// corsConfigFromEnv reads CORS_ALLOWED_ORIGINS (comma-separated),
+// CORS_ALLOW_CREDENTIALS and CORS_MAX_AGE, falling back to DefaultCORSConfig.
+func corsConfigFromEnv(getenv func(string) string) (CORSConfig, error) {
+	cfg := DefaultCORSConfig()
+
+	if value := strings.TrimSpace(getenv("CORS_ALLOWED_ORIGINS")); value != "" {
+		cfg.AllowedOrigins = nil
+		for _, origin := range strings.Split(value, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				cfg.AllowedOrigins = append(cfg.AllowedOrigins, origin)
+			}
+		}
+	}
+	if value := strings.TrimSpace(getenv("CORS_ALLOW_CREDENTIALS")); value != "" {
+		allow, err := strconv.ParseBool(value)
+		if err != nil {
+			return CORSConfig{}, fmt.Errorf("invalid CORS_ALLOW_CREDENTIALS %q", value)
+		}
+		cfg.AllowCredentials = allow
+	}
+	if value := strings.TrimSpace(getenv("CORS_MAX_AGE")); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return CORSConfig{}, fmt.Errorf("invalid CORS_MAX_AGE %q", value)
+		}
+		cfg.MaxAge = maxAge
+	}
+
+	if _, err := newCORSPolicy(cfg); err != nil {
+		return CORSConfig{}, err
+	}
+	return cfg, nil
+}
+
+// corsPolicy is a validated CORSConfig ready for matching.
+type corsPolicy struct {
+	anyOrigin   bool
+	exact       map[string]bool
+	wildcards   []corsWildcard
+	credentials bool
+	maxAge      string
+}
+
+// corsWildcard matches origins with scheme whose host ends in suffix (".example.com").
+type corsWildcard struct {
+	scheme string
+	suffix string
+}
+
+func newCORSPolicy(cfg CORSConfig) (*corsPolicy, error) {
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil, fmt.Errorf("CORS allowed origins must not be empty")
+	}
+
+	p := &corsPolicy{
+		exact:       make(map[string]bool),
+		credentials: cfg.AllowCredentials,
+		maxAge:      strconv.Itoa(int(cfg.MaxAge / time.Second)),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		if origin == corsAnyOrigin {
+			p.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+			return nil, fmt.Errorf("invalid CORS origin %q (want scheme://host[:port])", origin)
+		}
+		host := strings.ToLower(u.Host)
+		if strings.HasPrefix(host, "*.") {
+			if strings.Contains(host[2:], "*") || len(host) == 2 {
+				return nil, fmt.Errorf("invalid CORS origin %q (wildcards are only allowed as the first label)", origin)
+			}
+			p.wildcards = append(p.wildcards, corsWildcard{scheme: u.Scheme, suffix: host[1:]})
+			continue
+		}
+		if strings.Contains(host, "*") {
+			return nil, fmt.Errorf("invalid CORS origin %q (wildcards are only allowed as the first label)", origin)
+		}
+		p.exact[u.Scheme+"://"+host] = true
+	}
+	if p.anyOrigin && p.credentials {
+		return nil, fmt.Errorf("CORS credentials cannot be allowed for every origin (%q)", corsAnyOrigin)
+	}
+	return p, nil
+}
+
+// allows reports whether a request from origin may read responses.
+func (p *corsPolicy) allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	if origin == "" {
+		return false
+	}
+
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok {
+		return false
+	}
+	for _, wildcard := range p.wildcards {
+		// Ports must match too: the suffix carries the port when one was configured.
+		if scheme == wildcard.scheme && strings.HasSuffix(host, wildcard.suffix) && len(host) > len(wildcard.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnableCORS replaces the default CORS policy. cfg must be valid; use
+// corsConfigFromEnv or newCORSPolicy to check it first.
+func (s *Server) EnableCORS(cfg CORSConfig) error {
+	policy, err := newCORSPolicy(cfg)
+	if err != nil {
+		return err
+	}
+	s.updateSettings(func(settings *serverSettings) { settings.cors = policy })
+	return nil
+}
+
+// corsMiddleware answers preflights and sets CORS response headers for
+// allowed origins. Other origins get no CORS headers, so browsers block them,
+// and their preflights are rejected with 403.
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		cors := s.settings.Load().cors
+		w.Header().Add("Vary", "Origin")
+
+		requestedMethod := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != http.MethodOptions || requestedMethod == "" || origin == "" {
+			if cors.allows(origin) {
+				cors.setOriginHeaders(w, origin)
+			}
+			// A plain OPTIONS is answered for known routes only; unknown
+			// paths fall through to the router's 404.
+			if r.Method == http.MethodOptions {
+				if methods := s.routeMethods(r); len(methods) > 0 {
+					w.Header().Set("Allow", strings.Join(methods, ", ")+", "+http.MethodOptions)
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if !cors.allows(origin) {
+			s.rejectPreflight(w, r, "origin not allowed", "origin", origin)
+			return
+		}
+		methods := s.routeMethods(r)
+		if !containsString(methods, requestedMethod) {
+			s.rejectPreflight(w, r, "method not allowed", "origin", origin, "requested_method", requestedMethod)
+			return
+		}
+		if header, ok := disallowedCORSHeader(r.Header.Get("Access-Control-Request-Headers")); !ok {
+			s.rejectPreflight(w, r, "header not allowed: "+header, "origin", origin, "requested_header", header)
+			return
+		}
+
+		cors.setOriginHeaders(w, origin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(corsAllowedHeaders, ", "))
+		w.Header().Set("Access-Control-Max-Age", cors.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (p *corsPolicy) setOriginHeaders(w http.ResponseWriter, origin string) {
+	if p.anyOrigin && !p.credentials {
+		w.Header().Set("Access-Control-Allow-Origin", corsAnyOrigin)
+	} else {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+	w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+}
+
+func (s *Server) rejectPreflight(w http.ResponseWriter, r *http.Request, reason string, attrs ...any) {
+	s.logger.InfoContext(r.Context(), "CORS preflight rejected", append([]any{"reason", reason}, attrs...)...)
+	s.writeError(w, http.StatusForbidden, "CORS preflight rejected: "+reason)
+}
+
+// disallowedCORSHeader returns the first requested header that is not in
+// corsAllowedHeaders, and false, or "" and true when all are allowed.
+func disallowedCORSHeader(requested string) (string, bool) {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		allowed := false
+		for _, candidate := range corsAllowedHeaders {
+			if strings.EqualFold(header, candidate) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return header, false
+		}
+	}
+	return "", true
+}
+
+// checkWebSocketOrigin applies the CORS origin policy to WebSocket
+// handshakes. Clients that send no Origin (non-browsers) are allowed.
+func (s *Server) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || s.settings.Load().cors.allows(origin)
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newCORSTestServer(t *testing.T, cfg CORSConfig) *Server {
+	t.Helper()
+
+	s := newTestServer(t)
+	if err := s.EnableCORS(cfg); err != nil {
+		t.Fatalf("failed to enable CORS: %v", err)
+	}
+	return s
+}
+
+func preflight(handler http.Handler, path, origin, method, headers string) *httptest.ResponseRecorder {
+	return performRequestWithHeaders(handler, http.MethodOptions, path, "", map[string]string{
+		"Origin":                         origin,
+		"Access-Control-Request-Method":  method,
+		"Access-Control-Request-Headers": headers,
+	})
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	s := newCORSTestServer(t, CORSConfig{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	})
+	h := s.Handler()
+
+	testCases := []struct {
+		origin  string
+		allowed bool
+	}{
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "https://APP.example.com", allowed: true},
+		{origin: "https://a.example.org", allowed: true},
+		{origin: "https://a.b.example.org", allowed: true},
+		{origin: "https://example.org", allowed: false},
+		{origin: "http://a.example.org", allowed: false},
+		{origin: "https://a.example.org:8443", allowed: false},
+		{origin: "https://evil-example.org", allowed: false},
+		{origin: "https://app.example.com.evil.com", allowed: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.origin, func(t *testing.T) {
+			res := performRequestWithHeaders(h, http.MethodGet, "/api/tasks", "", map[string]string{"Origin": tc.origin})
+			if res.Code != http.StatusOK {
+				t.Fatalf("expected simple requests to be served, got %d", res.Code)
+			}
+			got := res.Header().Get("Access-Control-Allow-Origin")
+			if tc.allowed && (got != tc.origin || res.Header().Get("Access-Control-Allow-Credentials") != "true") {
+				t.Fatalf("expected origin echoed with credentials, got %q", got)
+			}
+			if !tc.allowed && got != "" {
+				t.Fatalf("expected no allow-origin header, got %q", got)
+			}
+			if exposed := res.Header().Get("Access-Control-Expose-Headers"); tc.allowed && exposed != "ETag, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, RateLimit-Policy, Retry-After, X-Request-ID" {
+				t.Fatalf("expected the validator, rate limit and request ID headers to be exposed, got %q", exposed)
+			}
+			if !tc.allowed && res.Header().Get("Access-Control-Expose-Headers") != "" {
+				t.Fatal("expected no expose-headers header for a disallowed origin")
+			}
+			if !strings.Contains(strings.Join(res.Header().Values("Vary"), ","), "Origin") {
+				t.Fatalf("expected Vary: Origin, got %v", res.Header().Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	s := newCORSTestServer(t, CORSConfig{AllowedOrigins: []string{"https://app.example.com"}, MaxAge: time.Hour})
+	h := s.Handler()
+	const origin = "https://app.example.com"
+
+	res := preflight(h, "/api/tasks/1", origin, http.MethodPut, "Content-Type, x-workspace-id")
+	if res.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusNoContent, res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Access-Control-Allow-Methods"); got != "PATCH, PUT" {
+		t.Fatalf("expected route methods, got %q", got)
+	}
+	if got := res.Header().Get("Access-Control-Max-Age"); got != "3600" {
+		t.Fatalf("expected max age 3600, got %q", got)
+	}
+	if res.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatal("expected no credentials header when credentials are disabled")
+	}
+
+	rejected := map[string]*httptest.ResponseRecorder{
+		"origin not allowed":           preflight(h, "/api/tasks", "https://evil.example.com", http.MethodGet, ""),
+		"method not allowed":           preflight(h, "/api/stats", origin, http.MethodPost, ""),
+		"header not allowed: X-Secret": preflight(h, "/api/tasks", origin, http.MethodGet, "X-Secret"),
+	}
+	for reason, res := range rejected {
+		if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), reason) {
+			t.Fatalf("expected 403 %q, got %d body=%s", reason, res.Code, res.Body.String())
+		}
+		if res.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("expected rejected preflight %q to carry no allow-origin header", reason)
+		}
+	}
+}
+
+func TestCORSPreflightSkipsAuthentication(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{APIKeys: []APIKey{{Name: "ci", Key: "secret-key"}}})
+
+	res := preflight(s.Handler(), "/api/tasks", "https://app.example.com", http.MethodPost, "Authorization")
+	if res.Code != http.StatusNoContent || res.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("expected unauthenticated preflight to succeed, got %d %v", res.Code, res.Header())
+	}
+}
+
+func TestCORSConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"CORS_ALLOWED_ORIGINS":   "https://app.example.com, https://*.example.org",
+		"CORS_ALLOW_CREDENTIALS": "true",
+		"CORS_MAX_AGE":           "5m",
+	}
+	cfg, err := corsConfigFromEnv(func(key string) string { return env[key] })
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	if len(cfg.AllowedOrigins) != 2 || !cfg.AllowCredentials || cfg.MaxAge != 5*time.Minute {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	defaults, err := corsConfigFromEnv(func(string) string { return "" })
+	if err != nil || len(defaults.AllowedOrigins) != 1 || defaults.AllowedOrigins[0] != corsAnyOrigin {
+		t.Fatalf("expected wildcard default, got %+v err=%v", defaults, err)
+	}
+
+	invalid := map[string]map[string]string{
+		"credentials with wildcard": {"CORS_ALLOW_CREDENTIALS": "true"},
+		"bad credentials flag":      {"CORS_ALLOW_CREDENTIALS": "maybe"},
+		"bad max age":               {"CORS_MAX_AGE": "-1s"},
+		"path in origin":            {"CORS_ALLOWED_ORIGINS": "https://app.example.com/app"},
+		"missing scheme":            {"CORS_ALLOWED_ORIGINS": "app.example.com"},
+		"inner wildcard":            {"CORS_ALLOWED_ORIGINS": "https://app.*.example.com"},
+	}
+	for name, env := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := corsConfigFromEnv(func(key string) string { return env[key] }); err == nil {
+				t.Fatal("expected config to be rejected")
+			}
+		})
+	}
+}
+
+func TestWebSocketHandshakeChecksOrigin(t *testing.T) {
+	s := newCORSTestServer(t, CORSConfig{AllowedOrigins: []string{"https://app.example.com"}})
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/ws"
+	_, res, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.example.com"}})
+	if err == nil || res == nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected disallowed origin to be rejected, got %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://app.example.com"}})
+	if err != nil {
+		t.Fatalf("expected allowed origin to connect, got %v", err)
+	}
+	_ = conn.Close()
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,20 +18,25 @@ var (
 	ErrInvalidTaskStatus = errors.New("invalid task status")
 	// ErrUserDoesNotExist is returned when a task references an unknown user.
 	ErrUserDoesNotExist = errors.New("user does not exist")
+	// ErrTaskConflict is returned when a task no longer matches an update's
+	// preconditions.
+	ErrTaskConflict = errors.New("task precondition failed")
 )
 
 const defaultActorName = "system"
 
 // Store defines data access methods used by HTTP handlers.
 type Store interface {
-	GetUsers() ([]User, error)
-	GetUserByID(id int) (User, bool, error)
-	GetTasks(status, userID string) ([]Task, error)
-	GetTaskHistory(taskID int) ([]TaskHistoryItem, error)
-	GetStats() (StatsResponse, error)
-	CreateUser(name, email, role string) (User, error)
-	CreateTask(title, status string, userID int, actor string) (Task, error)
-	UpdateTask(id int, update TaskUpdate, actor string) (Task, error)
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUserByID(ctx context.Context, id int) (User, bool, error)
+	GetUserByEmail(ctx context.Context, email string) (User, bool, error)
+	GetTasks(ctx context.Context, status, userID string) ([]Task, error)
+	GetTaskByID(ctx context.Context, id int) (Task, bool, error)
+	GetTaskHistory(ctx context.Context, taskID int) ([]TaskHistoryItem, error)
+	GetStats(ctx context.Context) (StatsResponse, error)
+	CreateUser(ctx context.Context, name, email, role string) (User, error)
+	CreateTask(ctx context.Context, title, status string, userID int, actor string) (Task, error)
+	UpdateTask(ctx context.Context, id int, update TaskUpdate, actor string) (Task, error)
 }
 
 // TaskUpdate represents patch semantics for task updates.
@@ -37,6 +44,29 @@ type TaskUpdate struct {
 	Title  *string
 	Status *string
 	UserID *int
+	// Expect is checked against the task under the same lock as the update.
+	Expect TaskPrecondition
+}
+
+// TaskPrecondition lists values a task must still have for an update to
+// apply, e.g. from JSON Patch "test" operations. Nil fields are not checked.
+type TaskPrecondition struct {
+	Title  *string
+	Status *string
+	UserID *int
+}
+
+// check returns ErrTaskConflict naming the first field of task that differs.
+func (p TaskPrecondition) check(task Task) error {
+	switch {
+	case p.Title != nil && *p.Title != task.Title:
+		return fmt.Errorf("%w: title has changed", ErrTaskConflict)
+	case p.Status != nil && *p.Status != task.Status:
+		return fmt.Errorf("%w: status has changed", ErrTaskConflict)
+	case p.UserID != nil && *p.UserID != task.UserID:
+		return fmt.Errorf("%w: userId has changed", ErrTaskConflict)
+	}
+	return nil
 }
 
 // DataStore holds all application data in memory.
@@ -48,24 +78,24 @@ type DataStore struct {
 	nextUserID  int
 	nextTaskID  int
 	nextHistID  int
+	events      *EventBus
 }
 
-var initialUsers = []User{
-	{ID: 1, Name: "John Doe", Email: "john@example.com", Role: "developer"},
-	{ID: 2, Name: "Jane Smith", Email: "jane@example.com", Role: "designer"},
-	{ID: 3, Name: "Bob Johnson", Email: "bob@example.com", Role: "manager"},
-}
-
-var initialTasks = []Task{
-	{ID: 1, Title: "Implement authentication", Status: "pending", UserID: 1},
-	{ID: 2, Title: "Design user interface", Status: "in-progress", UserID: 2},
-	{ID: 3, Title: "Review code changes", Status: "completed", UserID: 3},
-}
-
-// NewDataStore initializes a thread-safe in-memory store.
+// NewDataStore initializes a thread-safe in-memory store. Users and tasks
+// without a workspace are placed in the default workspace.
 func NewDataStore(users []User, tasks []Task) *DataStore {
 	userCopy := copyUsers(users)
+	for i := range userCopy {
+		if userCopy[i].WorkspaceID == "" {
+			userCopy[i].WorkspaceID = defaultWorkspaceID
+		}
+	}
 	taskCopy := copyTasks(tasks)
+	for i := range taskCopy {
+		if taskCopy[i].WorkspaceID == "" {
+			taskCopy[i].WorkspaceID = defaultWorkspaceID
+		}
+	}
 	taskHistory := make(map[int][]TaskHistoryItem, len(taskCopy))
 	for _, task := range taskCopy {
 		taskHistory[task.ID] = []TaskHistoryItem{}
@@ -77,30 +107,70 @@ func NewDataStore(users []User, tasks []Task) *DataStore {
 		nextUserID:  nextUserID(userCopy),
 		nextTaskID:  nextTaskID(taskCopy),
 		nextHistID:  1,
+		events:      NewEventBus(),
 	}
 }
 
-func (ds *DataStore) GetUsers() ([]User, error) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
+// Events returns the bus that receives this store's change events.
+func (ds *DataStore) Events() *EventBus {
+	return ds.events
+}
 
-	return copyUsers(ds.users), nil
+// Ping always succeeds; the in-memory store has no external dependency.
+func (ds *DataStore) Ping(ctx context.Context) error {
+	return ctx.Err()
 }
 
-func (ds *DataStore) GetUserByID(id int) (User, bool, error) {
+func (ds *DataStore) GetUsers(ctx context.Context) ([]User, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
+	workspaceID := workspaceFromContext(ctx)
+	users := make([]User, 0, len(ds.users))
 	for _, user := range ds.users {
-		if user.ID == id {
-			return user, true, nil
+		if inWorkspace(workspaceID, user.WorkspaceID) {
+			users = append(users, user)
 		}
 	}
+	return users, nil
+}
+
+func (ds *DataStore) GetUserByID(ctx context.Context, id int) (User, bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	if user, ok := ds.findUserLocked(workspaceFromContext(ctx), id); ok {
+		return user, true, nil
+	}
 
 	return User{}, false, nil
 }
 
-func (ds *DataStore) GetTasks(status, userID string) ([]Task, error) {
+// GetUserByEmail finds the user whose email matches case-insensitively.
+// Emails are not constrained to be unique, so an email shared by several
+// users finds none.
+func (ds *DataStore) GetUserByEmail(ctx context.Context, email string) (User, bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	workspaceID := workspaceFromContext(ctx)
+	var (
+		match User
+		found bool
+	)
+	for _, user := range ds.users {
+		if !inWorkspace(workspaceID, user.WorkspaceID) || !strings.EqualFold(user.Email, email) {
+			continue
+		}
+		if found {
+			return User{}, false, nil
+		}
+		match, found = user, true
+	}
+	return match, found, nil
+}
+
+func (ds *DataStore) GetTasks(ctx context.Context, status, userID string) ([]Task, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
@@ -115,8 +185,12 @@ func (ds *DataStore) GetTasks(status, userID string) ([]Task, error) {
 		parsedUserID = id
 	}
 
+	workspaceID := workspaceFromContext(ctx)
 	filtered := make([]Task, 0, len(ds.tasks))
 	for _, task := range ds.tasks {
+		if !inWorkspace(workspaceID, task.WorkspaceID) {
+			continue
+		}
 		if status != "" && task.Status != status {
 			continue
 		}
@@ -130,11 +204,22 @@ func (ds *DataStore) GetTasks(status, userID string) ([]Task, error) {
 	return filtered, nil
 }
 
-func (ds *DataStore) GetTaskHistory(taskID int) ([]TaskHistoryItem, error) {
+func (ds *DataStore) GetTaskByID(ctx context.Context, id int) (Task, bool, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	if idx := ds.findTaskLocked(workspaceFromContext(ctx), id); idx >= 0 {
+		return copyTask(ds.tasks[idx]), true, nil
+	}
+
+	return Task{}, false, nil
+}
+
+func (ds *DataStore) GetTaskHistory(ctx context.Context, taskID int) ([]TaskHistoryItem, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
-	if !ds.taskExistsLocked(taskID) {
+	if ds.findTaskLocked(workspaceFromContext(ctx), taskID) < 0 {
 		return nil, fmt.Errorf("%w: %d", ErrTaskNotFound, taskID)
 	}
 
@@ -145,15 +230,67 @@ func (ds *DataStore) GetTaskHistory(taskID int) ([]TaskHistoryItem, error) {
 	return history, nil
 }
 
-func (ds *DataStore) GetStats() (StatsResponse, error) {
+// GetTaskHistorySince returns up to limit history entries with an ID greater
+// than afterID, oldest first.
+func (ds *DataStore) GetTaskHistorySince(ctx context.Context, afterID, limit int) ([]TaskHistoryItem, error) {
 	ds.mu.RLock()
 	defer ds.mu.RUnlock()
 
+	workspaceID := workspaceFromContext(ctx)
+	entries := make([]TaskHistoryItem, 0)
+	for _, history := range ds.taskHistory {
+		for _, entry := range history {
+			if entry.ID > afterID && inWorkspace(workspaceID, entry.WorkspaceID) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return copyTaskHistory(entries), nil
+}
+
+// GetTaskOwners returns the assignee of each task in taskIDs that exists.
+func (ds *DataStore) GetTaskOwners(ctx context.Context, taskIDs []int) (map[int]int, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	workspaceID := workspaceFromContext(ctx)
+	wanted := make(map[int]bool, len(taskIDs))
+	for _, id := range taskIDs {
+		wanted[id] = true
+	}
+	owners := make(map[int]int, len(taskIDs))
+	for _, task := range ds.tasks {
+		if wanted[task.ID] && inWorkspace(workspaceID, task.WorkspaceID) {
+			owners[task.ID] = task.UserID
+		}
+	}
+	return owners, nil
+}
+
+func (ds *DataStore) GetStats(ctx context.Context) (StatsResponse, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	workspaceID := workspaceFromContext(ctx)
 	var stats StatsResponse
-	stats.Users.Total = len(ds.users)
-	stats.Tasks.Total = len(ds.tasks)
+	for _, user := range ds.users {
+		if inWorkspace(workspaceID, user.WorkspaceID) {
+			stats.Users.Total++
+		}
+	}
 
 	for _, task := range ds.tasks {
+		if !inWorkspace(workspaceID, task.WorkspaceID) {
+			continue
+		}
+		stats.Tasks.Total++
 		switch task.Status {
 		case "pending":
 			stats.Tasks.Pending++
@@ -167,75 +304,162 @@ func (ds *DataStore) GetStats() (StatsResponse, error) {
 	return stats, nil
 }
 
-func (ds *DataStore) CreateUser(name, email, role string) (User, error) {
+// ExportTasks calls fn for each task matching the GET /api/tasks filters.
+// The tasks are copied first so fn runs without the lock.
+func (ds *DataStore) ExportTasks(ctx context.Context, status, userID string, fn func(Task) error) error {
+	tasks, err := ds.GetTasks(ctx, status, userID)
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		if err := fn(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *DataStore) ExportUsers(ctx context.Context, fn func(User) error) error {
+	users, err := ds.GetUsers(ctx)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *DataStore) ExportHistory(ctx context.Context, fn func(TaskHistoryItem) error) error {
+	history, err := ds.GetTaskHistorySince(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, entry := range history {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ds *DataStore) CreateUser(ctx context.Context, name, email, role string) (User, error) {
+	workspaceID, err := writableWorkspace(ctx)
+	if err != nil {
+		return User{}, err
+	}
+
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
+	user := ds.createUserLocked(workspaceID, name, email, role)
+	ds.events.Publish(userEvent(user))
+
+	return user, nil
+}
+
+func (ds *DataStore) createUserLocked(workspaceID, name, email, role string) User {
 	user := User{
-		ID:    ds.nextUserID,
-		Name:  name,
-		Email: email,
-		Role:  role,
+		ID:          ds.nextUserID,
+		WorkspaceID: workspaceID,
+		Name:        name,
+		Email:       email,
+		Role:        role,
 	}
 	ds.nextUserID++
 	ds.users = append(ds.users, user)
-
-	return user, nil
+	return user
 }
 
-func (ds *DataStore) CreateTask(title, status string, userID int, actor string) (Task, error) {
-	if !isValidTaskStatus(status) {
-		return Task{}, fmt.Errorf("%w: %q", ErrInvalidTaskStatus, status)
+func (ds *DataStore) CreateTask(ctx context.Context, title, status string, userID int, actor string) (Task, error) {
+	workspaceID, err := writableWorkspace(ctx)
+	if err != nil {
+		return Task{}, err
 	}
 
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	if !ds.userExistsLocked(userID) {
-		return Task{}, fmt.Errorf("%w: %d", ErrUserDoesNotExist, userID)
+	task, err := ds.createTaskLocked(workspaceID, TaskCreate{Title: title, Status: status, UserID: userID}, actor, "")
+	if err != nil {
+		return Task{}, err
+	}
+	ds.events.Publish(taskEvent(EventTaskCreated, task))
+
+	return copyTask(task), nil
+}
+
+func (ds *DataStore) createTaskLocked(workspaceID string, create TaskCreate, actor, batchID string) (Task, error) {
+	if !isValidTaskStatus(create.Status) {
+		return Task{}, fmt.Errorf("%w: %q", ErrInvalidTaskStatus, create.Status)
+	}
+	if _, ok := ds.findUserLocked(workspaceID, create.UserID); !ok {
+		return Task{}, fmt.Errorf("%w: %d", ErrUserDoesNotExist, create.UserID)
 	}
 
 	task := Task{
-		ID:     ds.nextTaskID,
-		Title:  title,
-		Status: status,
-		UserID: userID,
+		ID:          ds.nextTaskID,
+		WorkspaceID: workspaceID,
+		Title:       create.Title,
+		Status:      create.Status,
+		UserID:      create.UserID,
 	}
 	ds.nextTaskID++
 	history := ds.appendHistoryLocked(
+		workspaceID,
 		task.ID,
 		normalizeActor(actor),
 		"status",
 		nil,
-		status,
+		create.Status,
 		time.Now().UTC(),
+		batchID,
 	)
 	task.LastChange = &history
 	ds.tasks = append(ds.tasks, task)
 
-	return copyTask(task), nil
+	return task, nil
 }
 
-func (ds *DataStore) UpdateTask(id int, update TaskUpdate, actor string) (Task, error) {
+func (ds *DataStore) UpdateTask(ctx context.Context, id int, update TaskUpdate, actor string) (Task, error) {
+	workspaceID, err := writableWorkspace(ctx)
+	if err != nil {
+		return Task{}, err
+	}
+
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	idx := -1
-	for i := range ds.tasks {
-		if ds.tasks[i].ID == id {
-			idx = i
-			break
-		}
+	task, changed, err := ds.updateTaskLocked(workspaceID, id, update, actor, "")
+	if err != nil {
+		return Task{}, err
+	}
+	if changed {
+		ds.events.Publish(taskEvent(EventTaskUpdated, task))
 	}
+
+	return copyTask(task), nil
+}
+
+// updateTaskLocked applies update and reports whether any field changed.
+func (ds *DataStore) updateTaskLocked(workspaceID string, id int, update TaskUpdate, actor, batchID string) (Task, bool, error) {
+	idx := ds.findTaskLocked(workspaceID, id)
 	if idx == -1 {
-		return Task{}, fmt.Errorf("%w: %d", ErrTaskNotFound, id)
+		return Task{}, false, fmt.Errorf("%w: %d", ErrTaskNotFound, id)
+	}
+	if err := update.Expect.check(ds.tasks[idx]); err != nil {
+		return Task{}, false, err
 	}
 
 	if update.Status != nil && !isValidTaskStatus(*update.Status) {
-		return Task{}, fmt.Errorf("%w: %q", ErrInvalidTaskStatus, *update.Status)
+		return Task{}, false, fmt.Errorf("%w: %q", ErrInvalidTaskStatus, *update.Status)
 	}
-	if update.UserID != nil && !ds.userExistsLocked(*update.UserID) {
-		return Task{}, fmt.Errorf("%w: %d", ErrUserDoesNotExist, *update.UserID)
+	if update.UserID != nil {
+		if _, ok := ds.findUserLocked(workspaceID, *update.UserID); !ok {
+			return Task{}, false, fmt.Errorf("%w: %d", ErrUserDoesNotExist, *update.UserID)
+		}
 	}
 
 	var latestChange *TaskHistoryItem
@@ -245,7 +469,7 @@ func (ds *DataStore) UpdateTask(id int, update TaskUpdate, actor string) (Task,
 	if update.Title != nil {
 		if ds.tasks[idx].Title != *update.Title {
 			fromValue := ds.tasks[idx].Title
-			change := ds.appendHistoryLocked(id, normalizedActor, "title", &fromValue, *update.Title, now)
+			change := ds.appendHistoryLocked(workspaceID, id, normalizedActor, "title", &fromValue, *update.Title, now, batchID)
 			latestChange = &change
 		}
 		ds.tasks[idx].Title = *update.Title
@@ -253,7 +477,7 @@ func (ds *DataStore) UpdateTask(id int, update TaskUpdate, actor string) (Task,
 	if update.Status != nil {
 		if ds.tasks[idx].Status != *update.Status {
 			fromValue := ds.tasks[idx].Status
-			change := ds.appendHistoryLocked(id, normalizedActor, "status", &fromValue, *update.Status, now)
+			change := ds.appendHistoryLocked(workspaceID, id, normalizedActor, "status", &fromValue, *update.Status, now, batchID)
 			latestChange = &change
 		}
 		ds.tasks[idx].Status = *update.Status
@@ -262,7 +486,7 @@ func (ds *DataStore) UpdateTask(id int, update TaskUpdate, actor string) (Task,
 		if ds.tasks[idx].UserID != *update.UserID {
 			fromValue := strconv.Itoa(ds.tasks[idx].UserID)
 			toValue := strconv.Itoa(*update.UserID)
-			change := ds.appendHistoryLocked(id, normalizedActor, "userId", &fromValue, toValue, now)
+			change := ds.appendHistoryLocked(workspaceID, id, normalizedActor, "userId", &fromValue, toValue, now, batchID)
 			latestChange = &change
 		}
 		ds.tasks[idx].UserID = *update.UserID
@@ -271,44 +495,259 @@ func (ds *DataStore) UpdateTask(id int, update TaskUpdate, actor string) (Task,
 		ds.tasks[idx].LastChange = latestChange
 	}
 
-	return copyTask(ds.tasks[idx]), nil
+	return ds.tasks[idx], latestChange != nil, nil
 }
 
-func (ds *DataStore) userExistsLocked(id int) bool {
-	for _, user := range ds.users {
-		if user.ID == id {
-			return true
+// snapshotLocked records the users, tasks and history so a multi-write
+// operation can be undone by calling the returned restore function.
+func (ds *DataStore) snapshotLocked() (restore func()) {
+	var (
+		users      = append([]User(nil), ds.users...)
+		tasks      = append([]Task(nil), ds.tasks...)
+		history    = make(map[int][]TaskHistoryItem, len(ds.taskHistory))
+		nextUserID = ds.nextUserID
+		nextTaskID = ds.nextTaskID
+		nextHistID = ds.nextHistID
+	)
+	for taskID, entries := range ds.taskHistory {
+		// Appends past len are invisible once the old slice is restored.
+		history[taskID] = entries
+	}
+	return func() {
+		ds.users, ds.tasks, ds.taskHistory = users, tasks, history
+		ds.nextUserID, ds.nextTaskID, ds.nextHistID = nextUserID, nextTaskID, nextHistID
+	}
+}
+
+// ApplyTaskBatch applies batch under one lock. Atomic batches are rolled back
+// by restoring the state from before the first write.
+func (ds *DataStore) ApplyTaskBatch(ctx context.Context, batch TaskBatch) ([]TaskWriteResult, error) {
+	workspaceID, err := writableWorkspace(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	restore := ds.snapshotLocked()
+	results := make([]TaskWriteResult, len(batch.Writes))
+	var events []ChangeEvent
+	for i, write := range batch.Writes {
+		var (
+			task    Task
+			changed = true
+			err     error
+		)
+		eventType := EventTaskUpdated
+		if write.Create != nil {
+			eventType = EventTaskCreated
+			task, err = ds.createTaskLocked(workspaceID, *write.Create, batch.Actor, batch.ID)
+		} else {
+			task, changed, err = ds.updateTaskLocked(workspaceID, write.TaskID, write.Update, batch.Actor, batch.ID)
+		}
+		if err != nil && batch.Atomic {
+			restore()
+			return abortedBatchResults(len(batch.Writes), i, err), nil
+		}
+		results[i] = TaskWriteResult{Task: copyTask(task), Err: err}
+		if err == nil && changed {
+			events = append(events, taskEvent(eventType, task))
 		}
 	}
+	for _, event := range events {
+		ds.events.Publish(event)
+	}
 
-	return false
+	return results, nil
 }
 
-func (ds *DataStore) taskExistsLocked(id int) bool {
-	for _, task := range ds.tasks {
-		if task.ID == id {
+// Import creates every user and task of batch or, on the first failure,
+// none of them.
+func (ds *DataStore) Import(ctx context.Context, batch ImportBatch) (ImportResult, error) {
+	workspaceID, err := writableWorkspace(ctx)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	restore := ds.snapshotLocked()
+	result := ImportResult{Users: make([]User, 0, len(batch.Users)), Tasks: make([]Task, 0, len(batch.Tasks))}
+	for _, row := range batch.Users {
+		result.Users = append(result.Users, ds.createUserLocked(workspaceID, row.Name, row.Email, row.Role))
+	}
+	for i, row := range batch.Tasks {
+		create := TaskCreate{Title: row.Title, Status: row.Status, UserID: row.UserID}
+		if row.UserEmail != "" {
+			user, ok := ds.findUserByEmailLocked(workspaceID, row.UserEmail)
+			if !ok {
+				restore()
+				return ImportResult{}, fmt.Errorf("tasks[%d]: %w: %s", i, ErrUserDoesNotExist, row.UserEmail)
+			}
+			create.UserID = user.ID
+		}
+		task, err := ds.createTaskLocked(workspaceID, create, batch.Actor, batch.ID)
+		if err != nil {
+			restore()
+			return ImportResult{}, fmt.Errorf("tasks[%d]: %w", i, err)
+		}
+		result.Tasks = append(result.Tasks, copyTask(task))
+	}
+
+	for _, user := range result.Users {
+		ds.events.Publish(userEvent(user))
+	}
+	for _, task := range result.Tasks {
+		ds.events.Publish(taskEvent(EventTaskCreated, task))
+	}
+	return result, nil
+}
+
+// Seed writes fixtures, as validated by loadFixtures, with their IDs. The
+// new state is built aside and swapped in, so a failed seed changes nothing.
+func (ds *DataStore) Seed(_ context.Context, fixtures Fixtures, mode SeedMode) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	users := copyUsers(ds.users)
+	if len(fixtures.Users) > 0 && (mode == SeedUpsert || len(users) == 0) {
+		for _, fixture := range fixtures.Users {
+			users = upsertByID(users, fixture, func(user User) int { return user.ID })
+		}
+	}
+
+	tasks := copyTasks(ds.tasks)
+	if len(fixtures.Tasks) > 0 && (mode == SeedUpsert || len(tasks) == 0) {
+		for _, fixture := range fixtures.Tasks {
+			if !containsUser(users, fixture.WorkspaceID, fixture.UserID) {
+				return fmt.Errorf("seed task %d: %w: %d", fixture.ID, ErrUserDoesNotExist, fixture.UserID)
+			}
+			fixture.LastChange = nil
+			tasks = upsertByID(tasks, fixture, func(task Task) int { return task.ID })
+		}
+	}
+
+	history := make(map[int][]TaskHistoryItem, len(ds.taskHistory))
+	historyCount := 0
+	for taskID, entries := range ds.taskHistory {
+		history[taskID] = copyTaskHistory(entries)
+		historyCount += len(entries)
+	}
+	if len(fixtures.History) > 0 && (mode == SeedUpsert || historyCount == 0) {
+		for _, fixture := range fixtures.History {
+			// An upsert may move an entry to another task.
+			for taskID, entries := range history {
+				history[taskID] = removeByID(entries, fixture.ID, func(entry TaskHistoryItem) int { return entry.ID })
+			}
+			fixture.FromValue = copyStringPtr(fixture.FromValue)
+			entries := append(history[fixture.TaskID], fixture)
+			sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+			history[fixture.TaskID] = entries
+		}
+	}
+	for _, task := range tasks {
+		if _, ok := history[task.ID]; !ok {
+			history[task.ID] = []TaskHistoryItem{}
+		}
+	}
+
+	ds.users, ds.tasks, ds.taskHistory = users, tasks, history
+	ds.nextUserID = nextUserID(users)
+	ds.nextTaskID = nextTaskID(tasks)
+	for _, entries := range history {
+		for _, entry := range entries {
+			if entry.ID >= ds.nextHistID {
+				ds.nextHistID = entry.ID + 1
+			}
+		}
+	}
+	return nil
+}
+
+func containsUser(users []User, workspaceID string, id int) bool {
+	for _, user := range users {
+		if user.ID == id && user.WorkspaceID == workspaceID {
 			return true
 		}
 	}
 	return false
 }
 
+// upsertByID replaces the element of items with value's ID, or appends value.
+func upsertByID[T any](items []T, value T, id func(T) int) []T {
+	for i := range items {
+		if id(items[i]) == id(value) {
+			items[i] = value
+			return items
+		}
+	}
+	return append(items, value)
+}
+
+func removeByID[T any](items []T, target int, id func(T) int) []T {
+	for i := range items {
+		if id(items[i]) == target {
+			return append(items[:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+// findUserByEmailLocked returns the first user of workspaceID whose email
+// matches case-insensitively.
+func (ds *DataStore) findUserByEmailLocked(workspaceID, email string) (User, bool) {
+	for _, user := range ds.users {
+		if inWorkspace(workspaceID, user.WorkspaceID) && strings.EqualFold(user.Email, email) {
+			return user, true
+		}
+	}
+	return User{}, false
+}
+
+// findUserLocked returns the user with id if it is visible to workspaceID.
+func (ds *DataStore) findUserLocked(workspaceID string, id int) (User, bool) {
+	for _, user := range ds.users {
+		if user.ID == id && inWorkspace(workspaceID, user.WorkspaceID) {
+			return user, true
+		}
+	}
+
+	return User{}, false
+}
+
+// findTaskLocked returns the index of task id if it is visible to
+// workspaceID, or -1.
+func (ds *DataStore) findTaskLocked(workspaceID string, id int) int {
+	for i, task := range ds.tasks {
+		if task.ID == id && inWorkspace(workspaceID, task.WorkspaceID) {
+			return i
+		}
+	}
+	return -1
+}
+
 func (ds *DataStore) appendHistoryLocked(
+	workspaceID string,
 	taskID int,
 	actor string,
 	field string,
 	fromValue *string,
 	toValue string,
 	changedAt time.Time,
+	batchID string,
 ) TaskHistoryItem {
 	entry := TaskHistoryItem{
-		ID:        ds.nextHistID,
-		TaskID:    taskID,
-		ChangedAt: changedAt,
-		ChangedBy: actor,
-		Field:     field,
-		FromValue: copyStringPtr(fromValue),
-		ToValue:   toValue,
+		ID:          ds.nextHistID,
+		WorkspaceID: workspaceID,
+		TaskID:      taskID,
+		ChangedAt:   changedAt,
+		ChangedBy:   actor,
+		Field:       field,
+		FromValue:   copyStringPtr(fromValue),
+		ToValue:     toValue,
+		BatchID:     batchID,
 	}
 	ds.nextHistID++
 	ds.taskHistory[taskID] = append(ds.taskHistory[taskID], entry)
@@ -323,13 +762,11 @@ func normalizeActor(actor string) string {
 	return trimmed
 }
 
+// taskStatuses lists the valid task statuses in workflow order.
+var taskStatuses = []string{"pending", "in-progress", "completed"}
+
 func isValidTaskStatus(status string) bool {
-	switch status {
-	case "pending", "in-progress", "completed":
-		return true
-	default:
-		return false
-	}
+	return containsString(taskStatuses, status)
 }
 
 func nextUserID(users []User) int {
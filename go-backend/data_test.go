@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"strconv"
 	"sync"
 	"testing"
 )
@@ -11,13 +13,13 @@ func TestDataStoreGetUsersReturnsCopy(t *testing.T) {
 		{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "developer"},
 	}, nil)
 
-	users, err := ds.GetUsers()
+	users, err := ds.GetUsers(context.Background())
 	if err != nil {
 		t.Fatalf("expected get users to succeed, got %v", err)
 	}
 	users[0].Name = "Mutated"
 
-	user, ok, err := ds.GetUserByID(1)
+	user, ok, err := ds.GetUserByID(context.Background(), 1)
 	if err != nil {
 		t.Fatalf("expected get user by ID to succeed, got %v", err)
 	}
@@ -34,11 +36,11 @@ func TestDataStoreCreateUserAssignsIncrementingID(t *testing.T) {
 		{ID: 10, Name: "Alice", Email: "alice@example.com", Role: "developer"},
 	}, nil)
 
-	user1, err := ds.CreateUser("Bob", "bob@example.com", "designer")
+	user1, err := ds.CreateUser(context.Background(), "Bob", "bob@example.com", "designer")
 	if err != nil {
 		t.Fatalf("expected first create user to succeed, got %v", err)
 	}
-	user2, err := ds.CreateUser("Carol", "carol@example.com", "manager")
+	user2, err := ds.CreateUser(context.Background(), "Carol", "carol@example.com", "manager")
 	if err != nil {
 		t.Fatalf("expected second create user to succeed, got %v", err)
 	}
@@ -56,15 +58,15 @@ func TestDataStoreCreateTaskValidation(t *testing.T) {
 		{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "developer"},
 	}, nil)
 
-	if _, err := ds.CreateTask("Task 1", "invalid", 1, "admin"); !errors.Is(err, ErrInvalidTaskStatus) {
+	if _, err := ds.CreateTask(context.Background(), "Task 1", "invalid", 1, "admin"); !errors.Is(err, ErrInvalidTaskStatus) {
 		t.Fatalf("expected ErrInvalidTaskStatus, got %v", err)
 	}
 
-	if _, err := ds.CreateTask("Task 1", "pending", 999, "admin"); !errors.Is(err, ErrUserDoesNotExist) {
+	if _, err := ds.CreateTask(context.Background(), "Task 1", "pending", 999, "admin"); !errors.Is(err, ErrUserDoesNotExist) {
 		t.Fatalf("expected ErrUserDoesNotExist, got %v", err)
 	}
 
-	task, err := ds.CreateTask("Task 1", "pending", 1, "admin")
+	task, err := ds.CreateTask(context.Background(), "Task 1", "pending", 1, "admin")
 	if err != nil {
 		t.Fatalf("expected successful task creation, got %v", err)
 	}
@@ -92,7 +94,7 @@ func TestDataStoreUpdateTaskPartial(t *testing.T) {
 
 	newStatus := "completed"
 	newUserID := 2
-	updated, err := ds.UpdateTask(1, TaskUpdate{
+	updated, err := ds.UpdateTask(context.Background(), 1, TaskUpdate{
 		Status: &newStatus,
 		UserID: &newUserID,
 	}, "qa-user")
@@ -116,7 +118,7 @@ func TestDataStoreUpdateTaskPartial(t *testing.T) {
 		t.Fatalf("expected changedBy qa-user, got %q", updated.LastChange.ChangedBy)
 	}
 
-	if _, err := ds.UpdateTask(999, TaskUpdate{Status: &newStatus}, "qa-user"); !errors.Is(err, ErrTaskNotFound) {
+	if _, err := ds.UpdateTask(context.Background(), 999, TaskUpdate{Status: &newStatus}, "qa-user"); !errors.Is(err, ErrTaskNotFound) {
 		t.Fatalf("expected ErrTaskNotFound, got %v", err)
 	}
 }
@@ -133,14 +135,14 @@ func TestDataStoreGetTaskHistory(t *testing.T) {
 
 	status1 := "in-progress"
 	status2 := "completed"
-	if _, err := ds.UpdateTask(1, TaskUpdate{Status: &status1}, "alice"); err != nil {
+	if _, err := ds.UpdateTask(context.Background(), 1, TaskUpdate{Status: &status1}, "alice"); err != nil {
 		t.Fatalf("expected first update to succeed, got %v", err)
 	}
-	if _, err := ds.UpdateTask(1, TaskUpdate{Status: &status2}, "bob"); err != nil {
+	if _, err := ds.UpdateTask(context.Background(), 1, TaskUpdate{Status: &status2}, "bob"); err != nil {
 		t.Fatalf("expected second update to succeed, got %v", err)
 	}
 
-	history, err := ds.GetTaskHistory(1)
+	history, err := ds.GetTaskHistory(context.Background(), 1)
 	if err != nil {
 		t.Fatalf("expected task history lookup to succeed, got %v", err)
 	}
@@ -157,7 +159,7 @@ func TestDataStoreGetTaskHistory(t *testing.T) {
 		t.Fatalf("unexpected fromValue in history: %+v", history[0].FromValue)
 	}
 
-	if _, err := ds.GetTaskHistory(999); !errors.Is(err, ErrTaskNotFound) {
+	if _, err := ds.GetTaskHistory(context.Background(), 999); !errors.Is(err, ErrTaskNotFound) {
 		t.Fatalf("expected ErrTaskNotFound for unknown task, got %v", err)
 	}
 }
@@ -173,7 +175,7 @@ func TestDataStoreConcurrentCreateUserIDsAreUnique(t *testing.T) {
 	for i := 0; i < total; i++ {
 		go func(idx int) {
 			defer wg.Done()
-			user, err := ds.CreateUser("User", "user@example.com", "developer")
+			user, err := ds.CreateUser(context.Background(), "User", "user@example.com", "developer")
 			if err != nil {
 				t.Errorf("expected create user to succeed, got %v", err)
 				return
@@ -211,7 +213,7 @@ func TestDataStoreGetTasksFilters(t *testing.T) {
 		},
 	)
 
-	all, err := ds.GetTasks("", "")
+	all, err := ds.GetTasks(context.Background(), "", "")
 	if err != nil {
 		t.Fatalf("expected get tasks to succeed, got %v", err)
 	}
@@ -219,7 +221,7 @@ func TestDataStoreGetTasksFilters(t *testing.T) {
 		t.Fatalf("expected 3 tasks, got %d", len(all))
 	}
 
-	pending, err := ds.GetTasks("pending", "")
+	pending, err := ds.GetTasks(context.Background(), "pending", "")
 	if err != nil {
 		t.Fatalf("expected get tasks with status to succeed, got %v", err)
 	}
@@ -227,7 +229,7 @@ func TestDataStoreGetTasksFilters(t *testing.T) {
 		t.Fatalf("expected 2 pending tasks, got %d", len(pending))
 	}
 
-	userOneTasks, err := ds.GetTasks("", "1")
+	userOneTasks, err := ds.GetTasks(context.Background(), "", "1")
 	if err != nil {
 		t.Fatalf("expected get tasks with user filter to succeed, got %v", err)
 	}
@@ -235,7 +237,7 @@ func TestDataStoreGetTasksFilters(t *testing.T) {
 		t.Fatalf("expected 2 tasks for user 1, got %d", len(userOneTasks))
 	}
 
-	invalidUserID, err := ds.GetTasks("", "not-an-int")
+	invalidUserID, err := ds.GetTasks(context.Background(), "", "not-an-int")
 	if err != nil {
 		t.Fatalf("expected invalid userId filter to return empty result without error, got %v", err)
 	}
@@ -257,7 +259,7 @@ func TestDataStoreGetStats(t *testing.T) {
 		},
 	)
 
-	stats, err := ds.GetStats()
+	stats, err := ds.GetStats(context.Background())
 	if err != nil {
 		t.Fatalf("expected get stats to succeed, got %v", err)
 	}
@@ -276,3 +278,101 @@ func TestDataStoreGetStats(t *testing.T) {
 		)
 	}
 }
+
+func TestDataStoreGetTaskHistorySince(t *testing.T) {
+	ds := NewDataStore(
+		[]User{
+			{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "developer"},
+		},
+		[]Task{
+			{ID: 1, Title: "First", Status: "pending", UserID: 1},
+			{ID: 2, Title: "Second", Status: "pending", UserID: 1},
+		},
+	)
+
+	for idx, id := range []int{1, 2, 1} {
+		title := "Renamed " + strconv.Itoa(idx)
+		if _, err := ds.UpdateTask(context.Background(), id, TaskUpdate{Title: &title}, "alice"); err != nil {
+			t.Fatalf("expected update to succeed, got %v", err)
+		}
+	}
+
+	history, err := ds.GetTaskHistorySince(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatalf("expected history since to succeed, got %v", err)
+	}
+	if len(history) != 2 || history[0].ID != 2 || history[1].ID != 3 {
+		t.Fatalf("expected entries 2 and 3 in ID order, got %+v", history)
+	}
+
+	limited, err := ds.GetTaskHistorySince(context.Background(), 0, 1)
+	if err != nil {
+		t.Fatalf("expected limited history since to succeed, got %v", err)
+	}
+	if len(limited) != 1 || limited[0].ID != 1 {
+		t.Fatalf("expected only the first entry, got %+v", limited)
+	}
+}
+
+func TestDataStoreGetTaskOwners(t *testing.T) {
+	ds := NewDataStore(
+		[]User{
+			{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "developer"},
+			{ID: 2, Name: "Bob", Email: "bob@example.com", Role: "developer"},
+		},
+		[]Task{
+			{ID: 1, Title: "First", Status: "pending", UserID: 1},
+			{ID: 2, Title: "Second", Status: "pending", UserID: 2},
+		},
+	)
+
+	owners, err := ds.GetTaskOwners(context.Background(), []int{2, 9})
+	if err != nil {
+		t.Fatalf("expected task owners to load, got %v", err)
+	}
+	if len(owners) != 1 || owners[2] != 2 {
+		t.Fatalf("expected only task 2's owner, got %v", owners)
+	}
+}
+
+func TestDataStorePublishesChangeEvents(t *testing.T) {
+	ds := NewDataStore([]User{
+		{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "developer"},
+	}, nil)
+
+	events, unsubscribe := ds.Events().Subscribe(EventFilter{})
+	defer unsubscribe()
+
+	if _, err := ds.CreateUser(context.Background(), "Bob", "bob@example.com", "designer"); err != nil {
+		t.Fatalf("expected create user to succeed, got %v", err)
+	}
+	task, err := ds.CreateTask(context.Background(), "Task", "pending", 1, "alice")
+	if err != nil {
+		t.Fatalf("expected create task to succeed, got %v", err)
+	}
+	unchanged := "Task"
+	if _, err := ds.UpdateTask(context.Background(), task.ID, TaskUpdate{Title: &unchanged}, "alice"); err != nil {
+		t.Fatalf("expected no-op update to succeed, got %v", err)
+	}
+	status := "completed"
+	if _, err := ds.UpdateTask(context.Background(), task.ID, TaskUpdate{Status: &status}, "alice"); err != nil {
+		t.Fatalf("expected update to succeed, got %v", err)
+	}
+
+	want := []string{EventUserCreated, EventTaskCreated, EventTaskUpdated}
+	for _, eventType := range want {
+		select {
+		case event := <-events:
+			if event.Type != eventType {
+				t.Fatalf("expected %s event, got %s", eventType, event.Type)
+			}
+		default:
+			t.Fatalf("expected %s event to be published", eventType)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected no event for no-op update, got %+v", event)
+	default:
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Change event types published to live-update subscribers.
+const (
+	EventTaskCreated = "task.created"
+	EventTaskUpdated = "task.updated"
+	EventUserCreated = "user.created"
+)
+
+const eventSubscriberBuffer = 64
+
+// ChangeEvent describes a single mutation delivered to event subscribers.
+// Task events carry the task_history ID of the change as their ID so
+// consumers can resume from it; user events have no ID.
+type ChangeEvent struct {
+	ID          int              `json:"id,omitempty"`
+	Type        string           `json:"type"`
+	WorkspaceID string           `json:"workspaceId"`
+	TaskID      int              `json:"taskId,omitempty"`
+	UserID      int              `json:"userId,omitempty"`
+	Task        *Task            `json:"task,omitempty"`
+	User        *User            `json:"user,omitempty"`
+	Change      *TaskHistoryItem `json:"change,omitempty"`
+	OccurredAt  time.Time        `json:"occurredAt"`
+}
+
+// EventFilter narrows a subscription to a workspace, task and/or user. Zero
+// values match everything.
+type EventFilter struct {
+	WorkspaceID string
+	TaskID      int
+	UserID      int
+}
+
+// Matches reports whether the event passes the filter.
+func (f EventFilter) Matches(event ChangeEvent) bool {
+	if f.WorkspaceID != "" && !inWorkspace(f.WorkspaceID, event.WorkspaceID) {
+		return false
+	}
+	if f.TaskID != 0 && event.TaskID != f.TaskID {
+		return false
+	}
+	if f.UserID != 0 && event.UserID != f.UserID {
+		// A reassignment is also relevant to the previous assignee.
+		if event.Change == nil || event.Change.Field != "userId" ||
+			event.Change.FromValue == nil || *event.Change.FromValue != strconv.Itoa(f.UserID) {
+			return false
+		}
+	}
+	return true
+}
+
+// eventSource is implemented by stores that publish their own change events.
+type eventSource interface {
+	Events() *EventBus
+}
+
+// historyFeed is implemented by stores that can replay task history after a given ID.
+type historyFeed interface {
+	GetTaskHistorySince(ctx context.Context, afterID, limit int) ([]TaskHistoryItem, error)
+	// GetTaskOwners returns the current assignee of each task in taskIDs
+	// that still exists.
+	GetTaskOwners(ctx context.Context, taskIDs []int) (map[int]int, error)
+}
+
+// EventBus fans change events out to in-process subscribers.
+// A nil *EventBus is valid and drops everything published to it.
+type EventBus struct {
+	mu          sync.Mutex
+	subscribers map[*eventSubscription]struct{}
+}
+
+type eventSubscription struct {
+	ch     chan ChangeEvent
+	filter EventFilter
+}
+
+// NewEventBus creates an empty event bus.
+func NewEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[*eventSubscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscriber and returns its event channel and an
+// unsubscribe function. The channel is closed when the subscriber is removed,
+// either by unsubscribing or because it fell too far behind.
+func (b *EventBus) Subscribe(filter EventFilter) (<-chan ChangeEvent, func()) {
+	sub := &eventSubscription{
+		ch:     make(chan ChangeEvent, eventSubscriberBuffer),
+		filter: filter,
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			b.removeLocked(sub)
+			b.mu.Unlock()
+		})
+	}
+}
+
+// Publish delivers the event to all matching subscribers without blocking.
+// Subscribers whose buffer is full are dropped so they can resume from their
+// last event ID instead of stalling publishers.
+func (b *EventBus) Publish(event ChangeEvent) {
+	if b == nil {
+		return
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			b.removeLocked(sub)
+		}
+	}
+}
+
+// SubscriberCount returns the number of active subscribers.
+func (b *EventBus) SubscriberCount() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscribers)
+}
+
+func (b *EventBus) removeLocked(sub *eventSubscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+func taskEvent(eventType string, task Task) ChangeEvent {
+	event := ChangeEvent{
+		Type:        eventType,
+		WorkspaceID: task.WorkspaceID,
+		TaskID:      task.ID,
+		UserID:      task.UserID,
+	}
+	taskCopy := copyTask(task)
+	event.Task = &taskCopy
+	if task.LastChange != nil {
+		event.ID = task.LastChange.ID
+		event.Change = taskCopy.LastChange
+		event.OccurredAt = task.LastChange.ChangedAt
+	}
+	return event
+}
+
+func userEvent(user User) ChangeEvent {
+	userCopy := user
+	return ChangeEvent{
+		Type:        EventUserCreated,
+		WorkspaceID: user.WorkspaceID,
+		UserID:      user.ID,
+		User:        &userCopy,
+	}
+}
+
+// historyPage is one page of replayed task events.
+type historyPage struct {
+	events []ChangeEvent
+	// through is the ID of the last history entry the events account for;
+	// the next page starts after it.
+	through int
+	// more reports that the page was full, so history may continue.
+	more bool
+}
+
+// replayHistory rebuilds the task events of up to limit history entries
+// recorded after afterID, resolving each task's current assignee so user
+// filters still apply. A write records one history entry per changed field
+// but publishes a single event, so entries are grouped back into the event
+// their write published: the one carrying its last entry. A full page leaves
+// out the write it ends in, whose entries may continue on the next.
+func replayHistory(ctx context.Context, feed historyFeed, afterID, limit int, filter EventFilter) (historyPage, error) {
+	history, err := feed.GetTaskHistorySince(ctx, afterID, limit)
+	if err != nil {
+		return historyPage{}, err
+	}
+	page := historyPage{through: afterID, more: len(history) == limit}
+	writes := groupHistory(history)
+	if page.more {
+		cut := len(history)
+		for i, write := range writes {
+			if write == writes[len(writes)-1] {
+				cut = i
+				break
+			}
+		}
+		// A page that is all one write is replayed as it is.
+		if cut > 0 {
+			history, writes = history[:cut], writes[:cut]
+		}
+	}
+	if len(history) == 0 {
+		return page, nil
+	}
+	page.through = history[len(history)-1].ID
+
+	last := make(map[int]int, len(history))
+	created := make(map[int]bool)
+	taskIDs := make([]int, 0, len(history))
+	seenTasks := make(map[int]bool)
+	for i, entry := range history {
+		last[writes[i]] = i
+		if entry.Field == "status" && entry.FromValue == nil {
+			created[writes[i]] = true
+		}
+		if !seenTasks[entry.TaskID] {
+			seenTasks[entry.TaskID] = true
+			taskIDs = append(taskIDs, entry.TaskID)
+		}
+	}
+	owners, err := feed.GetTaskOwners(ctx, taskIDs)
+	if err != nil {
+		return historyPage{}, err
+	}
+
+	page.events = make([]ChangeEvent, 0, len(last))
+	for i, entry := range history {
+		if last[writes[i]] != i {
+			continue
+		}
+		event := historyEvent(entry, owners[entry.TaskID])
+		if created[writes[i]] {
+			event.Type = EventTaskCreated
+		}
+		if filter.Matches(event) {
+			page.events = append(page.events, event)
+		}
+	}
+	return page, nil
+}
+
+// historyWrite identifies the history entries recorded by one create or
+// update: stores stamp every entry of a write with the same time.
+type historyWrite struct {
+	taskID    int
+	changedAt int64
+	changedBy string
+	batchID   string
+}
+
+// groupHistory numbers the write each history entry belongs to. The entries
+// of one write share a historyWrite and name each field once, so a repeated
+// field starts the task's next write even within the same microsecond.
+func groupHistory(history []TaskHistoryItem) []int {
+	type openWrite struct {
+		key    historyWrite
+		number int
+		fields map[string]bool
+	}
+	writes := make([]int, len(history))
+	open := make(map[int]*openWrite)
+	for i, entry := range history {
+		key := historyWrite{
+			taskID:    entry.TaskID,
+			changedAt: entry.ChangedAt.UnixMicro(),
+			changedBy: entry.ChangedBy,
+			batchID:   entry.BatchID,
+		}
+		write := open[entry.TaskID]
+		if write == nil || write.key != key || write.fields[entry.Field] {
+			write = &openWrite{key: key, number: i, fields: make(map[string]bool)}
+			open[entry.TaskID] = write
+		}
+		write.fields[entry.Field] = true
+		writes[i] = write.number
+	}
+	return writes
+}
+
+// historyEvent rebuilds a change event from a persisted history entry.
+func historyEvent(entry TaskHistoryItem, userID int) ChangeEvent {
+	change := entry
+	change.FromValue = copyStringPtr(entry.FromValue)
+	return ChangeEvent{
+		ID:          entry.ID,
+		Type:        EventTaskUpdated,
+		WorkspaceID: entry.WorkspaceID,
+		TaskID:      entry.TaskID,
+		UserID:      userID,
+		Change:      &change,
+		OccurredAt:  entry.ChangedAt,
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventFilterMatches(t *testing.T) {
+	previousOwner := "2"
+	reassigned := ChangeEvent{
+		Type:   EventTaskUpdated,
+		TaskID: 1,
+		UserID: 3,
+		Change: &TaskHistoryItem{Field: "userId", FromValue: &previousOwner, ToValue: "3"},
+	}
+
+	testCases := []struct {
+		name   string
+		filter EventFilter
+		event  ChangeEvent
+		want   bool
+	}{
+		{name: "empty filter", filter: EventFilter{}, event: ChangeEvent{Type: EventUserCreated, UserID: 9}, want: true},
+		{name: "task match", filter: EventFilter{TaskID: 1}, event: reassigned, want: true},
+		{name: "task mismatch", filter: EventFilter{TaskID: 2}, event: reassigned, want: false},
+		{name: "new assignee", filter: EventFilter{UserID: 3}, event: reassigned, want: true},
+		{name: "previous assignee", filter: EventFilter{UserID: 2}, event: reassigned, want: true},
+		{name: "unrelated user", filter: EventFilter{UserID: 1}, event: reassigned, want: false},
+		{name: "user event with task filter", filter: EventFilter{TaskID: 1}, event: ChangeEvent{Type: EventUserCreated, UserID: 1}, want: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.Matches(tc.event); got != tc.want {
+				t.Fatalf("expected match=%v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestEventBusDeliversToMatchingSubscribers(t *testing.T) {
+	bus := NewEventBus()
+
+	all, unsubscribeAll := bus.Subscribe(EventFilter{})
+	defer unsubscribeAll()
+	taskOnly, unsubscribeTask := bus.Subscribe(EventFilter{TaskID: 2})
+	defer unsubscribeTask()
+
+	bus.Publish(ChangeEvent{ID: 1, Type: EventTaskUpdated, TaskID: 1})
+	bus.Publish(ChangeEvent{ID: 2, Type: EventTaskUpdated, TaskID: 2})
+
+	first := <-all
+	if first.ID != 1 {
+		t.Fatalf("expected first event ID 1, got %d", first.ID)
+	}
+	if first.OccurredAt.IsZero() {
+		t.Fatal("expected publish to stamp occurredAt")
+	}
+	if event := <-all; event.ID != 2 {
+		t.Fatalf("expected second event ID 2, got %d", event.ID)
+	}
+	if event := <-taskOnly; event.ID != 2 {
+		t.Fatalf("expected filtered subscriber to receive event 2, got %d", event.ID)
+	}
+}
+
+func TestEventBusDropsSlowSubscriber(t *testing.T) {
+	bus := NewEventBus()
+
+	events, unsubscribe := bus.Subscribe(EventFilter{})
+	defer unsubscribe()
+
+	for i := 0; i <= eventSubscriberBuffer; i++ {
+		bus.Publish(ChangeEvent{ID: i + 1, Type: EventTaskUpdated, TaskID: 1})
+	}
+
+	if bus.SubscriberCount() != 0 {
+		t.Fatalf("expected slow subscriber to be dropped, got %d subscribers", bus.SubscriberCount())
+	}
+
+	received := 0
+	for range events {
+		received++
+	}
+	if received != eventSubscriberBuffer {
+		t.Fatalf("expected %d buffered events before close, got %d", eventSubscriberBuffer, received)
+	}
+}
+
+func TestEventBusUnsubscribeIsIdempotent(t *testing.T) {
+	bus := NewEventBus()
+
+	events, unsubscribe := bus.Subscribe(EventFilter{})
+	unsubscribe()
+	unsubscribe()
+
+	if _, ok := <-events; ok {
+		t.Fatal("expected channel to be closed after unsubscribe")
+	}
+	if bus.SubscriberCount() != 0 {
+		t.Fatalf("expected no subscribers, got %d", bus.SubscriberCount())
+	}
+
+	var nilBus *EventBus
+	nilBus.Publish(ChangeEvent{Type: EventUserCreated})
+}
+
+func TestReplayHistoryPagesKeepUpdatesWhole(t *testing.T) {
+	ds := NewDataStore(
+		[]User{{ID: 1, Name: "Alice", Email: "alice@example.com", Role: "developer"}},
+		[]Task{{ID: 1, Title: "First", Status: "pending", UserID: 1}},
+	)
+	ctx := context.Background()
+	before, _ := ds.GetTaskHistorySince(ctx, 0, 100)
+	base := 0
+	if len(before) > 0 {
+		base = before[len(before)-1].ID
+	}
+
+	title, completed, pending := "Renamed", "completed", "pending"
+	if _, err := ds.UpdateTask(ctx, 1, TaskUpdate{Title: &title, Status: &completed}, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.UpdateTask(ctx, 1, TaskUpdate{Status: &pending}, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	first, second := base+2, base+3
+
+	testCases := []struct {
+		name        string
+		afterID     int
+		limit       int
+		wantEvents  []int
+		wantThrough int
+		wantMore    bool
+	}{
+		{"full page of one update", base, 2, []int{first}, first, true},
+		{"page ending inside an update", base, 3, []int{first}, first, true},
+		{"last page", first, 3, []int{second}, second, false},
+		{"caught up", second, 3, nil, second, false},
+	}
+	for _, tc := range testCases {
+		page, err := replayHistory(ctx, ds, tc.afterID, tc.limit, EventFilter{})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var ids []int
+		for _, event := range page.events {
+			ids = append(ids, event.ID)
+		}
+		if !reflect.DeepEqual(ids, tc.wantEvents) || page.through != tc.wantThrough || page.more != tc.wantMore {
+			t.Fatalf("%s: got events %v through %d more %v", tc.name, ids, page.through, page.more)
+		}
+	}
+}
+
+func TestGroupHistorySplitsRepeatedFields(t *testing.T) {
+	at := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	entry := func(taskID int, field string) TaskHistoryItem {
+		return TaskHistoryItem{TaskID: taskID, ChangedAt: at, ChangedBy: "alice", Field: field}
+	}
+	history := []TaskHistoryItem{
+		entry(1, "title"), entry(2, "status"), entry(1, "status"),
+		// The same actor changing task 1 again within the microsecond.
+		entry(1, "status"),
+		entry(2, "userId"),
+	}
+
+	want := []int{0, 1, 0, 3, 1}
+	if got := groupHistory(history); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected writes %v, got %v", want, got)
+	}
+}
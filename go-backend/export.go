@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+
+	// exportFlushRows is how many rows are buffered between flushes.
+	exportFlushRows = 100
+)
+
+// exportSource is implemented by stores that can stream rows for export
+// without loading them all into memory. fn is called once per row, in ID
+// order; an error from fn stops the export and is returned.
+type exportSource interface {
+	ExportTasks(ctx context.Context, status, userID string, fn func(Task) error) error
+	ExportUsers(ctx context.Context, fn func(User) error) error
+	ExportHistory(ctx context.Context, fn func(TaskHistoryItem) error) error
+}
+
+// exportFormat is a supported export encoding.
+type exportFormat struct {
+	name        string
+	contentType string
+}
+
+var exportFormats = []exportFormat{
+	{name: "csv", contentType: csvContentType},
+	{name: "ndjson", contentType: ndjsonContentType},
+}
+
+// negotiateExportFormat picks the format from ?format=, then Accept. No
+// preference means CSV.
+func negotiateExportFormat(r *http.Request) (exportFormat, error) {
+	if name := strings.TrimSpace(r.URL.Query().Get("format")); name != "" {
+		return exportFormatByName(name)
+	}
+
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return exportFormats[0], nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case "*/*", "text/*":
+			return exportFormats[0], nil
+		}
+		for _, format := range exportFormats {
+			if mediaType == format.contentType {
+				return format, nil
+			}
+		}
+	}
+	return exportFormat{}, errors.New("acceptable formats are text/csv and application/x-ndjson")
+}
+
+func exportFormatByName(name string) (exportFormat, error) {
+	for _, format := range exportFormats {
+		if strings.EqualFold(name, format.name) {
+			return format, nil
+		}
+	}
+	return exportFormat{}, fmt.Errorf("invalid format %q (want csv or ndjson)", name)
+}
+
+// rowWriter encodes export rows in one format.
+type rowWriter interface {
+	writeHeader(columns []string) error
+	writeRow(record []string, value any) error
+	flush() error
+}
+
+func newRowWriter(format exportFormat, w io.Writer) rowWriter {
+	if format.contentType == csvContentType {
+		return csvRowWriter{w: csv.NewWriter(w)}
+	}
+	return ndjsonRowWriter{enc: json.NewEncoder(w)}
+}
+
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func (c csvRowWriter) writeHeader(columns []string) error {
+	return c.w.Write(columns)
+}
+
+func (c csvRowWriter) writeRow(record []string, _ any) error {
+	for i, field := range record {
+		record[i] = csvSafe(field)
+	}
+	return c.w.Write(record)
+}
+
+func (c csvRowWriter) flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvSafe stops spreadsheets from evaluating user-supplied text as a formula.
+func csvSafe(field string) string {
+	if field != "" && strings.ContainsRune("=+-@\t\r", rune(field[0])) {
+		return "'" + field
+	}
+	return field
+}
+
+type ndjsonRowWriter struct {
+	enc *json.Encoder
+}
+
+func (ndjsonRowWriter) writeHeader([]string) error { return nil }
+
+func (n ndjsonRowWriter) writeRow(_ []string, value any) error {
+	return n.enc.Encode(value)
+}
+
+func (ndjsonRowWriter) flush() error { return nil }
+
+// exportStream writes rows to the response, sending headers with the first
+// row so a failure before any output still gets a problem response.
+type exportStream struct {
+	s          *Server
+	w          http.ResponseWriter
+	r          *http.Request
+	format     exportFormat
+	name       string
+	columns    []string
+	rows       rowWriter
+	controller *http.ResponseController
+	count      int
+}
+
+func (s *Server) newExportStream(w http.ResponseWriter, r *http.Request, format exportFormat, name string, columns []string) *exportStream {
+	return &exportStream{
+		s:          s,
+		w:          w,
+		r:          r,
+		format:     format,
+		name:       name,
+		columns:    columns,
+		rows:       newRowWriter(format, w),
+		controller: http.NewResponseController(w),
+	}
+}
+
+func (e *exportStream) start() error {
+	filename := fmt.Sprintf("%s-%s.%s", e.name, time.Now().UTC().Format("20060102"), e.format.name)
+	e.w.Header().Set("Content-Type", e.format.contentType+"; charset=utf-8")
+	e.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	e.w.Header().Set("Cache-Control", "no-store")
+	e.w.WriteHeader(http.StatusOK)
+	return e.rows.writeHeader(e.columns)
+}
+
+func (e *exportStream) write(record []string, value any) error {
+	if e.count == 0 {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+	if err := e.rows.writeRow(record, value); err != nil {
+		return err
+	}
+	e.count++
+	if e.count%exportFlushRows == 0 {
+		if err := e.rows.flush(); err != nil {
+			return err
+		}
+		return e.controller.Flush()
+	}
+	return nil
+}
+
+// finish completes the export. An error after the first row can only be
+// logged: the status line has already been sent.
+func (e *exportStream) finish(err error) {
+	if err != nil {
+		e.s.logger.ErrorContext(e.r.Context(), "export failed", "export", e.name, "rows", e.count, "error", err)
+		if e.count == 0 {
+			e.s.writeError(e.w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+	if e.count == 0 {
+		if err := e.start(); err != nil {
+			return
+		}
+	}
+	if err := e.rows.flush(); err != nil {
+		e.s.logger.ErrorContext(e.r.Context(), "export failed", "export", e.name, "rows", e.count, "error", err)
+	}
+}
+
+// beginExport checks the format, permission and store support shared by
+// every export endpoint.
+func (s *Server) beginExport(w http.ResponseWriter, r *http.Request, permission string) (exportFormat, bool) {
+	format, err := negotiateExportFormat(r)
+	if err != nil {
+		status := http.StatusNotAcceptable
+		if r.URL.Query().Has("format") {
+			status = http.StatusBadRequest
+		}
+		s.writeError(w, status, err.Error())
+		return exportFormat{}, false
+	}
+	if _, ok := s.authorize(w, r, permission); !ok {
+		return exportFormat{}, false
+	}
+	if s.exports == nil {
+		s.writeError(w, http.StatusNotImplemented, "export is not supported by this store")
+		return exportFormat{}, false
+	}
+
+	// Large exports outlive the server-wide WriteTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	return format, true
+}
+
+var taskExportColumns = []string{"id", "workspace_id", "title", "status", "user_id", "last_changed_at", "last_changed_by"}
+
+// handleExportTasks streams tasks, filtered like GET /api/tasks.
+func (s *Server) handleExportTasks(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	userID := r.URL.Query().Get("userId")
+	if userID != "" {
+		parsedUserID, err := strconv.Atoi(userID)
+		if err != nil || parsedUserID <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid userId query parameter")
+			return
+		}
+	}
+	format, ok := s.beginExport(w, r, permTasksRead)
+	if !ok {
+		return
+	}
+
+	stream := s.newExportStream(w, r, format, "tasks", taskExportColumns)
+	stream.finish(s.exports.ExportTasks(r.Context(), status, userID, func(task Task) error {
+		return stream.write(taskExportRecord(task), task)
+	}))
+}
+
+func taskExportRecord(task Task) []string {
+	record := []string{strconv.Itoa(task.ID), task.WorkspaceID, task.Title, task.Status, strconv.Itoa(task.UserID), "", ""}
+	if task.LastChange != nil {
+		record[5] = task.LastChange.ChangedAt.Format(time.RFC3339)
+		record[6] = task.LastChange.ChangedBy
+	}
+	return record
+}
+
+var userExportColumns = []string{"id", "workspace_id", "name", "email", "role"}
+
+func (s *Server) handleExportUsers(w http.ResponseWriter, r *http.Request) {
+	format, ok := s.beginExport(w, r, permUsersRead)
+	if !ok {
+		return
+	}
+
+	stream := s.newExportStream(w, r, format, "users", userExportColumns)
+	stream.finish(s.exports.ExportUsers(r.Context(), func(user User) error {
+		return stream.write(userExportRecord(user), user)
+	}))
+}
+
+func userExportRecord(user User) []string {
+	return []string{strconv.Itoa(user.ID), user.WorkspaceID, user.Name, user.Email, user.Role}
+}
+
+var historyExportColumns = []string{"id", "workspace_id", "task_id", "changed_at", "changed_by", "field", "from_value", "to_value", "batch_id"}
+
+func (s *Server) handleExportHistory(w http.ResponseWriter, r *http.Request) {
+	format, ok := s.beginExport(w, r, permTasksRead)
+	if !ok {
+		return
+	}
+
+	stream := s.newExportStream(w, r, format, "history", historyExportColumns)
+	stream.finish(s.exports.ExportHistory(r.Context(), func(entry TaskHistoryItem) error {
+		return stream.write(historyExportRecord(entry), entry)
+	}))
+}
+
+func historyExportRecord(entry TaskHistoryItem) []string {
+	fromValue := ""
+	if entry.FromValue != nil {
+		fromValue = *entry.FromValue
+	}
+	return []string{
+		strconv.Itoa(entry.ID),
+		entry.WorkspaceID,
+		strconv.Itoa(entry.TaskID),
+		entry.ChangedAt.Format(time.RFC3339),
+		entry.ChangedBy,
+		entry.Field,
+		fromValue,
+		entry.ToValue,
+		entry.BatchID,
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportTasksCSV(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequest(s.Handler(), http.MethodGet, "/api/export/tasks?status=pending", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if got := res.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Fatalf("unexpected Content-Type %q", got)
+	}
+	if got := res.Header().Get("Content-Disposition"); !strings.HasPrefix(got, `attachment; filename=tasks-`) || !strings.HasSuffix(got, ".csv") {
+		t.Fatalf("unexpected Content-Disposition %q", got)
+	}
+
+	records, err := csv.NewReader(res.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if !reflect.DeepEqual(records[0], taskExportColumns) {
+		t.Fatalf("expected header %v, got %v", taskExportColumns, records[0])
+	}
+	if len(records) != 2 || records[1][0] != "1" || records[1][3] != "pending" {
+		t.Fatalf("expected only the pending task, got %v", records)
+	}
+
+	if res := performRequest(s.Handler(), http.MethodGet, "/api/export/tasks?userId=abc", ""); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a bad filter, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/export/users", "", map[string]string{"Accept": "application/x-ndjson"})
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var users []User
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var user User
+		if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+			t.Fatalf("decode line %q: %v", scanner.Text(), err)
+		}
+		users = append(users, user)
+	}
+	if demo := demoFixtures(t); len(users) != len(demo.Users) || users[0].Email != demo.Users[0].Email {
+		t.Fatalf("expected every user, got %+v", users)
+	}
+
+	res = performRequest(s.Handler(), http.MethodGet, "/api/export/history?format=ndjson", "")
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != ndjsonContentType+"; charset=utf-8" {
+		t.Fatalf("expected NDJSON history, got %d %q", res.Code, res.Header().Get("Content-Type"))
+	}
+}
+
+func TestExportFormatNegotiation(t *testing.T) {
+	s := newTestServer(t)
+
+	testCases := []struct {
+		name       string
+		path       string
+		accept     string
+		wantStatus int
+	}{
+		{name: "unknown format", path: "/api/export/tasks?format=xlsx", wantStatus: http.StatusBadRequest},
+		{name: "unacceptable", path: "/api/export/tasks", accept: "application/xml", wantStatus: http.StatusNotAcceptable},
+		{name: "wildcard", path: "/api/export/tasks", accept: "application/xml, */*;q=0.1", wantStatus: http.StatusOK},
+		{name: "query wins", path: "/api/export/tasks?format=csv", accept: "application/xml", wantStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tc.accept != "" {
+				headers["Accept"] = tc.accept
+			}
+			res := performRequestWithHeaders(s.Handler(), http.MethodGet, tc.path, "", headers)
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d body=%s", tc.wantStatus, res.Code, res.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSVSafe(t *testing.T) {
+	for field, want := range map[string]string{"=SUM(A1)": "'=SUM(A1)", "@cmd": "'@cmd", "plain": "plain", "": ""} {
+		if got := csvSafe(field); got != want {
+			t.Fatalf("csvSafe(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
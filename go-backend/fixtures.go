@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fixtureSets are the named fixture sets built into the binary, one YAML
+// file per set.
+//
+//go:embed fixtures/*.yaml
+var fixtureSets embed.FS
+
+// SeedMode selects how fixtures are written.
+type SeedMode string
+
+const (
+	// SeedIfEmpty fills each table only while it has no rows, so a populated
+	// database is left alone.
+	SeedIfEmpty SeedMode = "if-empty"
+	// SeedUpsert inserts every fixture row or overwrites the row with its ID,
+	// so running it again changes nothing.
+	SeedUpsert SeedMode = "upsert"
+)
+
+func parseSeedMode(value string) (SeedMode, error) {
+	switch mode := SeedMode(strings.TrimSpace(value)); mode {
+	case "":
+		return SeedIfEmpty, nil
+	case SeedIfEmpty, SeedUpsert:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid seed mode %q (want %s or %s)", value, SeedIfEmpty, SeedUpsert)
+	}
+}
+
+// Fixtures are users, tasks and task history to seed a store with. IDs are
+// kept as given so rows can refer to each other, and rows without a
+// workspace go to the default one.
+type Fixtures struct {
+	Users   []User            `json:"users"`
+	Tasks   []Task            `json:"tasks"`
+	History []TaskHistoryItem `json:"history"`
+}
+
+// fixtureSetNames lists the built-in sets, sorted.
+func fixtureSetNames() []string {
+	entries, _ := fixtureSets.ReadDir("fixtures")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), ".yaml"))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// loadFixtures reads the built-in set named source, or else the YAML or JSON
+// file at path source, and validates it.
+func loadFixtures(source string) (Fixtures, error) {
+	data, err := fixtureSets.ReadFile(path.Join("fixtures", source+".yaml"))
+	if err != nil {
+		data, err = os.ReadFile(source)
+		if errors.Is(err, fs.ErrNotExist) {
+			return Fixtures{}, fmt.Errorf("%q is neither a fixture set (%s) nor a file", source, strings.Join(fixtureSetNames(), ", "))
+		}
+		if err != nil {
+			return Fixtures{}, fmt.Errorf("read fixtures: %w", err)
+		}
+	}
+
+	fixtures, err := parseFixtures(data)
+	if err != nil {
+		return Fixtures{}, fmt.Errorf("decode fixtures %s: %w", source, err)
+	}
+	if err := fixtures.validate(); err != nil {
+		return Fixtures{}, fmt.Errorf("invalid fixtures %s: %w", source, err)
+	}
+	return fixtures, nil
+}
+
+// parseFixtures decodes YAML, or JSON as a subset of it. The document is
+// re-encoded as JSON so fields match the API's names and unknown fields are
+// rejected the same way.
+func parseFixtures(data []byte) (Fixtures, error) {
+	var document any
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return Fixtures{}, err
+	}
+	var fixtures Fixtures
+	if document == nil {
+		return fixtures, nil
+	}
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return Fixtures{}, err
+	}
+	if err := decodeJSON(bytes.NewReader(encoded), &fixtures); err != nil {
+		return Fixtures{}, err
+	}
+	return fixtures, nil
+}
+
+// validate fills in default workspaces and checks every row, that IDs are
+// unique, and that tasks and history refer to fixture rows in their own
+// workspace.
+func (f *Fixtures) validate() error {
+	var (
+		v       validator
+		userIDs = make(map[int]string, len(f.Users))
+		taskIDs = make(map[int]string, len(f.Tasks))
+		histIDs = make(map[int]bool, len(f.History))
+		emails  = make(map[string]bool, len(f.Users))
+	)
+	workspace := func(prefix string, id *string) {
+		if *id == "" {
+			*id = defaultWorkspaceID
+		} else if !isValidWorkspaceID(*id) {
+			v.add(prefix+"workspaceId", codeInvalidFormat, "invalid workspace ID "+*id)
+		}
+	}
+	uniqueID := func(prefix, kind string, id int, seen bool) {
+		switch {
+		case id <= 0:
+			v.add(prefix+"id", codeInvalidValue, "id must be a positive integer")
+		case seen:
+			v.add(prefix+"id", codeDuplicate, fmt.Sprintf("%s id %d is used twice", kind, id))
+		}
+	}
+
+	for i := range f.Users {
+		user := &f.Users[i]
+		prefix := fmt.Sprintf("users[%d].", i)
+		workspace(prefix, &user.WorkspaceID)
+		row := createUserRequest{Name: user.Name, Email: user.Email, Role: user.Role}
+		if err := row.validate(); err != nil {
+			v.addPrefixed(prefix, err)
+		}
+		user.Name, user.Email, user.Role = row.Name, row.Email, row.Role
+
+		_, seen := userIDs[user.ID]
+		uniqueID(prefix, "user", user.ID, seen)
+		userIDs[user.ID] = user.WorkspaceID
+		if key := user.WorkspaceID + "/" + strings.ToLower(user.Email); emails[key] {
+			v.add(prefix+"email", codeDuplicate, "email "+user.Email+" is used twice")
+		} else {
+			emails[key] = true
+		}
+	}
+
+	for i := range f.Tasks {
+		task := &f.Tasks[i]
+		prefix := fmt.Sprintf("tasks[%d].", i)
+		workspace(prefix, &task.WorkspaceID)
+		row := createTaskRequest{Title: task.Title, Status: task.Status, UserID: &task.UserID}
+		if err := row.validate(); err != nil {
+			v.addPrefixed(prefix, err)
+		}
+		task.Title, task.Status = row.Title, row.Status
+
+		_, seen := taskIDs[task.ID]
+		uniqueID(prefix, "task", task.ID, seen)
+		taskIDs[task.ID] = task.WorkspaceID
+		if userWorkspace, ok := userIDs[task.UserID]; !ok || userWorkspace != task.WorkspaceID {
+			v.add(prefix+"userId", codeUnknownReference, fmt.Sprintf("user %d is not a fixture user in workspace %s", task.UserID, task.WorkspaceID))
+		}
+	}
+
+	for i := range f.History {
+		entry := &f.History[i]
+		prefix := fmt.Sprintf("history[%d].", i)
+		workspace(prefix, &entry.WorkspaceID)
+		uniqueID(prefix, "history", entry.ID, histIDs[entry.ID])
+		histIDs[entry.ID] = true
+		if taskWorkspace, ok := taskIDs[entry.TaskID]; !ok || taskWorkspace != entry.WorkspaceID {
+			v.add(prefix+"taskId", codeUnknownReference, fmt.Sprintf("task %d is not a fixture task in workspace %s", entry.TaskID, entry.WorkspaceID))
+		}
+		if entry.ChangedAt.IsZero() {
+			v.add(prefix+"changedAt", codeRequired, "changedAt is required")
+		}
+		if entry.ChangedBy == "" {
+			v.add(prefix+"changedBy", codeRequired, "changedBy is required")
+		}
+		if !containsString(historyFields, entry.Field) {
+			v.add(prefix+"field", codeInvalidValue, "field must be one of "+strings.Join(historyFields, ", "))
+		}
+		if entry.ToValue == "" {
+			v.add(prefix+"toValue", codeRequired, "toValue is required")
+		}
+	}
+
+	return v.err()
+}
+
+// historyFields are the task fields history entries record.
+var historyFields = []string{"title", "status", "userId"}
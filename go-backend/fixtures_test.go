@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// demoFixtures loads the demo set, which the store tests are written against.
+func demoFixtures(t testing.TB) Fixtures {
+	t.Helper()
+	fixtures, err := loadFixtures("demo")
+	if err != nil {
+		t.Fatalf("load demo fixtures: %v", err)
+	}
+	return fixtures
+}
+
+func newDemoDataStore(t testing.TB) *DataStore {
+	t.Helper()
+	ds := NewDataStore(nil, nil)
+	if err := ds.Seed(context.Background(), demoFixtures(t), SeedIfEmpty); err != nil {
+		t.Fatalf("seed demo fixtures: %v", err)
+	}
+	return ds
+}
+
+func TestFixtureSetsAreValid(t *testing.T) {
+	names := fixtureSetNames()
+	for _, want := range []string{"demo", "e2e", "empty"} {
+		if !containsString(names, want) {
+			t.Fatalf("expected fixture set %q, got %v", want, names)
+		}
+	}
+	for _, name := range names {
+		if _, err := loadFixtures(name); err != nil {
+			t.Fatalf("fixture set %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadFixturesFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"fixtures.json": `{
+			"users": [{"id": 10, "name": " Dana ", "email": "dana@example.com", "role": "developer"}],
+			"tasks": [{"id": 20, "title": "Onboard", "status": "pending", "userId": 10}]
+		}`,
+		"fixtures.yaml": `
+users:
+  - {id: 10, name: " Dana ", email: dana@example.com, role: developer}
+tasks:
+  - {id: 20, title: Onboard, status: pending, userId: 10}
+`,
+	}
+	for name, body := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		fixtures, err := loadFixtures(path)
+		if err != nil {
+			t.Fatalf("%s: loadFixtures: %v", name, err)
+		}
+		if len(fixtures.Users) != 1 || fixtures.Users[0].Name != "Dana" || fixtures.Users[0].WorkspaceID != defaultWorkspaceID || fixtures.Tasks[0].UserID != 10 {
+			t.Fatalf("%s: unexpected fixtures: %+v", name, fixtures)
+		}
+	}
+
+	misspelled := filepath.Join(dir, "misspelled.yaml")
+	if err := os.WriteFile(misspelled, []byte("task:\n  - {id: 1, title: Typo, status: pending, userId: 10}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFixtures(misspelled); err == nil {
+		t.Fatal("expected a misspelled section to be rejected rather than ignored")
+	}
+	if _, err := loadFixtures("staging"); err == nil {
+		t.Fatal("expected an unknown set name to be rejected")
+	}
+}
+
+func TestFixturesValidateReportsEveryRow(t *testing.T) {
+	fixtures := Fixtures{
+		Users: []User{
+			{ID: 1, Name: "Ann", Email: "ann@example.com", Role: "developer"},
+			{ID: 1, Name: "Bob", Email: "ANN@example.com", Role: "developer"},
+			{ID: 2, WorkspaceID: "acme", Name: "Cy", Email: "cy@example.com", Role: "developer"},
+		},
+		Tasks: []Task{
+			{ID: 0, Title: "T", Status: "pending", UserID: 1},
+			{ID: 2, Title: "T", Status: "done", UserID: 9},
+			{ID: 3, Title: "T", Status: "pending", UserID: 2},
+		},
+		History: []TaskHistoryItem{
+			{ID: 1, TaskID: 2, ChangedBy: "system", Field: "priority", ToValue: "high"},
+		},
+	}
+
+	codes := fieldErrorCodes(ProblemDetails{Errors: fixtures.validate().(*ValidationError).Errors})
+	want := map[string]string{
+		"users[1].id":          codeDuplicate,
+		"users[1].email":       codeDuplicate,
+		"tasks[0].id":          codeInvalidValue,
+		"tasks[1].status":      codeInvalidValue,
+		"tasks[1].userId":      codeUnknownReference,
+		"tasks[2].userId":      codeUnknownReference,
+		"history[0].changedAt": codeRequired,
+		"history[0].field":     codeInvalidValue,
+	}
+	for field, code := range want {
+		if codes[field] != code {
+			t.Fatalf("expected %q to fail with %q, got %v", field, code, codes)
+		}
+	}
+}
+
+func TestParseSeedMode(t *testing.T) {
+	for value, want := range map[string]SeedMode{"": SeedIfEmpty, "if-empty": SeedIfEmpty, "upsert": SeedUpsert} {
+		if got, err := parseSeedMode(value); err != nil || got != want {
+			t.Fatalf("parseSeedMode(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := parseSeedMode("replace"); err == nil {
+		t.Fatal("expected an unknown mode to be rejected")
+	}
+}
+
+func TestDataStoreSeedModes(t *testing.T) {
+	ctx := context.Background()
+	ds := newDemoDataStore(t)
+
+	changed := demoFixtures(t)
+	changed.Users[0].Name = "Johnny Doe"
+	if err := ds.Seed(ctx, changed, SeedIfEmpty); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+	if user, _, _ := ds.GetUserByID(ctx, 1); user.Name != "John Doe" {
+		t.Fatalf("expected if-empty to leave populated tables alone, got %q", user.Name)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := ds.Seed(ctx, changed, SeedUpsert); err != nil {
+			t.Fatalf("Seed: %v", err)
+		}
+	}
+	users, _ := ds.GetUsers(ctx)
+	history, _ := ds.GetTaskHistory(ctx, 1)
+	if len(users) != len(changed.Users) || users[0].Name != "Johnny Doe" || len(history) != 1 {
+		t.Fatalf("expected upserts to overwrite rows without duplicating them, got %+v and %+v", users, history)
+	}
+
+	// Rows created after seeding do not reuse fixture IDs.
+	task, err := ds.CreateTask(ctx, "Next", "pending", 1, "admin")
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	history, _ = ds.GetTaskHistory(ctx, task.ID)
+	if task.ID != len(changed.Tasks)+1 || history[0].ID != len(changed.History)+1 {
+		t.Fatalf("expected new IDs after the fixtures, got task %d history %d", task.ID, history[0].ID)
+	}
+}
+
+func TestDataStoreSeedRejectsUnknownUserAtomically(t *testing.T) {
+	ds := NewDataStore(nil, nil)
+	fixtures := Fixtures{Tasks: []Task{{ID: 1, WorkspaceID: defaultWorkspaceID, Title: "T", Status: "pending", UserID: 1}}}
+
+	if err := ds.Seed(context.Background(), fixtures, SeedUpsert); !errors.Is(err, ErrUserDoesNotExist) {
+		t.Fatalf("expected ErrUserDoesNotExist, got %v", err)
+	}
+	if tasks, _ := ds.GetTasks(context.Background(), "", ""); len(tasks) != 0 {
+		t.Fatalf("expected nothing to be seeded, got %+v", tasks)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// readinessCheckTimeout is the default HTTPConfig.ReadinessTimeout.
+	readinessCheckTimeout = 1 * time.Second
+
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+	healthStatusDraining    = "draining"
+)
+
+// ErrMigrationsPending is returned when the database schema is behind the code.
+var ErrMigrationsPending = errors.New("migrations pending")
+
+// Pinger is implemented by stores that can verify their backing dependency is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// migrationChecker is implemented by stores whose schema must be migrated before serving.
+type migrationChecker interface {
+	CheckMigrations(ctx context.Context) error
+}
+
+// HealthCheck is the outcome of one readiness check.
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// PoolStats is the connection pool snapshot included in verbose health output.
+type PoolStats struct {
+	MaxOpenConnections int     `json:"maxOpenConnections"`
+	OpenConnections    int     `json:"openConnections"`
+	InUse              int     `json:"inUse"`
+	Idle               int     `json:"idle"`
+	WaitCount          int64   `json:"waitCount"`
+	WaitDurationMs     float64 `json:"waitDurationMs"`
+}
+
+func newPoolStats(stats sql.DBStats) *PoolStats {
+	return &PoolStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDurationMs:     durationMillis(stats.WaitDuration),
+	}
+}
+
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	s.writeJSON(w, http.StatusOK, HealthResponse{
+		Status:  healthStatusOK,
+		Message: "process is alive",
+	})
+}
+
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	s.serveReadiness(w, r, "ready")
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.serveReadiness(w, r, "Go backend is running")
+}
+
+// serveReadiness runs the readiness checks and answers 200 when all pass or
+// 503 otherwise. ?verbose=1 adds per-check results and pool statistics.
+func (s *Server) serveReadiness(w http.ResponseWriter, r *http.Request, okMessage string) {
+	checks := s.runReadinessChecks(r.Context())
+
+	var failing []string
+	for name, check := range checks {
+		if check.Status != healthStatusOK {
+			failing = append(failing, name)
+		}
+	}
+	sort.Strings(failing)
+
+	status := http.StatusOK
+	response := HealthResponse{Status: healthStatusOK, Message: okMessage}
+	if len(failing) > 0 {
+		status = http.StatusServiceUnavailable
+		response.Status = healthStatusUnavailable
+		response.Message = "not ready: " + strings.Join(failing, ", ")
+	}
+
+	if isTruthy(r.URL.Query().Get("verbose")) {
+		response.Checks = checks
+		if s.pool != nil {
+			response.Pool = newPoolStats(s.pool.DBStats())
+		}
+	}
+
+	s.writeJSON(w, status, response)
+}
+
+// runReadinessChecks pings the store and checks migrations, each with its own
+// short timeout, and reports the drain state during graceful shutdown.
+func (s *Server) runReadinessChecks(ctx context.Context) map[string]HealthCheck {
+	checks := make(map[string]HealthCheck)
+
+	if s.draining.Load() {
+		checks["shutdown"] = HealthCheck{Status: healthStatusDraining, Error: "server is shutting down"}
+	} else {
+		checks["shutdown"] = HealthCheck{Status: healthStatusOK}
+	}
+
+	timeout := s.settings.Load().readinessTimeout
+	if s.pinger != nil {
+		checks["store"] = runHealthCheck(ctx, timeout, s.pinger.Ping)
+	}
+	if s.migrations != nil {
+		checks["migrations"] = runHealthCheck(ctx, timeout, s.migrations.CheckMigrations)
+	}
+
+	return checks
+}
+
+func runHealthCheck(ctx context.Context, timeout time.Duration, check func(context.Context) error) HealthCheck {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(ctx)
+	result := HealthCheck{Status: healthStatusOK, LatencyMs: durationMillis(time.Since(start))}
+	if err != nil {
+		result.Status = healthStatusUnavailable
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func durationMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func isTruthy(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+)
+
+// probeStore wraps the in-memory store with controllable dependency checks.
+type probeStore struct {
+	*DataStore
+	pingErr      error
+	migrationErr error
+}
+
+func (st *probeStore) Ping(ctx context.Context) error {
+	return st.pingErr
+}
+
+func (st *probeStore) CheckMigrations(ctx context.Context) error {
+	return st.migrationErr
+}
+
+func newProbeServer(t *testing.T, store *probeStore) *Server {
+	t.Helper()
+
+	store.DataStore = NewDataStore(nil, nil)
+	s := NewServer(store)
+	s.logger = discardLogger()
+	return s
+}
+
+func TestLivezIgnoresDependencies(t *testing.T) {
+	s := newProbeServer(t, &probeStore{pingErr: errors.New("connection refused")})
+
+	res := performRequest(s.Handler(), http.MethodGet, "/livez", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	var body HealthResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &body)
+	if body.Status != healthStatusOK {
+		t.Fatalf("expected ok status, got %+v", body)
+	}
+}
+
+func TestReadyzReportsDependencyFailures(t *testing.T) {
+	testCases := []struct {
+		name        string
+		store       *probeStore
+		wantStatus  int
+		wantMessage string
+	}{
+		{name: "all checks pass", store: &probeStore{}, wantStatus: http.StatusOK, wantMessage: "ready"},
+		{name: "store unreachable", store: &probeStore{pingErr: errors.New("connection refused")}, wantStatus: http.StatusServiceUnavailable, wantMessage: "not ready: store"},
+		{name: "migrations pending", store: &probeStore{migrationErr: ErrMigrationsPending}, wantStatus: http.StatusServiceUnavailable, wantMessage: "not ready: migrations"},
+		{
+			name:        "both failing",
+			store:       &probeStore{pingErr: errors.New("timeout"), migrationErr: ErrMigrationsPending},
+			wantStatus:  http.StatusServiceUnavailable,
+			wantMessage: "not ready: migrations, store",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newProbeServer(t, tc.store)
+
+			for _, path := range []string{"/readyz", "/health"} {
+				res := performRequest(s.Handler(), http.MethodGet, path, "")
+				if res.Code != tc.wantStatus {
+					t.Fatalf("%s: expected status %d, got %d", path, tc.wantStatus, res.Code)
+				}
+			}
+
+			res := performRequest(s.Handler(), http.MethodGet, "/readyz", "")
+			var body HealthResponse
+			decodeJSONResponse(t, res.Body.Bytes(), &body)
+			if body.Message != tc.wantMessage {
+				t.Fatalf("expected message %q, got %q", tc.wantMessage, body.Message)
+			}
+			if body.Checks != nil {
+				t.Fatalf("expected no check details without verbose, got %v", body.Checks)
+			}
+		})
+	}
+}
+
+func TestHealthVerboseShowsChecks(t *testing.T) {
+	s := newProbeServer(t, &probeStore{pingErr: errors.New("connection refused")})
+
+	res := performRequest(s.Handler(), http.MethodGet, "/health?verbose=1", "")
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, res.Code)
+	}
+
+	var body HealthResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &body)
+	store := body.Checks["store"]
+	if store.Status != healthStatusUnavailable || store.Error != "connection refused" {
+		t.Fatalf("expected failing store check, got %+v", store)
+	}
+	if body.Checks["migrations"].Status != healthStatusOK || body.Checks["shutdown"].Status != healthStatusOK {
+		t.Fatalf("expected other checks to pass, got %+v", body.Checks)
+	}
+	if body.Pool != nil {
+		t.Fatalf("expected no pool stats for the in-memory store, got %+v", body.Pool)
+	}
+}
+
+func TestHealthVerboseIncludesPoolStatsForPostgres(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	mock.
+		ExpectQuery(`FROM information_schema.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(len(requiredTables)))
+
+	s := NewServer(store)
+	s.logger = discardLogger()
+
+	res := performRequest(s.Handler(), http.MethodGet, "/health?verbose=true", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	if !strings.Contains(res.Body.String(), `"pool":{"maxOpenConnections"`) {
+		t.Fatalf("expected pool stats in verbose health, got %s", res.Body.String())
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreCheckMigrations(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	mock.
+		ExpectQuery(`FROM information_schema.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.
+		ExpectQuery(`FROM information_schema.tables`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+	if err := store.CheckMigrations(context.Background()); !errors.Is(err, ErrMigrationsPending) {
+		t.Fatalf("expected ErrMigrationsPending, got %v", err)
+	}
+	if err := store.CheckMigrations(context.Background()); err != nil {
+		t.Fatalf("expected migrations to be applied, got %v", err)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestReadyzFailsWhileDraining(t *testing.T) {
+	s := newTestServer(t)
+	drainDelay := 500 * time.Millisecond
+	s.updateSettings(func(settings *serverSettings) { settings.drainDelay = drainDelay })
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	httpServer := &http.Server{Handler: s.Handler()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErrCh := make(chan error, 1)
+	go func() {
+		runErrCh <- s.runWithContext(ctx, httpServer, func() error {
+			return httpServer.Serve(listener)
+		})
+	}()
+
+	address := "http://" + listener.Addr().String() + "/readyz"
+	if status := getStatus(t, address); status != http.StatusOK {
+		t.Fatalf("expected ready before shutdown, got %d", status)
+	}
+
+	cancel()
+	deadline := time.Now().Add(drainDelay)
+	for {
+		if getStatus(t, address) == http.StatusServiceUnavailable {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected readiness to fail during drain")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := <-runErrCh; err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+}
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
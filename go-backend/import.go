@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Defaults for Limits. maxImportBodyBytes is larger than maxRequestBodyBytes:
+// an import carries a whole team.
+const (
+	maxImportBodyBytes = 10 << 20
+	maxImportRows      = 5000
+)
+
+// ImportBatch is a set of users and tasks created together. Task history
+// entries carry the batch ID and Actor.
+type ImportBatch struct {
+	ID    string
+	Actor string
+	Users []ImportUser
+	Tasks []ImportTask
+}
+
+type ImportUser struct {
+	Name  string
+	Email string
+	Role  string
+}
+
+// ImportTask is assigned to UserID, or to the user with UserEmail when set,
+// which may be one created by the same batch.
+type ImportTask struct {
+	Title     string
+	Status    string
+	UserID    int
+	UserEmail string
+}
+
+// ImportResult lists what an import created.
+type ImportResult struct {
+	Users []User
+	Tasks []Task
+}
+
+// importer is implemented by stores that can apply an ImportBatch all or
+// nothing.
+type importer interface {
+	Import(ctx context.Context, batch ImportBatch) (ImportResult, error)
+}
+
+type importRequest struct {
+	Users []createUserRequest `json:"users"`
+	Tasks []importTaskRow     `json:"tasks"`
+}
+
+// importTaskRow is a task to import. It names its user by userId or userEmail.
+type importTaskRow struct {
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	UserID    *int   `json:"userId"`
+	UserEmail string `json:"userEmail"`
+}
+
+// ImportResponse is the body of POST /api/import. A dry run reports only the
+// row counts.
+type ImportResponse struct {
+	DryRun    bool   `json:"dryRun"`
+	BatchID   string `json:"batchId,omitempty"`
+	UserCount int    `json:"userCount"`
+	TaskCount int    `json:"taskCount"`
+	Users     []User `json:"users,omitempty"`
+	Tasks     []Task `json:"tasks,omitempty"`
+}
+
+// handleImport creates users and tasks from a JSON body, or from CSV with
+// ?kind=users|tasks. Every row is validated first and any error rejects the
+// whole import; ?dryRun=true stops after validation.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if raw := r.URL.Query().Get("dryRun"); raw != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid dryRun query parameter")
+			return
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "application/json" && mediaType != csvContentType) {
+		s.writeError(w, http.StatusUnsupportedMediaType, "content type must be application/json or text/csv")
+		return
+	}
+	limits := s.settings.Load().limits
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxImportBodyBytes)
+
+	var req importRequest
+	if mediaType == csvContentType {
+		err = decodeImportCSV(r.Body, r.URL.Query().Get("kind"), &req)
+	} else {
+		err = decodeJSONBody(r, &req)
+	}
+	if err != nil {
+		s.writeDecodeError(w, err)
+		return
+	}
+	if len(req.Users)+len(req.Tasks) == 0 {
+		s.writeError(w, http.StatusBadRequest, "nothing to import")
+		return
+	}
+	if len(req.Users)+len(req.Tasks) > limits.MaxImportRows {
+		s.writeError(w, http.StatusBadRequest, fmt.Sprintf("an import may have at most %d rows", limits.MaxImportRows))
+		return
+	}
+
+	c, ok := s.authorize(w, r, req.permissions()...)
+	if !ok {
+		return
+	}
+
+	existing, err := s.dataStore.GetUsers(r.Context())
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "error loading users for import", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	batch, err := req.validate(existing)
+	if err != nil {
+		s.writeValidationError(w, err)
+		return
+	}
+
+	if s.settings.Load().policy != nil && !c.can(permTasksAssign) {
+		for _, task := range batch.Tasks {
+			if task.UserEmail != "" || task.UserID != c.userID {
+				s.writeForbidden(w, r, c, permTasksAssign)
+				return
+			}
+		}
+	}
+
+	response := ImportResponse{DryRun: dryRun, UserCount: len(batch.Users), TaskCount: len(batch.Tasks)}
+	if dryRun {
+		s.writeJSON(w, http.StatusOK, response)
+		return
+	}
+	if s.importer == nil {
+		s.writeError(w, http.StatusNotImplemented, "import is not supported by this store")
+		return
+	}
+
+	batch.ID = newRequestID()
+	batch.Actor = c.actor
+	result, err := s.importer.Import(r.Context(), batch)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidTaskStatus), errors.Is(err, ErrUserDoesNotExist):
+			s.writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			s.logger.ErrorContext(r.Context(), "error importing", "batch_id", batch.ID, "error", err)
+			s.writeError(w, http.StatusInternalServerError, "internal server error")
+		}
+		return
+	}
+
+	response.BatchID = batch.ID
+	response.Users = result.Users
+	response.Tasks = result.Tasks
+	s.writeJSON(w, http.StatusCreated, response)
+}
+
+// validate checks every row and the references between them against the
+// existing users, returning the batch to import. Field errors are prefixed
+// with the row, e.g. "users[2].email"; rows count from 0 after any CSV header.
+func (req *importRequest) validate(existing []User) (ImportBatch, error) {
+	var (
+		v      validator
+		batch  ImportBatch
+		emails = make(map[string]bool, len(existing)+len(req.Users))
+		userID = make(map[int]bool, len(existing))
+	)
+	for _, user := range existing {
+		emails[strings.ToLower(user.Email)] = true
+		userID[user.ID] = true
+	}
+
+	for i := range req.Users {
+		row := &req.Users[i]
+		prefix := fmt.Sprintf("users[%d].", i)
+		if err := row.validate(); err != nil {
+			v.addPrefixed(prefix, err)
+			continue
+		}
+		if key := strings.ToLower(row.Email); emails[key] {
+			v.add(prefix+"email", codeDuplicate, "a user with email "+row.Email+" already exists")
+		} else {
+			emails[key] = true
+		}
+		batch.Users = append(batch.Users, ImportUser{Name: row.Name, Email: row.Email, Role: row.Role})
+	}
+
+	for i := range req.Tasks {
+		row := &req.Tasks[i]
+		prefix := fmt.Sprintf("tasks[%d].", i)
+		if err := row.validate(); err != nil {
+			v.addPrefixed(prefix, err)
+			continue
+		}
+		task := ImportTask{Title: row.Title, Status: row.Status, UserEmail: row.UserEmail}
+		switch {
+		case row.UserEmail != "" && !emails[strings.ToLower(row.UserEmail)]:
+			v.add(prefix+"userEmail", codeUnknownReference, "no user has email "+row.UserEmail)
+		case row.UserID != nil && !userID[*row.UserID]:
+			v.add(prefix+"userId", codeUnknownReference, fmt.Sprintf("user %d does not exist", *row.UserID))
+		case row.UserID != nil:
+			task.UserID = *row.UserID
+		}
+		batch.Tasks = append(batch.Tasks, task)
+	}
+
+	if err := v.err(); err != nil {
+		return ImportBatch{}, err
+	}
+	return batch, nil
+}
+
+// permissions lists what the caller needs to import req. Tasks for other
+// users also need tasks:assign, checked once references are resolved.
+func (req *importRequest) permissions() []string {
+	var permissions []string
+	if len(req.Users) > 0 {
+		permissions = append(permissions, permUsersCreate)
+	}
+	if len(req.Tasks) > 0 {
+		permissions = append(permissions, permTasksCreate)
+	}
+	return permissions
+}
+
+// importColumns are the CSV columns accepted for each kind, named like the
+// JSON fields.
+var importColumns = map[string][]string{
+	"users": {"name", "email", "role"},
+	"tasks": {"title", "status", "userId", "userEmail"},
+}
+
+// decodeImportCSV reads CSV rows of kind into req. The header row names the
+// columns, in any order; empty userId cells mean no userId.
+func decodeImportCSV(body io.Reader, kind string, req *importRequest) error {
+	allowed, ok := importColumns[kind]
+	if !ok {
+		return errors.New("kind query parameter must be users or tasks for CSV imports")
+	}
+
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return errors.New("request body is required")
+	}
+	if err != nil {
+		return fmt.Errorf("invalid CSV: %w", err)
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if !containsString(allowed, header[i]) {
+			return fmt.Errorf("unknown CSV column %q (want %s)", header[i], strings.Join(allowed, ", "))
+		}
+	}
+
+	for row := 0; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid CSV: %w", err)
+		}
+		values := make(map[string]string, len(header))
+		for i, column := range header {
+			values[column] = strings.TrimSpace(record[i])
+		}
+
+		if kind == "users" {
+			req.Users = append(req.Users, createUserRequest{Name: values["name"], Email: values["email"], Role: values["role"]})
+			continue
+		}
+		task := importTaskRow{Title: values["title"], Status: values["status"], UserEmail: values["userEmail"]}
+		if raw := values["userId"]; raw != "" {
+			id, err := strconv.Atoi(raw)
+			if err != nil {
+				return &ValidationError{Errors: []FieldError{{
+					Field:   fmt.Sprintf("tasks[%d].userId", row),
+					Code:    codeInvalidType,
+					Message: fmt.Sprintf("userId %q is not a number", raw),
+				}}}
+			}
+			task.UserID = &id
+		}
+		req.Tasks = append(req.Tasks, task)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func csvHeaders() map[string]string {
+	return map[string]string{"Content-Type": "text/csv"}
+}
+
+func TestImportJSON(t *testing.T) {
+	s := newTestServer(t)
+
+	body := `{
+		"users": [{"name":"Dana","email":"dana@example.com","role":"developer"}],
+		"tasks": [
+			{"title":"Onboard","status":"pending","userEmail":"DANA@example.com"},
+			{"title":"Review","status":"in-progress","userId":2}
+		]
+	}`
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/import", body, asActor("alice"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var response ImportResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+	if len(response.Users) != 1 || len(response.Tasks) != 2 || response.BatchID == "" {
+		t.Fatalf("unexpected import response: %+v", response)
+	}
+	if response.Tasks[0].UserID != response.Users[0].ID || response.Tasks[1].UserID != 2 {
+		t.Fatalf("expected tasks assigned to the new user and user 2, got %+v", response.Tasks)
+	}
+
+	history, err := s.dataStore.GetTaskHistory(context.Background(), response.Tasks[0].ID)
+	if err != nil {
+		t.Fatalf("GetTaskHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].ChangedBy != "alice" || history[0].BatchID != response.BatchID {
+		t.Fatalf("expected creation history by alice in the import batch, got %+v", history)
+	}
+}
+
+func TestImportDryRunReportsEveryRow(t *testing.T) {
+	s := newTestServer(t)
+
+	body := `{
+		"users": [
+			{"name":"Dana","email":"dana@example.com","role":"developer"},
+			{"name":"","email":"john@example.com","role":"developer"},
+			{"name":"Eve","email":"DANA@example.com","role":"designer"}
+		],
+		"tasks": [
+			{"title":"T","status":"done","userEmail":"nobody@example.com"},
+			{"title":"T","status":"pending","userId":99},
+			{"title":"T","status":"pending"}
+		]
+	}`
+	res := performRequest(s.Handler(), http.MethodPost, "/api/import?dryRun=true", body)
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, res.Code, res.Body.String())
+	}
+	want := map[string]string{
+		"users[1].name":   codeRequired,
+		"users[2].email":  codeDuplicate,
+		"tasks[0].status": codeInvalidValue,
+		"tasks[1].userId": codeUnknownReference,
+		"tasks[2].userId": codeRequired,
+	}
+	codes := fieldErrorCodes(decodeProblem(t, res))
+	for field, code := range want {
+		if codes[field] != code {
+			t.Fatalf("expected %q to fail with %q, got %v", field, code, codes)
+		}
+	}
+
+	res = performRequest(s.Handler(), http.MethodPost, "/api/import?dryRun=true", `{"users":[{"name":"Dana","email":"dana@example.com","role":"developer"}]}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var response ImportResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &response)
+	if !response.DryRun || response.UserCount != 1 || response.Users != nil {
+		t.Fatalf("unexpected dry run response: %+v", response)
+	}
+	users, _ := s.dataStore.GetUsers(context.Background())
+	if len(users) != len(demoFixtures(t).Users) {
+		t.Fatalf("expected a dry run to write nothing, got %d users", len(users))
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+
+	res := performRequestWithHeaders(h, http.MethodPost, "/api/import?kind=users", "email,name,role\ndana@example.com,Dana,developer\n", csvHeaders())
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusCreated, res.Code, res.Body.String())
+	}
+
+	res = performRequestWithHeaders(h, http.MethodPost, "/api/import?kind=tasks", "title,status,userId,userEmail\nOnboard,pending,,dana@example.com\nFix,pending,x,\n", csvHeaders())
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, res.Code, res.Body.String())
+	}
+	if codes := fieldErrorCodes(decodeProblem(t, res)); codes["tasks[1].userId"] != codeInvalidType {
+		t.Fatalf("expected an invalid_type error for row 1, got %v", codes)
+	}
+
+	for path, body := range map[string]string{
+		"/api/import":            "title,status\nT,pending\n",
+		"/api/import?kind=tasks": "title,priority\nT,high\n",
+	} {
+		if res := performRequestWithHeaders(h, http.MethodPost, path, body, csvHeaders()); res.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d for %s, got %d", http.StatusBadRequest, path, res.Code)
+		}
+	}
+}
+
+func TestImportRequiresPermissions(t *testing.T) {
+	s := newPolicyTestServer(t, DefaultPolicy())
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/import", `{"users":[{"name":"Dana","email":"dana@example.com","role":"developer"}]}`, asActor("john@example.com"))
+	assertForbidden(t, res, permUsersCreate)
+
+	res = performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/import", `{"tasks":[{"title":"T","status":"pending","userId":2}]}`, asActor("john@example.com"))
+	assertForbidden(t, res, permTasksAssign)
+}
+
+func TestDataStoreImportIsAllOrNothing(t *testing.T) {
+	ds := newDemoDataStore(t)
+
+	_, err := ds.Import(context.Background(), ImportBatch{
+		ID:    "b1",
+		Users: []ImportUser{{Name: "Dana", Email: "dana@example.com", Role: "developer"}},
+		Tasks: []ImportTask{
+			{Title: "Onboard", Status: "pending", UserEmail: "dana@example.com"},
+			{Title: "Lost", Status: "pending", UserEmail: "nobody@example.com"},
+		},
+	})
+	if !errors.Is(err, ErrUserDoesNotExist) {
+		t.Fatalf("expected ErrUserDoesNotExist, got %v", err)
+	}
+
+	users, _ := ds.GetUsers(context.Background())
+	tasks, _ := ds.GetTasks(context.Background(), "", "")
+	if demo := demoFixtures(t); len(users) != len(demo.Users) || len(tasks) != len(demo.Tasks) {
+		t.Fatalf("expected nothing to be imported, got %d users and %d tasks", len(users), len(tasks))
+	}
+}
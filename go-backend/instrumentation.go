@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	unmatchedRoute        = "unmatched"
+	metricsGaugeTimeout   = 2 * time.Second
+	metricsStoreOperation = "operation"
+)
+
+// serverMetrics holds the collectors updated on the request and store paths.
+type serverMetrics struct {
+	registry      *metricsRegistry
+	httpRequests  *counterVec
+	httpDuration  *histogramVec
+	storeDuration *histogramVec
+	storeErrors   *counterVec
+	rateLimited   *counterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	registry := newMetricsRegistry()
+	return &serverMetrics{
+		registry: registry,
+		httpRequests: registry.NewCounterVec(
+			"http_requests_total",
+			"HTTP requests served, by route name, method and status code.",
+			"route", "method", "status",
+		),
+		httpDuration: registry.NewHistogramVec(
+			"http_request_duration_seconds",
+			"HTTP request latency, by route name, method and status code.",
+			defaultDurationBuckets,
+			"route", "method", "status",
+		),
+		storeDuration: registry.NewHistogramVec(
+			"store_operation_duration_seconds",
+			"Store call latency, by Store method.",
+			defaultDurationBuckets,
+			metricsStoreOperation,
+		),
+		storeErrors: registry.NewCounterVec(
+			"store_operation_errors_total",
+			"Store calls that failed, by Store method. Validation and not-found results are not counted.",
+			metricsStoreOperation,
+		),
+		rateLimited: registry.NewCounterVec(
+			"http_rate_limited_total",
+			"Requests rejected with 429 by the rate limiter, by route name.",
+			"route",
+		),
+	}
+}
+
+func (m *serverMetrics) observeRequest(route, method string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	m.httpRequests.Inc(route, method, statusLabel)
+	m.httpDuration.Observe(duration.Seconds(), route, method, statusLabel)
+}
+
+func (m *serverMetrics) observeStoreCall(operation string, start time.Time, err error) {
+	m.storeDuration.Observe(time.Since(start).Seconds(), operation)
+	if err != nil && !isDomainError(err) {
+		m.storeErrors.Inc(operation)
+	}
+}
+
+// isDomainError reports whether err is an expected outcome surfaced to the
+// client as a 4xx rather than a storage failure.
+func isDomainError(err error) bool {
+	return errors.Is(err, ErrTaskNotFound) ||
+		errors.Is(err, ErrInvalidTaskStatus) ||
+		errors.Is(err, ErrUserDoesNotExist)
+}
+
+// dbStatsSource is implemented by stores backed by a database/sql pool.
+type dbStatsSource interface {
+	DBStats() sql.DBStats
+}
+
+// registerStoreGauges adds the scrape-time gauges derived from the store:
+// pool statistics when available and business counts from GetStats.
+func (s *Server) registerStoreGauges(store Store) {
+	registry := s.metrics.registry
+
+	if source, ok := store.(dbStatsSource); ok {
+		poolGauge := func(value func(sql.DBStats) float64) func(context.Context) []metricSample {
+			return func(context.Context) []metricSample {
+				return []metricSample{{Value: value(source.DBStats())}}
+			}
+		}
+		registry.NewGaugeFunc("db_max_open_connections", "Maximum number of open connections to the database.", nil,
+			poolGauge(func(st sql.DBStats) float64 { return float64(st.MaxOpenConnections) }))
+		registry.NewGaugeFunc("db_open_connections", "Established connections, both in use and idle.", nil,
+			poolGauge(func(st sql.DBStats) float64 { return float64(st.OpenConnections) }))
+		registry.NewGaugeFunc("db_in_use_connections", "Connections currently in use.", nil,
+			poolGauge(func(st sql.DBStats) float64 { return float64(st.InUse) }))
+		registry.NewGaugeFunc("db_idle_connections", "Idle connections.", nil,
+			poolGauge(func(st sql.DBStats) float64 { return float64(st.Idle) }))
+		registry.NewCounterFunc("db_wait_count_total", "Connections waited for because the pool was exhausted.", nil,
+			poolGauge(func(st sql.DBStats) float64 { return float64(st.WaitCount) }))
+		registry.NewCounterFunc("db_wait_duration_seconds_total", "Time blocked waiting for a new connection.", nil,
+			poolGauge(func(st sql.DBStats) float64 { return st.WaitDuration.Seconds() }))
+	}
+
+	registry.NewGaugeFunc("users_total", "Users in the store.", nil, func(ctx context.Context) []metricSample {
+		stats, ok := s.scrapeStats(ctx)
+		if !ok {
+			return nil
+		}
+		return []metricSample{{Value: float64(stats.Users.Total)}}
+	})
+	registry.NewGaugeFunc("tasks", "Tasks in the store, by status.", []string{"status"}, func(ctx context.Context) []metricSample {
+		stats, ok := s.scrapeStats(ctx)
+		if !ok {
+			return nil
+		}
+		return []metricSample{
+			{LabelValues: []string{"pending"}, Value: float64(stats.Tasks.Pending)},
+			{LabelValues: []string{"in-progress"}, Value: float64(stats.Tasks.InProgress)},
+			{LabelValues: []string{"completed"}, Value: float64(stats.Tasks.Completed)},
+		}
+	})
+	registry.NewGaugeFunc("event_subscribers", "Open change-event subscriptions (SSE and WebSocket clients).", nil, func(context.Context) []metricSample {
+		return []metricSample{{Value: float64(s.events.SubscriberCount())}}
+	})
+}
+
+// scrapedStats shares one GetStats call between the gauges of a single scrape.
+type scrapedStats struct {
+	once  sync.Once
+	stats StatsResponse
+	err   error
+}
+
+func (s *Server) scrapeStats(ctx context.Context) (StatsResponse, bool) {
+	cached, ok := ctx.Value(scrapeStatsContextKey).(*scrapedStats)
+	if !ok {
+		cached = &scrapedStats{}
+	}
+	cached.once.Do(func() {
+		cached.stats, cached.err = s.dataStore.GetStats(ctx)
+		if cached.err != nil {
+			s.logger.ErrorContext(ctx, "error loading stats for metrics", "error", cached.err)
+		}
+	})
+	return cached.stats, cached.err == nil
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), metricsGaugeTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, scrapeStatsContextKey, &scrapedStats{})
+	// Gauges report totals across every workspace.
+	ctx = withWorkspace(ctx, allWorkspaces)
+
+	w.Header().Set("Content-Type", metricsContentType)
+	w.WriteHeader(http.StatusOK)
+	if err := s.metrics.registry.WriteTo(ctx, w); err != nil {
+		s.logger.WarnContext(r.Context(), "error writing metrics", "error", err)
+	}
+}
+
+// instrumentedStore records latency, failures and a trace span for every Store call.
+type instrumentedStore struct {
+	next    Store
+	metrics *serverMetrics
+	tracer  trace.Tracer
+}
+
+func newInstrumentedStore(next Store, metrics *serverMetrics, tracer trace.Tracer) *instrumentedStore {
+	return &instrumentedStore{next: next, metrics: metrics, tracer: tracer}
+}
+
+// observe starts the span for operation; the returned func ends it and
+// records metrics.
+func (m *serverMetrics) observe(ctx context.Context, tracer trace.Tracer, operation string) (context.Context, func(error)) {
+	start := time.Now()
+	ctx, endSpan := startStoreSpan(ctx, tracer, operation)
+	return ctx, func(err error) {
+		m.observeStoreCall(operation, start, err)
+		endSpan(err)
+	}
+}
+
+func (st *instrumentedStore) GetUsers(ctx context.Context) ([]User, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetUsers")
+	users, err := st.next.GetUsers(ctx)
+	done(err)
+	return users, err
+}
+
+func (st *instrumentedStore) GetUserByID(ctx context.Context, id int) (User, bool, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetUserByID")
+	user, found, err := st.next.GetUserByID(ctx, id)
+	done(err)
+	return user, found, err
+}
+
+func (st *instrumentedStore) GetUserByEmail(ctx context.Context, email string) (User, bool, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetUserByEmail")
+	user, found, err := st.next.GetUserByEmail(ctx, email)
+	done(err)
+	return user, found, err
+}
+
+func (st *instrumentedStore) GetTasks(ctx context.Context, status, userID string) ([]Task, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetTasks")
+	tasks, err := st.next.GetTasks(ctx, status, userID)
+	done(err)
+	return tasks, err
+}
+
+func (st *instrumentedStore) GetTaskByID(ctx context.Context, id int) (Task, bool, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetTaskByID")
+	task, found, err := st.next.GetTaskByID(ctx, id)
+	done(err)
+	return task, found, err
+}
+
+func (st *instrumentedStore) GetTaskHistory(ctx context.Context, taskID int) ([]TaskHistoryItem, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetTaskHistory")
+	history, err := st.next.GetTaskHistory(ctx, taskID)
+	done(err)
+	return history, err
+}
+
+func (st *instrumentedStore) GetStats(ctx context.Context) (StatsResponse, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "GetStats")
+	stats, err := st.next.GetStats(ctx)
+	done(err)
+	return stats, err
+}
+
+func (st *instrumentedStore) CreateUser(ctx context.Context, name, email, role string) (User, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "CreateUser")
+	user, err := st.next.CreateUser(ctx, name, email, role)
+	done(err)
+	return user, err
+}
+
+func (st *instrumentedStore) CreateTask(ctx context.Context, title, status string, userID int, actor string) (Task, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "CreateTask")
+	task, err := st.next.CreateTask(ctx, title, status, userID, actor)
+	done(err)
+	return task, err
+}
+
+func (st *instrumentedStore) UpdateTask(ctx context.Context, id int, update TaskUpdate, actor string) (Task, error) {
+	ctx, done := st.metrics.observe(ctx, st.tracer, "UpdateTask")
+	task, err := st.next.UpdateTask(ctx, id, update, actor)
+	done(err)
+	return task, err
+}
+
+// instrumentedFeed instruments the history replays used by event streams.
+type instrumentedFeed struct {
+	next    historyFeed
+	metrics *serverMetrics
+	tracer  trace.Tracer
+}
+
+func (f instrumentedFeed) GetTaskHistorySince(ctx context.Context, afterID, limit int) ([]TaskHistoryItem, error) {
+	ctx, done := f.metrics.observe(ctx, f.tracer, "GetTaskHistorySince")
+	history, err := f.next.GetTaskHistorySince(ctx, afterID, limit)
+	done(err)
+	return history, err
+}
+
+func (f instrumentedFeed) GetTaskOwners(ctx context.Context, taskIDs []int) (map[int]int, error) {
+	ctx, done := f.metrics.observe(ctx, f.tracer, "GetTaskOwners")
+	owners, err := f.next.GetTaskOwners(ctx, taskIDs)
+	done(err)
+	return owners, err
+}
+
+// instrumentedBatchWriter instruments bulk task writes.
+type instrumentedBatchWriter struct {
+	next    taskBatchWriter
+	metrics *serverMetrics
+	tracer  trace.Tracer
+}
+
+func (b instrumentedBatchWriter) ApplyTaskBatch(ctx context.Context, batch TaskBatch) ([]TaskWriteResult, error) {
+	ctx, done := b.metrics.observe(ctx, b.tracer, "ApplyTaskBatch")
+	results, err := b.next.ApplyTaskBatch(ctx, batch)
+	done(err)
+	return results, err
+}
+
+// instrumentedExporter instruments streamed exports. The observed duration
+// includes the time spent writing rows to the client.
+type instrumentedExporter struct {
+	next    exportSource
+	metrics *serverMetrics
+	tracer  trace.Tracer
+}
+
+func (e instrumentedExporter) ExportTasks(ctx context.Context, status, userID string, fn func(Task) error) error {
+	ctx, done := e.metrics.observe(ctx, e.tracer, "ExportTasks")
+	err := e.next.ExportTasks(ctx, status, userID, fn)
+	done(err)
+	return err
+}
+
+func (e instrumentedExporter) ExportUsers(ctx context.Context, fn func(User) error) error {
+	ctx, done := e.metrics.observe(ctx, e.tracer, "ExportUsers")
+	err := e.next.ExportUsers(ctx, fn)
+	done(err)
+	return err
+}
+
+func (e instrumentedExporter) ExportHistory(ctx context.Context, fn func(TaskHistoryItem) error) error {
+	ctx, done := e.metrics.observe(ctx, e.tracer, "ExportHistory")
+	err := e.next.ExportHistory(ctx, fn)
+	done(err)
+	return err
+}
+
+// instrumentedImporter instruments bulk imports.
+type instrumentedImporter struct {
+	next    importer
+	metrics *serverMetrics
+	tracer  trace.Tracer
+}
+
+func (i instrumentedImporter) Import(ctx context.Context, batch ImportBatch) (ImportResult, error) {
+	ctx, done := i.metrics.observe(ctx, i.tracer, "Import")
+	result, err := i.next.Import(ctx, batch)
+	done(err)
+	return result, err
+}
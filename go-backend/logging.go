@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	requestIDHeaderName = "X-Request-ID"
+	maxRequestIDLength  = 128
+)
+
+type contextKey int
+
+const (
+	requestInfoContextKey contextKey = iota
+	actorContextKey
+	scrapeStatsContextKey
+	workspaceContextKey
+	routeParamsContextKey
+)
+
+// newLogger builds a structured logger writing "json" or "text" records at or above level.
+func newLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", "text":
+		handler = slog.NewTextHandler(w, options)
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %q (want json or text)", format)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+// parseLogLevel accepts debug, info, warn or error (case-insensitive); empty means info.
+func parseLogLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if strings.TrimSpace(value) == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", value)
+	}
+	return level, nil
+}
+
+// contextHandler adds the request ID, actor and trace ID carried by ctx to
+// every record, so store and handler logs can be correlated with the request
+// (and trace) that caused them.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestIDFromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if actor := actorFromContext(ctx); actor != "" {
+		record.AddAttrs(slog.String("actor", actor))
+	}
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok && info.workspace != "" {
+		record.AddAttrs(slog.String("workspace", info.workspace))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// requestInfo is shared by the whole middleware chain, so the actor resolved
+// by authentication also shows up in the logs of the outer middleware.
+type requestInfo struct {
+	id        string
+	actor     string
+	workspace string
+}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestInfoContextKey, &requestInfo{id: id})
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// setRequestActor records the actor for the request carried by ctx.
+func setRequestActor(ctx context.Context, actor string) {
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok {
+		info.actor = actor
+	}
+}
+
+// setRequestWorkspace records the workspace for the request carried by ctx.
+func setRequestWorkspace(ctx context.Context, workspaceID string) {
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok {
+		info.workspace = workspaceID
+	}
+}
+
+// withActor overrides the logged actor for work derived from ctx.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+func actorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorContextKey).(string); ok {
+		return actor
+	}
+	if info, ok := ctx.Value(requestInfoContextKey).(*requestInfo); ok {
+		return info.actor
+	}
+	return ""
+}
+
+// requestIDMiddleware propagates a caller-supplied X-Request-ID or generates
+// one, echoes it on the response and stores it (with the actor) in the
+// request context for logging.
+func (s *Server) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.Header.Get(requestIDHeaderName))
+		if !isValidRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeaderName, id)
+
+		ctx := withRequestID(r.Context(), id)
+		setRequestActor(ctx, extractActor(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("generate request ID: %v", err))
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// isValidRequestID rejects empty, oversized or non-token IDs so arbitrary
+// client input is never echoed into headers or logs.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
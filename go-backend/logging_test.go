@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDGeneratedAndEchoed(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequest(s.Handler(), http.MethodGet, "/health", "")
+	id := res.Header().Get(requestIDHeaderName)
+	if len(id) != 32 || !isValidRequestID(id) {
+		t.Fatalf("expected generated request ID, got %q", id)
+	}
+
+	other := performRequest(s.Handler(), http.MethodGet, "/health", "")
+	if other.Header().Get(requestIDHeaderName) == id {
+		t.Fatal("expected a fresh request ID per request")
+	}
+}
+
+func TestRequestIDPropagatedFromCaller(t *testing.T) {
+	s := newTestServer(t)
+
+	testCases := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "valid ID is kept", incoming: "edge-1234.abc:9", keep: true},
+		{name: "invalid characters are replaced", incoming: "bad id\nvalue", keep: false},
+		{name: "oversized ID is replaced", incoming: strings.Repeat("a", maxRequestIDLength+1), keep: false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			req.Header.Set(requestIDHeaderName, tc.incoming)
+			res := httptest.NewRecorder()
+			s.Handler().ServeHTTP(res, req)
+
+			got := res.Header().Get(requestIDHeaderName)
+			if tc.keep && got != tc.incoming {
+				t.Fatalf("expected request ID %q to be propagated, got %q", tc.incoming, got)
+			}
+			if !tc.keep && (got == tc.incoming || !isValidRequestID(got)) {
+				t.Fatalf("expected invalid request ID to be replaced, got %q", got)
+			}
+		})
+	}
+}
+
+func TestErrorResponseIncludesRequestID(t *testing.T) {
+	s := newTestServer(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/999", nil)
+	req.Header.Set(requestIDHeaderName, "req-42")
+	res := httptest.NewRecorder()
+	s.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+
+	if body := decodeProblem(t, res); body.Instance != "req-42" {
+		t.Fatalf("expected request ID as the problem instance, got %+v", body)
+	}
+}
+
+func TestRequestLogIncludesRequestIDAndActor(t *testing.T) {
+	s := newTestServer(t)
+
+	var logBuffer bytes.Buffer
+	s.logger = newTestLogger(t, &logBuffer, "json")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users/999", nil)
+	req.Header.Set(requestIDHeaderName, "req-7")
+	req.Header.Set("X-Actor", "alice")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]any
+	if err := json.Unmarshal(logBuffer.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON log record, got %q: %v", logBuffer.String(), err)
+	}
+	want := map[string]any{
+		"msg":        "request",
+		"level":      "INFO",
+		"method":     "GET",
+		"path":       "/api/users/999",
+		"status":     float64(http.StatusNotFound),
+		"request_id": "req-7",
+		"actor":      "alice",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Fatalf("expected %s=%v in log record, got %v", key, value, record)
+		}
+	}
+}
+
+func TestServerErrorsLogAtErrorLevel(t *testing.T) {
+	s := NewServer(&errorReadStore{usersErr: errors.New("db unavailable")})
+
+	var logBuffer bytes.Buffer
+	s.logger = newTestLogger(t, &logBuffer, "text")
+
+	res := performRequest(s.Handler(), http.MethodGet, "/api/users", "")
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, res.Code)
+	}
+
+	logOutput := logBuffer.String()
+	if !strings.Contains(logOutput, `level=ERROR msg="error loading users"`) {
+		t.Fatalf("expected store error to be logged, got: %s", logOutput)
+	}
+	if !strings.Contains(logOutput, "level=ERROR msg=request") {
+		t.Fatalf("expected 5xx request log at error level, got: %s", logOutput)
+	}
+	if strings.Count(logOutput, "request_id=") != 2 {
+		t.Fatalf("expected both records to carry the request ID, got: %s", logOutput)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	testCases := []struct {
+		value   string
+		want    slog.Level
+		wantErr bool
+	}{
+		{value: "", want: slog.LevelInfo},
+		{value: "debug", want: slog.LevelDebug},
+		{value: "WARN", want: slog.LevelWarn},
+		{value: " error ", want: slog.LevelError},
+		{value: "verbose", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseLogLevel(tc.value)
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("expected error for %q", tc.value)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("parseLogLevel(%q) = %v, %v; want %v", tc.value, got, err, tc.want)
+		}
+	}
+}
+
+func TestNewLoggerRejectsUnknownFormat(t *testing.T) {
+	if _, err := newLogger(io.Discard, "xml", slog.LevelInfo); err == nil {
+		t.Fatal("expected unknown format to be rejected")
+	}
+}
+
+func TestNewLoggerFiltersByLevel(t *testing.T) {
+	var logBuffer bytes.Buffer
+	logger, err := newLogger(&logBuffer, "text", slog.LevelWarn)
+	if err != nil {
+		t.Fatalf("expected logger, got %v", err)
+	}
+
+	ctx := withRequestID(context.Background(), "abc")
+	logger.InfoContext(ctx, "dropped")
+	logger.With("component", "store").WarnContext(ctx, "kept")
+
+	logOutput := logBuffer.String()
+	if strings.Contains(logOutput, "dropped") {
+		t.Fatalf("expected info record to be filtered, got: %s", logOutput)
+	}
+	if !strings.Contains(logOutput, "component=store") || !strings.Contains(logOutput, "request_id=abc") {
+		t.Fatalf("expected derived logger to keep context attributes, got: %s", logOutput)
+	}
+}
+
+func newTestLogger(t *testing.T, w io.Writer, format string) *slog.Logger {
+	t.Helper()
+
+	logger, err := newLogger(w, format, slog.LevelDebug)
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	return logger
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
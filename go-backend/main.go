@@ -1,42 +1,46 @@
 package main
 
 import (
-	"log"
 	"os"
-	"strings"
 	"time"
 )
 
 const (
-	defaultPort = "8080"
+	defaultPort            = "8080"
+	tracingShutdownTimeout = 5 * time.Second
 )
 
 // User represents an application user.
 type User struct {
-	ID    int    `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	ID          int    `json:"id"`
+	WorkspaceID string `json:"workspaceId"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
 }
 
 // Task represents a work item assigned to a user.
 type Task struct {
-	ID         int              `json:"id"`
-	Title      string           `json:"title"`
-	Status     string           `json:"status"`
-	UserID     int              `json:"userId"`
-	LastChange *TaskHistoryItem `json:"lastChange,omitempty"`
+	ID          int              `json:"id"`
+	WorkspaceID string           `json:"workspaceId"`
+	Title       string           `json:"title"`
+	Status      string           `json:"status"`
+	UserID      int              `json:"userId"`
+	LastChange  *TaskHistoryItem `json:"lastChange,omitempty"`
 }
 
 // TaskHistoryItem captures a single mutation event for a task.
 type TaskHistoryItem struct {
-	ID        int       `json:"id"`
-	TaskID    int       `json:"taskId"`
-	ChangedAt time.Time `json:"changedAt"`
-	ChangedBy string    `json:"changedBy"`
-	Field     string    `json:"field"`
-	FromValue *string   `json:"fromValue,omitempty"`
-	ToValue   string    `json:"toValue"`
+	ID          int       `json:"id"`
+	WorkspaceID string    `json:"workspaceId"`
+	TaskID      int       `json:"taskId"`
+	ChangedAt   time.Time `json:"changedAt"`
+	ChangedBy   string    `json:"changedBy"`
+	Field       string    `json:"field"`
+	FromValue   *string   `json:"fromValue,omitempty"`
+	ToValue     string    `json:"toValue"`
+	// BatchID links entries written by one bulk request.
+	BatchID string `json:"batchId,omitempty"`
 }
 
 // TaskHistoryResponse is the envelope for task audit history.
@@ -71,34 +75,15 @@ type StatsResponse struct {
 	} `json:"tasks"`
 }
 
-// HealthResponse is returned by the health endpoint.
+// HealthResponse is returned by the health endpoints. Checks and Pool are
+// only populated for verbose requests.
 type HealthResponse struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
+	Status  string                 `json:"status"`
+	Message string                 `json:"message"`
+	Checks  map[string]HealthCheck `json:"checks,omitempty"`
+	Pool    *PoolStats             `json:"pool,omitempty"`
 }
 
 func main() {
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
-	}
-
-	postgresDSN := strings.TrimSpace(os.Getenv("POSTGRES_DSN"))
-	if postgresDSN == "" {
-		log.Fatal("POSTGRES_DSN is required (no in-memory fallback is configured)")
-	}
-
-	postgresStore, err := NewPostgresStore(postgresDSN)
-	if err != nil {
-		log.Fatalf("failed to initialize postgres store: %v", err)
-	}
-	defer func() {
-		if closeErr := postgresStore.Close(); closeErr != nil {
-			log.Printf("error closing postgres store: %v", closeErr)
-		}
-	}()
-
-	server := NewServer(postgresStore)
-	server.Start(port)
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// defaultDurationBuckets are upper bounds in seconds, matching the Prometheus client defaults.
+var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metricsRegistry renders registered metrics in the Prometheus text exposition
+// format. It covers the counter, gauge and histogram shapes this service needs
+// without pulling in the full client library.
+type metricsRegistry struct {
+	mu         sync.Mutex
+	collectors []metricCollector
+}
+
+type metricCollector interface {
+	writeMetric(ctx context.Context, w *bufio.Writer)
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{}
+}
+
+func (r *metricsRegistry) register(c metricCollector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// NewCounterVec registers a counter partitioned by the given label names.
+func (r *metricsRegistry) NewCounterVec(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, series: map[string]*counterSeries{}}
+	r.register(c)
+	return c
+}
+
+// NewHistogramVec registers a histogram partitioned by the given label names.
+func (r *metricsRegistry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogramSeries{}}
+	r.register(h)
+	return h
+}
+
+// NewGaugeFunc registers a gauge whose samples are computed at scrape time.
+func (r *metricsRegistry) NewGaugeFunc(name, help string, labels []string, collect func(context.Context) []metricSample) {
+	r.register(&funcMetric{name: name, help: help, kind: "gauge", labels: labels, collect: collect})
+}
+
+// NewCounterFunc registers a counter whose samples are read from an external
+// source at scrape time, such as the cumulative sql.DBStats fields.
+func (r *metricsRegistry) NewCounterFunc(name, help string, labels []string, collect func(context.Context) []metricSample) {
+	r.register(&funcMetric{name: name, help: help, kind: "counter", labels: labels, collect: collect})
+}
+
+// WriteTo renders every registered metric in registration order.
+func (r *metricsRegistry) WriteTo(ctx context.Context, w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]metricCollector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.writeMetric(ctx, bw)
+	}
+	return bw.Flush()
+}
+
+// metricSample is one computed value of a func metric.
+type metricSample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc adds one to the counter identified by labelValues.
+func (c *counterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter identified by labelValues by delta.
+func (c *counterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	series, ok := c.series[key]
+	if !ok {
+		series = &counterSeries{labelValues: append([]string(nil), labelValues...)}
+		c.series[key] = series
+	}
+	series.value += delta
+}
+
+// Value returns the current count for labelValues.
+func (c *counterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if series, ok := c.series[seriesKey(labelValues)]; ok {
+		return series.value
+	}
+	return 0
+}
+
+func (c *counterVec) writeMetric(_ context.Context, w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeMetricHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		series := c.series[key]
+		writeSample(w, c.name, c.labels, series.labelValues, "", "", series.value)
+	}
+}
+
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues  []string
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// Observe records value in the histogram identified by labelValues.
+func (h *histogramVec) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := seriesKey(labelValues)
+	series, ok := h.series[key]
+	if !ok {
+		series = &histogramSeries{
+			labelValues:  append([]string(nil), labelValues...),
+			bucketCounts: make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = series
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			series.bucketCounts[i]++
+			break
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+// Count returns how many values were observed for labelValues.
+func (h *histogramVec) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if series, ok := h.series[seriesKey(labelValues)]; ok {
+		return series.count
+	}
+	return 0
+}
+
+func (h *histogramVec) writeMetric(_ context.Context, w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeMetricHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		series := h.series[key]
+
+		var cumulative uint64
+		for i, upperBound := range h.buckets {
+			cumulative += series.bucketCounts[i]
+			writeSample(w, h.name+"_bucket", h.labels, series.labelValues, "le", formatFloat(upperBound), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, series.labelValues, "le", "+Inf", float64(series.count))
+		writeSample(w, h.name+"_sum", h.labels, series.labelValues, "", "", series.sum)
+		writeSample(w, h.name+"_count", h.labels, series.labelValues, "", "", float64(series.count))
+	}
+}
+
+type funcMetric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	collect func(context.Context) []metricSample
+}
+
+func (m *funcMetric) writeMetric(ctx context.Context, w *bufio.Writer) {
+	samples := m.collect(ctx)
+	if len(samples) == 0 {
+		return
+	}
+
+	writeMetricHeader(w, m.name, m.help, m.kind)
+	for _, sample := range samples {
+		writeSample(w, m.name, m.labels, sample.LabelValues, "", "", sample.Value)
+	}
+}
+
+func writeMetricHeader(w *bufio.Writer, name, help, kind string) {
+	w.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// writeSample writes one sample line; extraName/extraValue append a label such as "le".
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+
+	var pairs []string
+	for i, label := range labels {
+		labelValue := ""
+		if i < len(labelValues) {
+			labelValue = labelValues[i]
+		}
+		pairs = append(pairs, label+`="`+escapeLabelValue(labelValue)+`"`)
+	}
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper       = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+func seriesKey(labelValues []string) string {
+	return strings.Join(labelValues, "\xff")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
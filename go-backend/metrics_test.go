@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMetricsRegistryWritesExpositionFormat(t *testing.T) {
+	registry := newMetricsRegistry()
+	counter := registry.NewCounterVec("jobs_total", "Jobs run.\nSecond line.", "queue")
+	histogram := registry.NewHistogramVec("job_seconds", "Job latency.", []float64{0.1, 1}, "queue")
+	registry.NewGaugeFunc("queue_depth", "Queued jobs.", []string{"queue"}, func(context.Context) []metricSample {
+		return []metricSample{{LabelValues: []string{`a"b\c`}, Value: 3}}
+	})
+	registry.NewGaugeFunc("skipped", "Gauge without samples.", nil, func(context.Context) []metricSample {
+		return nil
+	})
+
+	counter.Inc("emails")
+	counter.Add(2, "emails")
+	counter.Inc("billing")
+	histogram.Observe(0.05, "emails")
+	histogram.Observe(0.5, "emails")
+	histogram.Observe(5, "emails")
+
+	var out strings.Builder
+	if err := registry.WriteTo(context.Background(), &out); err != nil {
+		t.Fatalf("expected metrics to render, got %v", err)
+	}
+
+	want := `# HELP jobs_total Jobs run.\nSecond line.
+# TYPE jobs_total counter
+jobs_total{queue="billing"} 1
+jobs_total{queue="emails"} 3
+# HELP job_seconds Job latency.
+# TYPE job_seconds histogram
+job_seconds_bucket{queue="emails",le="0.1"} 1
+job_seconds_bucket{queue="emails",le="1"} 2
+job_seconds_bucket{queue="emails",le="+Inf"} 3
+job_seconds_sum{queue="emails"} 5.55
+job_seconds_count{queue="emails"} 3
+# HELP queue_depth Queued jobs.
+# TYPE queue_depth gauge
+queue_depth{queue="a\"b\\c"} 3
+`
+	if out.String() != want {
+		t.Fatalf("unexpected exposition output:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestFormatFloatSpecialValues(t *testing.T) {
+	testCases := map[float64]string{
+		math.Inf(1):  "+Inf",
+		math.Inf(-1): "-Inf",
+		0.25:         "0.25",
+		1e6:          "1e+06",
+	}
+	for value, want := range testCases {
+		if got := formatFloat(value); got != want {
+			t.Fatalf("formatFloat(%v) = %q, want %q", value, got, want)
+		}
+	}
+	if got := formatFloat(math.NaN()); got != "NaN" {
+		t.Fatalf("expected NaN, got %q", got)
+	}
+}
+
+func TestMetricsEndpointReportsRequestsAndStore(t *testing.T) {
+	s := newTestServer(t)
+
+	performRequest(s.Handler(), http.MethodGet, "/api/tasks/1/history", "")
+	performRequest(s.Handler(), http.MethodPut, "/api/tasks/999", `{"title":"Write docs","status":"completed","userId":1}`)
+	performRequest(s.Handler(), http.MethodGet, "/nope", "")
+
+	res := performRequest(s.Handler(), http.MethodGet, "/metrics", "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if got := res.Header().Get("Content-Type"); got != metricsContentType {
+		t.Fatalf("expected content type %q, got %q", metricsContentType, got)
+	}
+
+	body := res.Body.String()
+	for _, want := range []string{
+		`http_requests_total{route="tasks.history",method="GET",status="200"} 1`,
+		`http_requests_total{route="tasks.update",method="PUT",status="404"} 1`,
+		`http_requests_total{route="unmatched",method="GET",status="404"} 1`,
+		`http_request_duration_seconds_count{route="tasks.history",method="GET",status="200"} 1`,
+		`store_operation_duration_seconds_count{operation="GetTaskHistory"} 1`,
+		`store_operation_duration_seconds_count{operation="UpdateTask"} 1`,
+		`users_total 3`,
+		`tasks{status="pending"} 1`,
+		`tasks{status="in-progress"} 1`,
+		`tasks{status="completed"} 1`,
+		`event_subscribers 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "store_operation_errors_total{") {
+		t.Fatalf("expected not-found update not to count as a store error, got:\n%s", body)
+	}
+	if strings.Contains(body, "db_open_connections") {
+		t.Fatalf("expected no pool gauges for the in-memory store, got:\n%s", body)
+	}
+}
+
+func TestMetricsCountStoreFailures(t *testing.T) {
+	s := NewServer(&errorReadStore{usersErr: errors.New("db unavailable"), statsErr: errors.New("db unavailable")})
+	s.logger = discardLogger()
+
+	performRequest(s.Handler(), http.MethodGet, "/api/users", "")
+	performRequest(s.Handler(), http.MethodGet, "/api/users", "")
+
+	if got := s.metrics.storeErrors.Value("GetUsers"); got != 2 {
+		t.Fatalf("expected 2 GetUsers errors, got %v", got)
+	}
+
+	res := performRequest(s.Handler(), http.MethodGet, "/metrics", "")
+	body := res.Body.String()
+	if !strings.Contains(body, `store_operation_errors_total{operation="GetUsers"} 2`) {
+		t.Fatalf("expected store error counter in output, got:\n%s", body)
+	}
+	if strings.Contains(body, "users_total") {
+		t.Fatalf("expected business gauges to be skipped when stats fail, got:\n%s", body)
+	}
+	if got := s.metrics.storeErrors.Value("GetStats"); got != 1 {
+		t.Fatalf("expected a single GetStats call per scrape, got %v errors", got)
+	}
+}
+
+func TestMetricsIncludePoolStatsForPostgresStore(t *testing.T) {
+	store, _, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	s := NewServer(store)
+	s.logger = discardLogger()
+
+	res := performRequest(s.Handler(), http.MethodGet, "/metrics", "")
+	body := res.Body.String()
+	for _, want := range []string{
+		"# TYPE db_open_connections gauge",
+		"# TYPE db_wait_count_total counter",
+		"db_in_use_connections 0",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsEndpointRejectsNonGET(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequest(s.Handler(), http.MethodPost, "/metrics", "")
+	if res.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, res.Code)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migrationLockID is the advisory lock key that serializes migration runs
+// across replicas starting at the same time.
+const migrationLockID = 727_310_001
+
+// migration is one versioned schema change. Statements run in order inside
+// the migration run's transaction.
+type migration struct {
+	version int
+	name    string
+	up      []string
+	down    []string
+}
+
+// migrations lists every schema change, oldest first. Never edit a released
+// migration; append a new one. Up statements are idempotent so databases
+// created before schema_migrations existed can be adopted by running them.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create users, tasks and task_history",
+		up: []string{
+			`
+			CREATE TABLE IF NOT EXISTS users (
+				id BIGSERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				email TEXT NOT NULL,
+				role TEXT NOT NULL
+			);
+			`,
+			`
+			CREATE TABLE IF NOT EXISTS tasks (
+				id BIGSERIAL PRIMARY KEY,
+				title TEXT NOT NULL,
+				status TEXT NOT NULL CHECK (status IN ('pending', 'in-progress', 'completed')),
+				user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE RESTRICT
+			);
+			`,
+			`
+			CREATE TABLE IF NOT EXISTS task_history (
+				id BIGSERIAL PRIMARY KEY,
+				task_id BIGINT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+				changed_at TIMESTAMPTZ NOT NULL,
+				changed_by TEXT NOT NULL,
+				field TEXT NOT NULL CHECK (field IN ('title', 'status', 'userId')),
+				from_value TEXT,
+				to_value TEXT NOT NULL
+			);
+			`,
+			`CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);`,
+			`CREATE INDEX IF NOT EXISTS idx_tasks_user_id ON tasks(user_id);`,
+			`CREATE INDEX IF NOT EXISTS idx_task_history_task_id ON task_history(task_id);`,
+			`CREATE INDEX IF NOT EXISTS idx_task_history_changed_at ON task_history(changed_at DESC);`,
+		},
+		down: []string{
+			`DROP TABLE IF EXISTS task_history;`,
+			`DROP TABLE IF EXISTS tasks;`,
+			`DROP TABLE IF EXISTS users;`,
+		},
+	},
+	workspaceMigration(2),
+	{
+		version: 3,
+		name:    "add task_history.batch_id",
+		up:      []string{`ALTER TABLE task_history ADD COLUMN IF NOT EXISTS batch_id TEXT;`},
+		down:    []string{`ALTER TABLE task_history DROP COLUMN IF EXISTS batch_id;`},
+	},
+	{
+		version: 4,
+		name:    "add shared rate limit buckets",
+		up: []string{
+			`
+			CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+				key TEXT PRIMARY KEY,
+				tokens DOUBLE PRECISION NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				full_at TIMESTAMPTZ NOT NULL
+			);
+			`,
+			`CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets(full_at);`,
+			// take_rate_limit_token refills the bucket for the time since its
+			// last request and takes a token if there is one.
+			`
+			CREATE OR REPLACE FUNCTION take_rate_limit_token(
+				bucket_key TEXT, capacity DOUBLE PRECISION, per_second DOUBLE PRECISION,
+				OUT remaining DOUBLE PRECISION, OUT allowed BOOLEAN
+			) AS $$
+			DECLARE
+				bucket rate_limit_buckets%ROWTYPE;
+			BEGIN
+				INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+				VALUES (bucket_key, capacity, NOW(), NOW())
+				ON CONFLICT (key) DO NOTHING;
+				SELECT * INTO bucket FROM rate_limit_buckets WHERE key = bucket_key FOR UPDATE;
+
+				remaining := LEAST(capacity, bucket.tokens + GREATEST(EXTRACT(EPOCH FROM NOW() - bucket.updated_at), 0) * per_second);
+				allowed := remaining >= 1;
+				IF allowed THEN
+					remaining := remaining - 1;
+				END IF;
+
+				UPDATE rate_limit_buckets
+				SET tokens = remaining,
+					updated_at = NOW(),
+					full_at = NOW() + make_interval(secs => (capacity - remaining) / per_second)
+				WHERE key = bucket_key;
+			END;
+			$$ LANGUAGE plpgsql;
+			`,
+		},
+		down: []string{
+			`DROP FUNCTION IF EXISTS take_rate_limit_token(TEXT, DOUBLE PRECISION, DOUBLE PRECISION);`,
+			`DROP TABLE IF EXISTS rate_limit_buckets;`,
+		},
+	},
+}
+
+// workspaceMigration adds workspace tenancy: a workspace_id column on every
+// table and row-level security keyed on app.workspace_id, which
+// beginWorkspaceTx sets per transaction. FORCE applies the policy to the
+// table owner too; only superusers and BYPASSRLS roles skip it.
+func workspaceMigration(version int) migration {
+	m := migration{version: version, name: "add workspace tenancy with row-level security"}
+	for _, table := range requiredTables {
+		m.up = append(m.up,
+			fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS workspace_id TEXT NOT NULL DEFAULT 'default';`, table),
+			fmt.Sprintf(`CREATE INDEX IF NOT EXISTS idx_%s_workspace_id ON %s(workspace_id);`, table, table),
+			fmt.Sprintf(`ALTER TABLE %s ENABLE ROW LEVEL SECURITY;`, table),
+			fmt.Sprintf(`ALTER TABLE %s FORCE ROW LEVEL SECURITY;`, table),
+			fmt.Sprintf(`
+			DO $$
+			BEGIN
+				IF NOT EXISTS (
+					SELECT 1 FROM pg_policies
+					WHERE schemaname = current_schema() AND tablename = '%[1]s' AND policyname = 'workspace_isolation'
+				) THEN
+					CREATE POLICY workspace_isolation ON %[1]s
+						USING (current_setting('app.workspace_id', true) IN (workspace_id, '*'))
+						WITH CHECK (current_setting('app.workspace_id', true) IN (workspace_id, '*'));
+				END IF;
+			END
+			$$;
+			`, table),
+		)
+	}
+	for i := len(requiredTables) - 1; i >= 0; i-- {
+		table := requiredTables[i]
+		m.down = append(m.down,
+			fmt.Sprintf(`DROP POLICY IF EXISTS workspace_isolation ON %s;`, table),
+			fmt.Sprintf(`ALTER TABLE %s NO FORCE ROW LEVEL SECURITY;`, table),
+			fmt.Sprintf(`ALTER TABLE %s DISABLE ROW LEVEL SECURITY;`, table),
+			fmt.Sprintf(`DROP INDEX IF EXISTS idx_%s_workspace_id;`, table),
+			fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS workspace_id;`, table),
+		)
+	}
+	return m
+}
+
+// MigrationStatus reports whether one migration has been applied.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+}
+
+// MigrateUp applies every pending migration in one transaction and returns
+// the ones it applied.
+func (ps *PostgresStore) MigrateUp(ctx context.Context) ([]migration, error) {
+	var applied []migration
+	err := ps.inMigrationTx(ctx, func(tx *sql.Tx, done map[int]time.Time) error {
+		for _, m := range migrations {
+			if _, ok := done[m.version]; ok {
+				continue
+			}
+			if err := ps.runMigration(ctx, tx, m, m.up); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, NOW())
+			`, m.version, m.name); err != nil {
+				return fmt.Errorf("record migration %d: %w", m.version, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// MigrateDown reverts the latest steps applied migrations, newest first, and
+// returns the ones it reverted.
+func (ps *PostgresStore) MigrateDown(ctx context.Context, steps int) ([]migration, error) {
+	var reverted []migration
+	err := ps.inMigrationTx(ctx, func(tx *sql.Tx, done map[int]time.Time) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			m := migrations[i]
+			if _, ok := done[m.version]; !ok {
+				continue
+			}
+			if err := ps.runMigration(ctx, tx, m, m.down); err != nil {
+				return err
+			}
+			if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, m.version); err != nil {
+				return fmt.Errorf("unrecord migration %d: %w", m.version, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reverted, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied. It
+// only reads, so it works with a read-only role before the first migration.
+func (ps *PostgresStore) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
+	defer cancel()
+
+	var tracked bool
+	if err := ps.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&tracked); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	done := map[int]time.Time{}
+	if tracked {
+		var err error
+		if done, err = loadAppliedMigrations(ctx, ps.db); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.version, Name: m.name}
+		if appliedAt, ok := done[m.version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// pendingMigrations counts the statuses not yet applied.
+func pendingMigrations(statuses []MigrationStatus) int {
+	pending := 0
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending++
+		}
+	}
+	return pending
+}
+
+// inMigrationTx runs fn in a transaction holding the migration lock, with the
+// applied versions loaded. fn's changes commit only if it succeeds.
+func (ps *PostgresStore) inMigrationTx(ctx context.Context, fn func(tx *sql.Tx, done map[int]time.Time) error) error {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.MigrationTimeout)
+	defer cancel()
+
+	if _, err := ps.db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		);
+	`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin migration transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+
+	done, err := loadAppliedMigrations(ctx, tx)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx, done); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migrations: %w", err)
+	}
+	committed = true
+	return nil
+}
+
+func (ps *PostgresStore) runMigration(ctx context.Context, tx *sql.Tx, m migration, statements []string) error {
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// loadAppliedMigrations maps each applied version to when it was applied.
+func loadAppliedMigrations(ctx context.Context, q interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}) (map[int]time.Time, error) {
+	rows, err := q.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("load applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		done[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("load applied migrations: %w", err)
+	}
+	return done, nil
+}
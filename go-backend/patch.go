@@ -0,0 +1,494 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+// acceptPatch is the Accept-Patch header value for PATCH /api/tasks/{id}.
+var acceptPatch = mergePatchContentType + ", " + jsonPatchContentType
+
+// errInvalidPatch marks patch documents that are malformed or do not apply
+// to the task, as opposed to failed "test" operations (ErrTaskConflict).
+var errInvalidPatch = errors.New("invalid patch")
+
+// errPathNotFound is returned for JSON pointers that reference nothing.
+var errPathNotFound = fmt.Errorf("%w: path does not exist", errInvalidPatch)
+
+// Task document members. Patches may only change the editable ones; the
+// read-only ones must be left as they are.
+var (
+	editableTaskFields = []string{"title", "status", "userId"}
+	readOnlyTaskFields = []string{"id", "workspaceId", "lastChange"}
+)
+
+// jsonPatchOp is one RFC 6902 operation. Value is nil when absent, which
+// differs from an explicit JSON null.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// taskDocument returns the JSON form of task that patches apply to.
+func taskDocument(task Task) (map[string]any, error) {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// mergePatchTask applies an RFC 7386 merge patch to task and returns the
+// changes as a TaskUpdate.
+func mergePatchTask(task Task, patch json.RawMessage) (TaskUpdate, error) {
+	var value any
+	if err := json.Unmarshal(patch, &value); err != nil {
+		return TaskUpdate{}, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	if _, ok := value.(map[string]any); !ok {
+		return TaskUpdate{}, fmt.Errorf("%w: merge patch must be a JSON object", errInvalidPatch)
+	}
+
+	before, err := taskDocument(task)
+	if err != nil {
+		return TaskUpdate{}, err
+	}
+	after, err := taskDocument(task)
+	if err != nil {
+		return TaskUpdate{}, err
+	}
+	// A patch object merged into an object always yields that object.
+	patched := applyMergePatch(after, value).(map[string]any)
+	return taskUpdateFromDocument(task, before, patched, TaskPrecondition{})
+}
+
+// applyMergePatch merges patch into target as described in RFC 7386 §2.
+// target is modified in place when it is an object.
+func applyMergePatch(target, patch any) any {
+	patchObj, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]any)
+	if !ok {
+		targetObj = make(map[string]any, len(patchObj))
+	}
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = applyMergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
+
+// jsonPatchTask applies an RFC 6902 patch to task and returns the changes as
+// a TaskUpdate. "test" operations are evaluated in order against the patched
+// document; those that test title, status or userId before the patch changes
+// them also become preconditions, so they are checked again atomically with
+// the update.
+func jsonPatchTask(task Task, patch json.RawMessage) (TaskUpdate, error) {
+	var ops []jsonPatchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return TaskUpdate{}, fmt.Errorf("%w: JSON patch must be an array of operations", errInvalidPatch)
+	}
+
+	before, err := taskDocument(task)
+	if err != nil {
+		return TaskUpdate{}, err
+	}
+	var doc any
+	if doc, err = taskDocument(task); err != nil {
+		return TaskUpdate{}, err
+	}
+
+	var expect TaskPrecondition
+	changed := make(map[string]bool)
+	for i, op := range ops {
+		doc, err = applyJSONPatchOp(doc, op, changed, &expect)
+		if err != nil {
+			return TaskUpdate{}, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+
+	after, ok := doc.(map[string]any)
+	if !ok {
+		return TaskUpdate{}, fmt.Errorf("%w: patched task must be a JSON object", errInvalidPatch)
+	}
+	return taskUpdateFromDocument(task, before, after, expect)
+}
+
+func applyJSONPatchOp(doc any, op jsonPatchOp, changed map[string]bool, expect *TaskPrecondition) (any, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: %s requires a value", errInvalidPatch, op.Op)
+		}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+		}
+	}
+
+	switch op.Op {
+	case "test":
+		current, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w: %s does not match", ErrTaskConflict, op.Path)
+		}
+		expectUnchanged(expect, path, value, changed)
+		return doc, nil
+	case "add":
+		markChanged(changed, path)
+		return jsonPointerAdd(doc, path, value)
+	case "remove":
+		markChanged(changed, path)
+		doc, _, err = jsonPointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		markChanged(changed, path)
+		if doc, _, err = jsonPointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, value)
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if isJSONPointerPrefix(from, path) && len(from) < len(path) {
+				return nil, fmt.Errorf("%w: cannot move %s into itself", errInvalidPatch, op.From)
+			}
+			markChanged(changed, from)
+			if doc, value, err = jsonPointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if value, err = jsonPointerGet(doc, from); err != nil {
+				return nil, err
+			}
+			value = cloneJSONValue(value)
+		}
+		markChanged(changed, path)
+		return jsonPointerAdd(doc, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", errInvalidPatch, op.Op)
+	}
+}
+
+// markChanged records the top-level member an operation writes to; the
+// empty pointer replaces the whole document.
+func markChanged(changed map[string]bool, path []string) {
+	if len(path) == 0 {
+		for _, field := range editableTaskFields {
+			changed[field] = true
+		}
+		return
+	}
+	changed[path[0]] = true
+}
+
+// expectUnchanged turns a passing test of an editable field the patch has not
+// written yet into a precondition on the stored task.
+func expectUnchanged(expect *TaskPrecondition, path []string, value any, changed map[string]bool) {
+	if len(path) == 0 {
+		if obj, ok := value.(map[string]any); ok {
+			for _, field := range editableTaskFields {
+				expectUnchanged(expect, []string{field}, obj[field], changed)
+			}
+		}
+		return
+	}
+	if len(path) != 1 || changed[path[0]] {
+		return
+	}
+	switch path[0] {
+	case "title":
+		if title, ok := value.(string); ok {
+			expect.Title = &title
+		}
+	case "status":
+		if status, ok := value.(string); ok {
+			expect.Status = &status
+		}
+	case "userId":
+		if userID, ok := jsonInt(value); ok {
+			expect.UserID = &userID
+		}
+	}
+}
+
+// taskUpdateFromDocument validates the patched task document after and
+// returns the editable fields that differ from task.
+func taskUpdateFromDocument(task Task, before, after map[string]any, expect TaskPrecondition) (TaskUpdate, error) {
+	var unknown []string
+	for key := range after {
+		if !containsString(editableTaskFields, key) && !containsString(readOnlyTaskFields, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+
+	var v validator
+	for _, key := range unknown {
+		v.add(key, codeUnknownField, "unknown field "+key)
+	}
+	for _, key := range readOnlyTaskFields {
+		if !reflect.DeepEqual(before[key], after[key]) {
+			v.add(key, codeReadOnly, key+" cannot be changed")
+		}
+	}
+
+	req := replaceTaskRequest{
+		Title:  documentString(&v, after, "title"),
+		Status: documentString(&v, after, "status"),
+	}
+	if value, ok := after["userId"]; ok && value != nil {
+		if userID, ok := jsonInt(value); ok {
+			req.UserID = &userID
+		} else {
+			v.add("userId", codeInvalidType, "userId must be an integer")
+		}
+	}
+	if err := v.err(); err != nil {
+		return TaskUpdate{}, err
+	}
+
+	full, err := req.validate()
+	if err != nil {
+		return TaskUpdate{}, err
+	}
+	update := TaskUpdate{Expect: expect}
+	if *full.Title != task.Title {
+		update.Title = full.Title
+	}
+	if *full.Status != task.Status {
+		update.Status = full.Status
+	}
+	if *full.UserID != task.UserID {
+		update.UserID = full.UserID
+	}
+	return update, nil
+}
+
+// documentString returns doc[field] when it is a string; a missing field is
+// left for replaceTaskRequest.validate to report.
+func documentString(v *validator, doc map[string]any, field string) string {
+	value, ok := doc[field]
+	if !ok || value == nil {
+		return ""
+	}
+	s, ok := value.(string)
+	if !ok {
+		v.add(field, codeInvalidType, field+" must be a string")
+	}
+	return s
+}
+
+// jsonInt converts a decoded JSON number holding an integer to int.
+func jsonInt(value any) (int, bool) {
+	n, ok := value.(float64)
+	if !ok || n != math.Trunc(n) || math.Abs(n) > math.MaxInt32 {
+		return 0, false
+	}
+	return int(n), true
+}
+
+// parseJSONPointer splits an RFC 6901 pointer into unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", errInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func isJSONPointerPrefix(prefix, path []string) bool {
+	if len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonPointerGet(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, errPathNotFound
+			}
+			doc = value
+		case []any:
+			index, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[index]
+		default:
+			return nil, errPathNotFound
+		}
+	}
+	return doc, nil
+}
+
+// jsonPointerAdd adds value at path and returns the new document. Arrays get
+// value inserted at the index, or appended for "-".
+func jsonPointerAdd(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(rest) == 0 {
+			node[token] = value
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, errPathNotFound
+		}
+		child, err := jsonPointerAdd(child, rest, value)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []any:
+		if len(rest) == 0 {
+			index := len(node)
+			if token != "-" {
+				var err error
+				if index, err = arrayIndex(token, len(node)); err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[index+1:], node[index:])
+			node[index] = value
+			return node, nil
+		}
+		index, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		if node[index], err = jsonPointerAdd(node[index], rest, value); err != nil {
+			return nil, err
+		}
+		return node, nil
+	default:
+		return nil, errPathNotFound
+	}
+}
+
+// jsonPointerRemove removes the value at path, returning the new document
+// and the removed value.
+func jsonPointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	token, rest := path[0], path[1:]
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, nil, errPathNotFound
+		}
+		if len(rest) == 0 {
+			delete(node, token)
+			return node, child, nil
+		}
+		child, removed, err := jsonPointerRemove(child, rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[token] = child
+		return node, removed, nil
+	case []any:
+		index, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(rest) == 0 {
+			removed := node[index]
+			return append(node[:index], node[index+1:]...), removed, nil
+		}
+		child, removed, err := jsonPointerRemove(node[index], rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		node[index] = child
+		return node, removed, nil
+	default:
+		return nil, nil, errPathNotFound
+	}
+}
+
+// arrayIndex parses an array index token no greater than max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, errPathNotFound
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || index > max {
+		return 0, errPathNotFound
+	}
+	return index, nil
+}
+
+func cloneJSONValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		clone := make(map[string]any, len(v))
+		for key, item := range v {
+			clone[key] = cloneJSONValue(item)
+		}
+		return clone
+	case []any:
+		clone := make([]any, len(v))
+		for i, item := range v {
+			clone[i] = cloneJSONValue(item)
+		}
+		return clone
+	default:
+		return v
+	}
+}
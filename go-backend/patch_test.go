@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func jsonPatchHeaders() map[string]string {
+	return map[string]string{"Content-Type": jsonPatchContentType}
+}
+
+func TestPATCHTaskMergePatch(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`, asActor("alice"))
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var task Task
+	decodeJSONResponse(t, res.Body.Bytes(), &task)
+	if task.Status != "completed" || task.Title != "Implement authentication" || task.UserID != 1 {
+		t.Fatalf("expected only the status to change, got %+v", task)
+	}
+	if task.LastChange == nil || task.LastChange.Field != "status" || task.LastChange.ChangedBy != "alice" {
+		t.Fatalf("expected a status history entry by alice, got %+v", task.LastChange)
+	}
+
+	testCases := []struct {
+		name string
+		body string
+		want map[string]string
+	}{
+		{name: "read-only field", body: `{"id":7}`, want: map[string]string{"id": codeReadOnly}},
+		{name: "unknown field", body: `{"priority":"high"}`, want: map[string]string{"priority": codeUnknownField}},
+		{name: "wrong type", body: `{"userId":"2"}`, want: map[string]string{"userId": codeInvalidType}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", tc.body)
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, res.Code, res.Body.String())
+			}
+			if codes := fieldErrorCodes(decodeProblem(t, res)); !reflect.DeepEqual(codes, tc.want) {
+				t.Fatalf("expected field errors %v, got %v", tc.want, codes)
+			}
+		})
+	}
+
+	if res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `["status"]`); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected non-object merge patch to be rejected, got %d", res.Code)
+	}
+	if res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/999", `{"status":"pending"}`); res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+}
+
+func TestPATCHTaskJSONPatch(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+
+	body := `[{"op":"test","path":"/status","value":"pending"},{"op":"replace","path":"/status","value":"in-progress"},{"op":"copy","from":"/status","path":"/title"}]`
+	res := performRequestWithHeaders(h, http.MethodPatch, "/api/tasks/1", body, jsonPatchHeaders())
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusOK, res.Code, res.Body.String())
+	}
+	var task Task
+	decodeJSONResponse(t, res.Body.Bytes(), &task)
+	if task.Status != "in-progress" || task.Title != "in-progress" {
+		t.Fatalf("expected patched status and title, got %+v", task)
+	}
+
+	// The status is no longer pending, so the same patch now conflicts.
+	res = performRequestWithHeaders(h, http.MethodPatch, "/api/tasks/1", body, jsonPatchHeaders())
+	if res.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusConflict, res.Code, res.Body.String())
+	}
+
+	for _, invalid := range []string{
+		`{"op":"replace","path":"/status","value":"completed"}`,
+		`[{"op":"replace","path":"/status"}]`,
+		`[{"op":"remove","path":"/missing"}]`,
+		`[{"op":"update","path":"/status","value":"completed"}]`,
+		`[{"op":"remove","path":"/title"}]`,
+	} {
+		if res := performRequestWithHeaders(h, http.MethodPatch, "/api/tasks/1", invalid, jsonPatchHeaders()); res.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d for %s, got %d body=%s", http.StatusBadRequest, invalid, res.Code, res.Body.String())
+		}
+	}
+
+	res = performRequestWithHeaders(h, http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`, map[string]string{"Content-Type": "application/json"})
+	if res.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected status %d, got %d", http.StatusUnsupportedMediaType, res.Code)
+	}
+	if got := res.Header().Get("Accept-Patch"); got != acceptPatch {
+		t.Fatalf("expected Accept-Patch %q, got %q", acceptPatch, got)
+	}
+}
+
+func TestJSONPatchTestsBecomePreconditions(t *testing.T) {
+	task := Task{ID: 1, WorkspaceID: defaultWorkspaceID, Title: "Old", Status: "pending", UserID: 1}
+
+	update, err := jsonPatchTask(task, json.RawMessage(`[
+		{"op":"test","path":"/title","value":"Old"},
+		{"op":"replace","path":"/status","value":"completed"},
+		{"op":"test","path":"/status","value":"completed"}
+	]`))
+	if err != nil {
+		t.Fatalf("jsonPatchTask: %v", err)
+	}
+	if update.Title != nil || update.UserID != nil || update.Status == nil || *update.Status != "completed" {
+		t.Fatalf("expected only a status change, got %+v", update)
+	}
+	if update.Expect.Title == nil || *update.Expect.Title != "Old" || update.Expect.Status != nil {
+		t.Fatalf("expected only the title test as a precondition, got %+v", update.Expect)
+	}
+
+	// The store rechecks preconditions under its lock.
+	ds := NewDataStore(demoFixtures(t).Users, []Task{task})
+	renamed := "Renamed"
+	if _, err := ds.UpdateTask(context.Background(), 1, TaskUpdate{Title: &renamed}, "bob"); err != nil {
+		t.Fatalf("UpdateTask: %v", err)
+	}
+	if _, err := ds.UpdateTask(context.Background(), 1, update, "alice"); !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected ErrTaskConflict, got %v", err)
+	}
+}
+
+func TestApplyJSONPatchOps(t *testing.T) {
+	testCases := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+	}{
+		{name: "add to array", doc: `{"a":[1,3]}`, ops: `[{"op":"add","path":"/a/1","value":2}]`, want: `{"a":[1,2,3]}`},
+		{name: "append to array", doc: `{"a":[1]}`, ops: `[{"op":"add","path":"/a/-","value":2}]`, want: `{"a":[1,2]}`},
+		{name: "remove from array", doc: `{"a":[1,2,3]}`, ops: `[{"op":"remove","path":"/a/0"}]`, want: `{"a":[2,3]}`},
+		{name: "move member", doc: `{"a":{"b":1},"c":{}}`, ops: `[{"op":"move","from":"/a/b","path":"/c/d"}]`, want: `{"a":{},"c":{"d":1}}`},
+		{name: "escaped tokens", doc: `{"a/b":1,"m~n":2}`, ops: `[{"op":"replace","path":"/a~1b","value":3},{"op":"test","path":"/m~0n","value":2}]`, want: `{"a/b":3,"m~n":2}`},
+		{name: "replace root", doc: `{"a":1}`, ops: `[{"op":"replace","path":"","value":{"b":2}}]`, want: `{"b":2}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var doc, want any
+			var ops []jsonPatchOp
+			for raw, dst := range map[string]any{tc.doc: &doc, tc.ops: &ops, tc.want: &want} {
+				if err := json.Unmarshal([]byte(raw), dst); err != nil {
+					t.Fatalf("unmarshal %s: %v", raw, err)
+				}
+			}
+			var expect TaskPrecondition
+			for _, op := range ops {
+				var err error
+				if doc, err = applyJSONPatchOp(doc, op, map[string]bool{}, &expect); err != nil {
+					t.Fatalf("apply %+v: %v", op, err)
+				}
+			}
+			if !reflect.DeepEqual(doc, want) {
+				t.Fatalf("expected %v, got %v", want, doc)
+			}
+		})
+	}
+
+	var doc any = map[string]any{"a": map[string]any{"b": 1.0}}
+	if _, err := applyJSONPatchOp(doc, jsonPatchOp{Op: "move", From: "/a", Path: "/a/b"}, map[string]bool{}, &TaskPrecondition{}); !errors.Is(err, errInvalidPatch) {
+		t.Fatalf("expected moving a value into itself to fail, got %v", err)
+	}
+}
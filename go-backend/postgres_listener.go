@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	changeNotifyChannel   = "gotest_changes"
+	maxNotifyPayloadBytes = 7900
+	// listenerMinReconnect and listenerMaxReconnect are DatabaseConfig defaults.
+	listenerMinReconnect    = 1 * time.Second
+	listenerMaxReconnect    = 30 * time.Second
+	listenerPingInterval    = 90 * time.Second
+	listenerShutdownTimeout = 5 * time.Second
+	// listenerResyncWindow is how many history IDs below the newest one a
+	// resync re-checks for transactions that took an ID but committed later.
+	listenerResyncWindow = 100
+)
+
+// changeListener is the subset of *pq.Listener used by the listen loop.
+type changeListener interface {
+	Listen(channel string) error
+	NotificationChannel() <-chan *pq.Notification
+	Ping() error
+	Close() error
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// StartChangeListener subscribes to change notifications from every replica
+// sharing the database and republishes them on the store's event bus. Once
+// started, mutations are announced with NOTIFY instead of being published
+// locally, so this instance sees its own changes through the same path.
+func (ps *PostgresStore) StartChangeListener(dsn string) error {
+	listener := pq.NewListener(dsn, ps.cfg.ListenerMinReconnect, ps.cfg.ListenerMaxReconnect, ps.logListenerEvent)
+	return ps.startListening(listener)
+}
+
+func (ps *PostgresStore) startListening(listener changeListener) error {
+	if err := listener.Listen(changeNotifyChannel); err != nil {
+		_ = listener.Close()
+		return fmt.Errorf("listen on %s: %w", changeNotifyChannel, err)
+	}
+
+	// Changes committed from here on are notified; older ones need no resync.
+	seen, err := ps.latestHistoryID(context.Background())
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	ps.notifyChanges = true
+	ps.stopListening = func() {
+		cancel()
+		_ = listener.Close()
+		select {
+		case <-done:
+		case <-time.After(listenerShutdownTimeout):
+			ps.logger.Warn("timed out waiting for change listener to stop")
+		}
+	}
+
+	go func() {
+		defer close(done)
+		ps.listenForChanges(ctx, listener, seen)
+	}()
+
+	return nil
+}
+
+func (ps *PostgresStore) listenForChanges(ctx context.Context, listener changeListener, seen *seenChanges) {
+	ping := time.NewTicker(listenerPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification, ok := <-listener.NotificationChannel():
+			if !ok {
+				return
+			}
+			if notification == nil {
+				// The connection was re-established; anything sent meanwhile was lost.
+				ps.resyncChanges(ctx, seen)
+				continue
+			}
+
+			var event ChangeEvent
+			if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+				ps.logger.ErrorContext(ctx, "error decoding change notification", "error", err)
+				continue
+			}
+			seen.add(event.ID)
+			ps.events.Publish(event)
+		case <-ping.C:
+			if err := listener.Ping(); err != nil {
+				ps.logger.WarnContext(ctx, "change listener ping failed", "error", err)
+			}
+		}
+	}
+}
+
+// latestHistoryID returns the changes seen so far when the listener starts:
+// everything up to the newest task history ID.
+func (ps *PostgresStore) latestHistoryID(ctx context.Context) (*seenChanges, error) {
+	ctx, cancel := context.WithTimeout(withWorkspace(ctx, allWorkspaces), ps.cfg.OperationTimeout)
+	defer cancel()
+
+	var latest int
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, _ string) error {
+		return ps.queryRow(ctx, tx, "task_history.select_max_id", `SELECT COALESCE(MAX(id), 0) FROM task_history`, nil, &latest)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("query latest task history id: %w", err)
+	}
+	return newSeenChanges(latest), nil
+}
+
+// resyncChanges republishes task history missed while disconnected, a page
+// at a time until it is caught up. IDs are taken when a transaction inserts
+// history but become visible when it commits, so the window below the newest
+// ID seen is re-checked for changes that committed late. User events cannot
+// be recovered.
+func (ps *PostgresStore) resyncChanges(ctx context.Context, seen *seenChanges) {
+	afterID := seen.resyncFrom()
+	for {
+		// Subscribers filter by workspace themselves, so replay every workspace.
+		page, err := replayHistory(withWorkspace(ctx, allWorkspaces), ps, afterID, maxEventReplay, EventFilter{})
+		if err != nil {
+			ps.logger.ErrorContext(ctx, "error resyncing changes", "after_id", afterID, "error", err)
+			return
+		}
+		for _, event := range page.events {
+			if seen.has(event.ID) {
+				continue
+			}
+			seen.add(event.ID)
+			ps.events.Publish(event)
+		}
+		if !page.more {
+			return
+		}
+		afterID = page.through
+	}
+}
+
+// seenChanges tracks the task history IDs the listener has delivered within
+// listenerResyncWindow of the newest one. IDs at or below floor, the newest
+// ID when the listener started, were committed before it and count as seen.
+type seenChanges struct {
+	floor  int
+	latest int
+	ids    map[int]struct{}
+}
+
+func newSeenChanges(floor int) *seenChanges {
+	return &seenChanges{floor: floor, latest: floor, ids: make(map[int]struct{})}
+}
+
+func (s *seenChanges) add(id int) {
+	if id <= s.floor {
+		return
+	}
+	s.ids[id] = struct{}{}
+	if id <= s.latest {
+		return
+	}
+	s.latest = id
+	for seenID := range s.ids {
+		if seenID <= s.latest-listenerResyncWindow {
+			delete(s.ids, seenID)
+		}
+	}
+}
+
+func (s *seenChanges) has(id int) bool {
+	if id <= s.floor {
+		return true
+	}
+	_, ok := s.ids[id]
+	return ok
+}
+
+// resyncFrom is the history ID after which a resync looks for missed changes.
+func (s *seenChanges) resyncFrom() int {
+	return max(s.floor, s.latest-listenerResyncWindow)
+}
+
+// notifyChange announces event to all replicas with NOTIFY when the change
+// listener is running. Inside a transaction the notification is only
+// delivered if and when the transaction commits.
+func (ps *PostgresStore) notifyChange(ctx context.Context, db execer, event ChangeEvent) error {
+	if !ps.notifyChanges {
+		return nil
+	}
+
+	payload, err := notifyPayload(event)
+	if err != nil {
+		return fmt.Errorf("encode change notification: %w", err)
+	}
+	if _, err := ps.exec(ctx, db, "notify_change", `SELECT pg_notify($1, $2)`, changeNotifyChannel, payload); err != nil {
+		return fmt.Errorf("notify change: %w", err)
+	}
+	return nil
+}
+
+// publishLocally delivers a committed change in-process when no change
+// listener is running to deliver it via NOTIFY.
+func (ps *PostgresStore) publishLocally(event ChangeEvent) {
+	if ps.notifyChanges {
+		return
+	}
+	ps.events.Publish(event)
+}
+
+// notifyPayload encodes the event, dropping the snapshots and then the change
+// values if the result would exceed the NOTIFY payload limit. Receivers of a
+// trimmed event can still look the task up by ID.
+func notifyPayload(event ChangeEvent) (string, error) {
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) > maxNotifyPayloadBytes {
+		event.Task = nil
+		event.User = nil
+		if payload, err = json.Marshal(event); err != nil {
+			return "", err
+		}
+	}
+	if len(payload) > maxNotifyPayloadBytes {
+		event.Change = nil
+		if payload, err = json.Marshal(event); err != nil {
+			return "", err
+		}
+	}
+	return string(payload), nil
+}
+
+func (ps *PostgresStore) logListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		ps.logger.Warn("change listener disconnected", "error", err)
+	case pq.ListenerEventReconnected:
+		ps.logger.Info("change listener reconnected")
+	case pq.ListenerEventConnectionAttemptFailed:
+		ps.logger.Warn("change listener reconnect attempt failed", "error", err)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+)
+
+type fakeChangeListener struct {
+	notifications chan *pq.Notification
+	listenErr     error
+	listened      []string
+	closeOnce     sync.Once
+}
+
+func newFakeChangeListener() *fakeChangeListener {
+	return &fakeChangeListener{notifications: make(chan *pq.Notification, 8)}
+}
+
+func (l *fakeChangeListener) Listen(channel string) error {
+	l.listened = append(l.listened, channel)
+	return l.listenErr
+}
+
+func (l *fakeChangeListener) NotificationChannel() <-chan *pq.Notification {
+	return l.notifications
+}
+
+func (l *fakeChangeListener) Ping() error {
+	return nil
+}
+
+func (l *fakeChangeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.notifications) })
+	return nil
+}
+
+// expectLatestHistoryID expects the listener to look up where history stands
+// when it starts.
+func expectLatestHistoryID(mock sqlmock.Sqlmock, id int) {
+	expectWorkspaceTx(mock, allWorkspaces)
+	mock.
+		ExpectQuery(`SELECT COALESCE\(MAX\(id\), 0\) FROM task_history`).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(id))
+	mock.ExpectRollback()
+}
+
+func TestPostgresStoreListenerRepublishesNotifications(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	store.events = NewEventBus()
+	expectLatestHistoryID(mock, 0)
+
+	events, unsubscribe := store.events.Subscribe(EventFilter{})
+	defer unsubscribe()
+
+	listener := newFakeChangeListener()
+	if err := store.startListening(listener); err != nil {
+		t.Fatalf("expected listener to start, got %v", err)
+	}
+	defer store.stopListening()
+
+	if len(listener.listened) != 1 || listener.listened[0] != changeNotifyChannel {
+		t.Fatalf("expected LISTEN on %q, got %v", changeNotifyChannel, listener.listened)
+	}
+	if !store.notifyChanges {
+		t.Fatal("expected store to switch to NOTIFY-based publishing")
+	}
+
+	payload, err := notifyPayload(ChangeEvent{ID: 12, Type: EventTaskUpdated, TaskID: 3, UserID: 2})
+	if err != nil {
+		t.Fatalf("failed to encode payload: %v", err)
+	}
+	listener.notifications <- &pq.Notification{Channel: changeNotifyChannel, Extra: "not json"}
+	listener.notifications <- &pq.Notification{Channel: changeNotifyChannel, Extra: payload}
+
+	select {
+	case event := <-events:
+		if event.ID != 12 || event.TaskID != 3 || event.Type != EventTaskUpdated {
+			t.Fatalf("unexpected republished event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for republished notification")
+	}
+}
+
+func TestPostgresStoreListenerResyncsAfterReconnect(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	store.events = NewEventBus()
+
+	events, unsubscribe := store.events.Subscribe(EventFilter{})
+	defer unsubscribe()
+
+	// History stood at 3 when the listener started and 5 was notified live;
+	// 4 committed after 5 and 6 while the connection was down.
+	expectLatestHistoryID(mock, 3)
+	now := time.Now().UTC()
+	expectWorkspaceTx(mock, allWorkspaces)
+	mock.
+		ExpectQuery(`FROM task_history\s+WHERE \(workspace_id = \$1 OR \$1 = '\*'\) AND id > \$2`).
+		WithArgs(allWorkspaces, 3, maxEventReplay).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "workspace_id", "task_id", "changed_at", "changed_by", "field", "from_value", "to_value", "batch_id"}).
+				AddRow(4, defaultWorkspaceID, 2, now, "admin", "title", "Old", "New", nil).
+				AddRow(5, defaultWorkspaceID, 1, now.Add(-time.Second), "admin", "status", nil, "pending", nil).
+				AddRow(6, defaultWorkspaceID, 1, now, "admin", "status", "pending", "completed", nil),
+		)
+	mock.ExpectRollback()
+	expectWorkspaceTx(mock, allWorkspaces)
+	mock.
+		ExpectQuery(`SELECT id, user_id\s+FROM tasks`).
+		WithArgs(allWorkspaces, pq.Array([]int{2, 1})).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id"}).AddRow(1, 2).AddRow(2, 3))
+	mock.ExpectRollback()
+
+	listener := newFakeChangeListener()
+	if err := store.startListening(listener); err != nil {
+		t.Fatalf("expected listener to start, got %v", err)
+	}
+	defer store.stopListening()
+
+	payload, _ := notifyPayload(ChangeEvent{ID: 5, Type: EventTaskCreated, TaskID: 1, UserID: 2})
+	listener.notifications <- &pq.Notification{Channel: changeNotifyChannel, Extra: payload}
+	listener.notifications <- nil
+
+	for _, wantID := range []int{5, 4, 6} {
+		select {
+		case event := <-events:
+			if event.ID != wantID {
+				t.Fatalf("expected event %d, got %+v", wantID, event)
+			}
+			if wantID == 6 && event.UserID != 2 {
+				t.Fatalf("expected resynced event to resolve assignee 2, got %d", event.UserID)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for event %d", wantID)
+		}
+	}
+
+	store.stopListening()
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreListenerResyncPagesUntilCaughtUp(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	store.events = NewEventBus()
+
+	// Only task 2's events are read, so the subscriber keeps up.
+	events, unsubscribe := store.events.Subscribe(EventFilter{TaskID: 2})
+	defer unsubscribe()
+
+	// More changes were missed than one page holds; the last three are
+	// task 2's.
+	expectLatestHistoryID(mock, 0)
+	start := time.Now().UTC()
+	taskOf := func(id int) int {
+		if id >= maxEventReplay-1 {
+			return 2
+		}
+		return 1
+	}
+	expectHistoryPage := func(afterID int, ids []int, taskIDs []int) {
+		rows := sqlmock.NewRows([]string{"id", "workspace_id", "task_id", "changed_at", "changed_by", "field", "from_value", "to_value", "batch_id"})
+		owners := sqlmock.NewRows([]string{"id", "user_id"})
+		for _, id := range ids {
+			rows.AddRow(id, defaultWorkspaceID, taskOf(id), start.Add(time.Duration(id)*time.Second), "admin", "title", "Old", "New", nil)
+		}
+		for _, id := range taskIDs {
+			owners.AddRow(id, 3)
+		}
+		expectWorkspaceTx(mock, allWorkspaces)
+		mock.
+			ExpectQuery(`FROM task_history\s+WHERE \(workspace_id = \$1 OR \$1 = '\*'\) AND id > \$2`).
+			WithArgs(allWorkspaces, afterID, maxEventReplay).
+			WillReturnRows(rows)
+		mock.ExpectRollback()
+		expectWorkspaceTx(mock, allWorkspaces)
+		mock.
+			ExpectQuery(`SELECT id, user_id\s+FROM tasks`).
+			WithArgs(allWorkspaces, pq.Array(taskIDs)).
+			WillReturnRows(owners)
+		mock.ExpectRollback()
+	}
+	var first []int
+	for id := 1; id <= maxEventReplay; id++ {
+		first = append(first, id)
+	}
+	expectHistoryPage(0, first, []int{1, 2})
+	// The full page leaves its last write for the next one.
+	expectHistoryPage(maxEventReplay-1, []int{maxEventReplay, maxEventReplay + 1}, []int{2})
+
+	listener := newFakeChangeListener()
+	if err := store.startListening(listener); err != nil {
+		t.Fatalf("expected listener to start, got %v", err)
+	}
+	defer store.stopListening()
+	listener.notifications <- nil
+
+	for _, wantID := range []int{maxEventReplay - 1, maxEventReplay, maxEventReplay + 1} {
+		select {
+		case event := <-events:
+			if event.ID != wantID {
+				t.Fatalf("expected event %d, got %+v", wantID, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for event %d", wantID)
+		}
+	}
+
+	store.stopListening()
+	assertMockExpectations(t, mock)
+}
+
+func TestSeenChangesWindow(t *testing.T) {
+	seen := newSeenChanges(10)
+	if !seen.has(7) || seen.has(11) || seen.resyncFrom() != 10 {
+		t.Fatalf("expected IDs up to the floor to count as seen, got %+v", seen)
+	}
+	seen.add(12)
+	seen.add(10 + listenerResyncWindow + 5)
+	if seen.has(11) || seen.has(12) {
+		t.Fatal("expected IDs below the window to be forgotten")
+	}
+	if got, want := seen.resyncFrom(), 15; got != want {
+		t.Fatalf("expected a resync after %d, got %d", want, got)
+	}
+}
+
+func TestPostgresStoreStartListeningFailure(t *testing.T) {
+	store, _, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	listener := newFakeChangeListener()
+	listener.listenErr = errors.New("connection refused")
+
+	err := store.startListening(listener)
+	if err == nil || !strings.Contains(err.Error(), "listen on") {
+		t.Fatalf("expected wrapped listen error, got %v", err)
+	}
+	if store.notifyChanges {
+		t.Fatal("expected store to keep publishing locally when LISTEN fails")
+	}
+}
+
+func TestPostgresStoreNotifiesInsideTransaction(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	store.events = NewEventBus()
+	store.notifyChanges = true
+
+	events, unsubscribe := store.events.Subscribe(EventFilter{})
+	defer unsubscribe()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE workspace_id = \$1 AND id = \$2\)`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.
+		ExpectQuery(`INSERT INTO tasks`).
+		WithArgs(defaultWorkspaceID, "Task", "pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(4, defaultWorkspaceID, "Task", "pending", 1))
+	mock.
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 4, sqlmock.AnyArg(), "admin", "status", nil, "pending", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.
+		ExpectExec(`SELECT pg_notify\(\$1, \$2\)`).
+		WithArgs(changeNotifyChannel, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := store.CreateTask(context.Background(), "Task", "pending", 1, "admin"); err != nil {
+		t.Fatalf("expected create task to succeed, got %v", err)
+	}
+
+	select {
+	case event := <-events:
+		t.Fatalf("expected no local publish while notifying, got %+v", event)
+	default:
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestNotifyPayloadTrimsOversizedEvents(t *testing.T) {
+	longTitle := strings.Repeat("x", maxNotifyPayloadBytes)
+	task := Task{ID: 1, Title: longTitle, Status: "pending", UserID: 1}
+	task.LastChange = &TaskHistoryItem{ID: 3, TaskID: 1, Field: "title", ToValue: longTitle}
+
+	payload, err := notifyPayload(taskEvent(EventTaskUpdated, task))
+	if err != nil {
+		t.Fatalf("expected payload encoding to succeed, got %v", err)
+	}
+	if len(payload) > maxNotifyPayloadBytes {
+		t.Fatalf("expected payload within %d bytes, got %d", maxNotifyPayloadBytes, len(payload))
+	}
+
+	var event ChangeEvent
+	if err := json.Unmarshal([]byte(payload), &event); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if event.ID != 3 || event.TaskID != 1 || event.Task != nil || event.Change != nil {
+		t.Fatalf("expected trimmed event keeping identifiers, got %+v", event)
+	}
+}
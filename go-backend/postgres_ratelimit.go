@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// postgresRateLimiter keeps token buckets in the rate_limit_buckets table, so
+// every replica draws from the same buckets. Each Take is one call to
+// take_rate_limit_token, which locks the bucket's row and uses the database
+// clock, so replicas agree on refills.
+type postgresRateLimiter struct {
+	ps  *PostgresStore
+	now func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// newPostgresRateLimiter returns a limiter sharing buckets through ps.
+func newPostgresRateLimiter(ps *PostgresStore) *postgresRateLimiter {
+	return &postgresRateLimiter{ps: ps, now: time.Now}
+}
+
+func (l *postgresRateLimiter) Take(ctx context.Context, key string, rate Rate) (rateDecision, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.ps.cfg.OperationTimeout)
+	defer cancel()
+
+	var decision rateDecision
+	if err := l.ps.queryRow(ctx, l.ps.db, "rate_limit.take", `
+		SELECT remaining, allowed FROM take_rate_limit_token($1, $2, $3)
+	`, []any{key, rate.Limit, rate.perSecond()}, &decision.tokens, &decision.allowed); err != nil {
+		return rateDecision{}, fmt.Errorf("take rate limit token: %w", err)
+	}
+	l.sweep()
+	return decision, nil
+}
+
+// sweep deletes buckets that have refilled, at most once a
+// rateLimitSweepInterval per replica, in the background.
+func (l *postgresRateLimiter) sweep() {
+	now := l.now()
+	l.mu.Lock()
+	due := now.Sub(l.lastSweep) >= rateLimitSweepInterval
+	if due {
+		l.lastSweep = now
+	}
+	l.mu.Unlock()
+	if !due {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), l.ps.cfg.OperationTimeout)
+		defer cancel()
+		if _, err := l.ps.exec(ctx, l.ps.db, "rate_limit.sweep", `DELETE FROM rate_limit_buckets WHERE full_at < NOW()`); err != nil {
+			l.ps.logger.Warn("error deleting refilled rate limit buckets", "error", err)
+		}
+	}()
+}
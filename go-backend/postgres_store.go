@@ -5,123 +5,280 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// Defaults for DatabaseConfig.
 const (
 	dbOperationTimeout = 3 * time.Second
 	dbPingRetries      = 20
+
+	// dbExportTimeout bounds a streamed export, which reads whole tables.
+	dbExportTimeout = 5 * time.Minute
+	// dbBatchTimeout bounds a bulk task request, which runs up to
+	// Limits.MaxBulkItems writes in one transaction.
+	dbBatchTimeout = 30 * time.Second
+	// dbImportTimeout bounds an import, which writes every row in one transaction.
+	dbImportTimeout = time.Minute
+	// dbMigrationTimeout bounds a migration run, which may rewrite whole tables.
+	dbMigrationTimeout = 5 * time.Minute
 )
 
+// requiredTables are the tables the migrations create and the store queries.
+var requiredTables = []string{"users", "tasks", "task_history"}
+
 // PostgresStore persists users/tasks in PostgreSQL.
 type PostgresStore struct {
-	db     *sql.DB
-	logger *log.Logger
+	db            *sql.DB
+	cfg           DatabaseConfig
+	logger        *slog.Logger
+	events        *EventBus
+	tracer        trace.Tracer
+	notifyChanges bool
+	stopListening func()
+}
+
+// NewPostgresStore connects, applies pending migrations and starts the
+// change listener. It never seeds; see Seed.
+func NewPostgresStore(cfg DatabaseConfig) (*PostgresStore, error) {
+	ps, err := openPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := ps.MigrateUp(context.Background()); err != nil {
+		_ = ps.Close()
+		return nil, fmt.Errorf("initialize schema: %w", err)
+	}
+
+	if err := ps.StartChangeListener(cfg.DSN); err != nil {
+		_ = ps.Close()
+		return nil, fmt.Errorf("start change listener: %w", err)
+	}
+
+	return ps, nil
 }
 
-// NewPostgresStore initializes the PostgreSQL store, schema, and seed data.
-func NewPostgresStore(dsn string) (*PostgresStore, error) {
-	if strings.TrimSpace(dsn) == "" {
+// openPostgres connects to the database, pinging up to cfg.PingRetries
+// times, without touching the schema or listening for changes. Commands that
+// manage the database itself use it directly.
+func openPostgres(cfg DatabaseConfig) (*PostgresStore, error) {
+	if strings.TrimSpace(cfg.DSN) == "" {
 		return nil, errors.New("POSTGRES_DSN is required")
 	}
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := sql.Open("postgres", cfg.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("open postgres connection: %w", err)
 	}
 
-	db.SetConnMaxIdleTime(5 * time.Minute)
-	db.SetConnMaxLifetime(30 * time.Minute)
-	db.SetMaxIdleConns(5)
-	db.SetMaxOpenConns(20)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
 
-	if err := pingWithRetry(db); err != nil {
+	if err := pingWithRetry(db, cfg.PingRetries, cfg.OperationTimeout); err != nil {
 		_ = db.Close()
 		return nil, err
 	}
 
-	ps := &PostgresStore{
+	return &PostgresStore{
 		db:     db,
-		logger: log.Default(),
+		cfg:    cfg,
+		logger: slog.Default(),
+		events: NewEventBus(),
+		tracer: defaultTracer(),
+	}, nil
+}
+
+// Close stops the change listener and releases database resources.
+func (ps *PostgresStore) Close() error {
+	if ps.stopListening != nil {
+		ps.stopListening()
 	}
+	return ps.db.Close()
+}
 
-	if err := ps.initSchema(); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("initialize schema: %w", err)
+// Ping verifies the database is reachable.
+func (ps *PostgresStore) Ping(ctx context.Context) error {
+	ctx, span := ps.startQuerySpan(ctx, "ping", "PING")
+	err := ps.db.PingContext(ctx)
+	endQuerySpan(span, 0, err)
+	if err != nil {
+		return fmt.Errorf("ping postgres: %w", err)
 	}
+	return nil
+}
 
-	if err := ps.seedInitialData(); err != nil {
-		_ = db.Close()
-		return nil, fmt.Errorf("seed initial data: %w", err)
+// CheckMigrations reports ErrMigrationsPending when a table the store relies
+// on is missing.
+func (ps *PostgresStore) CheckMigrations(ctx context.Context) error {
+	var present int
+	if err := ps.queryRow(ctx, ps.db, "schema.count_tables", `
+		SELECT COUNT(*)
+		FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_name = ANY($1)
+	`, []any{pq.Array(requiredTables)}, &present); err != nil {
+		return fmt.Errorf("check schema: %w", err)
+	}
+	if present < len(requiredTables) {
+		return fmt.Errorf("%w: %d of %d tables present", ErrMigrationsPending, present, len(requiredTables))
 	}
+	return nil
+}
 
-	return ps, nil
+// DBStats reports connection pool statistics for metrics.
+func (ps *PostgresStore) DBStats() sql.DBStats {
+	return ps.db.Stats()
 }
 
-// Close releases database resources.
-func (ps *PostgresStore) Close() error {
-	return ps.db.Close()
+// Events returns the bus that receives this store's change events.
+func (ps *PostgresStore) Events() *EventBus {
+	return ps.events
 }
 
-func (ps *PostgresStore) GetUsers() ([]User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
-	defer cancel()
+// beginWorkspaceTx starts a transaction with app.workspace_id set to the
+// workspace of ctx, which the row-level security policies check. Writes
+// require a single workspace.
+func (ps *PostgresStore) beginWorkspaceTx(ctx context.Context, readOnly bool) (*sql.Tx, string, error) {
+	workspaceID := workspaceFromContext(ctx)
+	if !readOnly && workspaceID == allWorkspaces {
+		return nil, "", ErrWorkspaceRequired
+	}
 
-	rows, err := ps.db.QueryContext(ctx, `
-		SELECT id, name, email, role
-		FROM users
-		ORDER BY id
-	`)
+	tx, err := ps.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: readOnly})
 	if err != nil {
-		ps.logger.Printf("error querying users: %v", err)
-		return nil, fmt.Errorf("query users: %w", err)
+		return nil, "", fmt.Errorf("begin transaction: %w", err)
+	}
+	if _, err := ps.exec(ctx, tx, "workspace.set", `SELECT set_config('app.workspace_id', $1, true)`, workspaceID); err != nil {
+		_ = tx.Rollback()
+		return nil, "", fmt.Errorf("set workspace: %w", err)
 	}
-	defer rows.Close()
+	return tx, workspaceID, nil
+}
 
-	users := make([]User, 0)
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role); err != nil {
-			ps.logger.Printf("error scanning user row: %v", err)
-			return nil, fmt.Errorf("scan users row: %w", err)
-		}
-		users = append(users, user)
+// readInWorkspace runs fn in a read-only transaction scoped to the workspace
+// of ctx. Queries still filter by workspace explicitly; row-level security is
+// the second line of defense.
+func (ps *PostgresStore) readInWorkspace(ctx context.Context, fn func(tx *sql.Tx, workspaceID string) error) error {
+	tx, workspaceID, err := ps.beginWorkspaceTx(ctx, true)
+	if err != nil {
+		return err
 	}
-	if err := rows.Err(); err != nil {
-		ps.logger.Printf("error iterating user rows: %v", err)
-		return nil, fmt.Errorf("iterate users rows: %w", err)
+	defer func() { _ = tx.Rollback() }()
+
+	return fn(tx, workspaceID)
+}
+
+func (ps *PostgresStore) GetUsers(ctx context.Context) ([]User, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
+	defer cancel()
+
+	users := make([]User, 0)
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, "users.select_all", `
+			SELECT id, workspace_id, name, email, role
+			FROM users
+			WHERE workspace_id = $1 OR $1 = '*'
+			ORDER BY id
+		`, []any{workspaceID}, func(rows *sql.Rows) error {
+			var user User
+			if err := rows.Scan(&user.ID, &user.WorkspaceID, &user.Name, &user.Email, &user.Role); err != nil {
+				return fmt.Errorf("scan users row: %w", err)
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying users", "error", err)
+		return nil, fmt.Errorf("query users: %w", err)
 	}
 
 	return users, nil
 }
 
-func (ps *PostgresStore) GetUserByID(id int) (User, bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+func (ps *PostgresStore) GetUserByID(ctx context.Context, id int) (User, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
 	defer cancel()
 
 	var user User
-	err := ps.db.QueryRowContext(ctx, `
-		SELECT id, name, email, role
-		FROM users
-		WHERE id = $1
-	`, id).Scan(&user.ID, &user.Name, &user.Email, &user.Role)
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRow(ctx, tx, "users.select_by_id", `
+			SELECT id, workspace_id, name, email, role
+			FROM users
+			WHERE (workspace_id = $1 OR $1 = '*') AND id = $2
+		`, []any{workspaceID, id}, &user.ID, &user.WorkspaceID, &user.Name, &user.Email, &user.Role)
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return User{}, false, nil
 		}
-		ps.logger.Printf("error querying user id=%d: %v", id, err)
+		ps.logger.ErrorContext(ctx, "error querying user", "user_id", id, "error", err)
 		return User{}, false, fmt.Errorf("query user by id=%d: %w", id, err)
 	}
 
 	return user, true, nil
 }
 
-func (ps *PostgresStore) GetTasks(status, userID string) ([]Task, error) {
+// GetUserByEmail finds the user whose email matches case-insensitively, or
+// none when several users share it.
+func (ps *PostgresStore) GetUserByEmail(ctx context.Context, email string) (User, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
+	defer cancel()
+
+	users := make([]User, 0, 2)
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, "users.select_by_email", `
+			SELECT id, workspace_id, name, email, role
+			FROM users
+			WHERE (workspace_id = $1 OR $1 = '*') AND lower(email) = lower($2)
+			ORDER BY id
+			LIMIT 2
+		`, []any{workspaceID, email}, func(rows *sql.Rows) error {
+			var user User
+			if err := rows.Scan(&user.ID, &user.WorkspaceID, &user.Name, &user.Email, &user.Role); err != nil {
+				return fmt.Errorf("scan users row: %w", err)
+			}
+			users = append(users, user)
+			return nil
+		})
+	})
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying user by email", "error", err)
+		return User{}, false, fmt.Errorf("query user by email: %w", err)
+	}
+
+	if len(users) != 1 {
+		return User{}, false, nil
+	}
+	return users[0], true, nil
+}
+
+func (ps *PostgresStore) GetTasks(ctx context.Context, status, userID string) ([]Task, error) {
+	clauses, args, ok := taskFilterClauses(status, userID)
+	if !ok {
+		return []Task{}, nil
+	}
+
+	tasks, err := ps.selectTasks(ctx, "tasks.select_with_last_change", clauses, args)
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying tasks", "error", err)
+		return nil, fmt.Errorf("query tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// taskFilterClauses builds the selectTasks clauses for the GET /api/tasks
+// filters. It reports false when userID cannot match any task.
+func taskFilterClauses(status, userID string) ([]string, []any, bool) {
 	var (
 		clauses []string
 		args    []any
@@ -129,21 +286,58 @@ func (ps *PostgresStore) GetTasks(status, userID string) ([]Task, error) {
 
 	if status != "" {
 		args = append(args, status)
-		clauses = append(clauses, fmt.Sprintf("status = $%d", len(args)))
+		clauses = append(clauses, fmt.Sprintf("t.status = $%d", len(args)+1))
 	}
 
 	if userID != "" {
 		parsedUserID, err := strconv.Atoi(userID)
 		if err != nil {
-			return []Task{}, nil
+			return nil, nil, false
 		}
 		args = append(args, parsedUserID)
-		clauses = append(clauses, fmt.Sprintf("user_id = $%d", len(args)))
+		clauses = append(clauses, fmt.Sprintf("t.user_id = $%d", len(args)+1))
+	}
+
+	return clauses, args, true
+}
+
+func (ps *PostgresStore) GetTaskByID(ctx context.Context, id int) (Task, bool, error) {
+	tasks, err := ps.selectTasks(ctx, "tasks.select_by_id", []string{"t.id = $2"}, []any{id})
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying task", "task_id", id, "error", err)
+		return Task{}, false, fmt.Errorf("query task by id=%d: %w", id, err)
+	}
+	if len(tasks) == 0 {
+		return Task{}, false, nil
+	}
+	return tasks[0], true, nil
+}
+
+// selectTasks loads the tasks of the workspace of ctx with their latest
+// history entry, filtered by the AND-ed clauses. $1 is the workspace, so
+// clause placeholders start at $2.
+func (ps *PostgresStore) selectTasks(ctx context.Context, statement string, clauses []string, args []any) ([]Task, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
+	defer cancel()
+
+	tasks := make([]Task, 0)
+	err := ps.eachTask(ctx, statement, clauses, args, func(task Task) error {
+		tasks = append(tasks, task)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return tasks, nil
+}
 
+// eachTask runs the selectTasks query and calls fn for each row as it is
+// read, so callers need not hold every task in memory.
+func (ps *PostgresStore) eachTask(ctx context.Context, statement string, clauses []string, args []any, fn func(Task) error) error {
 	query := `
 		SELECT
 			t.id,
+			t.workspace_id,
 			t.title,
 			t.status,
 			t.user_id,
@@ -152,191 +346,203 @@ func (ps *PostgresStore) GetTasks(status, userID string) ([]Task, error) {
 			h.changed_by,
 			h.field,
 			h.from_value,
-			h.to_value
+			h.to_value,
+			h.batch_id
 		FROM tasks t
 		LEFT JOIN LATERAL (
-			SELECT id, changed_at, changed_by, field, from_value, to_value
+			SELECT id, changed_at, changed_by, field, from_value, to_value, batch_id
 			FROM task_history
 			WHERE task_id = t.id
 			ORDER BY changed_at DESC, id DESC
 			LIMIT 1
 		) h ON true
+		WHERE (t.workspace_id = $1 OR $1 = '*')
 	`
-	if len(clauses) > 0 {
-		query += " WHERE " + strings.Join(clauses, " AND ")
+	for _, clause := range clauses {
+		query += " AND " + clause
 	}
 	query += " ORDER BY t.id"
 
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+	return ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, statement, query, append([]any{workspaceID}, args...), func(rows *sql.Rows) error {
+			var (
+				task      Task
+				changeID  sql.NullInt64
+				changedAt sql.NullTime
+				changedBy sql.NullString
+				field     sql.NullString
+				fromValue sql.NullString
+				toValue   sql.NullString
+				batchID   sql.NullString
+			)
+			if err := rows.Scan(
+				&task.ID,
+				&task.WorkspaceID,
+				&task.Title,
+				&task.Status,
+				&task.UserID,
+				&changeID,
+				&changedAt,
+				&changedBy,
+				&field,
+				&fromValue,
+				&toValue,
+				&batchID,
+			); err != nil {
+				return fmt.Errorf("scan tasks row: %w", err)
+			}
+			if changeID.Valid {
+				entry := TaskHistoryItem{
+					ID:          int(changeID.Int64),
+					WorkspaceID: task.WorkspaceID,
+					TaskID:      task.ID,
+					ChangedAt:   changedAt.Time,
+					ChangedBy:   changedBy.String,
+					Field:       field.String,
+					ToValue:     toValue.String,
+					BatchID:     batchID.String,
+				}
+				if fromValue.Valid {
+					from := fromValue.String
+					entry.FromValue = &from
+				}
+				task.LastChange = &entry
+			}
+			return fn(task)
+		})
+	})
+}
+
+func (ps *PostgresStore) GetTaskHistory(ctx context.Context, taskID int) ([]TaskHistoryItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
 	defer cancel()
 
-	rows, err := ps.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		ps.logger.Printf("error querying tasks: %v", err)
-		return nil, fmt.Errorf("query tasks: %w", err)
-	}
-	defer rows.Close()
+	history := make([]TaskHistoryItem, 0)
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		var exists bool
+		if err := ps.queryRow(ctx, tx, "tasks.exists", `
+			SELECT EXISTS(SELECT 1 FROM tasks WHERE (workspace_id = $1 OR $1 = '*') AND id = $2)
+		`, []any{workspaceID, taskID}, &exists); err != nil {
+			return fmt.Errorf("check task existence: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("%w: %d", ErrTaskNotFound, taskID)
+		}
 
-	tasks := make([]Task, 0)
-	for rows.Next() {
-		var (
-			task      Task
-			changeID  sql.NullInt64
-			changedAt sql.NullTime
-			changedBy sql.NullString
-			field     sql.NullString
-			fromValue sql.NullString
-			toValue   sql.NullString
-		)
-		if err := rows.Scan(
-			&task.ID,
-			&task.Title,
-			&task.Status,
-			&task.UserID,
-			&changeID,
-			&changedAt,
-			&changedBy,
-			&field,
-			&fromValue,
-			&toValue,
-		); err != nil {
-			ps.logger.Printf("error scanning task row: %v", err)
-			return nil, fmt.Errorf("scan tasks row: %w", err)
-		}
-		if changeID.Valid {
-			entry := TaskHistoryItem{
-				ID:        int(changeID.Int64),
-				TaskID:    task.ID,
-				ChangedAt: changedAt.Time,
-				ChangedBy: changedBy.String,
-				Field:     field.String,
-				ToValue:   toValue.String,
-			}
-			if fromValue.Valid {
-				from := fromValue.String
-				entry.FromValue = &from
+		if err := ps.queryRows(ctx, tx, "task_history.select_by_task", `
+			SELECT id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value, batch_id
+			FROM task_history
+			WHERE (workspace_id = $1 OR $1 = '*') AND task_id = $2
+			ORDER BY changed_at DESC, id DESC
+		`, []any{workspaceID, taskID}, func(rows *sql.Rows) error {
+			entry, err := scanTaskHistoryItem(rows)
+			if err != nil {
+				return err
 			}
-			task.LastChange = &entry
+			history = append(history, entry)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("query task history: %w", err)
 		}
-		tasks = append(tasks, task)
-	}
-	if err := rows.Err(); err != nil {
-		ps.logger.Printf("error iterating task rows: %v", err)
-		return nil, fmt.Errorf("iterate tasks rows: %w", err)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return tasks, nil
+	return history, nil
 }
 
-func (ps *PostgresStore) GetTaskHistory(taskID int) ([]TaskHistoryItem, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+func (ps *PostgresStore) GetStats(ctx context.Context) (StatsResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
 	defer cancel()
 
-	var exists bool
-	if err := ps.db.QueryRowContext(ctx, `
-		SELECT EXISTS(SELECT 1 FROM tasks WHERE id = $1)
-	`, taskID).Scan(&exists); err != nil {
-		return nil, fmt.Errorf("check task existence: %w", err)
-	}
-	if !exists {
-		return nil, fmt.Errorf("%w: %d", ErrTaskNotFound, taskID)
-	}
-
-	rows, err := ps.db.QueryContext(ctx, `
-		SELECT id, task_id, changed_at, changed_by, field, from_value, to_value
-		FROM task_history
-		WHERE task_id = $1
-		ORDER BY changed_at DESC, id DESC
-	`, taskID)
-	if err != nil {
-		return nil, fmt.Errorf("query task history: %w", err)
-	}
-	defer rows.Close()
-
-	history := make([]TaskHistoryItem, 0)
-	for rows.Next() {
-		var (
-			entry     TaskHistoryItem
-			fromValue sql.NullString
-		)
-		if err := rows.Scan(
-			&entry.ID,
-			&entry.TaskID,
-			&entry.ChangedAt,
-			&entry.ChangedBy,
-			&entry.Field,
-			&fromValue,
-			&entry.ToValue,
-		); err != nil {
-			return nil, fmt.Errorf("scan task history row: %w", err)
+	var stats StatsResponse
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		if err := ps.queryRow(ctx, tx, "users.count", `
+			SELECT COUNT(*)
+			FROM users
+			WHERE workspace_id = $1 OR $1 = '*'
+		`, []any{workspaceID}, &stats.Users.Total); err != nil {
+			return fmt.Errorf("query user stats: %w", err)
 		}
-		if fromValue.Valid {
-			from := fromValue.String
-			entry.FromValue = &from
+
+		if err := ps.queryRow(ctx, tx, "tasks.count_by_status", `
+			SELECT
+				COUNT(*) AS total,
+				COUNT(*) FILTER (WHERE status = 'pending') AS pending,
+				COUNT(*) FILTER (WHERE status = 'in-progress') AS in_progress,
+				COUNT(*) FILTER (WHERE status = 'completed') AS completed
+			FROM tasks
+			WHERE workspace_id = $1 OR $1 = '*'
+		`, []any{workspaceID}, &stats.Tasks.Total, &stats.Tasks.Pending, &stats.Tasks.InProgress, &stats.Tasks.Completed); err != nil {
+			return fmt.Errorf("query task stats: %w", err)
 		}
-		history = append(history, entry)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("iterate task history rows: %w", err)
+		return nil
+	})
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying stats", "error", err)
+		return StatsResponse{}, err
 	}
 
-	return history, nil
+	return stats, nil
 }
 
-func (ps *PostgresStore) GetStats() (StatsResponse, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+func (ps *PostgresStore) CreateUser(ctx context.Context, name, email, role string) (User, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
 	defer cancel()
 
-	var stats StatsResponse
+	tx, workspaceID, err := ps.beginWorkspaceTx(ctx, false)
+	if err != nil {
+		return User{}, fmt.Errorf("begin create user transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
 
-	if err := ps.db.QueryRowContext(ctx, `
-		SELECT COUNT(*)
-		FROM users
-	`).Scan(&stats.Users.Total); err != nil {
-		ps.logger.Printf("error querying user stats: %v", err)
-		return StatsResponse{}, fmt.Errorf("query user stats: %w", err)
+	user, err := ps.createUserTx(ctx, tx, workspaceID, name, email, role)
+	if err != nil {
+		return User{}, err
 	}
 
-	if err := ps.db.QueryRowContext(ctx, `
-		SELECT
-			COUNT(*) AS total,
-			COUNT(*) FILTER (WHERE status = 'pending') AS pending,
-			COUNT(*) FILTER (WHERE status = 'in-progress') AS in_progress,
-			COUNT(*) FILTER (WHERE status = 'completed') AS completed
-		FROM tasks
-	`).Scan(&stats.Tasks.Total, &stats.Tasks.Pending, &stats.Tasks.InProgress, &stats.Tasks.Completed); err != nil {
-		ps.logger.Printf("error querying task stats: %v", err)
-		return StatsResponse{}, fmt.Errorf("query task stats: %w", err)
+	event := userEvent(user)
+	if err := ps.notifyChange(ctx, tx, event); err != nil {
+		return User{}, err
 	}
 
-	return stats, nil
-}
+	if err := ps.commit(ctx, tx); err != nil {
+		return User{}, fmt.Errorf("commit create user transaction: %w", err)
+	}
+	committed = true
+	ps.publishLocally(event)
 
-func (ps *PostgresStore) CreateUser(name, email, role string) (User, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
-	defer cancel()
+	return user, nil
+}
 
+func (ps *PostgresStore) createUserTx(ctx context.Context, tx *sql.Tx, workspaceID, name, email, role string) (User, error) {
 	var user User
-	if err := ps.db.QueryRowContext(ctx, `
-		INSERT INTO users (name, email, role)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, email, role
-	`, name, email, role).Scan(&user.ID, &user.Name, &user.Email, &user.Role); err != nil {
+	if err := ps.queryRow(ctx, tx, "users.insert", `
+		INSERT INTO users (workspace_id, name, email, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, workspace_id, name, email, role
+	`, []any{workspaceID, name, email, role}, &user.ID, &user.WorkspaceID, &user.Name, &user.Email, &user.Role); err != nil {
 		return User{}, fmt.Errorf("insert user: %w", err)
 	}
-
 	return user, nil
 }
 
-func (ps *PostgresStore) CreateTask(title, status string, userID int, actor string) (Task, error) {
+func (ps *PostgresStore) CreateTask(ctx context.Context, title, status string, userID int, actor string) (Task, error) {
 	if !isValidTaskStatus(status) {
 		return Task{}, fmt.Errorf("%w: %q", ErrInvalidTaskStatus, status)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
 	defer cancel()
 
-	tx, err := ps.db.BeginTx(ctx, nil)
+	tx, workspaceID, err := ps.beginWorkspaceTx(ctx, false)
 	if err != nil {
 		return Task{}, fmt.Errorf("begin create task transaction: %w", err)
 	}
@@ -347,57 +553,72 @@ func (ps *PostgresStore) CreateTask(title, status string, userID int, actor stri
 		}
 	}()
 
+	task, err := ps.createTaskTx(ctx, tx, workspaceID, TaskCreate{Title: title, Status: status, UserID: userID}, actor, "")
+	if err != nil {
+		return Task{}, err
+	}
+
+	event := taskEvent(EventTaskCreated, task)
+	if err := ps.notifyChange(ctx, tx, event); err != nil {
+		return Task{}, err
+	}
+
+	if err := ps.commit(ctx, tx); err != nil {
+		return Task{}, fmt.Errorf("commit create task transaction: %w", err)
+	}
+	committed = true
+	ps.publishLocally(event)
+
+	return task, nil
+}
+
+// createTaskTx inserts a task and its initial history entry inside tx.
+func (ps *PostgresStore) createTaskTx(ctx context.Context, tx *sql.Tx, workspaceID string, create TaskCreate, actor, batchID string) (Task, error) {
 	var userExists bool
-	if err := tx.QueryRowContext(ctx, `
-		SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)
-	`, userID).Scan(&userExists); err != nil {
+	if err := ps.queryRow(ctx, tx, "users.exists", `
+		SELECT EXISTS(SELECT 1 FROM users WHERE workspace_id = $1 AND id = $2)
+	`, []any{workspaceID, create.UserID}, &userExists); err != nil {
 		return Task{}, fmt.Errorf("check user existence: %w", err)
 	}
 	if !userExists {
-		return Task{}, fmt.Errorf("%w: %d", ErrUserDoesNotExist, userID)
+		return Task{}, fmt.Errorf("%w: %d", ErrUserDoesNotExist, create.UserID)
 	}
 
 	var task Task
-	if err := tx.QueryRowContext(ctx, `
-		INSERT INTO tasks (title, status, user_id)
-		VALUES ($1, $2, $3)
-		RETURNING id, title, status, user_id
-	`, title, status, userID).Scan(&task.ID, &task.Title, &task.Status, &task.UserID); err != nil {
+	if err := ps.queryRow(ctx, tx, "tasks.insert", `
+		INSERT INTO tasks (workspace_id, title, status, user_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, workspace_id, title, status, user_id
+	`, []any{workspaceID, create.Title, create.Status, create.UserID}, &task.ID, &task.WorkspaceID, &task.Title, &task.Status, &task.UserID); err != nil {
 		return Task{}, fmt.Errorf("insert task: %w", err)
 	}
 
-	changedAt := time.Now().UTC()
-	if _, err := tx.ExecContext(ctx, `
-		INSERT INTO task_history (task_id, changed_at, changed_by, field, from_value, to_value)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, task.ID, changedAt, normalizeActor(actor), "status", nil, status); err != nil {
-		return Task{}, fmt.Errorf("insert task history: %w", err)
-	}
-	task.LastChange = &TaskHistoryItem{
-		TaskID:    task.ID,
-		ChangedAt: changedAt,
-		ChangedBy: normalizeActor(actor),
-		Field:     "status",
-		ToValue:   status,
-	}
-
-	if err := tx.Commit(); err != nil {
-		return Task{}, fmt.Errorf("commit create task transaction: %w", err)
+	change, err := ps.insertTaskHistory(ctx, tx, TaskHistoryItem{
+		WorkspaceID: workspaceID,
+		TaskID:      task.ID,
+		ChangedAt:   time.Now().UTC(),
+		ChangedBy:   normalizeActor(actor),
+		Field:       "status",
+		ToValue:     create.Status,
+		BatchID:     batchID,
+	})
+	if err != nil {
+		return Task{}, err
 	}
-	committed = true
+	task.LastChange = &change
 
 	return task, nil
 }
 
-func (ps *PostgresStore) UpdateTask(id int, update TaskUpdate, actor string) (Task, error) {
+func (ps *PostgresStore) UpdateTask(ctx context.Context, id int, update TaskUpdate, actor string) (Task, error) {
 	if update.Status != nil && !isValidTaskStatus(*update.Status) {
 		return Task{}, fmt.Errorf("%w: %q", ErrInvalidTaskStatus, *update.Status)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
 	defer cancel()
 
-	tx, err := ps.db.BeginTx(ctx, nil)
+	tx, workspaceID, err := ps.beginWorkspaceTx(ctx, false)
 	if err != nil {
 		return Task{}, fmt.Errorf("begin update task transaction: %w", err)
 	}
@@ -408,28 +629,57 @@ func (ps *PostgresStore) UpdateTask(id int, update TaskUpdate, actor string) (Ta
 		}
 	}()
 
+	task, changed, err := ps.updateTaskTx(ctx, tx, workspaceID, id, update, actor, "")
+	if err != nil {
+		return Task{}, err
+	}
+
+	var event ChangeEvent
+	if changed {
+		event = taskEvent(EventTaskUpdated, task)
+		if err := ps.notifyChange(ctx, tx, event); err != nil {
+			return Task{}, err
+		}
+	}
+
+	if err := ps.commit(ctx, tx); err != nil {
+		return Task{}, fmt.Errorf("commit update task transaction: %w", err)
+	}
+	committed = true
+	if changed {
+		ps.publishLocally(event)
+	}
+
+	return task, nil
+}
+
+// updateTaskTx applies update inside tx and reports whether any field changed.
+func (ps *PostgresStore) updateTaskTx(ctx context.Context, tx *sql.Tx, workspaceID string, id int, update TaskUpdate, actor, batchID string) (Task, bool, error) {
 	var current Task
-	if err := tx.QueryRowContext(ctx, `
-		SELECT id, title, status, user_id
+	if err := ps.queryRow(ctx, tx, "tasks.lock_for_update", `
+		SELECT id, workspace_id, title, status, user_id
 		FROM tasks
-		WHERE id = $1
+		WHERE workspace_id = $1 AND id = $2
 		FOR UPDATE
-	`, id).Scan(&current.ID, &current.Title, &current.Status, &current.UserID); err != nil {
+	`, []any{workspaceID, id}, &current.ID, &current.WorkspaceID, &current.Title, &current.Status, &current.UserID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return Task{}, fmt.Errorf("%w: %d", ErrTaskNotFound, id)
+			return Task{}, false, fmt.Errorf("%w: %d", ErrTaskNotFound, id)
 		}
-		return Task{}, fmt.Errorf("load task for update: %w", err)
+		return Task{}, false, fmt.Errorf("load task for update: %w", err)
+	}
+	if err := update.Expect.check(current); err != nil {
+		return Task{}, false, err
 	}
 
 	if update.UserID != nil {
 		var userExists bool
-		if err := tx.QueryRowContext(ctx, `
-			SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)
-		`, *update.UserID).Scan(&userExists); err != nil {
-			return Task{}, fmt.Errorf("check user existence: %w", err)
+		if err := ps.queryRow(ctx, tx, "users.exists", `
+			SELECT EXISTS(SELECT 1 FROM users WHERE workspace_id = $1 AND id = $2)
+		`, []any{workspaceID, *update.UserID}, &userExists); err != nil {
+			return Task{}, false, fmt.Errorf("check user existence: %w", err)
 		}
 		if !userExists {
-			return Task{}, fmt.Errorf("%w: %d", ErrUserDoesNotExist, *update.UserID)
+			return Task{}, false, fmt.Errorf("%w: %d", ErrUserDoesNotExist, *update.UserID)
 		}
 	}
 
@@ -440,167 +690,222 @@ func (ps *PostgresStore) UpdateTask(id int, update TaskUpdate, actor string) (Ta
 	if update.Title != nil {
 		if current.Title != *update.Title {
 			from := current.Title
-			if _, err := tx.ExecContext(ctx, `
-				INSERT INTO task_history (task_id, changed_at, changed_by, field, from_value, to_value)
-				VALUES ($1, $2, $3, $4, $5, $6)
-			`, id, now, actorName, "title", from, *update.Title); err != nil {
-				return Task{}, fmt.Errorf("insert task history: %w", err)
-			}
-			fromValue := from
-			latestChange = &TaskHistoryItem{
-				TaskID:    id,
-				ChangedAt: now,
-				ChangedBy: actorName,
-				Field:     "title",
-				FromValue: &fromValue,
-				ToValue:   *update.Title,
+			change, err := ps.insertTaskHistory(ctx, tx, TaskHistoryItem{
+				WorkspaceID: workspaceID,
+				TaskID:      id,
+				ChangedAt:   now,
+				ChangedBy:   actorName,
+				Field:       "title",
+				FromValue:   &from,
+				ToValue:     *update.Title,
+				BatchID:     batchID,
+			})
+			if err != nil {
+				return Task{}, false, err
 			}
+			latestChange = &change
 		}
 		current.Title = *update.Title
 	}
 	if update.Status != nil {
 		if current.Status != *update.Status {
 			from := current.Status
-			if _, err := tx.ExecContext(ctx, `
-				INSERT INTO task_history (task_id, changed_at, changed_by, field, from_value, to_value)
-				VALUES ($1, $2, $3, $4, $5, $6)
-			`, id, now, actorName, "status", from, *update.Status); err != nil {
-				return Task{}, fmt.Errorf("insert task history: %w", err)
-			}
-			fromValue := from
-			latestChange = &TaskHistoryItem{
-				TaskID:    id,
-				ChangedAt: now,
-				ChangedBy: actorName,
-				Field:     "status",
-				FromValue: &fromValue,
-				ToValue:   *update.Status,
+			change, err := ps.insertTaskHistory(ctx, tx, TaskHistoryItem{
+				WorkspaceID: workspaceID,
+				TaskID:      id,
+				ChangedAt:   now,
+				ChangedBy:   actorName,
+				Field:       "status",
+				FromValue:   &from,
+				ToValue:     *update.Status,
+				BatchID:     batchID,
+			})
+			if err != nil {
+				return Task{}, false, err
 			}
+			latestChange = &change
 		}
 		current.Status = *update.Status
 	}
 	if update.UserID != nil {
 		if current.UserID != *update.UserID {
 			from := strconv.Itoa(current.UserID)
-			to := strconv.Itoa(*update.UserID)
-			if _, err := tx.ExecContext(ctx, `
-				INSERT INTO task_history (task_id, changed_at, changed_by, field, from_value, to_value)
-				VALUES ($1, $2, $3, $4, $5, $6)
-			`, id, now, actorName, "userId", from, to); err != nil {
-				return Task{}, fmt.Errorf("insert task history: %w", err)
-			}
-			fromValue := from
-			latestChange = &TaskHistoryItem{
-				TaskID:    id,
-				ChangedAt: now,
-				ChangedBy: actorName,
-				Field:     "userId",
-				FromValue: &fromValue,
-				ToValue:   to,
+			change, err := ps.insertTaskHistory(ctx, tx, TaskHistoryItem{
+				WorkspaceID: workspaceID,
+				TaskID:      id,
+				ChangedAt:   now,
+				ChangedBy:   actorName,
+				Field:       "userId",
+				FromValue:   &from,
+				ToValue:     strconv.Itoa(*update.UserID),
+				BatchID:     batchID,
+			})
+			if err != nil {
+				return Task{}, false, err
 			}
+			latestChange = &change
 		}
 		current.UserID = *update.UserID
 	}
 
-	if _, err := tx.ExecContext(ctx, `
+	if _, err := ps.exec(ctx, tx, "tasks.update", `
 		UPDATE tasks
 		SET title = $1, status = $2, user_id = $3
-		WHERE id = $4
-	`, current.Title, current.Status, current.UserID, id); err != nil {
-		return Task{}, fmt.Errorf("update task row: %w", err)
+		WHERE workspace_id = $4 AND id = $5
+	`, current.Title, current.Status, current.UserID, workspaceID, id); err != nil {
+		return Task{}, false, fmt.Errorf("update task row: %w", err)
 	}
 
-	if err := tx.Commit(); err != nil {
-		return Task{}, fmt.Errorf("commit update task transaction: %w", err)
+	if latestChange != nil {
+		current.LastChange = latestChange
+		return current, true, nil
 	}
-	committed = true
-	if latestChange == nil {
-		var (
-			entry     TaskHistoryItem
-			fromValue sql.NullString
-		)
-		err := ps.db.QueryRowContext(ctx, `
-			SELECT id, task_id, changed_at, changed_by, field, from_value, to_value
-			FROM task_history
-			WHERE task_id = $1
-			ORDER BY changed_at DESC, id DESC
-			LIMIT 1
-		`, id).Scan(
-			&entry.ID,
-			&entry.TaskID,
-			&entry.ChangedAt,
-			&entry.ChangedBy,
-			&entry.Field,
-			&fromValue,
-			&entry.ToValue,
-		)
-		if err == nil {
-			if fromValue.Valid {
-				from := fromValue.String
-				entry.FromValue = &from
-			}
-			latestChange = &entry
+
+	var (
+		entry     TaskHistoryItem
+		fromValue sql.NullString
+		batch     sql.NullString
+	)
+	err := ps.queryRow(ctx, tx, "task_history.select_latest", `
+		SELECT id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value, batch_id
+		FROM task_history
+		WHERE workspace_id = $1 AND task_id = $2
+		ORDER BY changed_at DESC, id DESC
+		LIMIT 1
+	`, []any{workspaceID, id},
+		&entry.ID,
+		&entry.WorkspaceID,
+		&entry.TaskID,
+		&entry.ChangedAt,
+		&entry.ChangedBy,
+		&entry.Field,
+		&fromValue,
+		&entry.ToValue,
+		&batch,
+	)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return Task{}, false, fmt.Errorf("load latest task change: %w", err)
+	}
+	if err == nil {
+		if fromValue.Valid {
+			from := fromValue.String
+			entry.FromValue = &from
 		}
+		entry.BatchID = batch.String
+		current.LastChange = &entry
 	}
-	current.LastChange = latestChange
 
-	return current, nil
+	return current, false, nil
 }
 
-func (ps *PostgresStore) initSchema() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+// ApplyTaskBatch runs batch in one transaction. Atomic batches roll back on
+// the first failure; otherwise each write runs under a savepoint so a failed
+// write is undone on its own and the rest still commit.
+func (ps *PostgresStore) ApplyTaskBatch(ctx context.Context, batch TaskBatch) ([]TaskWriteResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.BatchTimeout)
 	defer cancel()
 
-	statements := []string{
-		`
-		CREATE TABLE IF NOT EXISTS users (
-			id BIGSERIAL PRIMARY KEY,
-			name TEXT NOT NULL,
-			email TEXT NOT NULL,
-			role TEXT NOT NULL
-		);
-		`,
-		`
-		CREATE TABLE IF NOT EXISTS tasks (
-			id BIGSERIAL PRIMARY KEY,
-			title TEXT NOT NULL,
-			status TEXT NOT NULL CHECK (status IN ('pending', 'in-progress', 'completed')),
-			user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE RESTRICT
-		);
-		`,
-		`
-		CREATE TABLE IF NOT EXISTS task_history (
-			id BIGSERIAL PRIMARY KEY,
-			task_id BIGINT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
-			changed_at TIMESTAMPTZ NOT NULL,
-			changed_by TEXT NOT NULL,
-			field TEXT NOT NULL CHECK (field IN ('title', 'status', 'userId')),
-			from_value TEXT,
-			to_value TEXT NOT NULL
-		);
-		`,
-		`CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);`,
-		`CREATE INDEX IF NOT EXISTS idx_tasks_user_id ON tasks(user_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_task_history_task_id ON task_history(task_id);`,
-		`CREATE INDEX IF NOT EXISTS idx_task_history_changed_at ON task_history(changed_at DESC);`,
-	}
-
-	for _, statement := range statements {
-		if _, err := ps.db.ExecContext(ctx, statement); err != nil {
-			return err
+	tx, workspaceID, err := ps.beginWorkspaceTx(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("begin task batch transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	results := make([]TaskWriteResult, len(batch.Writes))
+	var events []ChangeEvent
+	for i, write := range batch.Writes {
+		if !batch.Atomic {
+			if _, err := ps.exec(ctx, tx, "task_batch.savepoint", `SAVEPOINT task_write`); err != nil {
+				return nil, fmt.Errorf("create savepoint: %w", err)
+			}
+		}
+
+		task, event, err := ps.applyTaskWriteTx(ctx, tx, workspaceID, write, batch)
+		if err != nil {
+			if batch.Atomic {
+				return abortedBatchResults(len(batch.Writes), i, err), nil
+			}
+			if _, rollbackErr := ps.exec(ctx, tx, "task_batch.rollback_savepoint", `ROLLBACK TO SAVEPOINT task_write`); rollbackErr != nil {
+				return nil, fmt.Errorf("roll back to savepoint: %w", rollbackErr)
+			}
+			results[i] = TaskWriteResult{Err: err}
+			continue
+		}
+		if !batch.Atomic {
+			if _, err := ps.exec(ctx, tx, "task_batch.release_savepoint", `RELEASE SAVEPOINT task_write`); err != nil {
+				return nil, fmt.Errorf("release savepoint: %w", err)
+			}
+		}
+		results[i] = TaskWriteResult{Task: task}
+		if event != nil {
+			events = append(events, *event)
+		}
+	}
+
+	if err := ps.commit(ctx, tx); err != nil {
+		return nil, fmt.Errorf("commit task batch transaction: %w", err)
+	}
+	committed = true
+	for _, event := range events {
+		ps.publishLocally(event)
+	}
+
+	return results, nil
+}
+
+// applyTaskWriteTx applies one batch write inside tx and notifies listeners
+// of the change. The returned event is nil when an update changed nothing.
+func (ps *PostgresStore) applyTaskWriteTx(ctx context.Context, tx *sql.Tx, workspaceID string, write TaskWrite, batch TaskBatch) (Task, *ChangeEvent, error) {
+	if err := write.checkStatus(); err != nil {
+		return Task{}, nil, err
+	}
+
+	var (
+		task      Task
+		eventType = EventTaskCreated
+		err       error
+	)
+	if write.Create != nil {
+		task, err = ps.createTaskTx(ctx, tx, workspaceID, *write.Create, batch.Actor, batch.ID)
+	} else {
+		var changed bool
+		task, changed, err = ps.updateTaskTx(ctx, tx, workspaceID, write.TaskID, write.Update, batch.Actor, batch.ID)
+		if err == nil && !changed {
+			return task, nil, nil
 		}
+		eventType = EventTaskUpdated
+	}
+	if err != nil {
+		return Task{}, nil, err
 	}
 
-	return nil
+	event := taskEvent(eventType, task)
+	if err := ps.notifyChange(ctx, tx, event); err != nil {
+		return Task{}, nil, err
+	}
+	return task, &event, nil
 }
 
-func (ps *PostgresStore) seedInitialData() error {
-	ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+// Import creates every user and task of batch in one transaction. Tasks
+// referencing a user by email see the users created earlier in the batch.
+func (ps *PostgresStore) Import(ctx context.Context, batch ImportBatch) (ImportResult, error) {
+	for i, row := range batch.Tasks {
+		if !isValidTaskStatus(row.Status) {
+			return ImportResult{}, fmt.Errorf("tasks[%d]: %w: %q", i, ErrInvalidTaskStatus, row.Status)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.ImportTimeout)
 	defer cancel()
 
-	tx, err := ps.db.BeginTx(ctx, nil)
+	tx, workspaceID, err := ps.beginWorkspaceTx(ctx, false)
 	if err != nil {
-		return err
+		return ImportResult{}, fmt.Errorf("begin import transaction: %w", err)
 	}
 	committed := false
 	defer func() {
@@ -609,84 +914,324 @@ func (ps *PostgresStore) seedInitialData() error {
 		}
 	}()
 
-	var userCount int
-	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`).Scan(&userCount); err != nil {
-		return err
+	result := ImportResult{Users: make([]User, 0, len(batch.Users)), Tasks: make([]Task, 0, len(batch.Tasks))}
+	events := make([]ChangeEvent, 0, len(batch.Users)+len(batch.Tasks))
+	for i, row := range batch.Users {
+		user, err := ps.createUserTx(ctx, tx, workspaceID, row.Name, row.Email, row.Role)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("users[%d]: %w", i, err)
+		}
+		result.Users = append(result.Users, user)
+		events = append(events, userEvent(user))
 	}
-
-	if userCount == 0 {
-		for _, user := range initialUsers {
-			if _, err := tx.ExecContext(ctx, `
-				INSERT INTO users (id, name, email, role)
-				VALUES ($1, $2, $3, $4)
-			`, user.ID, user.Name, user.Email, user.Role); err != nil {
-				return err
+	for i, row := range batch.Tasks {
+		create := TaskCreate{Title: row.Title, Status: row.Status, UserID: row.UserID}
+		if row.UserEmail != "" {
+			err := ps.queryRow(ctx, tx, "users.select_by_email", `
+				SELECT id FROM users
+				WHERE workspace_id = $1 AND lower(email) = lower($2)
+				ORDER BY id
+				LIMIT 1
+			`, []any{workspaceID, row.UserEmail}, &create.UserID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return ImportResult{}, fmt.Errorf("tasks[%d]: %w: %s", i, ErrUserDoesNotExist, row.UserEmail)
+			}
+			if err != nil {
+				return ImportResult{}, fmt.Errorf("tasks[%d]: look up user by email: %w", i, err)
 			}
 		}
+		task, err := ps.createTaskTx(ctx, tx, workspaceID, create, batch.Actor, batch.ID)
+		if err != nil {
+			return ImportResult{}, fmt.Errorf("tasks[%d]: %w", i, err)
+		}
+		result.Tasks = append(result.Tasks, task)
+		events = append(events, taskEvent(EventTaskCreated, task))
+	}
 
-		if _, err := tx.ExecContext(ctx, `
-			SELECT setval(
-				pg_get_serial_sequence('users', 'id'),
-				COALESCE((SELECT MAX(id) FROM users), 1),
-				true
-			)
-		`); err != nil {
-			return err
+	for _, event := range events {
+		if err := ps.notifyChange(ctx, tx, event); err != nil {
+			return ImportResult{}, err
 		}
 	}
+	if err := ps.commit(ctx, tx); err != nil {
+		return ImportResult{}, fmt.Errorf("commit import transaction: %w", err)
+	}
+	committed = true
+	for _, event := range events {
+		ps.publishLocally(event)
+	}
 
-	var taskCount int
-	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM tasks`).Scan(&taskCount); err != nil {
-		return err
+	return result, nil
+}
+
+// ExportTasks streams the tasks matching the GET /api/tasks filters to fn.
+// lib/pq reads rows off the connection as they are scanned, so memory use
+// does not grow with the table.
+func (ps *PostgresStore) ExportTasks(ctx context.Context, status, userID string, fn func(Task) error) error {
+	clauses, args, ok := taskFilterClauses(status, userID)
+	if !ok {
+		return nil
 	}
 
-	if taskCount == 0 {
-		for _, task := range initialTasks {
-			if _, err := tx.ExecContext(ctx, `
-				INSERT INTO tasks (id, title, status, user_id)
-				VALUES ($1, $2, $3, $4)
-			`, task.ID, task.Title, task.Status, task.UserID); err != nil {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.ExportTimeout)
+	defer cancel()
+
+	if err := ps.eachTask(ctx, "tasks.export", clauses, args, fn); err != nil {
+		return fmt.Errorf("export tasks: %w", err)
+	}
+	return nil
+}
+
+// ExportUsers streams every user of the workspace to fn.
+func (ps *PostgresStore) ExportUsers(ctx context.Context, fn func(User) error) error {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.ExportTimeout)
+	defer cancel()
+
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, "users.export", `
+			SELECT id, workspace_id, name, email, role
+			FROM users
+			WHERE workspace_id = $1 OR $1 = '*'
+			ORDER BY id
+		`, []any{workspaceID}, func(rows *sql.Rows) error {
+			var user User
+			if err := rows.Scan(&user.ID, &user.WorkspaceID, &user.Name, &user.Email, &user.Role); err != nil {
+				return fmt.Errorf("scan users row: %w", err)
+			}
+			return fn(user)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export users: %w", err)
+	}
+	return nil
+}
+
+// ExportHistory streams every history entry of the workspace to fn, oldest first.
+func (ps *PostgresStore) ExportHistory(ctx context.Context, fn func(TaskHistoryItem) error) error {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.ExportTimeout)
+	defer cancel()
+
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, "task_history.export", `
+			SELECT id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value, batch_id
+			FROM task_history
+			WHERE workspace_id = $1 OR $1 = '*'
+			ORDER BY id
+		`, []any{workspaceID}, func(rows *sql.Rows) error {
+			entry, err := scanTaskHistoryItem(rows)
+			if err != nil {
+				return err
+			}
+			return fn(entry)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export task history: %w", err)
+	}
+	return nil
+}
+
+// GetTaskHistorySince returns up to limit history entries with an ID greater
+// than afterID, oldest first.
+func (ps *PostgresStore) GetTaskHistorySince(ctx context.Context, afterID, limit int) ([]TaskHistoryItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
+	defer cancel()
+
+	history := make([]TaskHistoryItem, 0)
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, "task_history.select_since", `
+			SELECT id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value, batch_id
+			FROM task_history
+			WHERE (workspace_id = $1 OR $1 = '*') AND id > $2
+			ORDER BY id
+			LIMIT $3
+		`, []any{workspaceID, afterID, limit}, func(rows *sql.Rows) error {
+			entry, err := scanTaskHistoryItem(rows)
+			if err != nil {
 				return err
 			}
+			history = append(history, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying task history", "after_id", afterID, "error", err)
+		return nil, fmt.Errorf("query task history since id=%d: %w", afterID, err)
+	}
+
+	return history, nil
+}
+
+// GetTaskOwners returns the assignee of each task in taskIDs that exists.
+func (ps *PostgresStore) GetTaskOwners(ctx context.Context, taskIDs []int) (map[int]int, error) {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.OperationTimeout)
+	defer cancel()
+
+	owners := make(map[int]int, len(taskIDs))
+	err := ps.readInWorkspace(ctx, func(tx *sql.Tx, workspaceID string) error {
+		return ps.queryRows(ctx, tx, "tasks.select_owners", `
+			SELECT id, user_id
+			FROM tasks
+			WHERE (workspace_id = $1 OR $1 = '*') AND id = ANY($2)
+		`, []any{workspaceID, pq.Array(taskIDs)}, func(rows *sql.Rows) error {
+			var id, userID int
+			if err := rows.Scan(&id, &userID); err != nil {
+				return fmt.Errorf("scan task owner row: %w", err)
+			}
+			owners[id] = userID
+			return nil
+		})
+	})
+	if err != nil {
+		ps.logger.ErrorContext(ctx, "error querying task owners", "error", err)
+		return nil, fmt.Errorf("query task owners: %w", err)
+	}
+
+	return owners, nil
+}
+
+func scanTaskHistoryItem(rows *sql.Rows) (TaskHistoryItem, error) {
+	var (
+		entry     TaskHistoryItem
+		fromValue sql.NullString
+		batchID   sql.NullString
+	)
+	if err := rows.Scan(
+		&entry.ID,
+		&entry.WorkspaceID,
+		&entry.TaskID,
+		&entry.ChangedAt,
+		&entry.ChangedBy,
+		&entry.Field,
+		&fromValue,
+		&entry.ToValue,
+		&batchID,
+	); err != nil {
+		return TaskHistoryItem{}, fmt.Errorf("scan task history row: %w", err)
+	}
+	if fromValue.Valid {
+		from := fromValue.String
+		entry.FromValue = &from
+	}
+	entry.BatchID = batchID.String
+	return entry, nil
+}
+
+// insertTaskHistory writes a history entry inside tx and returns it with its ID set.
+func (ps *PostgresStore) insertTaskHistory(ctx context.Context, tx *sql.Tx, entry TaskHistoryItem) (TaskHistoryItem, error) {
+	if err := ps.queryRow(ctx, tx, "task_history.insert", `
+		INSERT INTO task_history (workspace_id, task_id, changed_at, changed_by, field, from_value, to_value, batch_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''))
+		RETURNING id
+	`, []any{entry.WorkspaceID, entry.TaskID, entry.ChangedAt, entry.ChangedBy, entry.Field, entry.FromValue, entry.ToValue, entry.BatchID}, &entry.ID); err != nil {
+		return TaskHistoryItem{}, fmt.Errorf("insert task history: %w", err)
+	}
+	return entry, nil
+}
+
+// Seed writes fixtures, as validated by loadFixtures, with their IDs in one
+// transaction. In SeedIfEmpty mode a table that already has rows is skipped;
+// in SeedUpsert mode rows with a fixture's ID are overwritten.
+func (ps *PostgresStore) Seed(ctx context.Context, fixtures Fixtures, mode SeedMode) error {
+	ctx, cancel := context.WithTimeout(ctx, ps.cfg.ImportTimeout)
+	defer cancel()
+
+	tx, err := ps.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin seed transaction: %w", err)
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = tx.Rollback()
 		}
+	}()
+
+	// Fixtures may span workspaces.
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.workspace_id', '*', true)`); err != nil {
+		return fmt.Errorf("scope seed transaction: %w", err)
+	}
 
+	seedTable := func(table string, rows int, insert func(i int) error) error {
+		if rows == 0 {
+			return nil
+		}
+		if mode == SeedIfEmpty {
+			var count int
+			if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table).Scan(&count); err != nil {
+				return fmt.Errorf("count %s: %w", table, err)
+			}
+			if count > 0 {
+				return nil
+			}
+		}
+		for i := 0; i < rows; i++ {
+			if err := insert(i); err != nil {
+				return fmt.Errorf("seed %s: %w", table, err)
+			}
+		}
+		// Rows created later must not reuse fixture IDs.
 		if _, err := tx.ExecContext(ctx, `
-			SELECT setval(
-				pg_get_serial_sequence('tasks', 'id'),
-				COALESCE((SELECT MAX(id) FROM tasks), 1),
-				true
-			)
-		`); err != nil {
-			return err
+			SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE((SELECT MAX(id) FROM `+table+`), 1), true)
+		`, table); err != nil {
+			return fmt.Errorf("advance %s sequence: %w", table, err)
 		}
+		return nil
 	}
 
-	var historyCount int
-	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM task_history`).Scan(&historyCount); err != nil {
+	if err := seedTable("users", len(fixtures.Users), func(i int) error {
+		user := fixtures.Users[i]
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO users (id, workspace_id, name, email, role)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (id) DO UPDATE SET
+				workspace_id = EXCLUDED.workspace_id, name = EXCLUDED.name, email = EXCLUDED.email, role = EXCLUDED.role
+		`, user.ID, user.WorkspaceID, user.Name, user.Email, user.Role)
+		return err
+	}); err != nil {
 		return err
 	}
-	if historyCount == 0 {
-		if _, err := tx.ExecContext(ctx, `
-			INSERT INTO task_history (task_id, changed_at, changed_by, field, from_value, to_value)
-			SELECT id, NOW(), $1, 'status', NULL, status
-			FROM tasks
-		`, defaultActorName); err != nil {
-			return err
-		}
+
+	if err := seedTable("tasks", len(fixtures.Tasks), func(i int) error {
+		task := fixtures.Tasks[i]
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tasks (id, workspace_id, title, status, user_id)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (id) DO UPDATE SET
+				workspace_id = EXCLUDED.workspace_id, title = EXCLUDED.title, status = EXCLUDED.status, user_id = EXCLUDED.user_id
+		`, task.ID, task.WorkspaceID, task.Title, task.Status, task.UserID)
+		return err
+	}); err != nil {
+		return err
 	}
 
-	if err := tx.Commit(); err != nil {
+	if err := seedTable("task_history", len(fixtures.History), func(i int) error {
+		entry := fixtures.History[i]
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO task_history (id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value, batch_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+			ON CONFLICT (id) DO UPDATE SET
+				workspace_id = EXCLUDED.workspace_id, task_id = EXCLUDED.task_id, changed_at = EXCLUDED.changed_at,
+				changed_by = EXCLUDED.changed_by, field = EXCLUDED.field, from_value = EXCLUDED.from_value,
+				to_value = EXCLUDED.to_value, batch_id = EXCLUDED.batch_id
+		`, entry.ID, entry.WorkspaceID, entry.TaskID, entry.ChangedAt, entry.ChangedBy, entry.Field, entry.FromValue, entry.ToValue, entry.BatchID)
+		return err
+	}); err != nil {
 		return err
 	}
-	committed = true
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit seed: %w", err)
+	}
+	committed = true
 	return nil
 }
 
-func pingWithRetry(db *sql.DB) error {
+func pingWithRetry(db *sql.DB, retries int, timeout time.Duration) error {
 	var lastErr error
-	for attempt := 1; attempt <= dbPingRetries; attempt++ {
-		ctx, cancel := context.WithTimeout(context.Background(), dbOperationTimeout)
+	for attempt := 1; attempt <= retries; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		err := db.PingContext(ctx)
 		cancel()
 		if err == nil {
@@ -694,8 +1239,10 @@ func pingWithRetry(db *sql.DB) error {
 		}
 
 		lastErr = err
-		time.Sleep(1 * time.Second)
+		if attempt < retries {
+			time.Sleep(1 * time.Second)
+		}
 	}
 
-	return fmt.Errorf("ping postgres after %d retries: %w", dbPingRetries, lastErr)
+	return fmt.Errorf("ping postgres after %d retries: %w", retries, lastErr)
 }
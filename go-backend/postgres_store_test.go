@@ -1,10 +1,9 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"io"
-	"log"
 	"regexp"
 	"strings"
 	"testing"
@@ -23,7 +22,8 @@ func newMockPostgresStore(t *testing.T) (*PostgresStore, sqlmock.Sqlmock, func()
 
 	store := &PostgresStore{
 		db:     db,
-		logger: log.New(io.Discard, "", 0),
+		cfg:    defaultDatabaseConfig(),
+		logger: discardLogger(),
 	}
 
 	cleanup := func() {
@@ -41,23 +41,33 @@ func assertMockExpectations(t *testing.T, mock sqlmock.Sqlmock) {
 	}
 }
 
+// expectWorkspaceTx expects beginWorkspaceTx to open a transaction scoped to workspaceID.
+func expectWorkspaceTx(mock sqlmock.Sqlmock, workspaceID string) {
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\('app.workspace_id', \$1, true\)`).
+		WithArgs(workspaceID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
 func TestPostgresStoreCreateUser(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
 		ExpectQuery(regexp.QuoteMeta(`
-		INSERT INTO users (name, email, role)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, email, role
+		INSERT INTO users (workspace_id, name, email, role)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, workspace_id, name, email, role
 	`)).
-		WithArgs("Alice", "alice@example.com", "developer").
+		WithArgs(defaultWorkspaceID, "Alice", "alice@example.com", "developer").
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "name", "email", "role"}).
-				AddRow(4, "Alice", "alice@example.com", "developer"),
+			sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).
+				AddRow(4, defaultWorkspaceID, "Alice", "alice@example.com", "developer"),
 		)
+	mock.ExpectCommit()
 
-	user, err := store.CreateUser("Alice", "alice@example.com", "developer")
+	user, err := store.CreateUser(context.Background(), "Alice", "alice@example.com", "developer")
 	if err != nil {
 		t.Fatalf("expected create user to succeed, got %v", err)
 	}
@@ -72,16 +82,14 @@ func TestPostgresStoreCreateUserInsertError(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(regexp.QuoteMeta(`
-		INSERT INTO users (name, email, role)
-		VALUES ($1, $2, $3)
-		RETURNING id, name, email, role
-	`)).
-		WithArgs("Alice", "alice@example.com", "developer").
+		ExpectQuery(`INSERT INTO users`).
+		WithArgs(defaultWorkspaceID, "Alice", "alice@example.com", "developer").
 		WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
 
-	_, err := store.CreateUser("Alice", "alice@example.com", "developer")
+	_, err := store.CreateUser(context.Background(), "Alice", "alice@example.com", "developer")
 	if err == nil {
 		t.Fatal("expected create user to fail")
 	}
@@ -96,7 +104,7 @@ func TestPostgresStoreCreateTaskValidation(t *testing.T) {
 	store, _, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
-	_, err := store.CreateTask("Task", "not-valid", 1, "admin")
+	_, err := store.CreateTask(context.Background(), "Task", "not-valid", 1, "admin")
 	if !errors.Is(err, ErrInvalidTaskStatus) {
 		t.Fatalf("expected ErrInvalidTaskStatus, got %v", err)
 	}
@@ -106,14 +114,14 @@ func TestPostgresStoreCreateTaskUnknownUser(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
-	mock.ExpectBegin()
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE id = \$1\)`).
-		WithArgs(999).
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE workspace_id = \$1 AND id = \$2\)`).
+		WithArgs(defaultWorkspaceID, 999).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 	mock.ExpectRollback()
 
-	_, err := store.CreateTask("Task", "pending", 999, "admin")
+	_, err := store.CreateTask(context.Background(), "Task", "pending", 999, "admin")
 	if !errors.Is(err, ErrUserDoesNotExist) {
 		t.Fatalf("expected ErrUserDoesNotExist, got %v", err)
 	}
@@ -125,33 +133,36 @@ func TestPostgresStoreCreateTaskSuccess(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
-	mock.ExpectBegin()
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE id = \$1\)`).
-		WithArgs(1).
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE workspace_id = \$1 AND id = \$2\)`).
+		WithArgs(defaultWorkspaceID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 
 	mock.
 		ExpectQuery(regexp.QuoteMeta(`
-		INSERT INTO tasks (title, status, user_id)
-		VALUES ($1, $2, $3)
-		RETURNING id, title, status, user_id
+		INSERT INTO tasks (workspace_id, title, status, user_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, workspace_id, title, status, user_id
 	`)).
-		WithArgs("Task", "pending", 1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "user_id"}).AddRow(4, "Task", "pending", 1))
+		WithArgs(defaultWorkspaceID, "Task", "pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(4, defaultWorkspaceID, "Task", "pending", 1))
 	mock.
-		ExpectExec(`INSERT INTO task_history`).
-		WithArgs(4, sqlmock.AnyArg(), "admin", "status", nil, "pending").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 4, sqlmock.AnyArg(), "admin", "status", nil, "pending", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
 	mock.ExpectCommit()
 
-	task, err := store.CreateTask("Task", "pending", 1, "admin")
+	task, err := store.CreateTask(context.Background(), "Task", "pending", 1, "admin")
 	if err != nil {
 		t.Fatalf("expected create task to succeed, got %v", err)
 	}
 	if task.ID != 4 || task.UserID != 1 {
 		t.Fatalf("unexpected task response: %+v", task)
 	}
+	if task.LastChange == nil || task.LastChange.ID != 7 {
+		t.Fatalf("expected lastChange with history ID 7, got %+v", task.LastChange)
+	}
 
 	assertMockExpectations(t, mock)
 }
@@ -160,15 +171,15 @@ func TestPostgresStoreUpdateTaskNotFound(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
-	mock.ExpectBegin()
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT id, title, status, user_id`).
-		WithArgs(999).
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 999).
 		WillReturnError(sql.ErrNoRows)
 	mock.ExpectRollback()
 
 	status := "completed"
-	_, err := store.UpdateTask(999, TaskUpdate{Status: &status}, "admin")
+	_, err := store.UpdateTask(context.Background(), 999, TaskUpdate{Status: &status}, "admin")
 	if !errors.Is(err, ErrTaskNotFound) {
 		t.Fatalf("expected ErrTaskNotFound, got %v", err)
 	}
@@ -180,28 +191,28 @@ func TestPostgresStoreUpdateTaskSuccess(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
-	mock.ExpectBegin()
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT id, title, status, user_id`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "user_id"}).AddRow(1, "Old", "pending", 1))
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(1, defaultWorkspaceID, "Old", "pending", 1))
 	mock.
-		ExpectExec(`INSERT INTO task_history`).
-		WithArgs(1, sqlmock.AnyArg(), "admin", "title", "Old", "Updated").
-		WillReturnResult(sqlmock.NewResult(1, 1))
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 1, sqlmock.AnyArg(), "admin", "title", "Old", "Updated", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
 	mock.
-		ExpectExec(`INSERT INTO task_history`).
-		WithArgs(1, sqlmock.AnyArg(), "admin", "status", "pending", "completed").
-		WillReturnResult(sqlmock.NewResult(2, 1))
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 1, sqlmock.AnyArg(), "admin", "status", "pending", "completed", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
 	mock.
 		ExpectExec(`UPDATE tasks`).
-		WithArgs("Updated", "completed", 1, 1).
+		WithArgs("Updated", "completed", 1, defaultWorkspaceID, 1).
 		WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
 	title := "Updated"
 	status := "completed"
-	task, err := store.UpdateTask(1, TaskUpdate{
+	task, err := store.UpdateTask(context.Background(), 1, TaskUpdate{
 		Title:  &title,
 		Status: &status,
 	}, "admin")
@@ -217,6 +228,9 @@ func TestPostgresStoreUpdateTaskSuccess(t *testing.T) {
 	if task.LastChange.Field != "status" {
 		t.Fatalf("expected latest change field=status, got %q", task.LastChange.Field)
 	}
+	if task.LastChange.ID != 2 {
+		t.Fatalf("expected latest change ID 2, got %d", task.LastChange.ID)
+	}
 
 	assertMockExpectations(t, mock)
 }
@@ -225,15 +239,18 @@ func TestPostgresStoreGetUsers(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT id, name, email, role`).
+		ExpectQuery(`SELECT id, workspace_id, name, email, role`).
+		WithArgs(defaultWorkspaceID).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "name", "email", "role"}).
-				AddRow(1, "John Doe", "john@example.com", "developer").
-				AddRow(2, "Jane Smith", "jane@example.com", "designer"),
+			sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).
+				AddRow(1, defaultWorkspaceID, "John Doe", "john@example.com", "developer").
+				AddRow(2, defaultWorkspaceID, "Jane Smith", "jane@example.com", "designer"),
 		)
+	mock.ExpectRollback()
 
-	users, err := store.GetUsers()
+	users, err := store.GetUsers(context.Background())
 	if err != nil {
 		t.Fatalf("expected get users to succeed, got %v", err)
 	}
@@ -244,16 +261,49 @@ func TestPostgresStoreGetUsers(t *testing.T) {
 	assertMockExpectations(t, mock)
 }
 
+func TestPostgresStoreExportUsersStopsOnCallbackError(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`FROM users`).
+		WithArgs(defaultWorkspaceID).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).
+				AddRow(1, defaultWorkspaceID, "Alice", "alice@example.com", "developer").
+				AddRow(2, defaultWorkspaceID, "Bob", "bob@example.com", "manager"),
+		)
+	mock.ExpectRollback()
+
+	errStop := errors.New("client went away")
+	var seen []string
+	err := store.ExportUsers(context.Background(), func(user User) error {
+		seen = append(seen, user.Name)
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+	if len(seen) != 1 || seen[0] != "Alice" {
+		t.Fatalf("expected the export to stop after one row, got %v", seen)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
 func TestPostgresStoreGetUserByIDNotFound(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT id, name, email, role`).
-		WithArgs(123).
+		ExpectQuery(`SELECT id, workspace_id, name, email, role`).
+		WithArgs(defaultWorkspaceID, 123).
 		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
 
-	_, ok, err := store.GetUserByID(123)
+	_, ok, err := store.GetUserByID(context.Background(), 123)
 	if err != nil {
 		t.Fatalf("expected get user by ID to return not found without error, got %v", err)
 	}
@@ -264,11 +314,41 @@ func TestPostgresStoreGetUserByIDNotFound(t *testing.T) {
 	assertMockExpectations(t, mock)
 }
 
+func TestPostgresStoreGetUserByEmailIgnoresSharedEmails(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	for _, rows := range []*sqlmock.Rows{
+		sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).
+			AddRow(3, defaultWorkspaceID, "Alex", "alex@example.com", "manager"),
+		sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).
+			AddRow(3, defaultWorkspaceID, "Alex", "alex@example.com", "manager").
+			AddRow(4, defaultWorkspaceID, "Alex", "ALEX@example.com", "developer"),
+	} {
+		expectWorkspaceTx(mock, defaultWorkspaceID)
+		mock.
+			ExpectQuery(`lower\(email\) = lower\(\$2\)`).
+			WithArgs(defaultWorkspaceID, "Alex@example.com").
+			WillReturnRows(rows)
+		mock.ExpectRollback()
+	}
+
+	user, found, err := store.GetUserByEmail(context.Background(), "Alex@example.com")
+	if err != nil || !found || user.ID != 3 || user.Role != "manager" {
+		t.Fatalf("expected user 3, got %+v found=%v err=%v", user, found, err)
+	}
+	if _, found, err := store.GetUserByEmail(context.Background(), "Alex@example.com"); err != nil || found {
+		t.Fatalf("expected a shared email to find no user, got found=%v err=%v", found, err)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
 func TestPostgresStoreGetTasksInvalidUserFilter(t *testing.T) {
 	store, _, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
-	tasks, err := store.GetTasks("", "not-an-int")
+	tasks, err := store.GetTasks(context.Background(), "", "not-an-int")
 	if err != nil {
 		t.Fatalf("expected invalid userId filter to return empty result without error, got %v", err)
 	}
@@ -281,11 +361,13 @@ func TestPostgresStoreGetTasksQueryErrorReturnsError(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
 		ExpectQuery(`FROM tasks t`).
 		WillReturnError(errors.New("query failed"))
+	mock.ExpectRollback()
 
-	_, err := store.GetTasks("", "")
+	_, err := store.GetTasks(context.Background(), "", "")
 	if err == nil {
 		t.Fatal("expected query error from get tasks")
 	}
@@ -297,11 +379,14 @@ func TestPostgresStoreGetTasksIncludesLastChange(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
 		ExpectQuery(`FROM tasks t`).
+		WithArgs(defaultWorkspaceID).
 		WillReturnRows(
 			sqlmock.NewRows([]string{
 				"id",
+				"workspace_id",
 				"title",
 				"status",
 				"user_id",
@@ -311,8 +396,10 @@ func TestPostgresStoreGetTasksIncludesLastChange(t *testing.T) {
 				"field",
 				"from_value",
 				"to_value",
+				"batch_id",
 			}).AddRow(
 				1,
+				defaultWorkspaceID,
 				"Task",
 				"in-progress",
 				2,
@@ -322,10 +409,12 @@ func TestPostgresStoreGetTasksIncludesLastChange(t *testing.T) {
 				"status",
 				"pending",
 				"in-progress",
+				nil,
 			),
 		)
+	mock.ExpectRollback()
 
-	tasks, err := store.GetTasks("", "")
+	tasks, err := store.GetTasks(context.Background(), "", "")
 	if err != nil {
 		t.Fatalf("expected get tasks to succeed, got %v", err)
 	}
@@ -349,19 +438,21 @@ func TestPostgresStoreGetTaskHistory(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM tasks WHERE id = \$1\)`).
-		WithArgs(1).
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM tasks WHERE \(workspace_id = \$1 OR \$1 = '\*'\) AND id = \$2\)`).
+		WithArgs(defaultWorkspaceID, 1).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
 	mock.
-		ExpectQuery(`SELECT id, task_id, changed_at, changed_by, field, from_value, to_value`).
-		WithArgs(1).
+		ExpectQuery(`SELECT id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value`).
+		WithArgs(defaultWorkspaceID, 1).
 		WillReturnRows(
-			sqlmock.NewRows([]string{"id", "task_id", "changed_at", "changed_by", "field", "from_value", "to_value"}).
-				AddRow(11, 1, time.Date(2026, time.January, 2, 10, 0, 0, 0, time.UTC), "admin", "status", "pending", "in-progress"),
+			sqlmock.NewRows([]string{"id", "workspace_id", "task_id", "changed_at", "changed_by", "field", "from_value", "to_value", "batch_id"}).
+				AddRow(11, defaultWorkspaceID, 1, time.Date(2026, time.January, 2, 10, 0, 0, 0, time.UTC), "admin", "status", "pending", "in-progress", nil),
 		)
+	mock.ExpectRollback()
 
-	history, err := store.GetTaskHistory(1)
+	history, err := store.GetTaskHistory(context.Background(), 1)
 	if err != nil {
 		t.Fatalf("expected get task history to succeed, got %v", err)
 	}
@@ -379,12 +470,14 @@ func TestPostgresStoreGetTaskHistoryNotFound(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM tasks WHERE id = \$1\)`).
-		WithArgs(99).
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM tasks WHERE \(workspace_id = \$1 OR \$1 = '\*'\) AND id = \$2\)`).
+		WithArgs(defaultWorkspaceID, 99).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectRollback()
 
-	_, err := store.GetTaskHistory(99)
+	_, err := store.GetTaskHistory(context.Background(), 99)
 	if !errors.Is(err, ErrTaskNotFound) {
 		t.Fatalf("expected ErrTaskNotFound, got %v", err)
 	}
@@ -392,19 +485,96 @@ func TestPostgresStoreGetTaskHistoryNotFound(t *testing.T) {
 	assertMockExpectations(t, mock)
 }
 
+func TestPostgresStoreGetTaskHistorySince(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	now := time.Now().UTC()
+	expectWorkspaceTx(mock, allWorkspaces)
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, task_id, changed_at, changed_by, field, from_value, to_value`).
+		WithArgs(allWorkspaces, 5, 100).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "workspace_id", "task_id", "changed_at", "changed_by", "field", "from_value", "to_value", "batch_id"}).
+				AddRow(6, defaultWorkspaceID, 1, now, "admin", "status", "pending", "completed", nil).
+				AddRow(7, "acme", 4, now, "system", "status", nil, "pending", nil),
+		)
+	mock.ExpectRollback()
+
+	history, err := store.GetTaskHistorySince(withWorkspace(context.Background(), allWorkspaces), 5, 100)
+	if err != nil {
+		t.Fatalf("expected history since to succeed, got %v", err)
+	}
+	if len(history) != 2 || history[0].ID != 6 || history[1].ID != 7 {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+	if history[1].WorkspaceID != "acme" {
+		t.Fatalf("expected workspace acme, got %q", history[1].WorkspaceID)
+	}
+	if history[1].FromValue != nil {
+		t.Fatalf("expected nil fromValue for create entry, got %q", *history[1].FromValue)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStorePublishesEventsAfterCommit(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	store.events = NewEventBus()
+
+	events, unsubscribe := store.events.Subscribe(EventFilter{})
+	defer unsubscribe()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(1, defaultWorkspaceID, "Old", "pending", 1))
+	mock.
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 1, sqlmock.AnyArg(), "admin", "status", "pending", "completed", "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(9))
+	mock.
+		ExpectExec(`UPDATE tasks`).
+		WithArgs("Old", "completed", 1, defaultWorkspaceID, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	status := "completed"
+	if _, err := store.UpdateTask(context.Background(), 1, TaskUpdate{Status: &status}, "admin"); err != nil {
+		t.Fatalf("expected update task to succeed, got %v", err)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != EventTaskUpdated || event.ID != 9 || event.TaskID != 1 {
+			t.Fatalf("unexpected event: %+v", event)
+		}
+	default:
+		t.Fatal("expected task.updated event after commit")
+	}
+
+	assertMockExpectations(t, mock)
+}
+
 func TestPostgresStoreGetStats(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
 		ExpectQuery(`SELECT COUNT\(\*\)`).
+		WithArgs(defaultWorkspaceID).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
 
 	mock.
 		ExpectQuery(`SELECT\s+COUNT\(\*\) AS total`).
+		WithArgs(defaultWorkspaceID).
 		WillReturnRows(sqlmock.NewRows([]string{"total", "pending", "in_progress", "completed"}).AddRow(5, 2, 1, 2))
+	mock.ExpectRollback()
 
-	stats, err := store.GetStats()
+	stats, err := store.GetStats(context.Background())
 	if err != nil {
 		t.Fatalf("expected get stats to succeed, got %v", err)
 	}
@@ -422,11 +592,13 @@ func TestPostgresStoreGetStatsUserQueryErrorReturnsError(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
 		ExpectQuery(`SELECT COUNT\(\*\)`).
 		WillReturnError(errors.New("stats query failed"))
+	mock.ExpectRollback()
 
-	_, err := store.GetStats()
+	_, err := store.GetStats(context.Background())
 	if err == nil {
 		t.Fatal("expected query error from get stats")
 	}
@@ -439,16 +611,54 @@ func TestPostgresStoreUpdateTaskInvalidStatus(t *testing.T) {
 	defer cleanup()
 
 	status := "not-valid"
-	_, err := store.UpdateTask(1, TaskUpdate{Status: &status}, "admin")
+	_, err := store.UpdateTask(context.Background(), 1, TaskUpdate{Status: &status}, "admin")
 	if !errors.Is(err, ErrInvalidTaskStatus) {
 		t.Fatalf("expected ErrInvalidTaskStatus, got %v", err)
 	}
 }
 
-func TestPostgresStoreInitSchema(t *testing.T) {
+func TestPostgresStoreMigrateUpAppliesPendingMigrations(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	appliedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, appliedAt).AddRow(2, appliedAt))
+	mock.ExpectExec(`ALTER TABLE task_history ADD COLUMN IF NOT EXISTS batch_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(3, migrations[2].name).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRateLimitMigration(mock)
+	mock.ExpectCommit()
+
+	applied, err := store.MigrateUp(context.Background())
+	if err != nil {
+		t.Fatalf("expected migrate up to succeed, got %v", err)
+	}
+	if len(applied) != 2 || applied[0].version != 3 || applied[1].version != 4 {
+		t.Fatalf("expected only migrations 3 and 4 to run, got %+v", applied)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func expectRateLimitMigration(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS rate_limit_buckets`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`CREATE OR REPLACE FUNCTION take_rate_limit_token`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(4, migrations[3].name).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestPostgresStoreMigrateUpFreshDatabase(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}))
 	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS users`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS tasks`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS task_history`).WillReturnResult(sqlmock.NewResult(0, 0))
@@ -456,31 +666,91 @@ func TestPostgresStoreInitSchema(t *testing.T) {
 	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_tasks_user_id`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_task_history_task_id`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_task_history_changed_at`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(1, migrations[0].name).WillReturnResult(sqlmock.NewResult(0, 1))
+	for _, table := range requiredTables {
+		mock.ExpectExec(`ALTER TABLE ` + table + ` ADD COLUMN IF NOT EXISTS workspace_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE INDEX IF NOT EXISTS idx_` + table + `_workspace_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`ALTER TABLE ` + table + ` ENABLE ROW LEVEL SECURITY`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`ALTER TABLE ` + table + ` FORCE ROW LEVEL SECURITY`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE POLICY workspace_isolation ON ` + table).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(2, migrations[1].name).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`ALTER TABLE task_history ADD COLUMN IF NOT EXISTS batch_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations`).WithArgs(3, migrations[2].name).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectRateLimitMigration(mock)
+	mock.ExpectCommit()
 
-	if err := store.initSchema(); err != nil {
-		t.Fatalf("expected init schema to succeed, got %v", err)
+	applied, err := store.MigrateUp(context.Background())
+	if err != nil {
+		t.Fatalf("expected migrate up to succeed, got %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Fatalf("expected every migration to run, got %d", len(applied))
 	}
 
 	assertMockExpectations(t, mock)
 }
 
-func TestPostgresStoreUpdateTaskUnknownUser(t *testing.T) {
+func TestPostgresStoreMigrateDownRevertsLatest(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	appliedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT version, applied_at FROM schema_migrations`).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "applied_at"}).AddRow(1, appliedAt).AddRow(2, appliedAt).AddRow(3, appliedAt))
+	mock.ExpectExec(`ALTER TABLE task_history DROP COLUMN IF EXISTS batch_id`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations`).WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	reverted, err := store.MigrateDown(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("expected migrate down to succeed, got %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].version != 3 {
+		t.Fatalf("expected migration 3 to be reverted, got %+v", reverted)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreMigrationStatusBeforeFirstMigration(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	mock.ExpectQuery(`SELECT to_regclass\('schema_migrations'\) IS NOT NULL`).
+		WillReturnRows(sqlmock.NewRows([]string{"tracked"}).AddRow(false))
+
+	statuses, err := store.MigrationStatus(context.Background())
+	if err != nil {
+		t.Fatalf("expected migration status to succeed, got %v", err)
+	}
+	if len(statuses) != len(migrations) || pendingMigrations(statuses) != len(migrations) {
+		t.Fatalf("expected every migration to be pending, got %+v", statuses)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreUpdateTaskUnknownUser(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
 	mock.
-		ExpectQuery(`SELECT id, title, status, user_id`).
-		WithArgs(1).
-		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "status", "user_id"}).AddRow(1, "Old", "pending", 1))
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(1, defaultWorkspaceID, "Old", "pending", 1))
 	mock.
-		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE id = \$1\)`).
-		WithArgs(999).
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users WHERE workspace_id = \$1 AND id = \$2\)`).
+		WithArgs(defaultWorkspaceID, 999).
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
 	mock.ExpectRollback()
 
 	newUserID := 999
-	_, err := store.UpdateTask(1, TaskUpdate{
+	_, err := store.UpdateTask(context.Background(), 1, TaskUpdate{
 		UserID: &newUserID,
 	}, "admin")
 	if !errors.Is(err, ErrUserDoesNotExist) {
@@ -490,51 +760,201 @@ func TestPostgresStoreUpdateTaskUnknownUser(t *testing.T) {
 	assertMockExpectations(t, mock)
 }
 
-func TestPostgresStoreSeedInitialDataOnEmptyTables(t *testing.T) {
+func TestPostgresStoreUpdateTaskPreconditionFailed(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(1, defaultWorkspaceID, "Old", "in-progress", 1))
+	mock.ExpectRollback()
+
+	expected, status := "pending", "completed"
+	_, err := store.UpdateTask(context.Background(), 1, TaskUpdate{
+		Status: &status,
+		Expect: TaskPrecondition{Status: &expected},
+	}, "admin")
+	if !errors.Is(err, ErrTaskConflict) {
+		t.Fatalf("expected ErrTaskConflict, got %v", err)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreApplyTaskBatchUsesSavepoints(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.ExpectExec(`SAVEPOINT task_write`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users`).
+		WithArgs(defaultWorkspaceID, 99).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectExec(`ROLLBACK TO SAVEPOINT task_write`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`SAVEPOINT task_write`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.
+		ExpectQuery(`INSERT INTO tasks`).
+		WithArgs(defaultWorkspaceID, "Task", "pending", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(4, defaultWorkspaceID, "Task", "pending", 1))
+	mock.
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 4, sqlmock.AnyArg(), "admin", "status", nil, "pending", "b1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(`RELEASE SAVEPOINT task_write`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	results, err := store.ApplyTaskBatch(context.Background(), TaskBatch{ID: "b1", Actor: "admin", Writes: []TaskWrite{
+		{Create: &TaskCreate{Title: "Orphan", Status: "pending", UserID: 99}},
+		{Create: &TaskCreate{Title: "Task", Status: "pending", UserID: 1}},
+	}})
+	if err != nil {
+		t.Fatalf("expected batch to succeed, got %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrUserDoesNotExist) {
+		t.Fatalf("expected ErrUserDoesNotExist for the first write, got %v", results[0].Err)
+	}
+	if results[1].Err != nil || results[1].Task.LastChange == nil || results[1].Task.LastChange.BatchID != "b1" {
+		t.Fatalf("expected the second write to succeed in batch b1, got %+v", results[1])
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreApplyTaskBatchAtomicRollsBack(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.
+		ExpectQuery(`INSERT INTO tasks`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(4, defaultWorkspaceID, "Task", "pending", 1))
+	mock.
+		ExpectQuery(`INSERT INTO task_history`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 42).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	completed := "completed"
+	results, err := store.ApplyTaskBatch(context.Background(), TaskBatch{ID: "b1", Atomic: true, Actor: "admin", Writes: []TaskWrite{
+		{Create: &TaskCreate{Title: "Task", Status: "pending", UserID: 1}},
+		{TaskID: 42, Update: TaskUpdate{Status: &completed}},
+	}})
+	if err != nil {
+		t.Fatalf("expected per-write results, got %v", err)
+	}
+	if !errors.Is(results[0].Err, ErrBatchAborted) || !errors.Is(results[1].Err, ErrTaskNotFound) {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreImportResolvesUsersByEmail(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`INSERT INTO users`).
+		WithArgs(defaultWorkspaceID, "Dana", "dana@example.com", "developer").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).AddRow(5, defaultWorkspaceID, "Dana", "dana@example.com", "developer"))
+	mock.
+		ExpectQuery(`SELECT id FROM users`).
+		WithArgs(defaultWorkspaceID, "DANA@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+	mock.
+		ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM users`).
+		WithArgs(defaultWorkspaceID, 5).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.
+		ExpectQuery(`INSERT INTO tasks`).
+		WithArgs(defaultWorkspaceID, "Onboard", "pending", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(4, defaultWorkspaceID, "Onboard", "pending", 5))
+	mock.
+		ExpectQuery(`INSERT INTO task_history`).
+		WithArgs(defaultWorkspaceID, 4, sqlmock.AnyArg(), "admin", "status", nil, "pending", "b1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectCommit()
+
+	result, err := store.Import(context.Background(), ImportBatch{
+		ID:    "b1",
+		Actor: "admin",
+		Users: []ImportUser{{Name: "Dana", Email: "dana@example.com", Role: "developer"}},
+		Tasks: []ImportTask{{Title: "Onboard", Status: "pending", UserEmail: "DANA@example.com"}},
+	})
+	if err != nil {
+		t.Fatalf("expected import to succeed, got %v", err)
+	}
+	if len(result.Users) != 1 || len(result.Tasks) != 1 || result.Tasks[0].UserID != 5 {
+		t.Fatalf("unexpected import result: %+v", result)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreSeedOnEmptyTables(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	fixtures := demoFixtures(t)
+
 	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\('app.workspace_id', '\*', true\)`).WillReturnResult(sqlmock.NewResult(0, 0))
 
 	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users`).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-
-	for _, user := range initialUsers {
-		mock.ExpectExec(`INSERT INTO users`).
-			WithArgs(user.ID, user.Name, user.Email, user.Role).
+	for _, user := range fixtures.Users {
+		mock.ExpectExec(`INSERT INTO users .* ON CONFLICT \(id\) DO UPDATE`).
+			WithArgs(user.ID, defaultWorkspaceID, user.Name, user.Email, user.Role).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 	}
-	mock.ExpectExec(`SELECT setval\(`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT setval\(`).WithArgs("users").WillReturnResult(sqlmock.NewResult(0, 1))
 
 	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM tasks`).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-
-	for _, task := range initialTasks {
+	for _, task := range fixtures.Tasks {
 		mock.ExpectExec(`INSERT INTO tasks`).
-			WithArgs(task.ID, task.Title, task.Status, task.UserID).
+			WithArgs(task.ID, defaultWorkspaceID, task.Title, task.Status, task.UserID).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 	}
-	mock.ExpectExec(`SELECT setval\(`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT setval\(`).WithArgs("tasks").WillReturnResult(sqlmock.NewResult(0, 1))
+
 	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM task_history`).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
-	mock.ExpectExec(`INSERT INTO task_history`).
-		WithArgs(defaultActorName).
-		WillReturnResult(sqlmock.NewResult(0, int64(len(initialTasks))))
-
+	for _, entry := range fixtures.History {
+		mock.ExpectExec(`INSERT INTO task_history`).
+			WithArgs(entry.ID, defaultWorkspaceID, entry.TaskID, entry.ChangedAt, entry.ChangedBy, entry.Field, entry.FromValue, entry.ToValue, "").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectExec(`SELECT setval\(`).WithArgs("task_history").WillReturnResult(sqlmock.NewResult(0, 1))
 	mock.ExpectCommit()
 
-	if err := store.seedInitialData(); err != nil {
-		t.Fatalf("expected seed initial data to succeed, got %v", err)
+	if err := store.Seed(context.Background(), fixtures, SeedIfEmpty); err != nil {
+		t.Fatalf("expected seed to succeed, got %v", err)
 	}
 
 	assertMockExpectations(t, mock)
 }
 
-func TestPostgresStoreSeedInitialDataSkipsWhenTablesPopulated(t *testing.T) {
+func TestPostgresStoreSeedSkipsWhenTablesPopulated(t *testing.T) {
 	store, mock, cleanup := newMockPostgresStore(t)
 	defer cleanup()
 
 	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\('app.workspace_id', '\*', true\)`).WillReturnResult(sqlmock.NewResult(0, 0))
 	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM users`).
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM tasks`).
@@ -543,8 +963,40 @@ func TestPostgresStoreSeedInitialDataSkipsWhenTablesPopulated(t *testing.T) {
 		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
 	mock.ExpectCommit()
 
-	if err := store.seedInitialData(); err != nil {
-		t.Fatalf("expected seed initial data to succeed with existing data, got %v", err)
+	if err := store.Seed(context.Background(), demoFixtures(t), SeedIfEmpty); err != nil {
+		t.Fatalf("expected seed to succeed with existing data, got %v", err)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreSeedUpsertSkipsCounts(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	fixtures := Fixtures{Users: []User{{ID: 7, WorkspaceID: "acme", Name: "Ann", Email: "ann@example.com", Role: "developer"}}}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT set_config\('app.workspace_id', '\*', true\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(`INSERT INTO users .* ON CONFLICT \(id\) DO UPDATE`).
+		WithArgs(7, "acme", "Ann", "ann@example.com", "developer").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(`SELECT setval\(`).WithArgs("users").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := store.Seed(context.Background(), fixtures, SeedUpsert); err != nil {
+		t.Fatalf("expected upsert seed to succeed, got %v", err)
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreWritesRequireSingleWorkspace(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	ctx := withWorkspace(context.Background(), allWorkspaces)
+	if _, err := store.CreateUser(ctx, "Alice", "alice@example.com", "developer"); !errors.Is(err, ErrWorkspaceRequired) {
+		t.Fatalf("expected ErrWorkspaceRequired, got %v", err)
 	}
 
 	assertMockExpectations(t, mock)
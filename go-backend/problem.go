@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	problemContentType = "application/problem+json"
+
+	// problemTypeDefault means the status code says it all (RFC 7807 §4.2).
+	problemTypeDefault    = "about:blank"
+	problemTypeValidation = "/problems/validation"
+)
+
+// Validation error codes reported in FieldError.Code.
+const (
+	codeRequired      = "required"
+	codeBlank         = "blank"
+	codeInvalidFormat = "invalid_format"
+	codeInvalidValue  = "invalid_value"
+	codeInvalidType   = "invalid_type"
+	codeEmptyUpdate   = "empty_update"
+	codeUnknownField  = "unknown_field"
+	codeReadOnly      = "read_only"
+	codeDuplicate     = "duplicate"
+	// codeUnknownReference means a value names a record that does not exist.
+	codeUnknownReference = "unknown_reference"
+)
+
+// ProblemDetails is an RFC 7807 error body, served as application/problem+json.
+type ProblemDetails struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes one invalid request field. Field is empty for errors
+// about the body as a whole.
+type FieldError struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError collects every FieldError found in a request.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ErrorFormat selects the shape of error responses.
+type ErrorFormat string
+
+const (
+	// ErrorFormatProblem is RFC 7807 problem details (the default).
+	ErrorFormatProblem ErrorFormat = "problem"
+	// ErrorFormatLegacy is {"error": "...", "requestId": "..."} as served
+	// before problem details, for clients that have not migrated yet.
+	ErrorFormatLegacy ErrorFormat = "legacy"
+)
+
+// parseErrorFormat reads ERROR_FORMAT; empty means ErrorFormatProblem.
+func parseErrorFormat(value string) (ErrorFormat, error) {
+	switch format := ErrorFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case "":
+		return ErrorFormatProblem, nil
+	case ErrorFormatProblem, ErrorFormatLegacy:
+		return format, nil
+	default:
+		return "", fmt.Errorf("invalid ERROR_FORMAT %q (want problem or legacy)", value)
+	}
+}
+
+// writeError writes a problem without field errors.
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	s.writeProblem(w, ProblemDetails{Type: problemTypeDefault, Status: status, Detail: message})
+}
+
+// writeValidationError writes a 400 listing every invalid field of a
+// *ValidationError; other errors become a plain 400.
+func (s *Server) writeValidationError(w http.ResponseWriter, err error) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeProblem(w, ProblemDetails{
+		Type:   problemTypeValidation,
+		Title:  "Request validation failed",
+		Status: http.StatusBadRequest,
+		Detail: validationErr.Error(),
+		Errors: validationErr.Errors,
+	})
+}
+
+// writeProblem fills in the title and instance (the request ID) and writes p
+// in the configured ErrorFormat.
+func (s *Server) writeProblem(w http.ResponseWriter, p ProblemDetails) {
+	// requestIDMiddleware sets the header before any handler runs.
+	id := w.Header().Get(requestIDHeaderName)
+
+	if s.settings.Load().errorFormat == ErrorFormatLegacy {
+		body := map[string]string{"error": p.Detail}
+		if id != "" {
+			body["requestId"] = id
+		}
+		s.writeJSON(w, p.Status, body)
+		return
+	}
+
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.Instance = id
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		s.logger.Error("failed to encode problem response", "error", err)
+	}
+}
+
+// writeDecodeError reports a request body that could not be decoded.
+func (s *Server) writeDecodeError(w http.ResponseWriter, err error) {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		s.writeValidationError(w, err)
+		return
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+		return
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		s.writeValidationError(w, &ValidationError{Errors: []FieldError{{
+			Field:   typeErr.Field,
+			Code:    codeInvalidType,
+			Message: normalizeJSONError(err),
+		}}})
+		return
+	}
+	s.writeError(w, http.StatusBadRequest, normalizeJSONError(err))
+}
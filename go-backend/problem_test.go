@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// decodeProblem checks res is application/problem+json and decodes it.
+func decodeProblem(t *testing.T, res *httptest.ResponseRecorder) ProblemDetails {
+	t.Helper()
+
+	if got := res.Header().Get("Content-Type"); got != problemContentType {
+		t.Fatalf("expected Content-Type %q, got %q body=%s", problemContentType, got, res.Body.String())
+	}
+	var problem ProblemDetails
+	decodeJSONResponse(t, res.Body.Bytes(), &problem)
+	if problem.Status != res.Code {
+		t.Fatalf("expected problem status %d to match response, got %d", res.Code, problem.Status)
+	}
+	return problem
+}
+
+func fieldErrorCodes(problem ProblemDetails) map[string]string {
+	codes := make(map[string]string, len(problem.Errors))
+	for _, fieldErr := range problem.Errors {
+		codes[fieldErr.Field] = fieldErr.Code
+	}
+	return codes
+}
+
+func TestErrorsAreProblemDetails(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users/999", "", map[string]string{requestIDHeaderName: "req-7"})
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+	problem := decodeProblem(t, res)
+	want := ProblemDetails{Type: problemTypeDefault, Title: "Not Found", Status: http.StatusNotFound, Detail: "user not found", Instance: "req-7"}
+	if problem.Type != want.Type || problem.Title != want.Title || problem.Detail != want.Detail || problem.Instance != want.Instance || problem.Errors != nil {
+		t.Fatalf("expected %+v, got %+v", want, problem)
+	}
+}
+
+func TestValidationProblemListsEveryField(t *testing.T) {
+	s := newTestServer(t)
+
+	testCases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   map[string]string
+	}{
+		{name: "user missing fields", method: http.MethodPost, path: "/api/users", body: `{"name":"  "}`, want: map[string]string{"name": codeRequired, "email": codeRequired, "role": codeRequired}},
+		{name: "user bad email", method: http.MethodPost, path: "/api/users", body: `{"name":"A","email":"nope","role":"developer"}`, want: map[string]string{"email": codeInvalidFormat}},
+		{name: "task bad status and no user", method: http.MethodPost, path: "/api/tasks", body: `{"title":"T","status":"done"}`, want: map[string]string{"status": codeInvalidValue, "userId": codeRequired}},
+		{name: "task wrong type", method: http.MethodPost, path: "/api/tasks", body: `{"title":"T","status":"pending","userId":"1"}`, want: map[string]string{"userId": codeInvalidType}},
+		{name: "replace blank title", method: http.MethodPut, path: "/api/tasks/1", body: `{"title":" ","status":"bad","userId":1}`, want: map[string]string{"title": codeRequired, "status": codeInvalidValue}},
+		{name: "replace without fields", method: http.MethodPut, path: "/api/tasks/1", body: `{}`, want: map[string]string{"title": codeRequired, "status": codeRequired, "userId": codeRequired}},
+		{name: "patch removes title", method: http.MethodPatch, path: "/api/tasks/1", body: `{"title":null,"status":"bad"}`, want: map[string]string{"title": codeRequired, "status": codeInvalidValue}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequest(s.Handler(), tc.method, tc.path, tc.body)
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, res.Code, res.Body.String())
+			}
+			problem := decodeProblem(t, res)
+			if problem.Type != problemTypeValidation || problem.Detail == "" {
+				t.Fatalf("expected a validation problem, got %+v", problem)
+			}
+			codes := fieldErrorCodes(problem)
+			if len(codes) != len(tc.want) {
+				t.Fatalf("expected field errors %v, got %+v", tc.want, problem.Errors)
+			}
+			for field, code := range tc.want {
+				if codes[field] != code {
+					t.Fatalf("expected %q to fail with %q, got %+v", field, code, problem.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestLegacyErrorFormat(t *testing.T) {
+	s := newTestServer(t)
+	s.updateSettings(func(settings *serverSettings) { settings.errorFormat = ErrorFormatLegacy })
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/users", `{"name":"A","email":"nope","role":"developer"}`, map[string]string{requestIDHeaderName: "req-9"})
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+	}
+	if got := res.Header().Get("Content-Type"); got != "application/json" {
+		t.Fatalf("expected legacy Content-Type application/json, got %q", got)
+	}
+	var body map[string]string
+	decodeJSONResponse(t, res.Body.Bytes(), &body)
+	if len(body) != 2 || body["error"] != "invalid email format" || body["requestId"] != "req-9" {
+		t.Fatalf("unexpected legacy error body: %v", body)
+	}
+}
+
+func TestParseErrorFormat(t *testing.T) {
+	for value, want := range map[string]ErrorFormat{"": ErrorFormatProblem, "problem": ErrorFormatProblem, " Legacy ": ErrorFormatLegacy} {
+		if got, err := parseErrorFormat(value); err != nil || got != want {
+			t.Fatalf("parseErrorFormat(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := parseErrorFormat("xml"); err == nil {
+		t.Fatal("expected unknown format to be rejected")
+	}
+}
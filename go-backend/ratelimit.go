@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit backends and client keys.
+const (
+	rateLimitBackendMemory   = "memory"
+	rateLimitBackendPostgres = "postgres"
+
+	rateLimitKeyPrincipal = "principal"
+	rateLimitKeyActor     = "actor"
+	rateLimitKeyIP        = "ip"
+)
+
+// rateLimitSweepInterval is how often limiters drop buckets that have
+// refilled, which a new request would recreate full anyway.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitConfig configures per-client token buckets for /api/* requests.
+// Reads (GET and HEAD) and writes share one bucket per client each, unless a
+// route has a rate of its own in Routes, keyed by route name. Failed
+// authentications draw from a bucket per IP address, AuthFailures; an
+// address that empties it is refused until a token is back. Limits are off
+// unless Enabled.
+type RateLimitConfig struct {
+	Enabled bool
+	// Key is what a client is: its principal, the actor a delegating
+	// principal names, or its IP address.
+	Key     string
+	Backend string
+	Read    Rate
+	Write   Rate
+	Routes  RouteRates
+	// AuthFailures is how many failed authentications an IP address may
+	// make.
+	AuthFailures Rate
+	// TrustedProxies are proxies whose X-Forwarded-For header is believed
+	// when a client is identified by IP address.
+	TrustedProxies TrustedProxies
+}
+
+func defaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Key:     rateLimitKeyPrincipal,
+		Backend: rateLimitBackendMemory,
+		Read:    Rate{Limit: 600, Period: time.Minute},
+		Write:   Rate{Limit: 120, Period: time.Minute},
+		Routes: RouteRates{
+			"tasks.bulk": {Limit: 20, Period: time.Minute},
+			"import":     {Limit: 5, Period: time.Minute},
+		},
+		AuthFailures: Rate{Limit: 20, Period: time.Minute},
+	}
+}
+
+// Rate allows Limit requests per Period, in bursts of up to Limit.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// parseRate parses "limit/period", e.g. "100/1m" or "10/s".
+func parseRate(value string) (Rate, error) {
+	limit, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q: want limit/period, e.g. 100/1m", value)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n < 1 {
+		return Rate{}, fmt.Errorf("invalid rate %q: limit must be a positive integer", value)
+	}
+	period = strings.TrimSpace(period)
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q: period must be a positive duration", value)
+	}
+	return Rate{Limit: n, Period: d}, nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%d/%s", r.Limit, r.Period)
+}
+
+// perSecond is how many tokens the bucket gains a second.
+func (r Rate) perSecond() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+// RouteRates are rates by route name.
+type RouteRates map[string]Rate
+
+// parseRouteRates parses comma-separated "route=limit/period" entries.
+func parseRouteRates(value string) (RouteRates, error) {
+	rates := make(RouteRates)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q: want route=limit/period", entry)
+		}
+		name = strings.TrimSpace(name)
+		if !knownRouteName(name) {
+			return nil, fmt.Errorf("unknown route %q", name)
+		}
+		parsed, err := parseRate(strings.TrimSpace(rate))
+		if err != nil {
+			return nil, err
+		}
+		rates[name] = parsed
+	}
+	return rates, nil
+}
+
+func (rates RouteRates) String() string {
+	entries := make([]string, 0, len(rates))
+	for _, name := range sortedKeys(rates) {
+		entries = append(entries, name+"="+rates[name].String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// knownRouteName reports whether a route is named name.
+func knownRouteName(name string) bool {
+	for _, r := range serverRoutes {
+		if r.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rateDecision is the state of a bucket after one request took, or failed to
+// take, a token.
+type rateDecision struct {
+	allowed bool
+	// tokens is what is left in the bucket.
+	tokens float64
+}
+
+// rateLimiter takes tokens from buckets by key. Buckets hold up to
+// rate.Limit tokens and refill continuously at rate.
+type rateLimiter interface {
+	Take(ctx context.Context, key string, rate Rate) (rateDecision, error)
+}
+
+// takeToken refills a bucket holding tokens for elapsed and takes one token
+// if there is one.
+func takeToken(tokens float64, elapsed time.Duration, rate Rate) (float64, bool) {
+	tokens = math.Min(float64(rate.Limit), tokens+math.Max(elapsed.Seconds(), 0)*rate.perSecond())
+	if tokens < 1 {
+		return tokens, false
+	}
+	return tokens - 1, true
+}
+
+// memoryRateLimiter keeps buckets in process, so each replica limits on its
+// own.
+type memoryRateLimiter struct {
+	now func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled.
+	full time.Time
+}
+
+func newMemoryRateLimiter() *memoryRateLimiter {
+	return &memoryRateLimiter{now: time.Now, buckets: make(map[string]*tokenBucket)}
+}
+
+func (l *memoryRateLimiter) Take(_ context.Context, key string, rate Rate) (rateDecision, error) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		for k, b := range l.buckets {
+			if !now.Before(b.full) {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(rate.Limit), updated: now}
+		l.buckets[key] = b
+	}
+	var allowed bool
+	b.tokens, allowed = takeToken(b.tokens, now.Sub(b.updated), rate)
+	b.updated = now
+	b.full = now.Add(secondsDuration((float64(rate.Limit) - b.tokens) / rate.perSecond()))
+	return rateDecision{allowed: allowed, tokens: b.tokens}, nil
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// UseRateLimiter replaces the in-memory limiter, e.g. with one shared by
+// every replica.
+func (s *Server) UseRateLimiter(limiter rateLimiter) {
+	s.limiter = limiter
+}
+
+// rateLimitMiddleware takes a token for each /api/* request from the bucket
+// of its client and route, and answers 429 when there is none. Every limited
+// response carries RateLimit-* headers. If the limiter fails, requests are
+// let through: the limits protect the service, and an outage of the shared
+// counters should not become an outage of the API.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.settings.Load().rateLimit
+		if !cfg.Enabled || !strings.HasPrefix(r.URL.Path, "/api/") || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route, _ := s.routeInfo(r)
+		scope, rate := "write", cfg.Write
+		if routeRate, ok := cfg.Routes[route]; ok {
+			scope, rate = route, routeRate
+		} else if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			scope, rate = "read", cfg.Read
+		}
+
+		decision, err := s.limiter.Take(r.Context(), scope+"|"+rateLimitClient(r, cfg), rate)
+		if err != nil {
+			s.logger.WarnContext(r.Context(), "rate limiter failed; allowing the request", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		perSecond := rate.perSecond()
+		header := w.Header()
+		header.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Limit, int(math.Ceil(rate.Period.Seconds()))))
+		header.Set("RateLimit-Limit", strconv.Itoa(rate.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(int(decision.tokens)))
+		header.Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(rate.Limit)-decision.tokens)/perSecond))))
+		if !decision.allowed {
+			s.metrics.rateLimited.Inc(route)
+			header.Set("Retry-After", strconv.Itoa(retryAfter(rate, decision)))
+			s.writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authAttemptAllowed reports whether r's client may still try to
+// authenticate, answering 429 if it is blocked. The check is local, so
+// clients that authenticate cost no limiter call; see recordAuthFailure.
+func (s *Server) authAttemptAllowed(w http.ResponseWriter, r *http.Request) bool {
+	cfg := s.settings.Load().rateLimit
+	if !cfg.Enabled {
+		return true
+	}
+	wait, blocked := s.authBlocks.blocked(authFailureKey(r, cfg.TrustedProxies))
+	if !blocked {
+		return true
+	}
+	s.writeAuthFailuresExceeded(w, r, wait)
+	return false
+}
+
+// recordAuthFailure charges a failed authentication to r's client. When
+// that empties the client's bucket it blocks the client until a token is
+// back, answers 429 and reports false; otherwise the caller answers 401.
+func (s *Server) recordAuthFailure(w http.ResponseWriter, r *http.Request) bool {
+	cfg := s.settings.Load().rateLimit
+	if !cfg.Enabled {
+		return true
+	}
+	key := authFailureKey(r, cfg.TrustedProxies)
+	decision, err := s.limiter.Take(r.Context(), key, cfg.AuthFailures)
+	if err != nil {
+		s.logger.WarnContext(r.Context(), "error counting a failed authentication", "error", err)
+		return true
+	}
+	if decision.allowed {
+		return true
+	}
+	wait := time.Duration(retryAfter(cfg.AuthFailures, decision)) * time.Second
+	s.authBlocks.block(key, wait)
+	s.writeAuthFailuresExceeded(w, r, wait)
+	return false
+}
+
+func (s *Server) writeAuthFailuresExceeded(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	route, _ := s.routeInfo(r)
+	s.metrics.rateLimited.Inc(route)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	s.writeError(w, http.StatusTooManyRequests, "too many failed authentication attempts")
+}
+
+func authFailureKey(r *http.Request, proxies TrustedProxies) string {
+	return "auth|" + remoteIPKey(r, proxies)
+}
+
+// authBlocklist remembers which clients used up their failed
+// authentications and until when, so they are turned away before their
+// credentials are checked. Each replica keeps its own.
+type authBlocklist struct {
+	now func() time.Time
+
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+func newAuthBlocklist() *authBlocklist {
+	return &authBlocklist{now: time.Now, until: make(map[string]time.Time)}
+}
+
+// blocked reports whether key is blocked and for how much longer.
+func (b *authBlocklist) blocked(key string) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, ok := b.until[key]
+	if !ok {
+		return 0, false
+	}
+	wait := until.Sub(b.now())
+	if wait <= 0 {
+		delete(b.until, key)
+		return 0, false
+	}
+	return wait, true
+}
+
+// block blocks key for d, dropping blocks that have run out.
+func (b *authBlocklist) block(key string, d time.Duration) {
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for k, until := range b.until {
+		if !now.Before(until) {
+			delete(b.until, k)
+		}
+	}
+	b.until[key] = now.Add(d)
+}
+
+// retryAfter is how many whole seconds, at least one, the bucket in decision
+// needs to refill a token.
+func retryAfter(rate Rate, decision rateDecision) int {
+	return int(math.Max(1, math.Ceil((1-decision.tokens)/rate.perSecond())))
+}
+
+// rateLimitClient identifies who a request counts against. Anonymous
+// requests always count against their IP address: their X-Actor header is
+// the caller's own claim.
+func rateLimitClient(r *http.Request, cfg RateLimitConfig) string {
+	principal, authenticated := principalFromContext(r.Context())
+	switch {
+	case cfg.Key == rateLimitKeyIP || !authenticated:
+		return remoteIPKey(r, cfg.TrustedProxies)
+	case cfg.Key == rateLimitKeyActor && principal.Delegating:
+		return "actor:" + principal.Subject + "/" + extractActor(r)
+	default:
+		return "principal:" + principal.Subject
+	}
+}
+
+// remoteIPKey identifies a client by its IP address: that of its
+// connection or, when the connection comes from a trusted proxy, the last
+// X-Forwarded-For address that is not one.
+func remoteIPKey(r *http.Request, proxies TrustedProxies) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !proxies.contains(host) {
+		return "ip:" + host
+	}
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if hop == "" {
+			continue
+		}
+		host = hop
+		if !proxies.contains(hop) {
+			break
+		}
+	}
+	return "ip:" + host
+}
+
+// TrustedProxies are the addresses whose X-Forwarded-For headers name the
+// client, such as a load balancer or the Node gateway.
+type TrustedProxies []netip.Prefix
+
+// parseTrustedProxies parses comma-separated IP addresses and CIDR ranges.
+func parseTrustedProxies(value string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid proxy address %q", entry)
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy range %q", entry)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+func (proxies TrustedProxies) String() string {
+	entries := make([]string, 0, len(proxies))
+	for _, prefix := range proxies {
+		entries = append(entries, prefix.String())
+	}
+	return strings.Join(entries, ",")
+}
+
+// contains reports whether host is the address of a trusted proxy.
+func (proxies TrustedProxies) contains(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range proxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// newRateLimitTestServer limits requests with cfg, using a limiter whose
+// clock only moves when the returned function is called.
+func newRateLimitTestServer(t *testing.T, cfg RateLimitConfig) (*Server, func(time.Duration)) {
+	t.Helper()
+	s := newTestServer(t)
+	cfg.Enabled = true
+	s.updateSettings(func(settings *serverSettings) { settings.rateLimit = cfg })
+
+	now := time.Now()
+	limiter := newMemoryRateLimiter()
+	limiter.now = func() time.Time { return now }
+	s.UseRateLimiter(limiter)
+	s.authBlocks.now = limiter.now
+	return s, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestRateLimitRejectsRequestsOverTheLimit(t *testing.T) {
+	cfg := defaultRateLimitConfig()
+	cfg.Write = Rate{Limit: 2, Period: time.Minute}
+	s, advance := newRateLimitTestServer(t, cfg)
+	h := s.Handler()
+	create := func() *httptest.ResponseRecorder {
+		return performRequest(h, http.MethodPost, "/api/users", `{"name":"Rate","email":"rate@example.com","role":"developer"}`)
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		res := create()
+		if res.Code != http.StatusCreated {
+			t.Fatalf("request %d: expected status %d, got %d", i, http.StatusCreated, res.Code)
+		}
+		if got := res.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Fatalf("request %d: expected RateLimit-Remaining %s, got %q", i, wantRemaining, got)
+		}
+	}
+
+	res := create()
+	if res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, res.Code)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":      "30",
+		"RateLimit-Limit":  "2",
+		"RateLimit-Reset":  "60",
+		"RateLimit-Policy": "2;w=60",
+	} {
+		if got := res.Header().Get(header); got != want {
+			t.Fatalf("expected %s %s, got %q", header, want, got)
+		}
+	}
+	if got := s.metrics.rateLimited.Value("users.create"); got != 1 {
+		t.Fatalf("expected one rate-limited request to be counted, got %v", got)
+	}
+
+	if res := performRequest(h, http.MethodGet, "/api/users", ""); res.Code != http.StatusOK {
+		t.Fatalf("expected reads to have their own bucket, got %d", res.Code)
+	}
+	advance(30 * time.Second)
+	if res := create(); res.Code != http.StatusCreated {
+		t.Fatalf("expected a token after the refill, got %d", res.Code)
+	}
+}
+
+func TestRateLimitRouteOverridesAndClients(t *testing.T) {
+	cfg := defaultRateLimitConfig()
+	cfg.Routes = RouteRates{"users.list": {Limit: 1, Period: time.Hour}}
+	s, _ := newRateLimitTestServer(t, cfg)
+	h := s.Handler()
+
+	if res := performRequest(h, http.MethodGet, "/api/users", ""); res.Code != http.StatusOK {
+		t.Fatalf("expected the first request to pass, got %d", res.Code)
+	}
+	if res := performRequest(h, http.MethodGet, "/api/users", ""); res.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the route's own limit to apply, got %d", res.Code)
+	}
+	if res := performRequest(h, http.MethodGet, "/api/tasks", ""); res.Code != http.StatusOK || res.Header().Get("RateLimit-Limit") != "600" {
+		t.Fatalf("expected other reads to use the read limit, got %d %q", res.Code, res.Header().Get("RateLimit-Limit"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+	req.RemoteAddr = "198.51.100.7:4321"
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected another client to have its own bucket, got %d", res.Code)
+	}
+	if res := performRequest(h, http.MethodGet, "/health", ""); res.Header().Get("RateLimit-Limit") != "" {
+		t.Fatal("expected requests outside /api/ not to be limited")
+	}
+}
+
+func TestRateLimitFailedAuthentications(t *testing.T) {
+	cfg := defaultRateLimitConfig()
+	cfg.AuthFailures = Rate{Limit: 2, Period: time.Minute}
+	s, advance := newRateLimitTestServer(t, cfg)
+	s.EnableAuth(AuthConfig{
+		APIKeys:    []APIKey{{Name: "ci", Key: "secret-key"}},
+		HMACSecret: []byte(testJWTSecret),
+		Issuer:     "https://issuer.example",
+		Audience:   "go-backend",
+	})
+	limiter := &countingRateLimiter{next: s.limiter}
+	s.UseRateLimiter(limiter)
+	h := s.Handler()
+	withHeader := func(name, value, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set(name, value)
+		if remoteAddr != "" {
+			req.RemoteAddr = remoteAddr
+		}
+		res := httptest.NewRecorder()
+		h.ServeHTTP(res, req)
+		return res
+	}
+	withKey := func(key, remoteAddr string) *httptest.ResponseRecorder {
+		return withHeader("X-API-Key", key, remoteAddr)
+	}
+
+	for i := 0; i < 3; i++ {
+		if res := withKey("secret-key", ""); res.Code != http.StatusOK {
+			t.Fatalf("expected successful authentications to pass, got %d", res.Code)
+		}
+	}
+	if limiter.auth != 0 {
+		t.Fatalf("expected successful authentications not to reach the limiter, got %d calls", limiter.auth)
+	}
+
+	expired := validClaims("alice")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	for i := 0; i < 3; i++ {
+		if res := withHeader("Authorization", "Bearer "+signHS256(t, expired), ""); res.Code != http.StatusUnauthorized {
+			t.Fatalf("expected expired tokens to get status %d, got %d", http.StatusUnauthorized, res.Code)
+		}
+	}
+	if limiter.auth != 0 {
+		t.Fatalf("expected expired tokens not to be charged, got %d limiter calls", limiter.auth)
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := withKey("guess", ""); res.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected status %d, got %d", i, http.StatusUnauthorized, res.Code)
+		}
+	}
+	res := withKey("guess", "")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected the failure over the limit to get 429, got %d %q", res.Code, res.Header().Get("Retry-After"))
+	}
+	res = withKey("secret-key", "")
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") != "30" {
+		t.Fatalf("expected the address to be blocked before its credentials are checked, got %d %q", res.Code, res.Header().Get("Retry-After"))
+	}
+	if limiter.auth != 3 {
+		t.Fatalf("expected blocked attempts to be refused without the limiter, got %d calls", limiter.auth)
+	}
+	if res := withKey("secret-key", "198.51.100.7:4321"); res.Code != http.StatusOK {
+		t.Fatalf("expected another address to be unaffected, got %d", res.Code)
+	}
+	advance(30 * time.Second)
+	if res := withKey("secret-key", ""); res.Code != http.StatusOK {
+		t.Fatalf("expected an attempt after the refill, got %d", res.Code)
+	}
+}
+
+// countingRateLimiter counts the calls for failed authentications.
+type countingRateLimiter struct {
+	next rateLimiter
+	auth int
+}
+
+func (l *countingRateLimiter) Take(ctx context.Context, key string, rate Rate) (rateDecision, error) {
+	if strings.HasPrefix(key, "auth|") {
+		l.auth++
+	}
+	return l.next.Take(ctx, key, rate)
+}
+
+func TestRateLimitClient(t *testing.T) {
+	anonymous := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	anonymous.RemoteAddr = "203.0.113.9:5000"
+	anonymous.Header.Set(actorHeaderName, "mallory")
+
+	gateway := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	gateway.Header.Set(actorHeaderName, "alice")
+	gateway = gateway.WithContext(withPrincipal(gateway.Context(), Principal{Subject: "gateway", Delegating: true}))
+
+	proxied := httptest.NewRequest(http.MethodGet, "/api/tasks", nil)
+	proxied.RemoteAddr = "10.0.0.5:4000"
+	proxied.Header.Add("X-Forwarded-For", "198.51.100.1, 203.0.113.7")
+	proxied.Header.Add("X-Forwarded-For", "10.0.0.9")
+
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.0.2.254")
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	if got := proxies.String(); got != "10.0.0.0/8,192.0.2.254/32" {
+		t.Fatalf("unexpected trusted proxies %q", got)
+	}
+	if _, err := parseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Fatal("expected an invalid range to be rejected")
+	}
+
+	testCases := []struct {
+		name    string
+		req     *http.Request
+		key     string
+		proxies TrustedProxies
+		want    string
+	}{
+		{"anonymous by actor", anonymous, rateLimitKeyActor, nil, "ip:203.0.113.9"},
+		{"principal", gateway, rateLimitKeyPrincipal, nil, "principal:gateway"},
+		{"delegated actor", gateway, rateLimitKeyActor, nil, "actor:gateway/alice"},
+		{"ip", gateway, rateLimitKeyIP, nil, "ip:192.0.2.1"},
+		{"untrusted proxy", proxied, rateLimitKeyIP, nil, "ip:10.0.0.5"},
+		{"trusted proxy", proxied, rateLimitKeyIP, proxies, "ip:203.0.113.7"},
+	}
+	for _, tc := range testCases {
+		cfg := RateLimitConfig{Key: tc.key, TrustedProxies: tc.proxies}
+		if got := rateLimitClient(tc.req, cfg); got != tc.want {
+			t.Fatalf("%s: expected %q, got %q", tc.name, tc.want, got)
+		}
+	}
+}
+
+type failingRateLimiter struct{}
+
+func (failingRateLimiter) Take(context.Context, string, Rate) (rateDecision, error) {
+	return rateDecision{}, errors.New("database unavailable")
+}
+
+func TestRateLimitAllowsRequestsWhenTheLimiterFails(t *testing.T) {
+	s, _ := newRateLimitTestServer(t, defaultRateLimitConfig())
+	s.UseRateLimiter(failingRateLimiter{})
+	if res := performRequest(s.Handler(), http.MethodGet, "/api/users", ""); res.Code != http.StatusOK {
+		t.Fatalf("expected the request to be let through, got %d", res.Code)
+	}
+}
+
+func TestParseRateLimitSettings(t *testing.T) {
+	rate, err := parseRate("10/s")
+	if err != nil || rate != (Rate{Limit: 10, Period: time.Second}) {
+		t.Fatalf("parseRate: got %+v, %v", rate, err)
+	}
+	for _, invalid := range []string{"10", "0/1m", "x/1m", "10/0s", "10/soon"} {
+		if _, err := parseRate(invalid); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+
+	env := map[string]string{"RATE_LIMIT_ROUTES": "tasks.bulk=2/1s, import=1/1h", "RATE_LIMIT_ENABLED": "true"}
+	cfg, err := loadConfig("", envLookup(env), nil)
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if !cfg.RateLimit.Enabled || cfg.RateLimit.Routes.String() != "import=1/1h0m0s,tasks.bulk=2/1s" {
+		t.Fatalf("unexpected rate limit config: %+v", cfg.RateLimit)
+	}
+
+	env = map[string]string{"RATE_LIMIT_ROUTES": "tasks.nope=1/m", "RATE_LIMIT_WRITE": "many"}
+	_, err = loadConfig("", envLookup(env), nil)
+	if err == nil || !strings.Contains(err.Error(), `unknown route "tasks.nope"`) || !strings.Contains(err.Error(), "rateLimit.write") {
+		t.Fatalf("expected both rate limit problems, got %v", err)
+	}
+}
+
+func TestPostgresRateLimiterTake(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+	limiter := newPostgresRateLimiter(store)
+	limiter.lastSweep = time.Now()
+
+	mock.ExpectQuery(`SELECT remaining, allowed FROM take_rate_limit_token`).
+		WithArgs("write|ip:192.0.2.1", 2, 2.0/60).
+		WillReturnRows(sqlmock.NewRows([]string{"remaining", "allowed"}).AddRow(0.5, false))
+
+	decision, err := limiter.Take(context.Background(), "write|ip:192.0.2.1", Rate{Limit: 2, Period: time.Minute})
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	if decision.allowed || decision.tokens != 0.5 {
+		t.Fatalf("unexpected decision: %+v", decision)
+	}
+	assertMockExpectations(t, mock)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// serverSettings are the parts of the configuration the server reads while
+// serving. They are replaced as a whole, so a request that loads them once
+// never sees half of a reload.
+type serverSettings struct {
+	cors             *corsPolicy
+	auth             *authenticator
+	policy           *Policy
+	errorFormat      ErrorFormat
+	limits           Limits
+	drainDelay       time.Duration
+	shutdownTimeout  time.Duration
+	readinessTimeout time.Duration
+	eventHeartbeat   time.Duration
+	wsPingInterval   time.Duration
+	// compressionMinBytes is the smallest response compressed; 0 disables
+	// compression.
+	compressionMinBytes int
+	rateLimit           RateLimitConfig
+}
+
+// newServerSettings builds the settings of cfg. Roles are enforced whenever
+// callers are authenticated, or when a policy file is configured explicitly.
+func newServerSettings(cfg Config) (*serverSettings, error) {
+	cors, err := newCORSPolicy(cfg.CORS)
+	if err != nil {
+		return nil, err
+	}
+	settings := &serverSettings{
+		cors:                cors,
+		errorFormat:         cfg.ErrorFormat,
+		limits:              cfg.Limits,
+		drainDelay:          cfg.HTTP.DrainDelay,
+		shutdownTimeout:     cfg.HTTP.ShutdownTimeout,
+		readinessTimeout:    cfg.HTTP.ReadinessTimeout,
+		eventHeartbeat:      cfg.HTTP.EventHeartbeat,
+		wsPingInterval:      cfg.HTTP.WSPingInterval,
+		compressionMinBytes: cfg.HTTP.CompressionMinBytes,
+		rateLimit:           cfg.RateLimit,
+	}
+	if cfg.Auth.Enabled() {
+		settings.auth = newAuthenticator(cfg.Auth)
+	}
+	if cfg.Auth.Enabled() || cfg.PolicyFile != "" {
+		policy := cfg.Policy
+		settings.policy = &policy
+	}
+	return settings, nil
+}
+
+// Configure replaces the server settings with those of cfg: timeouts, limits,
+// the error format, authentication, authorization and CORS.
+func (s *Server) Configure(cfg Config) error {
+	settings, err := newServerSettings(cfg)
+	if err != nil {
+		return err
+	}
+	s.settings.Store(settings)
+	return nil
+}
+
+// updateSettings replaces the settings with a copy changed by fn. It is for
+// setup, before the server handles requests; Reload swaps whole snapshots.
+func (s *Server) updateSettings(fn func(*serverSettings)) {
+	next := *s.settings.Load()
+	fn(&next)
+	s.settings.Store(&next)
+}
+
+// reloader re-reads the configuration for Reload.
+type reloader struct {
+	mu   sync.Mutex
+	load func() (Config, error)
+	// started is the configuration the process started with, and current the
+	// one last applied.
+	started Config
+	current Config
+	level   *slog.LevelVar
+}
+
+// EnableReload lets Reload, and SIGHUP while Start runs, apply the settings
+// load returns. cfg is the configuration already applied; level, if not nil,
+// is the logger's level.
+func (s *Server) EnableReload(cfg Config, load func() (Config, error), level *slog.LevelVar) {
+	s.reloader = &reloader{load: load, started: cfg, current: cfg, level: level}
+}
+
+// Reload loads the configuration again and swaps in its reloadable settings.
+// An invalid configuration is rejected and the current one kept. Changes to
+// settings read only at startup are logged as needing a restart.
+func (s *Server) Reload() error {
+	r := s.reloader
+	if r == nil {
+		return errors.New("configuration reload is not enabled")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	var settings *serverSettings
+	if err == nil {
+		settings, err = newServerSettings(next)
+	}
+	if err != nil {
+		s.logger.Error("configuration reload rejected; keeping the current configuration", "error", err)
+		return fmt.Errorf("reload configuration: %w", err)
+	}
+
+	changed := configChanges(r.current, next, false)
+	s.settings.Store(settings)
+	if r.level != nil {
+		r.level.Set(next.Log.Level)
+	}
+	r.current = next
+
+	if pending := configChanges(r.started, next, true); len(pending) > 0 {
+		s.logger.Warn("configuration changes need a restart to take effect", "settings", pending)
+	}
+	if len(changed) == 0 {
+		s.logger.Info("configuration reloaded; nothing changed")
+		return nil
+	}
+	s.logger.Info("configuration reloaded", "changed", changed)
+	return nil
+}
+
+// reloadOnSignal reloads the configuration for each signal until ctx ends.
+func (s *Server) reloadOnSignal(ctx context.Context, signals <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-signals:
+			s.logger.Info("reloading configuration", "signal", sig.String())
+			_ = s.Reload()
+		}
+	}
+}
+
+// configChanges lists the settings, reloadable or restart-only, whose values
+// differ between from and to as "key: old -> new". Secrets are only reported
+// as changed.
+func configChanges(from, to Config, restart bool) []string {
+	fromSettings, toSettings := from.settings(), to.settings()
+	var changes []string
+	for i, setting := range fromSettings {
+		if setting.restart != restart {
+			continue
+		}
+		old, updated := setting.value.String(), toSettings[i].value.String()
+		switch {
+		case old == updated:
+		case setting.redact != nil:
+			changes = append(changes, setting.key+": changed")
+		default:
+			changes = append(changes, fmt.Sprintf("%s: %q -> %q", setting.key, old, updated))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newReloadTestServer serves with the config file at path and returns the
+// buffer its logs go to.
+func newReloadTestServer(t *testing.T, path string) (*Server, *slog.LevelVar, *bytes.Buffer) {
+	t.Helper()
+	load := func() (Config, error) { return loadConfig(path, nil, nil) }
+	cfg, err := load()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+
+	s := newTestServer(t)
+	var logs bytes.Buffer
+	s.logger = slog.New(slog.NewTextHandler(&logs, nil))
+	if err := s.Configure(cfg); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+	level := new(slog.LevelVar)
+	level.Set(cfg.Log.Level)
+	s.EnableReload(cfg, load, level)
+	return s, level, &logs
+}
+
+func allowedOrigin(s *Server, origin string) string {
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", map[string]string{"Origin": origin})
+	return res.Header().Get("Access-Control-Allow-Origin")
+}
+
+func TestServerReloadAppliesNewSettings(t *testing.T) {
+	path := writeConfigFile(t, "cors:\n  allowedOrigins: [https://old.example]\n")
+	s, level, logs := newReloadTestServer(t, path)
+	if allowedOrigin(s, "https://new.example") != "" {
+		t.Fatal("expected the new origin to be rejected before the reload")
+	}
+
+	if err := os.WriteFile(path, []byte(`
+cors:
+  allowedOrigins: [https://new.example]
+log:
+  level: debug
+errors:
+  format: legacy
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if got := allowedOrigin(s, "https://new.example"); got != "https://new.example" {
+		t.Fatalf("expected the reloaded origin to be allowed, got %q", got)
+	}
+	if allowedOrigin(s, "https://old.example") != "" {
+		t.Fatal("expected the old origin to be dropped")
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Fatalf("expected the log level to change, got %s", level.Level())
+	}
+	if s.settings.Load().errorFormat != ErrorFormatLegacy {
+		t.Fatal("expected the error format to change")
+	}
+	for _, want := range []string{"configuration reloaded", `cors.allowedOrigins: \"https://old.example\" -> \"https://new.example\"`, "log.level"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Fatalf("expected %q in the diff log, got %s", want, logs.String())
+		}
+	}
+}
+
+func TestServerReloadRejectsInvalidConfig(t *testing.T) {
+	path := writeConfigFile(t, "cors:\n  allowedOrigins: [https://old.example]\n")
+	s, _, logs := newReloadTestServer(t, path)
+	before := s.settings.Load()
+
+	if err := os.WriteFile(path, []byte("cors:\n  allowedOrigins: [https://new.example]\nlimits:\n  maxBodyBytes: none\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err == nil {
+		t.Fatal("expected an invalid configuration to be rejected")
+	}
+
+	if s.settings.Load() != before || allowedOrigin(s, "https://old.example") != "https://old.example" {
+		t.Fatal("expected the current settings to be kept")
+	}
+	if !strings.Contains(logs.String(), "configuration reload rejected") || !strings.Contains(logs.String(), "limits.maxBodyBytes") {
+		t.Fatalf("expected the rejection to be logged, got %s", logs.String())
+	}
+}
+
+func TestServerReloadWarnsAboutRestartOnlySettings(t *testing.T) {
+	path := writeConfigFile(t, "http:\n  port: 8080\n")
+	s, _, logs := newReloadTestServer(t, path)
+
+	if err := os.WriteFile(path, []byte("http:\n  port: 9090\n  drainDelay: 2s\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+
+	if s.settings.Load().drainDelay != 2*time.Second {
+		t.Fatal("expected the drain delay to be reloaded")
+	}
+	if !strings.Contains(logs.String(), "need a restart") || !strings.Contains(logs.String(), "http.port") {
+		t.Fatalf("expected the port change to be flagged, got %s", logs.String())
+	}
+}
+
+func TestServerReloadsOnSignal(t *testing.T) {
+	path := writeConfigFile(t, "errors:\n  format: problem\n")
+	s, _, _ := newReloadTestServer(t, path)
+	if err := os.WriteFile(path, []byte("errors:\n  format: legacy\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	signals := make(chan os.Signal, 1)
+	go s.reloadOnSignal(ctx, signals)
+	signals <- syscall.SIGHUP
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.settings.Load().errorFormat != ErrorFormatLegacy {
+		if time.Now().After(deadline) {
+			t.Fatal("expected SIGHUP to reload the configuration")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReloadWithoutEnableReload(t *testing.T) {
+	if err := newTestServer(t).Reload(); err == nil {
+		t.Fatal("expected Reload to fail when it is not enabled")
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// route is one entry of the route table: a method, a path template and the
+// handler serving it. Templates are literal segments and typed parameters,
+// e.g. "/api/tasks/{taskId:int}/history". Parameters without a type match
+// any non-empty segment; ":int" parameters must be positive integers.
+type route struct {
+	// name identifies the route in metrics, logs and traces, e.g. "tasks.update".
+	name    string
+	method  string
+	pattern string
+	handler http.HandlerFunc
+	// serve is the handler of a serverRoutes entry, bound to a Server as
+	// handler by Server.routes.
+	serve func(*Server, http.ResponseWriter, *http.Request)
+	// stream marks long-lived responses; they are not served for HEAD.
+	stream bool
+
+	segments []routeSegment
+	// template is pattern without parameter types, e.g. "/api/tasks/{taskId}".
+	template string
+}
+
+type routeSegment struct {
+	literal string
+	param   string
+	isInt   bool
+}
+
+// routeMatch is the outcome of looking up a request in the router.
+type routeMatch struct {
+	route  *route
+	params map[string]string
+	// allowed lists every method served at the path, sorted; badParam names a
+	// typed parameter that failed to parse.
+	allowed  []string
+	badParam string
+}
+
+// router dispatches requests to routes by method and path template, answering
+// 404 for unknown paths and 405 with an Allow header for unsupported methods.
+// GET routes also serve HEAD.
+type router struct {
+	routes   []*route
+	notFound http.HandlerFunc
+	// methodNotAllowed is called after the Allow header has been set.
+	methodNotAllowed http.HandlerFunc
+	badParam         func(w http.ResponseWriter, r *http.Request, param string)
+}
+
+func newRouter(routes []route) *router {
+	rt := &router{}
+	for i := range routes {
+		r := routes[i]
+		r.segments = parseRouteTemplate(r.pattern)
+		r.template = routeTemplate(r.segments)
+		rt.routes = append(rt.routes, &r)
+	}
+	return rt
+}
+
+func parseRouteTemplate(pattern string) []routeSegment {
+	parts := strings.Split(strings.Trim(pattern, "/"), "/")
+	segments := make([]routeSegment, 0, len(parts))
+	for _, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name, kind, _ := strings.Cut(part[1:len(part)-1], ":")
+			if kind != "" && kind != "int" {
+				panic(fmt.Sprintf("route %s: unknown parameter type %q", pattern, kind))
+			}
+			segments = append(segments, routeSegment{param: name, isInt: kind == "int"})
+			continue
+		}
+		segments = append(segments, routeSegment{literal: part})
+	}
+	return segments
+}
+
+func routeTemplate(segments []routeSegment) string {
+	var b strings.Builder
+	for _, segment := range segments {
+		b.WriteString("/")
+		if segment.param != "" {
+			b.WriteString("{" + segment.param + "}")
+			continue
+		}
+		b.WriteString(segment.literal)
+	}
+	return b.String()
+}
+
+// match reports whether path fits the template, returning its parameters.
+// ok is true with badParam set when a typed parameter does not parse.
+func (r *route) match(path string) (params map[string]string, badParam string, ok bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != len(r.segments) || (path != "/" && strings.HasSuffix(path, "/")) {
+		return nil, "", false
+	}
+	for i, segment := range r.segments {
+		part := parts[i]
+		if segment.param == "" {
+			if part != segment.literal {
+				return nil, "", false
+			}
+			continue
+		}
+		if part == "" {
+			return nil, "", false
+		}
+		if params == nil {
+			params = make(map[string]string, len(r.segments))
+		}
+		params[segment.param] = part
+		if segment.isInt && badParam == "" {
+			if id, err := strconv.Atoi(part); err != nil || id <= 0 {
+				badParam = segment.param
+			}
+		}
+	}
+	return params, badParam, true
+}
+
+func (r *route) serves(method string) bool {
+	return r.method == method || (method == http.MethodHead && r.method == http.MethodGet && !r.stream)
+}
+
+// lookup finds the route for req. Literal segments win over parameters, so
+// /api/tasks/bulk is never read as a task ID, and allowed lists the methods of
+// the winning path only. A typed parameter that does not parse matches only
+// when no route fits the path otherwise, and only for a method served there;
+// for any other method the path does not exist. An exact method match wins
+// over a GET route answering HEAD.
+func (rt *router) lookup(req *http.Request) routeMatch {
+	var matched, malformed []routeMatch
+	for _, r := range rt.routes {
+		params, badParam, ok := r.match(req.URL.Path)
+		switch {
+		case !ok:
+		case badParam == "":
+			matched = append(matched, routeMatch{route: r, params: params})
+		default:
+			malformed = append(malformed, routeMatch{route: r, params: params, badParam: badParam})
+		}
+	}
+	candidates := mostSpecific(matched)
+	if len(candidates) == 0 {
+		candidates = mostSpecific(malformed)
+	}
+
+	var (
+		result  routeMatch
+		allowed = make(map[string]bool)
+	)
+	for _, candidate := range candidates {
+		r := candidate.route
+		if r.method == req.Method || (result.route == nil && r.serves(req.Method)) {
+			result = candidate
+		}
+		allowed[r.method] = true
+		if r.method == http.MethodGet && !r.stream {
+			allowed[http.MethodHead] = true
+		}
+	}
+	if len(matched) == 0 && result.route == nil {
+		return routeMatch{}
+	}
+	for method := range allowed {
+		result.allowed = append(result.allowed, method)
+	}
+	sort.Strings(result.allowed)
+	return result
+}
+
+// mostSpecific returns the matches whose templates are the most specific.
+func mostSpecific(matches []routeMatch) []routeMatch {
+	var best []routeMatch
+	for _, match := range matches {
+		if len(best) == 0 {
+			best = []routeMatch{match}
+			continue
+		}
+		switch compareSpecificity(match.route, best[0].route) {
+		case 1:
+			best = []routeMatch{match}
+		case 0:
+			best = append(best, match)
+		}
+	}
+	return best
+}
+
+// compareSpecificity orders two routes matching the same path: at the first
+// segment where one has a literal and the other a parameter, the literal one
+// is more specific. It returns 1, 0 or -1 as a is more, as or less specific.
+func compareSpecificity(a, b *route) int {
+	for i := range a.segments {
+		aLiteral, bLiteral := a.segments[i].param == "", b.segments[i].param == ""
+		switch {
+		case aLiteral && !bLiteral:
+			return 1
+		case !aLiteral && bLiteral:
+			return -1
+		}
+	}
+	return 0
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	match := rt.lookup(req)
+	switch {
+	case match.route != nil && match.badParam != "":
+		rt.badParam(w, req, match.badParam)
+	case match.route != nil:
+		match.route.handler(w, req.WithContext(context.WithValue(req.Context(), routeParamsContextKey, match.params)))
+	case len(match.allowed) > 0:
+		// The path exists, just not for this method.
+		w.Header().Set("Allow", strings.Join(match.allowed, ", "))
+		rt.methodNotAllowed(w, req)
+	default:
+		rt.notFound(w, req)
+	}
+}
+
+// pathParam returns the named path parameter of the route serving r.
+func pathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(routeParamsContextKey).(map[string]string)
+	return params[name]
+}
+
+// intPathParam returns an ":int" path parameter, which the router has
+// already validated as a positive integer.
+func intPathParam(r *http.Request, name string) int {
+	value, _ := strconv.Atoi(pathParam(r, name))
+	return value
+}
+
+// routeInfo returns the name and template (without parameter types) of the
+// route serving r, or unmatchedRoute for both when none does.
+func (s *Server) routeInfo(r *http.Request) (name, template string) {
+	if s.router == nil {
+		return unmatchedRoute, unmatchedRoute
+	}
+	if match := s.router.lookup(r); match.route != nil {
+		return match.route.name, match.route.template
+	}
+	return unmatchedRoute, unmatchedRoute
+}
+
+// routeStreams reports whether r is served by a streaming route.
+func (s *Server) routeStreams(r *http.Request) bool {
+	if s.router == nil {
+		return false
+	}
+	match := s.router.lookup(r)
+	return match.route != nil && match.route.stream
+}
+
+// routeMethods returns the methods served at the path of r, or nil.
+func (s *Server) routeMethods(r *http.Request) []string {
+	if s.router == nil {
+		return nil
+	}
+	return s.router.lookup(r).allowed
+}
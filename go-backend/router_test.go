@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterMethodsAndAllowHeader(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantAllow  string
+	}{
+		{name: "unsupported method on collection", method: http.MethodDelete, path: "/api/tasks", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, HEAD, POST"},
+		{name: "unsupported method on item", method: http.MethodGet, path: "/api/tasks/1", wantStatus: http.StatusMethodNotAllowed, wantAllow: "PATCH, PUT"},
+		{name: "streams do not answer HEAD", method: http.MethodHead, path: "/api/events", wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET"},
+		{name: "unknown sub-resource", method: http.MethodGet, path: "/api/tasks/5/foo", wantStatus: http.StatusNotFound},
+		{name: "trailing slash", method: http.MethodGet, path: "/api/tasks/", wantStatus: http.StatusNotFound},
+		{name: "unknown path", method: http.MethodGet, path: "/api/nope", wantStatus: http.StatusNotFound},
+		{name: "non-integer ID", method: http.MethodGet, path: "/api/users/abc", wantStatus: http.StatusBadRequest},
+		{name: "non-positive ID", method: http.MethodGet, path: "/api/tasks/0/history", wantStatus: http.StatusBadRequest},
+		{name: "HEAD on GET route", method: http.MethodHead, path: "/api/users/1", wantStatus: http.StatusOK},
+		{name: "literal segment over parameter", method: http.MethodPut, path: "/api/tasks/bulk", wantStatus: http.StatusMethodNotAllowed, wantAllow: "POST"},
+		{name: "non-integer ID for an unserved method", method: http.MethodGet, path: "/api/tasks/abc", wantStatus: http.StatusNotFound},
+		{name: "non-integer ID for a served method", method: http.MethodPut, path: "/api/tasks/abc", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequest(h, tc.method, tc.path, "")
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d body=%s", tc.wantStatus, res.Code, res.Body.String())
+			}
+			if got := res.Header().Get("Allow"); got != tc.wantAllow {
+				t.Fatalf("expected Allow %q, got %q", tc.wantAllow, got)
+			}
+		})
+	}
+
+	res := performRequest(h, http.MethodGet, "/api/tasks/abc/history", "")
+	if body := decodeProblem(t, res); body.Detail != "invalid task ID" {
+		t.Fatalf("expected parameter error message, got %v", body)
+	}
+}
+
+func TestRouterHEADOverRealServerHasNoBody(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	res, err := http.Head(ts.URL + "/api/tasks")
+	if err != nil {
+		t.Fatalf("HEAD failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	var buf bytes.Buffer
+	_, _ = buf.ReadFrom(res.Body)
+	if res.StatusCode != http.StatusOK || buf.Len() != 0 {
+		t.Fatalf("expected 200 without body, got %d with %d bytes", res.StatusCode, buf.Len())
+	}
+	if res.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected GET headers on HEAD, got %v", res.Header)
+	}
+}
+
+func TestRouterPathParams(t *testing.T) {
+	var got string
+	rt := newRouter([]route{
+		{name: "a.get", method: http.MethodGet, pattern: "/a/{slug}/b/{n:int}", handler: func(w http.ResponseWriter, r *http.Request) {
+			got = pathParam(r, "slug") + ":" + pathParam(r, "n")
+		}},
+	})
+
+	rt.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a/x-y/b/42", nil))
+	if got != "x-y:42" {
+		t.Fatalf("expected params x-y:42, got %q", got)
+	}
+	if tmpl := rt.routes[0].template; tmpl != "/a/{slug}/b/{n}" {
+		t.Fatalf("expected template without types, got %q", tmpl)
+	}
+}
+
+func TestRouterPrefersLiteralSegments(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	rt := newRouter([]route{
+		{name: "a.update", method: http.MethodPut, pattern: "/a/{id:int}", handler: noop},
+		{name: "a.new", method: http.MethodPost, pattern: "/a/new", handler: noop},
+	})
+
+	match := rt.lookup(httptest.NewRequest(http.MethodPut, "/a/new", nil))
+	if match.route != nil || match.badParam != "" {
+		t.Fatalf("expected /a/new not to be read as an ID, got %+v", match)
+	}
+	if len(match.allowed) != 1 || match.allowed[0] != http.MethodPost {
+		t.Fatalf("expected only the literal route's methods, got %v", match.allowed)
+	}
+}
+
+func TestRequestLogIncludesRouteName(t *testing.T) {
+	s := newTestServer(t)
+
+	var logBuffer bytes.Buffer
+	s.logger = newTestLogger(t, &logBuffer, "json")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/tasks/1/history", nil))
+
+	var record map[string]any
+	if err := json.Unmarshal(logBuffer.Bytes(), &record); err != nil {
+		t.Fatalf("expected a single JSON log record, got %q: %v", logBuffer.String(), err)
+	}
+	if record["route"] != "tasks.history" {
+		t.Fatalf("expected route name in request log, got %v", record)
+	}
+}
@@ -1,30 +1,60 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"mime"
+	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Server struct {
-	dataStore Store
-	logger    *log.Logger
-	handler   http.Handler
+	dataStore    Store
+	history      historyFeed
+	batches      taskBatchWriter
+	exports      exportSource
+	importer     importer
+	pinger       Pinger
+	migrations   migrationChecker
+	pool         dbStatsSource
+	limiter      rateLimiter
+	authBlocks   *authBlocklist
+	logger       *slog.Logger
+	handler      http.Handler
+	router       *router
+	metrics      *serverMetrics
+	tracer       trace.Tracer
+	propagator   propagation.TextMapPropagator
+	events       *EventBus
+	ws           *wsHub
+	streamsCtx   context.Context
+	closeStreams context.CancelFunc
+	draining     atomic.Bool
+	now          func() time.Time
+	// settings are swapped as a whole by Configure and Reload.
+	settings atomic.Pointer[serverSettings]
+	reloader *reloader
 }
 
 var emailRegex = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
 
+// maxRequestBodyBytes is the default Limits.MaxBodyBytes.
 const maxRequestBodyBytes = 1 << 20
 const actorHeaderName = "X-Actor"
 
@@ -52,82 +82,145 @@ func NewServer(dataStore Store) *Server {
 		panic("data store is required")
 	}
 
+	metrics := newServerMetrics()
+	tracer := defaultTracer()
 	s := &Server{
-		dataStore: dataStore,
-		logger:    log.Default(),
-	}
-
-	mux := http.NewServeMux()
-	s.setupRoutes(mux)
-	s.handler = s.loggingMiddleware(s.recoveryMiddleware(s.corsMiddleware(mux)))
+		dataStore:  newInstrumentedStore(dataStore, metrics, tracer),
+		logger:     slog.Default(),
+		metrics:    metrics,
+		tracer:     tracer,
+		propagator: newPropagator(),
+		ws:         newWSHub(),
+		limiter:    newMemoryRateLimiter(),
+		authBlocks: newAuthBlocklist(),
+		now:        time.Now,
+	}
+	settings, _ := newServerSettings(defaultConfig())
+	s.settings.Store(settings)
+	if source, ok := dataStore.(eventSource); ok {
+		s.events = source.Events()
+	}
+	if s.events == nil {
+		s.events = NewEventBus()
+	}
+	if feed, ok := dataStore.(historyFeed); ok {
+		s.history = instrumentedFeed{next: feed, metrics: metrics, tracer: tracer}
+	}
+	if writer, ok := dataStore.(taskBatchWriter); ok {
+		s.batches = instrumentedBatchWriter{next: writer, metrics: metrics, tracer: tracer}
+	}
+	if source, ok := dataStore.(exportSource); ok {
+		s.exports = instrumentedExporter{next: source, metrics: metrics, tracer: tracer}
+	}
+	if imp, ok := dataStore.(importer); ok {
+		s.importer = instrumentedImporter{next: imp, metrics: metrics, tracer: tracer}
+	}
+	s.pinger, _ = dataStore.(Pinger)
+	s.migrations, _ = dataStore.(migrationChecker)
+	s.pool, _ = dataStore.(dbStatsSource)
+	s.registerStoreGauges(dataStore)
+	s.streamsCtx, s.closeStreams = context.WithCancel(context.Background())
+
+	s.router = newRouter(s.routes())
+	s.router.notFound = s.handleNotFound
+	s.router.methodNotAllowed = s.handleMethodNotAllowed
+	s.router.badParam = s.handleBadPathParam
+	s.handler = s.requestIDMiddleware(s.tracingMiddleware(s.loggingMiddleware(s.compressionMiddleware(s.recoveryMiddleware(s.corsMiddleware(s.authMiddleware(s.rateLimitMiddleware(s.workspaceMiddleware(s.router)))))))))
 
 	return s
 }
 
-func (s *Server) setupRoutes(mux *http.ServeMux) {
-	mux.HandleFunc("/health", s.handleHealth)
-	mux.HandleFunc("/api/users", s.handleUsers)
-	mux.HandleFunc("/api/users/", s.handleUserByID)
-	mux.HandleFunc("/api/tasks", s.handleTasks)
-	mux.HandleFunc("/api/tasks/", s.handleTaskByID)
-	mux.HandleFunc("/api/stats", s.handleStats)
+// serverRoutes is the route table. GET routes also answer HEAD unless they
+// stream.
+var serverRoutes = []route{
+	{name: "health", method: http.MethodGet, pattern: "/health", serve: (*Server).handleHealth},
+	{name: "livez", method: http.MethodGet, pattern: "/livez", serve: (*Server).handleLivez},
+	{name: "readyz", method: http.MethodGet, pattern: "/readyz", serve: (*Server).handleReadyz},
+	{name: "metrics", method: http.MethodGet, pattern: "/metrics", serve: (*Server).handleMetrics},
+	{name: "users.list", method: http.MethodGet, pattern: "/api/users", serve: (*Server).listUsers},
+	{name: "users.create", method: http.MethodPost, pattern: "/api/users", serve: (*Server).createUser},
+	{name: "users.get", method: http.MethodGet, pattern: "/api/users/{userId:int}", serve: (*Server).getUser},
+	{name: "tasks.list", method: http.MethodGet, pattern: "/api/tasks", serve: (*Server).listTasks},
+	{name: "tasks.create", method: http.MethodPost, pattern: "/api/tasks", serve: (*Server).createTask},
+	{name: "tasks.bulk", method: http.MethodPost, pattern: "/api/tasks/bulk", serve: (*Server).handleBulkTasks},
+	{name: "tasks.update", method: http.MethodPut, pattern: "/api/tasks/{taskId:int}", serve: (*Server).updateTask},
+	{name: "tasks.patch", method: http.MethodPatch, pattern: "/api/tasks/{taskId:int}", serve: (*Server).patchTask},
+	{name: "tasks.history", method: http.MethodGet, pattern: "/api/tasks/{taskId:int}/history", serve: (*Server).handleTaskHistory},
+	{name: "export.tasks", method: http.MethodGet, pattern: "/api/export/tasks", serve: (*Server).handleExportTasks},
+	{name: "export.users", method: http.MethodGet, pattern: "/api/export/users", serve: (*Server).handleExportUsers},
+	{name: "export.history", method: http.MethodGet, pattern: "/api/export/history", serve: (*Server).handleExportHistory},
+	{name: "import", method: http.MethodPost, pattern: "/api/import", serve: (*Server).handleImport},
+	{name: "stats.get", method: http.MethodGet, pattern: "/api/stats", serve: (*Server).handleStats},
+	{name: "me.permissions", method: http.MethodGet, pattern: "/api/me/permissions", serve: (*Server).handleMyPermissions},
+	{name: "events.stream", method: http.MethodGet, pattern: "/api/events", serve: (*Server).handleEvents, stream: true},
+	{name: "ws.connect", method: http.MethodGet, pattern: "/api/ws", serve: (*Server).handleWebSocket, stream: true},
 }
 
-// Handler returns the fully configured HTTP handler chain.
-func (s *Server) Handler() http.Handler {
-	return s.handler
+// routes binds the route table to s.
+func (s *Server) routes() []route {
+	routes := make([]route, len(serverRoutes))
+	for i, r := range serverRoutes {
+		serve := r.serve
+		r.handler = func(w http.ResponseWriter, req *http.Request) { serve(s, w, req) }
+		routes[i] = r
+	}
+	return routes
 }
 
-func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-		return
-	}
+func (s *Server) handleNotFound(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, http.StatusNotFound, "not found")
+}
 
-	response := HealthResponse{
-		Status:  "ok",
-		Message: "Go backend is running",
-	}
+func (s *Server) handleMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
 
-	s.writeJSON(w, http.StatusOK, response)
+// handleBadPathParam rejects a typed path parameter that does not parse,
+// e.g. "invalid task ID" for {taskId:int}.
+func (s *Server) handleBadPathParam(w http.ResponseWriter, r *http.Request, param string) {
+	s.writeError(w, http.StatusBadRequest, "invalid "+strings.TrimSuffix(param, "Id")+" ID")
 }
 
-func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		users, err := s.dataStore.GetUsers()
-		if err != nil {
-			s.logger.Printf("error loading users: %v", err)
-			s.writeError(w, http.StatusInternalServerError, "internal server error")
-			return
-		}
-		response := UsersResponse{
-			Users: users,
-			Count: len(users),
-		}
-		s.writeJSON(w, http.StatusOK, response)
-	case http.MethodPost:
-		s.createUser(w, r)
-	default:
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+// EnableAuth requires credentials on /api/* as described by cfg. It is a
+// no-op when cfg has no credential sources.
+func (s *Server) EnableAuth(cfg AuthConfig) {
+	if cfg.Enabled() {
+		s.updateSettings(func(settings *serverSettings) { settings.auth = newAuthenticator(cfg) })
 	}
 }
 
-func (s *Server) handleUserByID(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+// Handler returns the fully configured HTTP handler chain.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.authorize(w, r, permUsersRead); !ok {
 		return
 	}
-
-	id, err := parseIDFromPath(r.URL.Path, "/api/users/")
+	users, err := s.dataStore.GetUsers(r.Context())
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid user ID")
+		s.logger.ErrorContext(r.Context(), "error loading users", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	response := UsersResponse{
+		Users: users,
+		Count: len(users),
+	}
+	// Users carry no change history, so the ETag is their only validator.
+	s.writeCollection(w, r, response, time.Time{})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	id := intPathParam(r, "userId")
+	if _, ok := s.authorize(w, r, permUsersRead); !ok {
 		return
 	}
 
-	user, ok, err := s.dataStore.GetUserByID(id)
+	user, ok, err := s.dataStore.GetUserByID(r.Context(), id)
 	if err != nil {
-		s.logger.Printf("error loading user id=%d: %v", id, err)
+		s.logger.ErrorContext(r.Context(), "error loading user", "user_id", id, "error", err)
 		s.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
@@ -139,164 +232,215 @@ func (s *Server) handleUserByID(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusOK, user)
 }
 
-func (s *Server) handleTasks(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		status := r.URL.Query().Get("status")
-		userID := r.URL.Query().Get("userId")
-		if userID != "" {
-			parsedUserID, err := strconv.Atoi(userID)
-			if err != nil || parsedUserID <= 0 {
-				s.writeError(w, http.StatusBadRequest, "invalid userId query parameter")
-				return
-			}
-		}
-
-		tasks, err := s.dataStore.GetTasks(status, userID)
-		if err != nil {
-			s.logger.Printf("error loading tasks: %v", err)
-			s.writeError(w, http.StatusInternalServerError, "internal server error")
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	userID := r.URL.Query().Get("userId")
+	if userID != "" {
+		parsedUserID, err := strconv.Atoi(userID)
+		if err != nil || parsedUserID <= 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid userId query parameter")
 			return
 		}
-		response := TasksResponse{
-			Tasks: tasks,
-			Count: len(tasks),
-		}
+	}
+	if _, ok := s.authorize(w, r, permTasksRead); !ok {
+		return
+	}
 
-		s.writeJSON(w, http.StatusOK, response)
-	case http.MethodPost:
-		s.createTask(w, r)
-	default:
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	tasks, err := s.dataStore.GetTasks(r.Context(), status, userID)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "error loading tasks", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	response := TasksResponse{
+		Tasks: tasks,
+		Count: len(tasks),
 	}
+
+	// A task changed to leave a filtered list is not in it, so only the whole
+	// list knows when it last changed.
+	var lastModified time.Time
+	if status == "" && userID == "" {
+		lastModified = latestTaskChange(tasks)
+	}
+	s.writeCollection(w, r, response, lastModified)
 }
 
-func (s *Server) handleTaskByID(w http.ResponseWriter, r *http.Request) {
-	if strings.HasSuffix(r.URL.Path, "/history") {
-		s.handleTaskHistory(w, r)
+func (s *Server) updateTask(w http.ResponseWriter, r *http.Request) {
+	taskID := intPathParam(r, "taskId")
+
+	if err := requireJSONContentType(r); err != nil {
+		s.writeError(w, http.StatusUnsupportedMediaType, err.Error())
 		return
 	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.settings.Load().limits.MaxBodyBytes)
 
-	if r.Method != http.MethodPut {
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	var req replaceTaskRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		s.writeDecodeError(w, err)
 		return
 	}
 
-	taskID, err := parseIDFromPath(r.URL.Path, "/api/tasks/")
+	update, err := req.validate()
 	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid task ID")
+		s.writeValidationError(w, err)
 		return
 	}
 
-	if err := requireJSONContentType(r); err != nil {
+	c, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	missing, err := s.checkTaskUpdate(r.Context(), c, taskID, update)
+	if err != nil {
+		status, message := s.taskUpdateError(r.Context(), taskID, err)
+		s.writeError(w, status, message)
+		return
+	}
+	if missing != "" {
+		s.writeForbidden(w, r, c, missing)
+		return
+	}
+
+	task, err := s.dataStore.UpdateTask(r.Context(), taskID, update, c.actor)
+	if err != nil {
+		status, message := s.taskUpdateError(r.Context(), taskID, err)
+		s.writeError(w, status, message)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, task)
+}
+
+// patchTask applies a JSON Merge Patch or JSON Patch to a task. The patch is
+// evaluated against the current task and only the fields it changes are
+// written; JSON Patch "test" operations fail with 409 Conflict.
+func (s *Server) patchTask(w http.ResponseWriter, r *http.Request) {
+	taskID := intPathParam(r, "taskId")
+
+	mediaType, err := requirePatchContentType(r)
+	if err != nil {
+		w.Header().Set("Accept-Patch", acceptPatch)
 		s.writeError(w, http.StatusUnsupportedMediaType, err.Error())
 		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, s.settings.Load().limits.MaxBodyBytes)
 
-	var req updateTaskRequest
-	if err := decodeJSONBody(r, &req); err != nil {
-		var maxBytesErr *http.MaxBytesError
-		if errors.As(err, &maxBytesErr) {
-			s.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
-			return
-		}
-		s.writeError(w, http.StatusBadRequest, normalizeJSONError(err))
+	var patch json.RawMessage
+	if err := decodeJSONBody(r, &patch); err != nil {
+		s.writeDecodeError(w, err)
 		return
 	}
 
-	if req.Title == nil && req.Status == nil && req.UserID == nil {
-		s.writeError(w, http.StatusBadRequest, "at least one field must be provided")
+	c, ok := s.authorize(w, r)
+	if !ok {
+		return
+	}
+	current, found, err := s.dataStore.GetTaskByID(r.Context(), taskID)
+	if err != nil {
+		status, message := s.taskUpdateError(r.Context(), taskID, err)
+		s.writeError(w, status, message)
+		return
+	}
+	if !found {
+		s.writeError(w, http.StatusNotFound, "task not found")
 		return
 	}
 
 	var update TaskUpdate
-	if req.Title != nil {
-		title := strings.TrimSpace(*req.Title)
-		if title == "" {
-			s.writeError(w, http.StatusBadRequest, "title cannot be empty")
-			return
-		}
-		update.Title = &title
+	if mediaType == jsonPatchContentType {
+		update, err = jsonPatchTask(current, patch)
+	} else {
+		update, err = mergePatchTask(current, patch)
+	}
+	var validationErr *ValidationError
+	switch {
+	case errors.As(err, &validationErr):
+		s.writeValidationError(w, err)
+		return
+	case errors.Is(err, errInvalidPatch):
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		status, message := s.taskUpdateError(r.Context(), taskID, err)
+		s.writeError(w, status, message)
+		return
 	}
 
-	if req.Status != nil {
-		status := strings.TrimSpace(*req.Status)
-		if !isValidTaskStatus(status) {
-			s.writeError(w, http.StatusBadRequest, "invalid status")
+	if s.settings.Load().policy != nil {
+		if missing := c.missingTaskUpdatePermission(current, update); missing != "" {
+			s.writeForbidden(w, r, c, missing)
 			return
 		}
-		update.Status = &status
 	}
 
-	if req.UserID != nil {
-		update.UserID = req.UserID
-	}
-
-	task, err := s.dataStore.UpdateTask(taskID, update, extractActor(r))
+	task, err := s.dataStore.UpdateTask(r.Context(), taskID, update, c.actor)
 	if err != nil {
-		switch {
-		case errors.Is(err, ErrTaskNotFound):
-			s.writeError(w, http.StatusNotFound, "task not found")
-		case errors.Is(err, ErrInvalidTaskStatus), errors.Is(err, ErrUserDoesNotExist):
-			s.writeError(w, http.StatusBadRequest, err.Error())
-		default:
-			s.logger.Printf("error updating task id=%d: %v", taskID, err)
-			s.writeError(w, http.StatusInternalServerError, "internal server error")
-		}
+		status, message := s.taskUpdateError(r.Context(), taskID, err)
+		s.writeError(w, status, message)
 		return
 	}
 
 	s.writeJSON(w, http.StatusOK, task)
 }
 
-func (s *Server) handleTaskHistory(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
-		return
+// taskUpdateError maps an UpdateTask failure to a status code and client-safe message.
+func (s *Server) taskUpdateError(ctx context.Context, taskID int, err error) (int, string) {
+	switch {
+	case errors.Is(err, ErrTaskNotFound):
+		return http.StatusNotFound, "task not found"
+	case errors.Is(err, ErrTaskConflict):
+		return http.StatusConflict, err.Error()
+	case errors.Is(err, ErrInvalidTaskStatus), errors.Is(err, ErrUserDoesNotExist):
+		return http.StatusBadRequest, err.Error()
+	default:
+		s.logger.ErrorContext(ctx, "error updating task", "task_id", taskID, "error", err)
+		return http.StatusInternalServerError, "internal server error"
 	}
+}
 
-	taskID, err := parseTaskHistoryIDFromPath(r.URL.Path, "/api/tasks/")
-	if err != nil {
-		s.writeError(w, http.StatusBadRequest, "invalid task ID")
+func (s *Server) handleTaskHistory(w http.ResponseWriter, r *http.Request) {
+	taskID := intPathParam(r, "taskId")
+	if _, ok := s.authorize(w, r, permTasksRead); !ok {
 		return
 	}
 
-	history, err := s.dataStore.GetTaskHistory(taskID)
+	history, err := s.dataStore.GetTaskHistory(r.Context(), taskID)
 	if err != nil {
 		if errors.Is(err, ErrTaskNotFound) {
 			s.writeError(w, http.StatusNotFound, "task not found")
 			return
 		}
-		s.logger.Printf("error loading task history id=%d: %v", taskID, err)
+		s.logger.ErrorContext(r.Context(), "error loading task history", "task_id", taskID, "error", err)
 		s.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
 
-	s.writeJSON(w, http.StatusOK, TaskHistoryResponse{
+	s.writeCollection(w, r, TaskHistoryResponse{
 		TaskID:  taskID,
 		History: history,
 		Count:   len(history),
-	})
+	}, latestHistoryChange(history))
 }
 
 func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	if _, ok := s.authorize(w, r, permStatsRead); !ok {
 		return
 	}
 
-	stats, err := s.dataStore.GetStats()
+	stats, err := s.dataStore.GetStats(r.Context())
 	if err != nil {
-		s.logger.Printf("error loading stats: %v", err)
+		s.logger.ErrorContext(r.Context(), "error loading stats", "error", err)
 		s.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
 	s.writeJSON(w, http.StatusOK, stats)
 }
 
-// Start runs the HTTP server on the provided port.
-func (s *Server) Start(port string) {
+// Start runs the HTTP server on cfg.Port until SIGINT or SIGTERM. With
+// EnableReload, SIGHUP reloads the configuration.
+func (s *Server) Start(cfg HTTPConfig) error {
+	port := cfg.Port
 	if port == "" {
 		port = defaultPort
 	}
@@ -304,24 +448,35 @@ func (s *Server) Start(port string) {
 	httpServer := &http.Server{
 		Addr:              ":" + port,
 		Handler:           s.handler,
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       10 * time.Second,
-		WriteTimeout:      15 * time.Second,
-		IdleTimeout:       60 * time.Second,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
 	}
 
-	log.Printf("Go backend server starting on http://localhost:%s", port)
-	log.Printf("Serving data from PostgreSQL-backed Go backend")
+	s.logger.Info("Go backend server starting", "addr", "http://localhost:"+port)
+	s.logger.Info("Serving data from PostgreSQL-backed Go backend")
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	if s.reloader != nil {
+		hangups := make(chan os.Signal, 1)
+		signal.Notify(hangups, syscall.SIGHUP)
+		defer signal.Stop(hangups)
+		go s.reloadOnSignal(ctx, hangups)
+	}
+
 	if err := s.runWithContext(ctx, httpServer, httpServer.ListenAndServe); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		return fmt.Errorf("serve: %w", err)
 	}
+	return nil
 }
 
 func (s *Server) runWithContext(ctx context.Context, httpServer *http.Server, serve func() error) error {
+	// Long-lived event streams would otherwise hold Shutdown open until its timeout.
+	httpServer.RegisterOnShutdown(s.closeStreams)
+
 	errCh := make(chan error, 1)
 	go func() {
 		errCh <- serve()
@@ -334,9 +489,18 @@ func (s *Server) runWithContext(ctx context.Context, httpServer *http.Server, se
 		}
 		return nil
 	case <-ctx.Done():
-		s.logger.Printf("shutdown signal received, shutting down server")
+		s.logger.Info("shutdown signal received, shutting down server")
+
+		// Fail readiness first so load balancers stop routing here before
+		// the listener closes.
+		s.draining.Store(true)
+		settings := s.settings.Load()
+		if settings.drainDelay > 0 {
+			s.logger.Info("draining before shutdown", "delay", settings.drainDelay)
+			time.Sleep(settings.drainDelay)
+		}
 
-		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), settings.shutdownTimeout)
 		defer cancel()
 
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
@@ -356,35 +520,25 @@ func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusUnsupportedMediaType, err.Error())
 		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, s.settings.Load().limits.MaxBodyBytes)
 
 	var req createUserRequest
 	if err := decodeJSONBody(r, &req); err != nil {
-		var maxBytesErr *http.MaxBytesError
-		if errors.As(err, &maxBytesErr) {
-			s.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
-			return
-		}
-		s.writeError(w, http.StatusBadRequest, normalizeJSONError(err))
+		s.writeDecodeError(w, err)
 		return
 	}
 
-	name := strings.TrimSpace(req.Name)
-	email := strings.TrimSpace(req.Email)
-	role := strings.TrimSpace(req.Role)
-
-	if name == "" || email == "" || role == "" {
-		s.writeError(w, http.StatusBadRequest, "name, email, and role are required")
+	if err := req.validate(); err != nil {
+		s.writeValidationError(w, err)
 		return
 	}
-	if !emailRegex.MatchString(email) {
-		s.writeError(w, http.StatusBadRequest, "invalid email format")
+	if _, ok := s.authorize(w, r, permUsersCreate); !ok {
 		return
 	}
 
-	user, err := s.dataStore.CreateUser(name, email, role)
+	user, err := s.dataStore.CreateUser(r.Context(), req.Name, req.Email, req.Role)
 	if err != nil {
-		s.logger.Printf("error creating user: %v", err)
+		s.logger.ErrorContext(r.Context(), "error creating user", "error", err)
 		s.writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
@@ -397,39 +551,36 @@ func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusUnsupportedMediaType, err.Error())
 		return
 	}
-	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodyBytes)
+	r.Body = http.MaxBytesReader(w, r.Body, s.settings.Load().limits.MaxBodyBytes)
 
 	var req createTaskRequest
 	if err := decodeJSONBody(r, &req); err != nil {
-		var maxBytesErr *http.MaxBytesError
-		if errors.As(err, &maxBytesErr) {
-			s.writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
-			return
-		}
-		s.writeError(w, http.StatusBadRequest, normalizeJSONError(err))
+		s.writeDecodeError(w, err)
 		return
 	}
 
-	title := strings.TrimSpace(req.Title)
-	status := strings.TrimSpace(req.Status)
-
-	if title == "" || status == "" || req.UserID == nil {
-		s.writeError(w, http.StatusBadRequest, "title, status, and userId are required")
+	if err := req.validate(); err != nil {
+		s.writeValidationError(w, err)
 		return
 	}
 
-	if !isValidTaskStatus(status) {
-		s.writeError(w, http.StatusBadRequest, "invalid status")
+	c, ok := s.authorize(w, r, permTasksCreate)
+	if !ok {
+		return
+	}
+	// Creating a task for someone else assigns it to them.
+	if s.settings.Load().policy != nil && *req.UserID != c.userID && !c.can(permTasksAssign) {
+		s.writeForbidden(w, r, c, permTasksAssign)
 		return
 	}
 
-	task, err := s.dataStore.CreateTask(title, status, *req.UserID, extractActor(r))
+	task, err := s.dataStore.CreateTask(r.Context(), req.Title, req.Status, *req.UserID, c.actor)
 	if err != nil {
 		switch {
 		case errors.Is(err, ErrInvalidTaskStatus), errors.Is(err, ErrUserDoesNotExist):
 			s.writeError(w, http.StatusBadRequest, err.Error())
 		default:
-			s.logger.Printf("error creating task: %v", err)
+			s.logger.ErrorContext(r.Context(), "error creating task", "error", err)
 			s.writeError(w, http.StatusInternalServerError, "internal server error")
 		}
 		return
@@ -438,26 +589,11 @@ func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, http.StatusCreated, task)
 }
 
-func (s *Server) corsMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Actor")
-		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,OPTIONS")
-
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		next.ServeHTTP(w, r)
-	})
-}
-
 func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				s.logger.Printf("panic recovered method=%s path=%s err=%v", r.Method, r.URL.Path, rec)
+				s.logger.ErrorContext(r.Context(), "panic recovered", "method", r.Method, "path", r.URL.Path, "error", rec)
 				s.writeError(w, http.StatusInternalServerError, "internal server error")
 			}
 		}()
@@ -466,6 +602,7 @@ func (s *Server) recoveryMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// loggingMiddleware logs each request and records its HTTP metrics.
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -477,13 +614,27 @@ func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 		if status == 0 {
 			status = http.StatusOK
 		}
+		duration := time.Since(start)
+		route, _ := s.routeInfo(r)
+		s.metrics.observeRequest(route, r.Method, status, duration)
 
-		s.logger.Printf(
-			"request method=%s path=%s status=%d duration=%s",
-			r.Method,
-			r.URL.Path,
-			status,
-			time.Since(start),
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case route == "livez" || route == "readyz":
+			// Probes run every few seconds; keep them out of info-level logs.
+			level = slog.LevelDebug
+		}
+		s.logger.LogAttrs(
+			r.Context(),
+			level,
+			"request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", status),
+			slog.Duration("duration", duration),
 		)
 	})
 }
@@ -493,54 +644,27 @@ func (s *Server) writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.WriteHeader(status)
 
 	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		s.logger.Printf("failed to encode JSON response: %v", err)
+		s.logger.Error("failed to encode JSON response", "error", err)
 	}
 }
 
-func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
-	s.writeJSON(w, status, map[string]string{
-		"error": message,
-	})
-}
-
-func parseIDFromPath(path, prefix string) (int, error) {
-	idPart := strings.TrimPrefix(path, prefix)
-	if idPart == "" || strings.Contains(idPart, "/") {
-		return 0, errors.New("invalid id")
-	}
-
-	id, err := strconv.Atoi(idPart)
-	if err != nil || id <= 0 {
-		return 0, errors.New("invalid id")
-	}
-
-	return id, nil
-}
-
-func parseTaskHistoryIDFromPath(path, prefix string) (int, error) {
-	idPart := strings.TrimPrefix(path, prefix)
-	if idPart == "" || !strings.HasSuffix(idPart, "/history") {
-		return 0, errors.New("invalid id")
-	}
-	idPart = strings.TrimSuffix(idPart, "/history")
-	if idPart == "" || strings.Contains(idPart, "/") {
-		return 0, errors.New("invalid id")
-	}
-
-	id, err := strconv.Atoi(idPart)
-	if err != nil || id <= 0 {
-		return 0, errors.New("invalid id")
+// extractActor returns who is acting: the authenticated subject, or the
+// X-Actor header when authentication is off or the principal may delegate.
+func extractActor(r *http.Request) string {
+	principal, authenticated := principalFromContext(r.Context())
+	if authenticated && !principal.Delegating {
+		return principal.Subject
 	}
 
-	return id, nil
-}
-
-func extractActor(r *http.Request) string {
 	actor := strings.TrimSpace(r.Header.Get(actorHeaderName))
-	if actor == "" {
+	switch {
+	case actor != "":
+		return actor
+	case authenticated:
+		return principal.Subject
+	default:
 		return defaultActorName
 	}
-	return actor
 }
 
 func decodeJSONBody(r *http.Request, dst any) error {
@@ -548,8 +672,13 @@ func decodeJSONBody(r *http.Request, dst any) error {
 		return errors.New("request body is required")
 	}
 	defer r.Body.Close()
+	return decodeJSON(r.Body, dst)
+}
 
-	decoder := json.NewDecoder(r.Body)
+// decodeJSON decodes exactly one JSON value from body into dst, rejecting
+// unknown fields.
+func decodeJSON(body io.Reader, dst any) error {
+	decoder := json.NewDecoder(body)
 	decoder.DisallowUnknownFields()
 
 	if err := decoder.Decode(dst); err != nil {
@@ -587,6 +716,20 @@ func requireJSONContentType(r *http.Request) error {
 	return nil
 }
 
+// requirePatchContentType returns the patch format of r: merge patch or JSON Patch.
+func requirePatchContentType(r *http.Request) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case r.Header.Get("Content-Type") == "":
+		return "", errors.New("content type must be " + mergePatchContentType + " or " + jsonPatchContentType)
+	case err != nil:
+		return "", errors.New("invalid content type header")
+	case mediaType != mergePatchContentType && mediaType != jsonPatchContentType:
+		return "", errors.New("content type must be " + mergePatchContentType + " or " + jsonPatchContentType)
+	}
+	return mediaType, nil
+}
+
 func normalizeJSONError(err error) string {
 	var syntaxErr *json.SyntaxError
 	if errors.As(err, &syntaxErr) {
@@ -624,3 +767,17 @@ func (sr *statusRecorder) Write(p []byte) (int, error) {
 	}
 	return sr.ResponseWriter.Write(p)
 }
+
+// Hijack lets WebSocket upgrades take over the connection through the middleware chain.
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(sr.ResponseWriter).Hijack()
+	if err == nil && sr.status == 0 {
+		sr.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
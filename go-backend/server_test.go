@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -166,7 +165,7 @@ func TestGETUserByID(t *testing.T) {
 
 func TestGETUsersReadErrorReturnsInternalServerError(t *testing.T) {
 	s := NewServer(&errorReadStore{usersErr: errors.New("db unavailable")})
-	s.logger = log.New(io.Discard, "", 0)
+	s.logger = discardLogger()
 
 	res := performRequest(s.Handler(), http.MethodGet, "/api/users", "")
 	if res.Code != http.StatusInternalServerError {
@@ -176,7 +175,7 @@ func TestGETUsersReadErrorReturnsInternalServerError(t *testing.T) {
 
 func TestGETUserByIDReadErrorReturnsInternalServerError(t *testing.T) {
 	s := NewServer(&errorReadStore{userByIDErr: errors.New("db unavailable")})
-	s.logger = log.New(io.Discard, "", 0)
+	s.logger = discardLogger()
 
 	res := performRequest(s.Handler(), http.MethodGet, "/api/users/1", "")
 	if res.Code != http.StatusInternalServerError {
@@ -234,7 +233,7 @@ func TestGETTasksAndStats(t *testing.T) {
 
 func TestGETTasksReadErrorReturnsInternalServerError(t *testing.T) {
 	s := NewServer(&errorReadStore{tasksErr: errors.New("db unavailable")})
-	s.logger = log.New(io.Discard, "", 0)
+	s.logger = discardLogger()
 
 	res := performRequest(s.Handler(), http.MethodGet, "/api/tasks", "")
 	if res.Code != http.StatusInternalServerError {
@@ -244,7 +243,7 @@ func TestGETTasksReadErrorReturnsInternalServerError(t *testing.T) {
 
 func TestGETStatsReadErrorReturnsInternalServerError(t *testing.T) {
 	s := NewServer(&errorReadStore{statsErr: errors.New("db unavailable")})
-	s.logger = log.New(io.Discard, "", 0)
+	s.logger = discardLogger()
 
 	res := performRequest(s.Handler(), http.MethodGet, "/api/stats", "")
 	if res.Code != http.StatusInternalServerError {
@@ -252,14 +251,14 @@ func TestGETStatsReadErrorReturnsInternalServerError(t *testing.T) {
 	}
 }
 
-func TestPUTTaskByIDPartialUpdate(t *testing.T) {
+func TestPUTTaskByIDReplacesTask(t *testing.T) {
 	s := newTestServer(t)
 
 	updateRes := performRequestWithHeaders(
 		s.Handler(),
 		http.MethodPut,
 		"/api/tasks/1",
-		`{"status":"completed"}`,
+		`{"title":"Write docs","status":"completed","userId":1}`,
 		map[string]string{actorHeaderName: "admin"},
 	)
 	if updateRes.Code != http.StatusOK {
@@ -268,11 +267,8 @@ func TestPUTTaskByIDPartialUpdate(t *testing.T) {
 
 	var updated Task
 	decodeJSONResponse(t, updateRes.Body.Bytes(), &updated)
-	if updated.Status != "completed" {
-		t.Fatalf("expected status completed, got %s", updated.Status)
-	}
-	if updated.Title == "" {
-		t.Fatalf("expected title to remain populated")
+	if updated.Title != "Write docs" || updated.Status != "completed" || updated.UserID != 1 {
+		t.Fatalf("expected the task to be replaced, got %+v", updated)
 	}
 	if updated.LastChange == nil {
 		t.Fatal("expected lastChange after update")
@@ -280,31 +276,28 @@ func TestPUTTaskByIDPartialUpdate(t *testing.T) {
 	if updated.LastChange.ChangedBy != "admin" {
 		t.Fatalf("expected changedBy admin, got %q", updated.LastChange.ChangedBy)
 	}
-	if updated.LastChange.Field != "status" {
-		t.Fatalf("expected last change field status, got %q", updated.LastChange.Field)
-	}
 
-	notFound := performRequest(s.Handler(), http.MethodPut, "/api/tasks/999", `{"status":"completed"}`)
+	notFound := performRequest(s.Handler(), http.MethodPut, "/api/tasks/999", `{"title":"T","status":"completed","userId":1}`)
 	if notFound.Code != http.StatusNotFound {
 		t.Fatalf("expected status %d, got %d", http.StatusNotFound, notFound.Code)
 	}
 
-	invalidBody := performRequest(s.Handler(), http.MethodPut, "/api/tasks/1", `{}`)
-	if invalidBody.Code != http.StatusBadRequest {
-		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, invalidBody.Code)
+	partial := performRequest(s.Handler(), http.MethodPut, "/api/tasks/1", `{"status":"completed"}`)
+	if partial.Code != http.StatusBadRequest {
+		t.Fatalf("expected partial replacement to be rejected, got %d", partial.Code)
 	}
 
-	invalidStatus := performRequest(s.Handler(), http.MethodPut, "/api/tasks/1", `{"status":"bad"}`)
+	invalidStatus := performRequest(s.Handler(), http.MethodPut, "/api/tasks/1", `{"title":"T","status":"bad","userId":1}`)
 	if invalidStatus.Code != http.StatusBadRequest {
 		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, invalidStatus.Code)
 	}
 
-	unknownField := performRequest(s.Handler(), http.MethodPut, "/api/tasks/1", `{"status":"completed","bad":true}`)
+	unknownField := performRequest(s.Handler(), http.MethodPut, "/api/tasks/1", `{"title":"T","status":"completed","userId":1,"bad":true}`)
 	if unknownField.Code != http.StatusBadRequest {
 		t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, unknownField.Code, unknownField.Body.String())
 	}
 
-	invalidID := performRequest(s.Handler(), http.MethodPut, "/api/tasks/not-an-id", `{"status":"completed"}`)
+	invalidID := performRequest(s.Handler(), http.MethodPut, "/api/tasks/not-an-id", `{"title":"T","status":"completed","userId":1}`)
 	if invalidID.Code != http.StatusBadRequest {
 		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, invalidID.Code)
 	}
@@ -315,14 +308,14 @@ func TestGETTaskHistory(t *testing.T) {
 
 	_ = performRequestWithHeaders(
 		s.Handler(),
-		http.MethodPut,
+		http.MethodPatch,
 		"/api/tasks/1",
 		`{"status":"in-progress"}`,
 		map[string]string{actorHeaderName: "alice"},
 	)
 	_ = performRequestWithHeaders(
 		s.Handler(),
-		http.MethodPut,
+		http.MethodPatch,
 		"/api/tasks/1",
 		`{"status":"completed"}`,
 		map[string]string{actorHeaderName: "bob"},
@@ -358,7 +351,7 @@ func TestGETTaskHistory(t *testing.T) {
 
 func TestGETTaskHistoryReadErrorReturnsInternalServerError(t *testing.T) {
 	s := NewServer(&errorReadStore{historyErr: errors.New("db unavailable")})
-	s.logger = log.New(io.Discard, "", 0)
+	s.logger = discardLogger()
 
 	res := performRequest(s.Handler(), http.MethodGet, "/api/tasks/1/history", "")
 	if res.Code != http.StatusInternalServerError {
@@ -369,15 +362,13 @@ func TestGETTaskHistoryReadErrorReturnsInternalServerError(t *testing.T) {
 func TestMethodNotAllowedReturnsJSONError(t *testing.T) {
 	s := newTestServer(t)
 
-	res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`)
+	res := performRequest(s.Handler(), http.MethodDelete, "/api/tasks/1", "")
 	if res.Code != http.StatusMethodNotAllowed {
 		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, res.Code)
 	}
 
-	var errResp map[string]string
-	decodeJSONResponse(t, res.Body.Bytes(), &errResp)
-	if errResp["error"] == "" {
-		t.Fatalf("expected error message in response, got %v", errResp)
+	if errResp := decodeProblem(t, res); errResp.Detail == "" {
+		t.Fatalf("expected error message in response, got %+v", errResp)
 	}
 
 	healthMethod := performRequest(s.Handler(), http.MethodPost, "/health", "{}")
@@ -396,6 +387,11 @@ func TestCORSOptionsRequest(t *testing.T) {
 	if res.Header().Get("Access-Control-Allow-Origin") != "*" {
 		t.Fatalf("expected CORS allow-origin header, got %q", res.Header().Get("Access-Control-Allow-Origin"))
 	}
+
+	res = performRequest(s.Handler(), http.MethodOptions, "/api/unknown", "")
+	if res.Code != http.StatusNotFound || res.Header().Get("Allow") != "" {
+		t.Fatalf("expected an unknown path to get 404 without Allow, got %d %v", res.Code, res.Header())
+	}
 }
 
 func TestInvalidJSONAndTypeErrors(t *testing.T) {
@@ -478,10 +474,8 @@ func TestWriteEndpointsRejectMalformedContentTypeHeader(t *testing.T) {
 		t.Fatalf("expected status %d, got %d body=%s", http.StatusUnsupportedMediaType, res.Code, res.Body.String())
 	}
 
-	var errResp map[string]string
-	decodeJSONResponse(t, res.Body.Bytes(), &errResp)
-	if errResp["error"] != "invalid content type header" {
-		t.Fatalf("expected malformed content-type message, got %q", errResp["error"])
+	if errResp := decodeProblem(t, res); errResp.Detail != "invalid content type header" {
+		t.Fatalf("expected malformed content-type message, got %q", errResp.Detail)
 	}
 }
 
@@ -495,10 +489,8 @@ func TestRequestBodyTooLarge(t *testing.T) {
 		t.Fatalf("expected status %d, got %d body=%s", http.StatusRequestEntityTooLarge, res.Code, res.Body.String())
 	}
 
-	var errResp map[string]string
-	decodeJSONResponse(t, res.Body.Bytes(), &errResp)
-	if errResp["error"] == "" {
-		t.Fatalf("expected error payload, got %v", errResp)
+	if errResp := decodeProblem(t, res); errResp.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected problem payload, got %+v", errResp)
 	}
 }
 
@@ -515,49 +507,6 @@ func TestRecoveryMiddleware(t *testing.T) {
 	}
 }
 
-func TestParseIDFromPath(t *testing.T) {
-	id, err := parseIDFromPath("/api/tasks/123", "/api/tasks/")
-	if err != nil {
-		t.Fatalf("expected valid ID parse, got %v", err)
-	}
-	if id != 123 {
-		t.Fatalf("expected ID 123, got %d", id)
-	}
-
-	if _, err := parseIDFromPath("/api/tasks/", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for empty ID")
-	}
-	if _, err := parseIDFromPath("/api/tasks/12/extra", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for nested path")
-	}
-	if _, err := parseIDFromPath("/api/tasks/not-int", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for non-integer ID")
-	}
-}
-
-func TestParseTaskHistoryIDFromPath(t *testing.T) {
-	id, err := parseTaskHistoryIDFromPath("/api/tasks/123/history", "/api/tasks/")
-	if err != nil {
-		t.Fatalf("expected valid ID parse, got %v", err)
-	}
-	if id != 123 {
-		t.Fatalf("expected ID 123, got %d", id)
-	}
-
-	if _, err := parseTaskHistoryIDFromPath("/api/tasks/123", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for missing /history suffix")
-	}
-	if _, err := parseTaskHistoryIDFromPath("/api/tasks//history", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for empty task ID")
-	}
-	if _, err := parseTaskHistoryIDFromPath("/api/tasks/12/extra/history", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for nested path")
-	}
-	if _, err := parseTaskHistoryIDFromPath("/api/tasks/not-int/history", "/api/tasks/"); err == nil {
-		t.Fatal("expected error for non-integer ID")
-	}
-}
-
 func TestDecodeJSONBodyNilBody(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/api/users", nil)
 	req.Body = nil
@@ -589,7 +538,7 @@ func TestLoggingMiddlewareLogsMethodPathStatus(t *testing.T) {
 	s := newTestServer(t)
 
 	var logBuffer bytes.Buffer
-	s.logger = log.New(&logBuffer, "", 0)
+	s.logger = newTestLogger(t, &logBuffer, "text")
 
 	res := performRequest(s.Handler(), http.MethodGet, "/health", "")
 	if res.Code != http.StatusOK {
@@ -673,7 +622,7 @@ func newTestServer(t *testing.T) *Server {
 	)
 
 	s := NewServer(ds)
-	s.logger = log.New(io.Discard, "", 0)
+	s.logger = discardLogger()
 	return s
 }
 
@@ -694,7 +643,9 @@ func performRequestWithHeaders(
 	}
 
 	req := httptest.NewRequest(method, path, requestBody)
-	if body != "" {
+	if body != "" && method == http.MethodPatch {
+		req.Header.Set("Content-Type", mergePatchContentType)
+	} else if body != "" {
 		req.Header.Set("Content-Type", "application/json")
 	}
 	for key, value := range headers {
@@ -718,53 +669,68 @@ type errorReadStore struct {
 	usersErr    error
 	userByIDErr error
 	tasksErr    error
+	taskByIDErr error
 	statsErr    error
 	historyErr  error
 }
 
-func (s *errorReadStore) GetUsers() ([]User, error) {
+func (s *errorReadStore) GetUsers(ctx context.Context) ([]User, error) {
 	if s.usersErr != nil {
 		return nil, s.usersErr
 	}
 	return []User{}, nil
 }
 
-func (s *errorReadStore) GetUserByID(id int) (User, bool, error) {
+func (s *errorReadStore) GetUserByID(ctx context.Context, id int) (User, bool, error) {
 	if s.userByIDErr != nil {
 		return User{}, false, s.userByIDErr
 	}
 	return User{}, false, nil
 }
 
-func (s *errorReadStore) GetTasks(status, userID string) ([]Task, error) {
+func (s *errorReadStore) GetUserByEmail(ctx context.Context, email string) (User, bool, error) {
+	if s.userByIDErr != nil {
+		return User{}, false, s.userByIDErr
+	}
+	return User{}, false, nil
+}
+
+func (s *errorReadStore) GetTasks(ctx context.Context, status, userID string) ([]Task, error) {
 	if s.tasksErr != nil {
 		return nil, s.tasksErr
 	}
 	return []Task{}, nil
 }
 
-func (s *errorReadStore) GetStats() (StatsResponse, error) {
+func (s *errorReadStore) GetTaskByID(ctx context.Context, id int) (Task, bool, error) {
+	if s.taskByIDErr != nil {
+		return Task{}, false, s.taskByIDErr
+	}
+	return Task{}, false, nil
+}
+
+func (s *errorReadStore) GetStats(ctx context.Context) (StatsResponse, error) {
 	if s.statsErr != nil {
 		return StatsResponse{}, s.statsErr
 	}
 	return StatsResponse{}, nil
 }
 
-func (s *errorReadStore) GetTaskHistory(taskID int) ([]TaskHistoryItem, error) {
+func (s *errorReadStore) GetTaskHistory(ctx context.Context, taskID int) ([]TaskHistoryItem, error) {
 	if s.historyErr != nil {
 		return nil, s.historyErr
 	}
 	return []TaskHistoryItem{}, nil
 }
 
-func (s *errorReadStore) CreateUser(name, email, role string) (User, error) {
+func (s *errorReadStore) CreateUser(ctx context.Context, name, email, role string) (User, error) {
 	return User{}, nil
 }
 
-func (s *errorReadStore) CreateTask(title, status string, userID int, actor string) (Task, error) {
+func (s *errorReadStore) CreateTask(ctx context.Context, title, status string, userID int, actor string) (Task, error) {
 	return Task{}, nil
 }
 
-func (s *errorReadStore) UpdateTask(id int, update TaskUpdate, actor string) (Task, error) {
+func (s *errorReadStore) UpdateTask(ctx context.Context, id int, update TaskUpdate, actor string) (Task, error) {
 	return Task{}, nil
 }
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEventHeartbeat = 15 * time.Second
+	eventRetryMillis      = 3000
+	// maxEventReplay is how many history entries a replay reads at a time,
+	// and maxEventReplayPages how many pages a client may be behind before
+	// it is told to reset instead.
+	maxEventReplay      = 500
+	maxEventReplayPages = 20
+	lastEventIDHeader   = "Last-Event-ID"
+	// sseResetEvent tells a client that missed changes cannot be replayed,
+	// so it should refetch what it shows.
+	sseResetEvent = "reset"
+)
+
+// handleEvents streams change events to the client as Server-Sent Events.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseEventFilter(r.URL.Query())
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.WorkspaceID = workspaceFromContext(r.Context())
+	if _, ok := s.authorize(w, r, permTasksRead); !ok {
+		return
+	}
+
+	lastEventID := 0
+	if raw := strings.TrimSpace(r.Header.Get(lastEventIDHeader)); raw != "" {
+		lastEventID, err = strconv.Atoi(raw)
+		if err != nil || lastEventID < 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid Last-Event-ID header")
+			return
+		}
+	}
+
+	// The server-wide WriteTimeout would otherwise cut the stream off.
+	controller := http.NewResponseController(w)
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	// Subscribe before replaying so nothing committed in between is missed.
+	events, unsubscribe := s.events.Subscribe(filter)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis); err != nil {
+		return
+	}
+
+	// Live events at or below this ID were already covered by the replay.
+	replayedThrough := lastEventID
+	if lastEventID > 0 {
+		replayedThrough, err = s.replayEvents(r.Context(), w, lastEventID, filter)
+		if err != nil {
+			return
+		}
+	}
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(s.settings.Load().eventHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.streamsCtx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				// Dropped for falling behind; the client reconnects with Last-Event-ID.
+				return
+			}
+			if event.ID != 0 && event.ID <= replayedThrough {
+				continue
+			}
+			if err := writeSSEEvent(w, event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// replayEvents writes the task events recorded after lastEventID, a page at
+// a time until it reaches the present, and returns the history ID they run
+// through. The subscription is already open, so later changes arrive live.
+// If history cannot be read, or the client is more than maxEventReplayPages
+// behind, it writes a reset event instead of the rest. Errors are write
+// errors: the client has gone.
+func (s *Server) replayEvents(ctx context.Context, w http.ResponseWriter, lastEventID int, filter EventFilter) (int, error) {
+	through := lastEventID
+	if s.history == nil {
+		return through, nil
+	}
+	for pages := 0; pages < maxEventReplayPages; pages++ {
+		page, err := replayHistory(ctx, s.history, through, maxEventReplay, filter)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "error replaying events", "last_event_id", lastEventID, "after_id", through, "error", err)
+			return through, writeSSEReset(w, filter.WorkspaceID)
+		}
+		for _, event := range page.events {
+			if err := writeSSEEvent(w, event); err != nil {
+				return through, err
+			}
+		}
+		through = page.through
+		if !page.more {
+			return through, nil
+		}
+	}
+	s.logger.InfoContext(ctx, "client too far behind to replay events", "last_event_id", lastEventID, "after_id", through)
+	return through, writeSSEReset(w, filter.WorkspaceID)
+}
+
+// writeSSEReset sends a reset event. Its empty id clears the client's last
+// event ID, so reconnecting does not attempt the same replay again.
+func writeSSEReset(w http.ResponseWriter, workspaceID string) error {
+	data, err := json.Marshal(ChangeEvent{Type: sseResetEvent, WorkspaceID: workspaceID, OccurredAt: time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id\nevent: %s\ndata: %s\n\n", sseResetEvent, data)
+	return err
+}
+
+func writeSSEEvent(w http.ResponseWriter, event ChangeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	if event.ID != 0 {
+		fmt.Fprintf(&b, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(&b, "event: %s\n", event.Type)
+	fmt.Fprintf(&b, "data: %s\n\n", data)
+
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
+
+func parseEventFilter(query url.Values) (EventFilter, error) {
+	var filter EventFilter
+	if raw := query.Get("taskId"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return EventFilter{}, errors.New("invalid taskId query parameter")
+		}
+		filter.TaskID = id
+	}
+	if raw := query.Get("userId"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return EventFilter{}, errors.New("invalid userId query parameter")
+		}
+		filter.UserID = id
+	}
+	return filter, nil
+}
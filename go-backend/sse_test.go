@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseMessage struct {
+	id      string
+	event   string
+	data    string
+	comment string
+	// clearsID is set by an "id" field with no value.
+	clearsID bool
+}
+
+func TestEventsStreamDeliversFilteredChanges(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	stream := openEventStream(t, ts.URL+"/api/events?taskId=1", nil)
+
+	ignored := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/2", `{"status":"completed"}`)
+	if ignored.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, ignored.Code)
+	}
+	updated := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"in-progress"}`)
+	if updated.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, updated.Code)
+	}
+
+	msg := readSSEMessage(t, stream)
+	if msg.event != EventTaskUpdated {
+		t.Fatalf("expected %s event, got %q", EventTaskUpdated, msg.event)
+	}
+	if msg.id != "2" {
+		t.Fatalf("expected event id 2 (second history entry), got %q", msg.id)
+	}
+
+	var event ChangeEvent
+	decodeJSONResponse(t, []byte(msg.data), &event)
+	if event.TaskID != 1 || event.Task == nil || event.Task.Status != "in-progress" {
+		t.Fatalf("unexpected event payload: %+v", event)
+	}
+	if event.Change == nil || event.Change.Field != "status" {
+		t.Fatalf("expected status change in payload, got %+v", event.Change)
+	}
+}
+
+func TestEventsStreamDeliversUserCreated(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	stream := openEventStream(t, ts.URL+"/api/events?userId=4", nil)
+
+	res := performRequest(s.Handler(), http.MethodPost, "/api/users", `{"name":"New","email":"new@example.com","role":"developer"}`)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, res.Code)
+	}
+
+	msg := readSSEMessage(t, stream)
+	if msg.event != EventUserCreated {
+		t.Fatalf("expected %s event, got %q", EventUserCreated, msg.event)
+	}
+	if msg.id != "" {
+		t.Fatalf("expected user event without id, got %q", msg.id)
+	}
+}
+
+func TestEventsStreamResumesFromLastEventID(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	for _, body := range []string{`{"status":"in-progress"}`, `{"status":"completed"}`} {
+		res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", body)
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+		}
+	}
+
+	stream := openEventStream(t, ts.URL+"/api/events?userId=1", map[string]string{lastEventIDHeader: "1"})
+
+	msg := readSSEMessage(t, stream)
+	if msg.id != "2" || msg.event != EventTaskUpdated {
+		t.Fatalf("expected replayed event 2, got id=%q event=%q", msg.id, msg.event)
+	}
+
+	var event ChangeEvent
+	decodeJSONResponse(t, []byte(msg.data), &event)
+	if event.UserID != 1 || event.Change == nil || event.Change.ToValue != "completed" {
+		t.Fatalf("unexpected replayed payload: %+v", event)
+	}
+
+	created := performRequest(s.Handler(), http.MethodPost, "/api/tasks", `{"title":"Next","status":"pending","userId":1}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, created.Code)
+	}
+
+	live := readSSEMessage(t, stream)
+	if live.id != "3" || live.event != EventTaskCreated {
+		t.Fatalf("expected live event 3 after replay, got id=%q event=%q", live.id, live.event)
+	}
+}
+
+func TestEventsStreamReplaysMultiFieldUpdatesAsOneEvent(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"in-progress"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	live := openEventStream(t, ts.URL+"/api/events?taskId=1", nil)
+	res = performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"title":"Renamed","status":"completed"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	want := readSSEMessage(t, live)
+	if want.id != "3" {
+		t.Fatalf("expected the live event to carry the update's last entry 3, got %q", want.id)
+	}
+
+	resumed := openEventStream(t, ts.URL+"/api/events?taskId=1", map[string]string{lastEventIDHeader: "1"})
+	got := readSSEMessage(t, resumed)
+	if got.id != want.id || got.event != want.event {
+		t.Fatalf("expected the replay to match live event id=%q event=%q, got id=%q event=%q", want.id, want.event, got.id, got.event)
+	}
+	var event ChangeEvent
+	decodeJSONResponse(t, []byte(got.data), &event)
+	if event.UserID != 1 || event.Change == nil || event.Change.Field != "status" {
+		t.Fatalf("unexpected replayed payload: %+v", event)
+	}
+
+	// The next event is the next update's, not the rest of the first one.
+	res = performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"pending"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if next := readSSEMessage(t, resumed); next.id != "4" {
+		t.Fatalf("expected live event 4 after the replay, got id=%q", next.id)
+	}
+}
+
+func TestEventsStreamReplaysMoreThanOnePage(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	ctx := context.Background()
+	statuses := []string{"in-progress", "pending"}
+	var ids []int
+	for i := 0; i < maxEventReplay+100; i++ {
+		task, err := s.dataStore.UpdateTask(ctx, 1, TaskUpdate{Status: &statuses[i%2]}, "tester")
+		if err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+		ids = append(ids, task.LastChange.ID)
+	}
+
+	stream := openEventStream(t, ts.URL+"/api/events?taskId=1", map[string]string{lastEventIDHeader: strconv.Itoa(ids[0])})
+	for _, want := range ids[1:] {
+		if msg := readSSEMessage(t, stream); msg.id != strconv.Itoa(want) {
+			t.Fatalf("expected replayed event %d, got id=%q event=%q", want, msg.id, msg.event)
+		}
+	}
+
+	task, err := s.dataStore.UpdateTask(ctx, 1, TaskUpdate{Status: &statuses[0]}, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := readSSEMessage(t, stream); msg.id != strconv.Itoa(task.LastChange.ID) {
+		t.Fatalf("expected live event %d after the replay, got id=%q", task.LastChange.ID, msg.id)
+	}
+}
+
+func TestEventsStreamResetsWhenReplayFails(t *testing.T) {
+	s := newTestServer(t)
+	s.history = failingHistoryFeed{}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"in-progress"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	stream := openEventStream(t, ts.URL+"/api/events", map[string]string{lastEventIDHeader: "1"})
+	msg := readSSEMessage(t, stream)
+	if msg.event != sseResetEvent || !msg.clearsID {
+		t.Fatalf("expected a reset event that clears the last event ID, got %+v", msg)
+	}
+
+	res = performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	if msg := readSSEMessage(t, stream); msg.event != EventTaskUpdated {
+		t.Fatalf("expected live events after the reset, got %+v", msg)
+	}
+}
+
+type failingHistoryFeed struct{}
+
+func (failingHistoryFeed) GetTaskHistorySince(context.Context, int, int) ([]TaskHistoryItem, error) {
+	return nil, errors.New("history unavailable")
+}
+
+func (failingHistoryFeed) GetTaskOwners(context.Context, []int) (map[int]int, error) {
+	return nil, errors.New("history unavailable")
+}
+
+func TestEventsStreamSendsHeartbeats(t *testing.T) {
+	s := newTestServer(t)
+	s.updateSettings(func(settings *serverSettings) { settings.eventHeartbeat = 10 * time.Millisecond })
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	stream := openEventStream(t, ts.URL+"/api/events", nil)
+
+	msg := readSSEMessage(t, stream)
+	if msg.comment != "heartbeat" {
+		t.Fatalf("expected heartbeat comment, got %+v", msg)
+	}
+}
+
+func TestEventsStreamRejectsInvalidParameters(t *testing.T) {
+	s := newTestServer(t)
+
+	testCases := []struct {
+		name    string
+		path    string
+		headers map[string]string
+	}{
+		{name: "invalid taskId", path: "/api/events?taskId=abc"},
+		{name: "invalid userId", path: "/api/events?userId=0"},
+		{name: "invalid Last-Event-ID", path: "/api/events", headers: map[string]string{lastEventIDHeader: "nope"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := performRequestWithHeaders(s.Handler(), http.MethodGet, tc.path, "", tc.headers)
+			if res.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d body=%s", http.StatusBadRequest, res.Code, res.Body.String())
+			}
+		})
+	}
+
+	notAllowed := performRequest(s.Handler(), http.MethodPost, "/api/events", `{}`)
+	if notAllowed.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, notAllowed.Code)
+	}
+}
+
+func TestEventsStreamClosesOnGracefulShutdown(t *testing.T) {
+	s := newTestServer(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	httpServer := &http.Server{Handler: s.Handler()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runErrCh := make(chan error, 1)
+	go func() {
+		runErrCh <- s.runWithContext(ctx, httpServer, func() error {
+			return httpServer.Serve(listener)
+		})
+	}()
+
+	stream := openEventStream(t, "http://"+listener.Addr().String()+"/api/events", nil)
+
+	cancel()
+
+	select {
+	case runErr := <-runErrCh:
+		if runErr != nil {
+			t.Fatalf("expected clean shutdown, got error: %v", runErr)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for graceful shutdown with open event stream")
+	}
+
+	if _, err := stream.ReadString('\n'); err == nil {
+		t.Fatal("expected event stream to be closed after shutdown")
+	}
+}
+
+// openEventStream connects to an SSE endpoint and consumes the initial retry
+// preamble, which is only written once the subscription is registered.
+func openEventStream(t *testing.T, url string, headers map[string]string) *bufio.Reader {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to build request: %v", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.StatusCode)
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("expected text/event-stream content type, got %q", contentType)
+	}
+
+	reader := bufio.NewReader(res.Body)
+	preamble, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(preamble, "retry: ") {
+		t.Fatalf("expected retry preamble, got %q err=%v", preamble, err)
+	}
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatalf("failed to read preamble terminator: %v", err)
+	}
+	return reader
+}
+
+func readSSEMessage(t *testing.T, reader *bufio.Reader) sseMessage {
+	t.Helper()
+
+	type result struct {
+		msg sseMessage
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var msg sseMessage
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				done <- result{msg: msg}
+				return
+			}
+			switch {
+			case strings.HasPrefix(line, ":"):
+				msg.comment = strings.TrimSpace(strings.TrimPrefix(line, ":"))
+			case line == "id":
+				msg.clearsID = true
+			case strings.HasPrefix(line, "id: "):
+				msg.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatalf("failed to read SSE message: %v", res.err)
+		}
+		if res.msg.data != "" && !json.Valid([]byte(res.msg.data)) {
+			t.Fatalf("expected JSON data, got %q", res.msg.data)
+		}
+		return res.msg
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for SSE message")
+	}
+	return sseMessage{}
+}
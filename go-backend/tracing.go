@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tracerName         = "go-backend"
+	defaultServiceName = "go-backend"
+
+	tracesExporterNone   = "none"
+	tracesExporterOTLP   = "otlp"
+	tracesExporterStdout = "stdout"
+	tracesExporterFile   = "file"
+
+	dbRowsAffectedKey = attribute.Key("db.rows_affected")
+	requestIDKey      = attribute.Key("http.request.id")
+)
+
+// newPropagator handles W3C traceparent/tracestate and baggage headers.
+func newPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// setupTracing installs the global tracer provider for the named exporter
+// (none, otlp, stdout or file) and returns a func that flushes and stops it.
+// The OTLP exporter reads the standard OTEL_EXPORTER_OTLP_* variables.
+func setupTracing(ctx context.Context, exporterName, filePath string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(newPropagator())
+
+	noop := func(context.Context) error { return nil }
+
+	var (
+		exporter sdktrace.SpanExporter
+		closer   io.Closer
+		err      error
+	)
+	switch strings.ToLower(strings.TrimSpace(exporterName)) {
+	case "", tracesExporterNone:
+		return noop, nil
+	case tracesExporterOTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case tracesExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case tracesExporterFile:
+		if strings.TrimSpace(filePath) == "" {
+			return noop, errors.New("OTEL_TRACES_FILE is required for the file exporter")
+		}
+		file, openErr := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return noop, fmt.Errorf("open trace file: %w", openErr)
+		}
+		closer = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return noop, fmt.Errorf("unknown traces exporter %q (want none, otlp, stdout or file)", exporterName)
+	}
+	if err != nil {
+		if closer != nil {
+			_ = closer.Close()
+		}
+		return noop, fmt.Errorf("create %s trace exporter: %w", exporterName, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(defaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return noop, fmt.Errorf("build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+func defaultTracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// tracingMiddleware continues the caller's trace from traceparent, or starts
+// a new one, and wraps the request in a server span named after its route.
+func (s *Server) tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := s.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+		_, route := s.routeInfo(r)
+		name := r.Method
+		if route != unmatchedRoute {
+			name += " " + route
+		}
+
+		ctx, span := s.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.HTTPRoute(route),
+				semconv.URLPath(r.URL.Path),
+				requestIDKey.String(requestIDFromContext(ctx)),
+			),
+		)
+		defer span.End()
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	})
+}
+
+// startStoreSpan wraps one Store call; done records err unless it is an
+// expected domain outcome.
+func startStoreSpan(ctx context.Context, tracer trace.Tracer, operation string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, "store."+operation, trace.WithAttributes(
+		attribute.String("store.operation", operation),
+	))
+	return ctx, func(err error) {
+		if err != nil && !isDomainError(err) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// sqlQuerier is satisfied by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	execer
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// startQuerySpan starts a client span for one SQL statement identified by a
+// short, stable statement name such as "tasks.lock_for_update".
+func (ps *PostgresStore) startQuerySpan(ctx context.Context, statement, query string) (context.Context, trace.Span) {
+	tracer := ps.tracer
+	if tracer == nil {
+		tracer = defaultTracer()
+	}
+	return tracer.Start(ctx, statement,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(statement),
+			semconv.DBStatement(strings.Join(strings.Fields(query), " ")),
+		),
+	)
+}
+
+// endQuerySpan records the affected row count and any error, then ends span.
+// sql.ErrNoRows is a normal result, not a failure.
+func endQuerySpan(span trace.Span, rows int64, err error) {
+	span.SetAttributes(dbRowsAffectedKey.Int64(rows))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// queryRow runs a single-row query in its own span and scans it into dest.
+func (ps *PostgresStore) queryRow(ctx context.Context, q sqlQuerier, statement, query string, args []any, dest ...any) error {
+	ctx, span := ps.startQuerySpan(ctx, statement, query)
+	err := q.QueryRowContext(ctx, query, args...).Scan(dest...)
+
+	var rows int64
+	if err == nil {
+		rows = 1
+	}
+	endQuerySpan(span, rows, err)
+	return err
+}
+
+// queryRows runs a multi-row query in its own span, calling scan for each row.
+// Errors from the query, scan and row iteration are returned as-is.
+func (ps *PostgresStore) queryRows(ctx context.Context, q sqlQuerier, statement, query string, args []any, scan func(*sql.Rows) error) error {
+	ctx, span := ps.startQuerySpan(ctx, statement, query)
+
+	var count int64
+	err := func() error {
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			if err := scan(rows); err != nil {
+				return err
+			}
+			count++
+		}
+		return rows.Err()
+	}()
+
+	endQuerySpan(span, count, err)
+	return err
+}
+
+// exec runs a statement in its own span.
+func (ps *PostgresStore) exec(ctx context.Context, db execer, statement, query string, args ...any) (sql.Result, error) {
+	ctx, span := ps.startQuerySpan(ctx, statement, query)
+	result, err := db.ExecContext(ctx, query, args...)
+
+	var rows int64
+	if err == nil {
+		rows, _ = result.RowsAffected()
+	}
+	endQuerySpan(span, rows, err)
+	return result, err
+}
+
+// commit commits tx in its own span so lock release and fsync time are visible.
+func (ps *PostgresStore) commit(ctx context.Context, tx *sql.Tx) error {
+	_, span := ps.startQuerySpan(ctx, "commit", "COMMIT")
+	err := tx.Commit()
+	endQuerySpan(span, 0, err)
+	return err
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	sqlmock "github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracingContinuesIncomingTraceparent(t *testing.T) {
+	s := newTestServer(t)
+	recorder := useTestTracer(t, s)
+
+	req := httptest.NewRequest(http.MethodPut, "/api/tasks/1", strings.NewReader(`{"title":"Write docs","status":"completed","userId":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", testTraceparent)
+	res := httptest.NewRecorder()
+	s.Handler().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	server := findSpan(t, recorder, "PUT /api/tasks/{taskId}")
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("expected trace ID from traceparent, got %s", got)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" || !server.Parent().IsRemote() {
+		t.Fatalf("expected remote parent span 00f067aa0ba902b7, got %s", got)
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Fatalf("expected server span kind, got %v", server.SpanKind())
+	}
+	assertSpanAttribute(t, server, "http.route", "/api/tasks/{taskId}")
+	assertSpanAttribute(t, server, "http.response.status_code", "200")
+	assertSpanAttribute(t, server, "http.request.id", res.Header().Get(requestIDHeaderName))
+
+	store := findSpan(t, recorder, "store.UpdateTask")
+	if store.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Fatal("expected store span to be a child of the request span")
+	}
+}
+
+func TestTracingStartsNewTraceAndMarksServerErrors(t *testing.T) {
+	s := NewServer(&errorReadStore{usersErr: errors.New("db unavailable")})
+	s.logger = discardLogger()
+	recorder := useTestTracer(t, s)
+
+	res := performRequest(s.Handler(), http.MethodGet, "/api/users", "")
+	if res.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, res.Code)
+	}
+
+	server := findSpan(t, recorder, "GET /api/users")
+	if server.Parent().IsValid() {
+		t.Fatal("expected a root span without traceparent")
+	}
+	if server.Status().Code != codes.Error {
+		t.Fatalf("expected error status on 5xx span, got %v", server.Status())
+	}
+	store := findSpan(t, recorder, "store.GetUsers")
+	if store.Status().Code != codes.Error || len(store.Events()) == 0 {
+		t.Fatalf("expected store span to record the error, got status=%v events=%d", store.Status(), len(store.Events()))
+	}
+}
+
+func TestTracingIgnoresDomainErrorsOnStoreSpans(t *testing.T) {
+	s := newTestServer(t)
+	recorder := useTestTracer(t, s)
+
+	res := performRequest(s.Handler(), http.MethodPut, "/api/tasks/999", `{"title":"Write docs","status":"completed","userId":1}`)
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, res.Code)
+	}
+
+	if span := findSpan(t, recorder, "store.UpdateTask"); span.Status().Code == codes.Error {
+		t.Fatalf("expected not-found to leave the span status unset, got %v", span.Status())
+	}
+}
+
+func TestLogsIncludeTraceID(t *testing.T) {
+	s := newTestServer(t)
+	useTestTracer(t, s)
+
+	var logBuffer bytes.Buffer
+	s.logger = newTestLogger(t, &logBuffer, "text")
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if !strings.Contains(logBuffer.String(), "trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Fatalf("expected trace_id in request log, got: %s", logBuffer.String())
+	}
+}
+
+func TestPostgresStoreUpdateTaskRecordsQuerySpans(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	recorder := tracetest.NewSpanRecorder()
+	store.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, title, status, user_id`).
+		WithArgs(defaultWorkspaceID, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "title", "status", "user_id"}).AddRow(1, defaultWorkspaceID, "Old", "pending", 1))
+	mock.
+		ExpectQuery(`INSERT INTO task_history`).
+		WillReturnError(errors.New("disk full"))
+	mock.ExpectRollback()
+
+	status := "completed"
+	if _, err := store.UpdateTask(context.Background(), 1, TaskUpdate{Status: &status}, "admin"); err == nil {
+		t.Fatal("expected update to fail")
+	}
+
+	lock := findSpan(t, recorder, "tasks.lock_for_update")
+	if lock.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("expected client span kind, got %v", lock.SpanKind())
+	}
+	assertSpanAttribute(t, lock, "db.system", "postgresql")
+	assertSpanAttribute(t, lock, "db.operation", "tasks.lock_for_update")
+	assertSpanAttribute(t, lock, "db.rows_affected", "1")
+	assertSpanAttribute(t, lock, "db.statement", "SELECT id, workspace_id, title, status, user_id FROM tasks WHERE workspace_id = $1 AND id = $2 FOR UPDATE")
+
+	insert := findSpan(t, recorder, "task_history.insert")
+	if insert.Status().Code != codes.Error || insert.Status().Description != "disk full" {
+		t.Fatalf("expected failed insert span, got %v", insert.Status())
+	}
+	assertSpanAttribute(t, insert, "db.rows_affected", "0")
+
+	assertMockExpectations(t, mock)
+}
+
+func TestPostgresStoreQuerySpansRecordRowsAndCommit(t *testing.T) {
+	store, mock, cleanup := newMockPostgresStore(t)
+	defer cleanup()
+
+	recorder := tracetest.NewSpanRecorder()
+	store.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer(tracerName)
+
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, name, email, role`).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}).
+				AddRow(1, defaultWorkspaceID, "John Doe", "john@example.com", "developer").
+				AddRow(2, defaultWorkspaceID, "Jane Smith", "jane@example.com", "designer"),
+		)
+	mock.ExpectRollback()
+	expectWorkspaceTx(mock, defaultWorkspaceID)
+	mock.
+		ExpectQuery(`SELECT id, workspace_id, name, email, role`).
+		WithArgs(defaultWorkspaceID, 9).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "workspace_id", "name", "email", "role"}))
+	mock.ExpectRollback()
+
+	if _, err := store.GetUsers(context.Background()); err != nil {
+		t.Fatalf("expected get users to succeed, got %v", err)
+	}
+	if _, found, err := store.GetUserByID(context.Background(), 9); err != nil || found {
+		t.Fatalf("expected missing user without error, got found=%v err=%v", found, err)
+	}
+
+	assertSpanAttribute(t, findSpan(t, recorder, "users.select_all"), "db.rows_affected", "2")
+	missing := findSpan(t, recorder, "users.select_by_id")
+	if missing.Status().Code == codes.Error {
+		t.Fatal("expected sql.ErrNoRows not to mark the span as failed")
+	}
+
+	assertMockExpectations(t, mock)
+}
+
+func TestSetupTracingFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+
+	shutdown, err := setupTracing(context.Background(), "file", path)
+	if err != nil {
+		t.Fatalf("expected file exporter to start, got %v", err)
+	}
+	_, span := defaultTracer().Start(context.Background(), "file-export-check")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("expected clean shutdown, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read trace file: %v", err)
+	}
+	if !strings.Contains(string(data), "file-export-check") {
+		t.Fatalf("expected span in trace file, got: %s", data)
+	}
+}
+
+func TestSetupTracingRejectsInvalidConfig(t *testing.T) {
+	testCases := []struct {
+		name     string
+		exporter string
+		path     string
+		want     string
+	}{
+		{name: "unknown exporter", exporter: "zipkin", want: "unknown traces exporter"},
+		{name: "file without path", exporter: "file", want: "OTEL_TRACES_FILE"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := setupTracing(context.Background(), tc.exporter, tc.path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("expected error containing %q, got %v", tc.want, err)
+			}
+		})
+	}
+
+	shutdown, err := setupTracing(context.Background(), "none", "")
+	if err != nil || shutdown(context.Background()) != nil {
+		t.Fatalf("expected none exporter to be a no-op, got %v", err)
+	}
+}
+
+// useTestTracer routes the server's request and store spans to an in-memory recorder.
+func useTestTracer(t *testing.T, s *Server) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	tracer := provider.Tracer(tracerName)
+	s.tracer = tracer
+	if store, ok := s.dataStore.(*instrumentedStore); ok {
+		store.tracer = tracer
+	}
+	return recorder
+}
+
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+		names = append(names, span.Name())
+	}
+	t.Fatalf("expected span %q, got %v", name, names)
+	return nil
+}
+
+func assertSpanAttribute(t *testing.T, span sdktrace.ReadOnlySpan, key, want string) {
+	t.Helper()
+
+	for _, attr := range span.Attributes() {
+		if attr.Key == attribute.Key(key) {
+			if got := attr.Value.Emit(); got != want {
+				t.Fatalf("expected %s=%q on span %q, got %q", key, want, span.Name(), got)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected attribute %s on span %q", key, span.Name())
+}
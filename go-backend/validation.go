@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// validator accumulates field errors so a request reports every problem at once.
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, code, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Code: code, Message: message})
+}
+
+// required reports whether value is non-empty, recording an error otherwise.
+func (v *validator) required(field, value string) bool {
+	if value == "" {
+		v.add(field, codeRequired, field+" is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) email(field, value string) {
+	if !emailRegex.MatchString(value) {
+		v.add(field, codeInvalidFormat, "invalid email format")
+	}
+}
+
+func (v *validator) taskStatus(field, value string) {
+	if !isValidTaskStatus(value) {
+		v.add(field, codeInvalidValue, "invalid status: must be one of "+strings.Join(taskStatuses, ", "))
+	}
+}
+
+// addPrefixed records the field errors of a *ValidationError under prefix.
+func (v *validator) addPrefixed(prefix string, err error) {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		v.add(strings.TrimSuffix(prefix, "."), codeInvalidValue, err.Error())
+		return
+	}
+	for _, fieldErr := range validationErr.Errors {
+		v.add(prefix+fieldErr.Field, fieldErr.Code, fieldErr.Message)
+	}
+}
+
+// err returns the collected errors as a *ValidationError, or nil.
+func (v *validator) err() error {
+	if len(v.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errors}
+}
+
+// validate trims the request in place and checks every field.
+func (req *createUserRequest) validate() error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	req.Role = strings.TrimSpace(req.Role)
+
+	var v validator
+	v.required("name", req.Name)
+	if v.required("email", req.Email) {
+		v.email("email", req.Email)
+	}
+	v.required("role", req.Role)
+	return v.err()
+}
+
+// validate trims the request in place and checks every field.
+func (req *createTaskRequest) validate() error {
+	req.Title = strings.TrimSpace(req.Title)
+	req.Status = strings.TrimSpace(req.Status)
+
+	var v validator
+	v.required("title", req.Title)
+	if v.required("status", req.Status) {
+		v.taskStatus("status", req.Status)
+	}
+	if req.UserID == nil {
+		v.add("userId", codeRequired, "userId is required")
+	}
+	return v.err()
+}
+
+// replaceTaskRequest is the body of PUT /api/tasks/{id}: a full replacement,
+// so every field is required as on create.
+type replaceTaskRequest createTaskRequest
+
+// validate checks every field and returns an update setting all of them.
+func (req *replaceTaskRequest) validate() (TaskUpdate, error) {
+	if err := (*createTaskRequest)(req).validate(); err != nil {
+		return TaskUpdate{}, err
+	}
+	return TaskUpdate{Title: &req.Title, Status: &req.Status, UserID: req.UserID}, nil
+}
+
+// validate checks an update request and returns the trimmed store patch.
+func (req updateTaskRequest) validate() (TaskUpdate, error) {
+	var v validator
+	if req.Title == nil && req.Status == nil && req.UserID == nil {
+		v.add("", codeEmptyUpdate, "at least one field must be provided")
+		return TaskUpdate{}, v.err()
+	}
+
+	var update TaskUpdate
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			v.add("title", codeBlank, "title cannot be empty")
+		}
+		update.Title = &title
+	}
+	if req.Status != nil {
+		status := strings.TrimSpace(*req.Status)
+		v.taskStatus("status", status)
+		update.Status = &status
+	}
+	update.UserID = req.UserID
+
+	if err := v.err(); err != nil {
+		return TaskUpdate{}, err
+	}
+	return update, nil
+}
+
+// validate trims the row in place and checks it like POST /api/tasks.
+func (row *importTaskRow) validate() error {
+	row.Title = strings.TrimSpace(row.Title)
+	row.Status = strings.TrimSpace(row.Status)
+	row.UserEmail = strings.TrimSpace(row.UserEmail)
+
+	var v validator
+	v.required("title", row.Title)
+	if v.required("status", row.Status) {
+		v.taskStatus("status", row.Status)
+	}
+	switch {
+	case row.UserID == nil && row.UserEmail == "":
+		v.add("userId", codeRequired, "userId or userEmail is required")
+	case row.UserID != nil && row.UserEmail != "":
+		v.add("userEmail", codeInvalidValue, "give userId or userEmail, not both")
+	case row.UserEmail != "":
+		v.email("userEmail", row.UserEmail)
+	}
+	return v.err()
+}
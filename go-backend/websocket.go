@@ -0,0 +1,567 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait       = 10 * time.Second
+	wsPongWait        = 60 * time.Second
+	wsPingInterval    = (wsPongWait * 9) / 10
+	wsMaxMessageBytes = 64 << 10
+	wsSendBuffer      = 64
+)
+
+// WebSocket message types exchanged on /api/ws.
+const (
+	wsTypeSubscribe    = "subscribe"
+	wsTypeUnsubscribe  = "unsubscribe"
+	wsTypeSubscribed   = "subscribed"
+	wsTypeUnsubscribed = "unsubscribed"
+	wsTypeUpdate       = "update"
+	wsTypeAck          = "ack"
+	wsTypeEvent        = "event"
+	wsTypePresence     = "presence"
+	wsTypePing         = "ping"
+	wsTypePong         = "pong"
+	wsTypeError        = "error"
+)
+
+// Presence states a client can announce for a task.
+const (
+	presenceViewing = "viewing"
+	presenceLeft    = "left"
+)
+
+// wsClientMessage is a message sent by a WebSocket client.
+type wsClientMessage struct {
+	Type    string             `json:"type"`
+	ID      string             `json:"id,omitempty"`
+	Channel string             `json:"channel,omitempty"`
+	TaskID  int                `json:"taskId,omitempty"`
+	Changes *updateTaskRequest `json:"changes,omitempty"`
+	State   string             `json:"state,omitempty"`
+}
+
+// wsServerMessage is a message sent to a WebSocket client.
+type wsServerMessage struct {
+	Type     string       `json:"type"`
+	ID       string       `json:"id,omitempty"`
+	Channel  string       `json:"channel,omitempty"`
+	Channels []string     `json:"channels,omitempty"`
+	Event    *ChangeEvent `json:"event,omitempty"`
+	Task     *Task        `json:"task,omitempty"`
+	TaskID   int          `json:"taskId,omitempty"`
+	Actor    string       `json:"actor,omitempty"`
+	State    string       `json:"state,omitempty"`
+	Viewers  []string     `json:"viewers,omitempty"`
+	Error    string       `json:"error,omitempty"`
+}
+
+// wsChannel identifies a subscription: "tasks", "users", "task:<id>" or "user:<id>".
+type wsChannel struct {
+	kind string
+	id   int
+}
+
+func parseWSChannel(raw string) (wsChannel, error) {
+	switch raw {
+	case "tasks", "users":
+		return wsChannel{kind: raw}, nil
+	}
+
+	kind, idPart, ok := strings.Cut(raw, ":")
+	if !ok || (kind != "task" && kind != "user") {
+		return wsChannel{}, errors.New("unknown channel")
+	}
+	id, err := strconv.Atoi(idPart)
+	if err != nil || id <= 0 {
+		return wsChannel{}, errors.New("invalid channel ID")
+	}
+	return wsChannel{kind: kind, id: id}, nil
+}
+
+func (c wsChannel) String() string {
+	if c.id == 0 {
+		return c.kind
+	}
+	return c.kind + ":" + strconv.Itoa(c.id)
+}
+
+// permission returns the permission needed to subscribe to c. User channels
+// carry names and emails, so they need users:read like GET /api/users.
+func (c wsChannel) permission() string {
+	if c.kind == "users" || c.kind == "user" {
+		return permUsersRead
+	}
+	return permTasksRead
+}
+
+func (c wsChannel) matches(event ChangeEvent) bool {
+	switch c.kind {
+	case "tasks":
+		return event.TaskID != 0
+	case "users":
+		return event.Type == EventUserCreated
+	case "task":
+		return event.TaskID == c.id
+	case "user":
+		return EventFilter{UserID: c.id}.Matches(event)
+	default:
+		return false
+	}
+}
+
+// wsHub tracks connected clients and who is viewing which task.
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	viewers map[int]map[*wsClient]struct{}
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{
+		clients: make(map[*wsClient]struct{}),
+		viewers: make(map[int]map[*wsClient]struct{}),
+	}
+}
+
+func (h *wsHub) add(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.clients[c] = struct{}{}
+}
+
+// remove drops the client and announces it has left every task it was viewing.
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.clients, c)
+	for taskID, viewers := range h.viewers {
+		if _, ok := viewers[c]; !ok {
+			continue
+		}
+		delete(viewers, c)
+		if len(viewers) == 0 {
+			delete(h.viewers, taskID)
+		}
+		h.broadcastPresenceLocked(c, taskID, presenceLeft)
+	}
+}
+
+func (h *wsHub) setPresence(c *wsClient, taskID int, state string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	viewers := h.viewers[taskID]
+	switch state {
+	case presenceViewing:
+		if viewers == nil {
+			viewers = make(map[*wsClient]struct{})
+			h.viewers[taskID] = viewers
+		}
+		viewers[c] = struct{}{}
+	case presenceLeft:
+		if _, ok := viewers[c]; !ok {
+			return
+		}
+		delete(viewers, c)
+		if len(viewers) == 0 {
+			delete(h.viewers, taskID)
+		}
+	}
+	h.broadcastPresenceLocked(c, taskID, state)
+}
+
+// viewerNames returns the distinct actors of workspaceID currently viewing
+// the task, sorted.
+func (h *wsHub) viewerNames(workspaceID string, taskID int) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen := make(map[string]struct{})
+	names := make([]string, 0, len(h.viewers[taskID]))
+	for c := range h.viewers[taskID] {
+		if c.workspace != workspaceID {
+			continue
+		}
+		if _, ok := seen[c.actor]; ok {
+			continue
+		}
+		seen[c.actor] = struct{}{}
+		names = append(names, c.actor)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// broadcastPresenceLocked tells the task's subscribers in from's workspace
+// that from is now viewing it or has left.
+func (h *wsHub) broadcastPresenceLocked(from *wsClient, taskID int, state string) {
+	probe := ChangeEvent{TaskID: taskID}
+	for c := range h.clients {
+		if c.workspace != from.workspace || len(c.matchingChannels(probe)) == 0 {
+			continue
+		}
+		c.enqueue(wsServerMessage{
+			Type:    wsTypePresence,
+			Channel: "task:" + strconv.Itoa(taskID),
+			TaskID:  taskID,
+			Actor:   from.actor,
+			State:   state,
+		})
+	}
+}
+
+// wsClient is a single WebSocket connection and its subscriptions.
+type wsClient struct {
+	conn      *websocket.Conn
+	actor     string
+	workspace string
+	send      chan wsServerMessage
+	done      chan struct{}
+
+	mu          sync.Mutex
+	channels    map[string]wsChannel
+	closeOnce   sync.Once
+	closeCode   int
+	closeReason string
+}
+
+func newWSClient(conn *websocket.Conn, actor, workspace string) *wsClient {
+	return &wsClient{
+		conn:      conn,
+		actor:     actor,
+		workspace: workspace,
+		send:      make(chan wsServerMessage, wsSendBuffer),
+		done:      make(chan struct{}),
+		channels:  make(map[string]wsChannel),
+	}
+}
+
+// enqueue queues a message without blocking. A client that cannot keep up is
+// disconnected rather than allowed to stall publishers.
+func (c *wsClient) enqueue(msg wsServerMessage) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+// close asks the write loop to send a close frame and stop.
+func (c *wsClient) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closeCode = code
+		c.closeReason = reason
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+func (c *wsClient) subscribe(channel wsChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels[channel.String()] = channel
+}
+
+func (c *wsClient) unsubscribe(channel wsChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.channels, channel.String())
+}
+
+func (c *wsClient) matchingChannels(event ChangeEvent) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var matched []string
+	for name, channel := range c.channels {
+		if channel.matches(event) {
+			matched = append(matched, name)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func (s *Server) wsUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  4096,
+		WriteBufferSize: 4096,
+		CheckOrigin:     s.checkWebSocketOrigin,
+	}
+}
+
+// handleWebSocket upgrades the connection and serves the board protocol.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		s.writeError(w, http.StatusBadRequest, "websocket upgrade required")
+		return
+	}
+
+	// Browsers cannot set custom headers on WebSocket handshakes, so ?actor=
+	// stands in for X-Actor wherever the header would be honored.
+	actor := extractActor(r)
+	principal, authenticated := principalFromContext(r.Context())
+	if (!authenticated || principal.Delegating) && strings.TrimSpace(r.Header.Get(actorHeaderName)) == "" {
+		if queryActor := strings.TrimSpace(r.URL.Query().Get("actor")); queryActor != "" {
+			actor = normalizeActor(queryActor)
+		}
+	}
+
+	c, err := s.resolveCaller(r.Context(), actor)
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "error resolving caller permissions", "error", err)
+		s.writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	if !c.can(permTasksRead) {
+		s.writeForbidden(w, r, c, permTasksRead)
+		return
+	}
+
+	conn, err := s.wsUpgrader().Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already written an error response.
+		return
+	}
+
+	client := newWSClient(conn, actor, workspaceFromContext(r.Context()))
+	s.ws.add(client)
+
+	events, unsubscribe := s.events.Subscribe(EventFilter{WorkspaceID: client.workspace})
+	go s.forwardWSEvents(client, events)
+
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		s.writeWSMessages(client)
+	}()
+
+	s.readWSMessages(withActor(r.Context(), actor), client)
+
+	unsubscribe()
+	s.ws.remove(client)
+	client.close(websocket.CloseNormalClosure, "")
+	<-writerDone
+	_ = conn.Close()
+}
+
+func (s *Server) forwardWSEvents(c *wsClient, events <-chan ChangeEvent) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case event, ok := <-events:
+			if !ok {
+				c.close(websocket.CloseTryAgainLater, "client too slow")
+				return
+			}
+			channels := c.matchingChannels(event)
+			if len(channels) == 0 {
+				continue
+			}
+			eventCopy := event
+			c.enqueue(wsServerMessage{Type: wsTypeEvent, Channels: channels, Event: &eventCopy})
+		}
+	}
+}
+
+func (s *Server) readWSMessages(ctx context.Context, c *wsClient) {
+	c.conn.SetReadLimit(wsMaxMessageBytes)
+	_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				s.logger.WarnContext(ctx, "websocket read error", "error", err)
+			}
+			return
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		if messageType != websocket.TextMessage {
+			c.enqueue(wsServerMessage{Type: wsTypeError, Error: "messages must be JSON text frames"})
+			continue
+		}
+		s.handleWSMessage(ctx, c, data)
+	}
+}
+
+func (s *Server) writeWSMessages(c *wsClient) {
+	ping := time.NewTicker(s.settings.Load().wsPingInterval)
+	defer ping.Stop()
+
+	shutdown := s.streamsCtx.Done()
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-shutdown:
+			// Keep writing until c.done; a closed channel would spin here.
+			shutdown = nil
+			c.close(websocket.CloseGoingAway, "server shutting down")
+		case <-c.done:
+			c.mu.Lock()
+			code, reason := c.closeCode, c.closeReason
+			c.mu.Unlock()
+			if code != websocket.CloseAbnormalClosure {
+				message := websocket.FormatCloseMessage(code, reason)
+				_ = c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteWait))
+			}
+			// Unblock the read loop if the peer never answers the close frame.
+			_ = c.conn.SetReadDeadline(time.Now().Add(wsWriteWait))
+			return
+		}
+	}
+}
+
+func (s *Server) handleWSMessage(ctx context.Context, c *wsClient, data []byte) {
+	var msg wsClientMessage
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&msg); err != nil {
+		c.enqueue(wsServerMessage{Type: wsTypeError, Error: normalizeJSONError(err)})
+		return
+	}
+
+	switch msg.Type {
+	case wsTypeSubscribe, wsTypeUnsubscribe:
+		channel, err := parseWSChannel(msg.Channel)
+		if err != nil {
+			c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Channel: msg.Channel, Error: err.Error()})
+			return
+		}
+		if msg.Type == wsTypeUnsubscribe {
+			c.unsubscribe(channel)
+			c.enqueue(wsServerMessage{Type: wsTypeUnsubscribed, ID: msg.ID, Channel: channel.String()})
+			return
+		}
+		caller, err := s.resolveCaller(ctx, c.actor)
+		if err != nil {
+			s.logger.ErrorContext(ctx, "error resolving caller permissions", "error", err)
+			c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Channel: msg.Channel, Error: "internal server error"})
+			return
+		}
+		if permission := channel.permission(); !caller.can(permission) {
+			s.logger.InfoContext(ctx, "permission denied", "role", caller.role, "permission", permission, "channel", channel.String())
+			c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Channel: channel.String(), Error: "missing permission: " + permission})
+			return
+		}
+		c.subscribe(channel)
+		c.enqueue(wsServerMessage{Type: wsTypeSubscribed, ID: msg.ID, Channel: channel.String()})
+		if channel.kind == "task" {
+			c.enqueue(wsServerMessage{
+				Type:    wsTypePresence,
+				Channel: channel.String(),
+				TaskID:  channel.id,
+				Viewers: s.ws.viewerNames(c.workspace, channel.id),
+			})
+		}
+	case wsTypeUpdate:
+		s.handleWSUpdate(ctx, c, msg)
+	case wsTypePresence:
+		if msg.TaskID <= 0 {
+			c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Error: "taskId is required"})
+			return
+		}
+		if msg.State != presenceViewing && msg.State != presenceLeft {
+			c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Error: "state must be viewing or left"})
+			return
+		}
+		// Presence is broadcast to the board, so only tasks the caller can
+		// see may be announced.
+		if msg.State == presenceViewing {
+			_, found, err := s.dataStore.GetTaskByID(ctx, msg.TaskID)
+			if err != nil {
+				s.logger.ErrorContext(ctx, "error looking up task for presence", "task_id", msg.TaskID, "error", err)
+				c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: "internal server error"})
+				return
+			}
+			if !found {
+				c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: "task not found"})
+				return
+			}
+		}
+		s.ws.setPresence(c, msg.TaskID, msg.State)
+	case wsTypePing:
+		c.enqueue(wsServerMessage{Type: wsTypePong, ID: msg.ID})
+	default:
+		c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Error: "unknown message type"})
+	}
+}
+
+// handleWSUpdate applies a partial task update, like a merge patch to
+// PATCH /api/tasks/{id}, attributed to the connection's actor.
+func (s *Server) handleWSUpdate(ctx context.Context, c *wsClient, msg wsClientMessage) {
+	if msg.TaskID <= 0 {
+		c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, Error: "invalid task ID"})
+		return
+	}
+	if msg.Changes == nil {
+		c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: "changes are required"})
+		return
+	}
+
+	update, err := msg.Changes.validate()
+	if err != nil {
+		c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: err.Error()})
+		return
+	}
+
+	caller, err := s.resolveCaller(ctx, c.actor)
+	if err == nil {
+		var missing string
+		missing, err = s.checkTaskUpdate(ctx, caller, msg.TaskID, update)
+		if err == nil && missing != "" {
+			c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: "missing permission: " + missing})
+			return
+		}
+	}
+	if err != nil {
+		_, message := s.taskUpdateError(ctx, msg.TaskID, err)
+		c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: message})
+		return
+	}
+
+	task, err := s.dataStore.UpdateTask(ctx, msg.TaskID, update, c.actor)
+	if err != nil {
+		_, message := s.taskUpdateError(ctx, msg.TaskID, err)
+		c.enqueue(wsServerMessage{Type: wsTypeError, ID: msg.ID, TaskID: msg.TaskID, Error: message})
+		return
+	}
+
+	c.enqueue(wsServerMessage{Type: wsTypeAck, ID: msg.ID, TaskID: task.ID, Task: &task})
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketSubscribeReceivesTaskEvents(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	conn := dialWebSocket(t, ts.URL, "")
+	sendWS(t, conn, map[string]any{"type": "subscribe", "id": "s1", "channel": "task:1"})
+	subscribed := readWSType(t, conn, wsTypeSubscribed)
+	if subscribed.ID != "s1" || subscribed.Channel != "task:1" {
+		t.Fatalf("unexpected subscribe ack: %+v", subscribed)
+	}
+
+	performRequest(s.Handler(), http.MethodPatch, "/api/tasks/2", `{"status":"completed"}`)
+	res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+
+	msg := readWSType(t, conn, wsTypeEvent)
+	if msg.Event == nil || msg.Event.TaskID != 1 || msg.Event.Type != EventTaskUpdated {
+		t.Fatalf("expected task 1 update event, got %+v", msg.Event)
+	}
+	if len(msg.Channels) != 1 || msg.Channels[0] != "task:1" {
+		t.Fatalf("expected event routed via task:1, got %v", msg.Channels)
+	}
+
+	sendWS(t, conn, map[string]any{"type": "unsubscribe", "channel": "task:1"})
+	readWSType(t, conn, wsTypeUnsubscribed)
+}
+
+func TestWebSocketUpdateUsesConnectionActor(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	conn := dialWebSocket(t, ts.URL, "?actor=alice")
+
+	sendWS(t, conn, map[string]any{"type": "update", "id": "u1", "taskId": 1, "changes": map[string]any{"status": "in-progress"}})
+	ack := readWSType(t, conn, wsTypeAck)
+	if ack.ID != "u1" || ack.Task == nil || ack.Task.Status != "in-progress" {
+		t.Fatalf("unexpected update ack: %+v", ack)
+	}
+	if ack.Task.LastChange == nil || ack.Task.LastChange.ChangedBy != "alice" {
+		t.Fatalf("expected change attributed to alice, got %+v", ack.Task.LastChange)
+	}
+
+	testCases := []struct {
+		name    string
+		message map[string]any
+		want    string
+	}{
+		{name: "invalid status", message: map[string]any{"type": "update", "id": "u2", "taskId": 1, "changes": map[string]any{"status": "bad"}}, want: "invalid status"},
+		{name: "unknown task", message: map[string]any{"type": "update", "id": "u3", "taskId": 999, "changes": map[string]any{"status": "pending"}}, want: "task not found"},
+		{name: "missing changes", message: map[string]any{"type": "update", "id": "u4", "taskId": 1}, want: "changes are required"},
+		{name: "unknown user", message: map[string]any{"type": "update", "id": "u5", "taskId": 1, "changes": map[string]any{"userId": 999}}, want: "user does not exist"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sendWS(t, conn, tc.message)
+			msg := readWSType(t, conn, wsTypeError)
+			if msg.ID != tc.message["id"] || !strings.Contains(msg.Error, tc.want) {
+				t.Fatalf("expected error %q for %v, got %+v", tc.want, tc.message["id"], msg)
+			}
+		})
+	}
+}
+
+func TestWebSocketPresence(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	alice := dialWebSocket(t, ts.URL, "?actor=alice")
+	bob := dialWebSocket(t, ts.URL, "?actor=bob")
+
+	sendWS(t, bob, map[string]any{"type": "subscribe", "channel": "task:1"})
+	readWSType(t, bob, wsTypeSubscribed)
+	snapshot := readWSType(t, bob, wsTypePresence)
+	if len(snapshot.Viewers) != 0 {
+		t.Fatalf("expected no viewers yet, got %v", snapshot.Viewers)
+	}
+
+	sendWS(t, alice, map[string]any{"type": "presence", "taskId": 1, "state": presenceViewing})
+	viewing := readWSType(t, bob, wsTypePresence)
+	if viewing.Actor != "alice" || viewing.State != presenceViewing || viewing.TaskID != 1 {
+		t.Fatalf("unexpected presence broadcast: %+v", viewing)
+	}
+
+	sendWS(t, bob, map[string]any{"type": "subscribe", "channel": "task:1"})
+	readWSType(t, bob, wsTypeSubscribed)
+	snapshot = readWSType(t, bob, wsTypePresence)
+	if len(snapshot.Viewers) != 1 || snapshot.Viewers[0] != "alice" {
+		t.Fatalf("expected alice in viewer snapshot, got %v", snapshot.Viewers)
+	}
+
+	_ = alice.Close()
+	left := readWSType(t, bob, wsTypePresence)
+	if left.Actor != "alice" || left.State != presenceLeft {
+		t.Fatalf("expected alice to leave on disconnect, got %+v", left)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	conn := dialWebSocket(t, ts.URL, "")
+
+	sendWS(t, conn, map[string]any{"type": "ping", "id": "p1"})
+	if pong := readWSType(t, conn, wsTypePong); pong.ID != "p1" {
+		t.Fatalf("expected pong for p1, got %+v", pong)
+	}
+
+	testCases := []struct {
+		name    string
+		message map[string]any
+		want    string
+	}{
+		{name: "unknown type", message: map[string]any{"type": "dance"}, want: "unknown message type"},
+		{name: "unknown channel", message: map[string]any{"type": "subscribe", "channel": "projects"}, want: "unknown channel"},
+		{name: "invalid channel ID", message: map[string]any{"type": "subscribe", "channel": "task:abc"}, want: "invalid channel ID"},
+		{name: "unknown field", message: map[string]any{"type": "ping", "extra": true}, want: "unknown field"},
+		{name: "invalid presence", message: map[string]any{"type": "presence", "taskId": 1, "state": "dancing"}, want: "state must be"},
+		{name: "presence on unknown task", message: map[string]any{"type": "presence", "taskId": 999, "state": presenceViewing}, want: "task not found"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sendWS(t, conn, tc.message)
+			msg := readWSType(t, conn, wsTypeError)
+			if !strings.Contains(msg.Error, tc.want) {
+				t.Fatalf("expected error containing %q, got %q", tc.want, msg.Error)
+			}
+		})
+	}
+}
+
+func TestWebSocketSubscribeChecksChannelPermissions(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Roles["board"] = []string{permTasksRead}
+	policy.Subjects = map[string]string{"wallboard": "board"}
+	s := newPolicyTestServer(t, policy)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	conn := dialWebSocket(t, ts.URL, "?actor=wallboard")
+	for _, channel := range []string{"users", "user:1"} {
+		sendWS(t, conn, map[string]any{"type": "subscribe", "id": channel, "channel": channel})
+		msg := readWSType(t, conn, wsTypeError)
+		if msg.ID != channel || msg.Channel != channel || msg.Error != "missing permission: "+permUsersRead {
+			t.Fatalf("expected %s to be denied, got %+v", channel, msg)
+		}
+	}
+
+	sendWS(t, conn, map[string]any{"type": "subscribe", "id": "tasks", "channel": "tasks"})
+	if msg := readWSType(t, conn, wsTypeSubscribed); msg.Channel != "tasks" {
+		t.Fatalf("expected the tasks channel to be allowed, got %+v", msg)
+	}
+
+	// A denied channel never receives events: creating a user reaches
+	// neither users nor user:N.
+	manager := asActor("bob@example.com")
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/users", `{"name":"Eve","email":"eve@example.com","role":"developer"}`, manager)
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	performRequestWithHeaders(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`, manager)
+	msg := readWSType(t, conn, wsTypeEvent)
+	if msg.Event == nil || msg.Event.Type != EventTaskUpdated || len(msg.Channels) != 1 || msg.Channels[0] != "tasks" {
+		t.Fatalf("expected only the task event via tasks, got %+v", msg)
+	}
+
+	managerConn := dialWebSocket(t, ts.URL, "?actor=bob@example.com")
+	sendWS(t, managerConn, map[string]any{"type": "subscribe", "channel": "user:1"})
+	if msg := readWSType(t, managerConn, wsTypeSubscribed); msg.Channel != "user:1" {
+		t.Fatalf("expected a manager to subscribe to user:1, got %+v", msg)
+	}
+}
+
+func TestWebSocketRequiresUpgrade(t *testing.T) {
+	s := newTestServer(t)
+
+	res := performRequest(s.Handler(), http.MethodGet, "/api/ws", "")
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, res.Code)
+	}
+}
+
+func TestWebSocketClosesOnShutdown(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	conn := dialWebSocket(t, ts.URL, "")
+	sendWS(t, conn, map[string]any{"type": "ping"})
+	readWSType(t, conn, wsTypePong)
+
+	s.closeStreams()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("expected going-away close frame, got %v", err)
+	}
+}
+
+func TestWSClientDisconnectsWhenSendBufferFull(t *testing.T) {
+	client := newWSClient(nil, "alice", defaultWorkspaceID)
+
+	for i := 0; i < wsSendBuffer; i++ {
+		client.enqueue(wsServerMessage{Type: wsTypePong})
+	}
+	select {
+	case <-client.done:
+		t.Fatal("expected client to stay open while buffer has room")
+	default:
+	}
+
+	client.enqueue(wsServerMessage{Type: wsTypePong})
+	select {
+	case <-client.done:
+	default:
+		t.Fatal("expected slow client to be closed")
+	}
+	if client.closeCode != websocket.CloseTryAgainLater {
+		t.Fatalf("expected close code %d, got %d", websocket.CloseTryAgainLater, client.closeCode)
+	}
+}
+
+func dialWebSocket(t *testing.T, serverURL, query string) *websocket.Conn {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(serverURL, "http") + "/api/ws" + query
+	conn, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to dial websocket: %v", err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected status %d, got %d", http.StatusSwitchingProtocols, res.StatusCode)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func sendWS(t *testing.T, conn *websocket.Conn, message map[string]any) {
+	t.Helper()
+
+	if err := conn.WriteJSON(message); err != nil {
+		t.Fatalf("failed to send websocket message: %v", err)
+	}
+}
+
+// readWSType reads messages until one of the given type arrives, failing on timeout.
+func readWSType(t *testing.T, conn *websocket.Conn, messageType string) wsServerMessage {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var msg wsServerMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("failed waiting for %q message: %v", messageType, err)
+		}
+		if msg.Type == messageType {
+			return msg
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	workspaceHeaderName = "X-Workspace-ID"
+	workspaceClaim      = "workspace"
+	defaultWorkspaceID  = "default"
+
+	// allWorkspaces scopes server-initiated reads, such as metrics and
+	// listener resyncs, to every workspace. Requests can never select it.
+	allWorkspaces = "*"
+)
+
+// ErrWorkspaceRequired is returned when a write is attempted without a single
+// target workspace.
+var ErrWorkspaceRequired = errors.New("a single workspace is required")
+
+var workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+func isValidWorkspaceID(id string) bool {
+	return workspaceIDPattern.MatchString(id)
+}
+
+func withWorkspace(ctx context.Context, workspaceID string) context.Context {
+	return context.WithValue(ctx, workspaceContextKey, workspaceID)
+}
+
+// workspaceFromContext returns the workspace every Store call made with ctx
+// is scoped to, or the default workspace when none was set.
+func workspaceFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(workspaceContextKey).(string); ok && id != "" {
+		return id
+	}
+	return defaultWorkspaceID
+}
+
+// inWorkspace reports whether a row of rowWorkspace is visible to workspaceID.
+func inWorkspace(workspaceID, rowWorkspace string) bool {
+	return workspaceID == allWorkspaces || workspaceID == rowWorkspace
+}
+
+// writableWorkspace returns the workspace writes made with ctx go to.
+func writableWorkspace(ctx context.Context) (string, error) {
+	workspaceID := workspaceFromContext(ctx)
+	if workspaceID == allWorkspaces {
+		return "", ErrWorkspaceRequired
+	}
+	return workspaceID, nil
+}
+
+// workspaceMiddleware scopes /api/* requests to a workspace taken from the
+// token's workspace claim or the X-Workspace-ID header, defaulting to
+// "default". A token bound to one workspace cannot be used for another.
+func (s *Server) workspaceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, protectedAPIPrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		workspaceID := strings.TrimSpace(r.Header.Get(workspaceHeaderName))
+		if workspaceID != "" && !isValidWorkspaceID(workspaceID) {
+			s.writeError(w, http.StatusBadRequest, "invalid "+workspaceHeaderName+" header")
+			return
+		}
+
+		if principal, ok := principalFromContext(r.Context()); ok && principal.Workspace != "" {
+			if workspaceID != "" && workspaceID != principal.Workspace {
+				s.logger.InfoContext(r.Context(), "workspace not permitted for credentials",
+					"requested_workspace", workspaceID, "token_workspace", principal.Workspace)
+				s.writeError(w, http.StatusForbidden, "credentials are not valid for this workspace")
+				return
+			}
+			workspaceID = principal.Workspace
+		}
+		if workspaceID == "" {
+			workspaceID = defaultWorkspaceID
+		}
+
+		setRequestWorkspace(r.Context(), workspaceID)
+		next.ServeHTTP(w, r.WithContext(withWorkspace(r.Context(), workspaceID)))
+	})
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func inWorkspaceHeader(workspaceID string) map[string]string {
+	return map[string]string{workspaceHeaderName: workspaceID}
+}
+
+func TestDataStoreIsolatesWorkspaces(t *testing.T) {
+	ds := NewDataStore(
+		[]User{
+			{ID: 1, Name: "John Doe", Email: "john@example.com", Role: "developer"},
+			{ID: 2, WorkspaceID: "acme", Name: "Ann Acme", Email: "ann@acme.example", Role: "manager"},
+		},
+		[]Task{
+			{ID: 1, Title: "Default task", Status: "pending", UserID: 1},
+			{ID: 2, WorkspaceID: "acme", Title: "Acme task", Status: "pending", UserID: 2},
+		},
+	)
+	acme := withWorkspace(context.Background(), "acme")
+
+	tasks, err := ds.GetTasks(acme, "", "")
+	if err != nil || len(tasks) != 1 || tasks[0].ID != 2 {
+		t.Fatalf("expected only the acme task, got %+v err=%v", tasks, err)
+	}
+	if _, found, _ := ds.GetTaskByID(acme, 1); found {
+		t.Fatal("expected default-workspace task to be invisible to acme")
+	}
+	if _, err := ds.CreateTask(acme, "Cross", "pending", 1, "ann"); !errors.Is(err, ErrUserDoesNotExist) {
+		t.Fatalf("expected assignee from another workspace to be rejected, got %v", err)
+	}
+	status := "completed"
+	if _, err := ds.UpdateTask(acme, 1, TaskUpdate{Status: &status}, "ann"); !errors.Is(err, ErrTaskNotFound) {
+		t.Fatalf("expected ErrTaskNotFound across workspaces, got %v", err)
+	}
+
+	user, err := ds.CreateUser(acme, "New", "new@acme.example", "developer")
+	if err != nil || user.WorkspaceID != "acme" {
+		t.Fatalf("expected user created in acme, got %+v err=%v", user, err)
+	}
+	stats, err := ds.GetStats(context.Background())
+	if err != nil || stats.Users.Total != 1 || stats.Tasks.Total != 1 {
+		t.Fatalf("expected default workspace stats to exclude acme, got %+v err=%v", stats, err)
+	}
+
+	all := withWorkspace(context.Background(), allWorkspaces)
+	if stats, _ := ds.GetStats(all); stats.Users.Total != 3 || stats.Tasks.Total != 2 {
+		t.Fatalf("expected totals across workspaces, got %+v", stats)
+	}
+	if _, err := ds.CreateUser(all, "Nobody", "nobody@example.com", "developer"); !errors.Is(err, ErrWorkspaceRequired) {
+		t.Fatalf("expected ErrWorkspaceRequired for writes to every workspace, got %v", err)
+	}
+}
+
+func TestWorkspaceHeaderScopesRequests(t *testing.T) {
+	s := newTestServer(t)
+	h := s.Handler()
+
+	res := performRequestWithHeaders(h, http.MethodPost, "/api/users", `{"name":"Ann","email":"ann@acme.example","role":"manager"}`, inWorkspaceHeader("acme"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d body=%s", http.StatusCreated, res.Code, res.Body.String())
+	}
+	var user User
+	decodeJSONResponse(t, res.Body.Bytes(), &user)
+	if user.WorkspaceID != "acme" {
+		t.Fatalf("expected workspaceId acme, got %q", user.WorkspaceID)
+	}
+
+	var users UsersResponse
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/users", "", inWorkspaceHeader("acme"))
+	decodeJSONResponse(t, res.Body.Bytes(), &users)
+	if users.Count != 1 || users.Users[0].Email != "ann@acme.example" {
+		t.Fatalf("expected only acme users, got %+v", users)
+	}
+
+	res = performRequestWithHeaders(h, http.MethodGet, "/api/tasks/1/history", "", inWorkspaceHeader("acme"))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for another workspace's task, got %d", http.StatusNotFound, res.Code)
+	}
+
+	res = performRequest(h, http.MethodGet, "/api/users", "")
+	decodeJSONResponse(t, res.Body.Bytes(), &users)
+	if users.Count != 3 {
+		t.Fatalf("expected requests without a header to use the default workspace, got %d users", users.Count)
+	}
+
+	for _, invalid := range []string{"Acme", "*", "a b", "-acme"} {
+		res = performRequestWithHeaders(h, http.MethodGet, "/api/users", "", inWorkspaceHeader(invalid))
+		if res.Code != http.StatusBadRequest {
+			t.Fatalf("expected status %d for workspace %q, got %d", http.StatusBadRequest, invalid, res.Code)
+		}
+	}
+}
+
+func TestWorkspaceClaimBindsToken(t *testing.T) {
+	s := newAuthTestServer(t, AuthConfig{
+		HMACSecret: []byte(testJWTSecret),
+		Issuer:     "https://issuer.example",
+		Audience:   "go-backend",
+	})
+	claims := validClaims("ann@acme.example")
+	claims[workspaceClaim] = "acme"
+	headers := map[string]string{"Authorization": "Bearer " + signHS256(t, claims)}
+
+	res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", headers)
+	var users UsersResponse
+	decodeJSONResponse(t, res.Body.Bytes(), &users)
+	if res.Code != http.StatusOK || users.Count != 0 {
+		t.Fatalf("expected the token's empty acme workspace, got %d %+v", res.Code, users)
+	}
+
+	headers[workspaceHeaderName] = "acme"
+	if res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", headers); res.Code != http.StatusOK {
+		t.Fatalf("expected matching header to be accepted, got %d", res.Code)
+	}
+
+	headers[workspaceHeaderName] = defaultWorkspaceID
+	if res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", headers); res.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for another workspace, got %d", http.StatusForbidden, res.Code)
+	}
+
+	claims[workspaceClaim] = "Not Valid"
+	headers = map[string]string{"Authorization": "Bearer " + signHS256(t, claims)}
+	if res := performRequestWithHeaders(s.Handler(), http.MethodGet, "/api/users", "", headers); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected invalid workspace claim to be rejected, got %d", res.Code)
+	}
+}
+
+func TestEventsStreamIsolatesWorkspaces(t *testing.T) {
+	s := newTestServer(t)
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+
+	acmeStream := openEventStream(t, ts.URL+"/api/events", inWorkspaceHeader("acme"))
+
+	if res := performRequest(s.Handler(), http.MethodPatch, "/api/tasks/1", `{"status":"completed"}`); res.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, res.Code)
+	}
+	res := performRequestWithHeaders(s.Handler(), http.MethodPost, "/api/users", `{"name":"Ann","email":"ann@acme.example","role":"manager"}`, inWorkspaceHeader("acme"))
+	if res.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, res.Code)
+	}
+
+	msg := readSSEMessage(t, acmeStream)
+	if msg.event != EventUserCreated {
+		t.Fatalf("expected the acme user event first, got %q", msg.event)
+	}
+	var event ChangeEvent
+	decodeJSONResponse(t, []byte(msg.data), &event)
+	if event.WorkspaceID != "acme" {
+		t.Fatalf("expected workspaceId acme, got %q", event.WorkspaceID)
+	}
+}
+
+func TestWSHubPresenceIsolatesWorkspaces(t *testing.T) {
+	hub := newWSHub()
+	alice := newWSClient(nil, "alice", defaultWorkspaceID)
+	ann := newWSClient(nil, "ann", "acme")
+	for _, client := range []*wsClient{alice, ann} {
+		client.subscribe(wsChannel{kind: "task", id: 1})
+		hub.add(client)
+	}
+
+	hub.setPresence(ann, 1, presenceViewing)
+
+	if got := hub.viewerNames(defaultWorkspaceID, 1); len(got) != 0 {
+		t.Fatalf("expected no default-workspace viewers, got %v", got)
+	}
+	if got := hub.viewerNames("acme", 1); len(got) != 1 || got[0] != "ann" {
+		t.Fatalf("expected ann viewing in acme, got %v", got)
+	}
+	select {
+	case msg := <-alice.send:
+		t.Fatalf("expected no presence across workspaces, got %+v", msg)
+	default:
+	}
+	if msg := <-ann.send; msg.Type != wsTypePresence || msg.Actor != "ann" {
+		t.Fatalf("expected own presence broadcast, got %+v", msg)
+	}
+}
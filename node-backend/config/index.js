@@ -27,6 +27,9 @@ module.exports = {
   NODE_ENV: process.env.NODE_ENV || 'development',
   GO_REQUEST_TIMEOUT_MS: parsePositiveInt(process.env.GO_REQUEST_TIMEOUT_MS, 5000),
   GO_MAX_RESPONSE_BYTES: parsePositiveInt(process.env.GO_MAX_RESPONSE_BYTES, 1024 * 1024),
+  // Sent to the Go backend as X-API-Key; its key must be delegating so the
+  // X-Actor header is honored.
+  GO_API_KEY: process.env.GO_API_KEY || "",
   SHUTDOWN_TIMEOUT_MS: parsePositiveInt(process.env.SHUTDOWN_TIMEOUT_MS, 10000),
   AUTH_ENABLED: parseBoolean(process.env.AUTH_ENABLED, true),
   AUTH_USERNAME: process.env.AUTH_USERNAME || "admin",
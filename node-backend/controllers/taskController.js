@@ -63,15 +63,17 @@ const createTask = async (req, res) => {
 };
 
 /**
- * Update a task by ID
+ * Update a task by ID. Clients send only the fields they change, so the
+ * update is forwarded to the Go backend as a JSON merge patch.
  */
 const updateTask = async (req, res) => {
   try {
     const actor = req.actor || 'system';
     const response = await makeRequest(`/api/tasks/${req.params.id}`, {
-      method: 'PUT',
+      method: 'PATCH',
       body: req.body,
       headers: {
+        'Content-Type': 'application/merge-patch+json',
         'X-Actor': actor,
       },
     });
@@ -9,6 +9,7 @@ const relevantEnvKeys = [
 	"NODE_ENV",
 	"GO_REQUEST_TIMEOUT_MS",
 	"GO_MAX_RESPONSE_BYTES",
+	"GO_API_KEY",
 	"SHUTDOWN_TIMEOUT_MS",
 	"AUTH_ENABLED",
 	"AUTH_USERNAME",
@@ -61,6 +62,7 @@ test("config uses documented defaults", () => {
 			NODE_ENV: undefined,
 			GO_REQUEST_TIMEOUT_MS: undefined,
 			GO_MAX_RESPONSE_BYTES: undefined,
+			GO_API_KEY: undefined,
 			SHUTDOWN_TIMEOUT_MS: undefined,
 			AUTH_ENABLED: undefined,
 			AUTH_USERNAME: undefined,
@@ -78,6 +80,7 @@ test("config uses documented defaults", () => {
 			assert.equal(config.NODE_ENV, "development");
 			assert.equal(config.GO_REQUEST_TIMEOUT_MS, 5000);
 			assert.equal(config.GO_MAX_RESPONSE_BYTES, 1024 * 1024);
+			assert.equal(config.GO_API_KEY, "");
 			assert.equal(config.SHUTDOWN_TIMEOUT_MS, 10000);
 			assert.equal(config.AUTH_ENABLED, true);
 			assert.equal(config.AUTH_USERNAME, "admin");
@@ -99,6 +102,7 @@ test("config respects environment overrides", () => {
 			NODE_ENV: "production",
 			GO_REQUEST_TIMEOUT_MS: "7000",
 			GO_MAX_RESPONSE_BYTES: "4096",
+			GO_API_KEY: "gateway-key",
 			SHUTDOWN_TIMEOUT_MS: "15000",
 			AUTH_ENABLED: "false",
 			AUTH_USERNAME: "qa-admin",
@@ -116,6 +120,7 @@ test("config respects environment overrides", () => {
 			assert.equal(config.NODE_ENV, "production");
 			assert.equal(config.GO_REQUEST_TIMEOUT_MS, 7000);
 			assert.equal(config.GO_MAX_RESPONSE_BYTES, 4096);
+			assert.equal(config.GO_API_KEY, "gateway-key");
 			assert.equal(config.SHUTDOWN_TIMEOUT_MS, 15000);
 			assert.equal(config.AUTH_ENABLED, false);
 			assert.equal(config.AUTH_USERNAME, "qa-admin");
@@ -8,7 +8,8 @@ const httpClientPath = path.resolve(__dirname, "..", "utils", "httpClient.js");
 const relevantEnvKeys = [
   "GO_BACKEND_URL",
   "GO_REQUEST_TIMEOUT_MS",
-  "GO_MAX_RESPONSE_BYTES"
+  "GO_MAX_RESPONSE_BYTES",
+  "GO_API_KEY"
 ];
 
 function clearModuleCache() {
@@ -231,3 +232,43 @@ test("makeRequest returns raw text for non-JSON success payloads", async () => {
     await closeServer(server);
   }
 });
+
+test("makeRequest forwards the configured Go API key", async () => {
+  const received = [];
+  const server = await startServer((req, res) => {
+    received.push({ apiKey: req.headers["x-api-key"], actor: req.headers["x-actor"] });
+    res.writeHead(200, { "Content-Type": "application/json" });
+    res.end(JSON.stringify({ ok: true }));
+  });
+
+  try {
+    const port = server.address().port;
+    await withEnv(
+      {
+        GO_BACKEND_URL: `http://127.0.0.1:${port}`,
+        GO_API_KEY: "gateway-key"
+      },
+      async () => {
+        const { makeRequest } = require(httpClientPath);
+        await makeRequest("/with-key", { headers: { "X-Actor": "alice" } });
+      }
+    );
+    await withEnv(
+      {
+        GO_BACKEND_URL: `http://127.0.0.1:${port}`,
+        GO_API_KEY: undefined
+      },
+      async () => {
+        const { makeRequest } = require(httpClientPath);
+        await makeRequest("/without-key");
+      }
+    );
+
+    assert.deepEqual(received, [
+      { apiKey: "gateway-key", actor: "alice" },
+      { apiKey: undefined, actor: undefined }
+    ]);
+  } finally {
+    await closeServer(server);
+  }
+});
@@ -532,7 +532,7 @@ test("task updates forward actor identity and history endpoint is proxied", asyn
       return;
     }
 
-    if (req.url === "/api/tasks/1" && req.method === "PUT") {
+    if (req.url === "/api/tasks/1" && req.method === "PATCH") {
       capturedActor = String(req.headers["x-actor"] || "");
       res.writeHead(200, { "Content-Type": "application/json" });
       res.end(
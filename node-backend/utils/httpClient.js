@@ -16,7 +16,8 @@ function createError(message, statusCode, code) {
 }
 
 /**
- * Helper function to make HTTP requests to Go backend
+ * Helper function to make HTTP requests to Go backend, authenticated with
+ * GO_API_KEY when one is configured
  * @param {string} path - API endpoint path
  * @param {object} options - Request options (method, headers, body, timeoutMs, maxResponseBytes, signal)
  * @returns {Promise} - Resolves with response data or rejects with error
@@ -33,6 +34,7 @@ function makeRequest(path, options = {}) {
       method: options.method || 'GET',
       headers: {
         'Content-Type': 'application/json',
+        ...(config.GO_API_KEY ? { 'X-API-Key': config.GO_API_KEY } : {}),
         ...options.headers
       }
     };
@@ -98,7 +100,8 @@ function makeRequest(path, options = {}) {
           let errorMessage = data;
           try {
             const errorData = JSON.parse(data);
-            errorMessage = errorData.error || errorData.message || data;
+            // Go backend errors are RFC 7807 problem details unless ERROR_FORMAT=legacy.
+            errorMessage = errorData.detail || errorData.error || errorData.message || data;
           } catch (e) {
             // Keep original error message if not JSON
           }